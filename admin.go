@@ -0,0 +1,202 @@
+package mockoidc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Admin API endpoints, served when an AdminToken is set so tests written
+// in other languages or running in other containers can manipulate the
+// mock at runtime. Requests authenticate with the AdminToken as a bearer
+// token in the Authorization header.
+const (
+	AdminBase             = "/admin"
+	AdminUsersEndpoint    = "/admin/users"
+	AdminErrorsEndpoint   = "/admin/errors"
+	AdminTimeEndpoint     = "/admin/time"
+	AdminSessionsEndpoint = "/admin/sessions"
+	AdminKeysEndpoint     = "/admin/keys/rotate"
+	AdminRequestsEndpoint = "/admin/requests"
+	AdminTokensEndpoint   = "/admin/tokens"
+	AdminStatsEndpoint    = "/admin/stats"
+	AdminLintEndpoint     = "/admin/lint"
+)
+
+// adminTime is the request & response of the AdminTimeEndpoint
+type adminTime struct {
+	FastForward string    `json:"fast_forward,omitempty"`
+	Offset      string    `json:"offset"`
+	Now         time.Time `json:"now"`
+}
+
+// adminHandler routes the admin API endpoints behind the AdminToken check
+func (m *MockOIDC) adminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(AdminUsersEndpoint, adminMethod(http.MethodPost, m.AdminQueueUser))
+	mux.HandleFunc(AdminErrorsEndpoint, adminMethod(http.MethodPost, m.AdminQueueError))
+	mux.HandleFunc(AdminTimeEndpoint, adminMethod(http.MethodPost, m.AdminFastForward))
+	mux.HandleFunc(AdminSessionsEndpoint, adminMethod(http.MethodGet, m.AdminSessions))
+	mux.HandleFunc(AdminKeysEndpoint, adminMethod(http.MethodPost, m.AdminRotateKeys))
+	mux.HandleFunc(AdminRequestsEndpoint, adminMethod(http.MethodGet, m.AdminRequests))
+	mux.HandleFunc(AdminTokensEndpoint, adminMethod(http.MethodGet, m.AdminTokens))
+	mux.HandleFunc(AdminStatsEndpoint, adminMethod(http.MethodGet, m.AdminStats))
+	mux.HandleFunc(AdminLintEndpoint, adminMethod(http.MethodGet, m.AdminLint))
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		token, err := adminToken(req)
+		if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(m.AdminToken)) != 1 {
+			rw.Header().Set("WWW-Authenticate", bearerChallenge(InvalidToken, "Invalid admin token"))
+			ErrInvalidBearerToken.Describe("Invalid admin token").Write(rw)
+			return
+		}
+		mux.ServeHTTP(rw, req)
+	})
+}
+
+// AdminQueueUser queues the MockUser in the JSON body for the next
+// `authorization_endpoint` call, or the next one of the `client_id` query
+// parameter's client.
+func (m *MockOIDC) AdminQueueUser(rw http.ResponseWriter, req *http.Request) {
+	user := &MockUser{}
+	if !decodeAdminRequest(rw, req, user) {
+		return
+	}
+	if user.Subject == "" {
+		ErrInvalidRequest.Describe("The user Subject is required").Write(rw)
+		return
+	}
+
+	if clientID := req.URL.Query().Get("client_id"); clientID != "" {
+		m.QueueClientUser(clientID, user)
+	} else {
+		m.QueueUser(user)
+	}
+	adminResponse(rw, map[string]int{"queued_users": m.QueuedUsers()})
+}
+
+// AdminQueueError queues the error scenario in the JSON body, declared
+// like the `errors` of a ConfigFile.
+func (m *MockOIDC) AdminQueueError(rw http.ResponseWriter, req *http.Request) {
+	fe := &FileError{}
+	if !decodeAdminRequest(rw, req, fe) {
+		return
+	}
+	if err := fe.queue(m); err != nil {
+		ErrInvalidRequest.Describe(err.Error()).Write(rw)
+		return
+	}
+	adminResponse(rw, map[string]int{"queued_errors": m.QueuedErrors()})
+}
+
+// AdminFastForward moves the MockOIDC's view of time forward by the
+// `fast_forward` duration of the JSON body, e.g. `1h`.
+func (m *MockOIDC) AdminFastForward(rw http.ResponseWriter, req *http.Request) {
+	body := &adminTime{}
+	if !decodeAdminRequest(rw, req, body) {
+		return
+	}
+	d, err := time.ParseDuration(body.FastForward)
+	if err != nil {
+		ErrInvalidRequest.Describe("Invalid fast_forward: %v", err).Write(rw)
+		return
+	}
+
+	offset := m.FastForward(d)
+	adminResponse(rw, &adminTime{Offset: offset.String(), Now: m.Now()})
+}
+
+// AdminSessions lists every Session
+func (m *MockOIDC) AdminSessions(rw http.ResponseWriter, _ *http.Request) {
+	sessions := m.Snapshot().Sessions
+	if sessions == nil {
+		sessions = []PersistedSession{}
+	}
+	resp, err := m.diagnosticsJSON(sessions)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// AdminRotateKeys rotates the Keypair and returns its new `kid`
+func (m *MockOIDC) AdminRotateKeys(rw http.ResponseWriter, _ *http.Request) {
+	kp, err := m.RotateKeypair()
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	kid, err := kp.KeyID()
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	adminResponse(rw, map[string]string{"kid": kid})
+}
+
+// AdminRequests lists the recorded requests
+func (m *MockOIDC) AdminRequests(rw http.ResponseWriter, _ *http.Request) {
+	adminResponse(rw, append([]RecordedRequest{}, m.Requests()...))
+}
+
+// AdminTokens lists the issued tokens, Redacted unless DisableRedaction
+// is set.
+func (m *MockOIDC) AdminTokens(rw http.ResponseWriter, _ *http.Request) {
+	adminResponse(rw, append([]IssuedToken{}, m.redactTokens(m.IssuedTokens())...))
+}
+
+// AdminStats returns the current resource Stats
+func (m *MockOIDC) AdminStats(rw http.ResponseWriter, _ *http.Request) {
+	adminResponse(rw, m.Stats())
+}
+
+// AdminLint lists the SecurityLint findings
+func (m *MockOIDC) AdminLint(rw http.ResponseWriter, _ *http.Request) {
+	adminResponse(rw, append([]LintFinding{}, m.SecurityLint()...))
+}
+
+// adminMethod only lets requests with the method through
+func adminMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			rw.Header().Set("Allow", method)
+			ErrInvalidRequest.Describe("Unsupported method: %s", req.Method).
+				WithStatus(http.StatusMethodNotAllowed).Write(rw)
+			return
+		}
+		handler(rw, req)
+	}
+}
+
+func decodeAdminRequest(rw http.ResponseWriter, req *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(req.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		ErrInvalidRequest.Describe("Invalid JSON body: %v", err).Write(rw)
+		return false
+	}
+	return true
+}
+
+// adminToken reads the AdminToken from the Authorization header only, so it
+// never ends up in access logs or browser history via the query string.
+func adminToken(req *http.Request) (string, error) {
+	parts := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
+	if len(parts) < 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", fmt.Errorf("Invalid authorization header")
+	}
+	return parts[1], nil
+}
+
+func adminResponse(rw http.ResponseWriter, v interface{}) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
@@ -0,0 +1,115 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_AdminAPI(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	// disabled without an AdminToken
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, mockoidc.AdminSessionsEndpoint, nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	m.AdminToken = "admin-secret"
+	handler := m.Handler()
+	admin := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr = admin(http.MethodGet, mockoidc.AdminSessionsEndpoint, "wrong", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Header().Get("WWW-Authenticate"), mockoidc.InvalidToken)
+
+	rr = admin(http.MethodPost, mockoidc.AdminUsersEndpoint, "admin-secret",
+		`{"Subject": "remote-user", "Email": "remote@example.com"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 1, m.QueuedUsers())
+
+	rr = admin(http.MethodPost, mockoidc.AdminUsersEndpoint+"?client_id=other", "admin-secret", `{"Subject": "other-user"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 2, m.QueuedUsers())
+
+	rr = admin(http.MethodPost, mockoidc.AdminErrorsEndpoint, "admin-secret",
+		`{"endpoint": "/oidc/token", "status": 503, "error": "temporarily_unavailable"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 1, m.QueuedErrors())
+
+	rr = admin(http.MethodPost, mockoidc.AdminErrorsEndpoint, "admin-secret", `{"status": 500}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = admin(http.MethodPost, mockoidc.AdminTimeEndpoint, "admin-secret", `{"fast_forward": "1h"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	timeResp := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &timeResp))
+	assert.Equal(t, "1h0m0s", timeResp["offset"])
+
+	_, err = m.SessionStore.NewSession("openid", "secret-nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	rr = admin(http.MethodGet, mockoidc.AdminSessionsEndpoint, "admin-secret", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var sessions []mockoidc.PersistedSession
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sessions))
+	assert.Len(t, sessions, 1)
+	assert.NotContains(t, rr.Body.String(), "secret-nonce")
+	assert.NotContains(t, rr.Body.String(), mockoidc.DefaultUser().Email)
+	assert.Equal(t, mockoidc.Redacted, sessions[0].OIDCNonce)
+
+	// the admin token is only accepted in the Authorization header
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, mockoidc.AdminSessionsEndpoint+"?access_token=admin-secret", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	req := httptest.NewRequest(http.MethodPost, mockoidc.AdminKeysEndpoint, strings.NewReader("access_token=admin-secret"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	oldKid, err := m.Keypair.KeyID()
+	assert.NoError(t, err)
+	rr = admin(http.MethodPost, mockoidc.AdminKeysEndpoint, "admin-secret", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	newKid, err := m.Keypair.KeyID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, oldKid, newKid)
+	assert.Contains(t, rr.Body.String(), newKid)
+
+	rr = admin(http.MethodGet, mockoidc.AdminKeysEndpoint, "admin-secret", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, http.MethodPost, rr.Header().Get("Allow"))
+
+	rr = admin(http.MethodGet, mockoidc.AdminRequestsEndpoint, "admin-secret", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "[]", rr.Body.String())
+
+	rr = admin(http.MethodGet, mockoidc.AdminStatsEndpoint, "admin-secret", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var stats mockoidc.Stats
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.Equal(t, 1, stats.Sessions)
+	assert.Equal(t, 2, stats.QueuedUsers)
+	assert.Equal(t, 1, stats.QueuedErrors)
+	assert.NotZero(t, stats.Goroutines)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet,
+		mockoidc.UserinfoEndpoint+"?access_token=leaked", nil))
+	rr = admin(http.MethodGet, mockoidc.AdminLintEndpoint, "admin-secret", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var findings []mockoidc.LintFinding
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &findings))
+	assert.Len(t, findings, 1)
+	assert.Equal(t, mockoidc.LintSecretInQuery, findings[0].Rule)
+}
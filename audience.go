@@ -0,0 +1,58 @@
+package mockoidc
+
+import "github.com/golang-jwt/jwt"
+
+// idTokenAudience wraps the IDTokenClaims hook to make the `aud` claim an
+// array of the client ID & the IDTokenAudience, with the client ID as the
+// `azp` authorized party.
+func idTokenAudience(audience []string, hook ClaimsHook) ClaimsHook {
+	if len(audience) == 0 {
+		return hook
+	}
+	return func(session *Session, claims jwt.MapClaims) {
+		clientID, _ := claims["aud"].(string)
+		if hook != nil {
+			hook(session, claims)
+		}
+		aud := []string{clientID}
+		for _, a := range audience {
+			if !contains(a, aud) {
+				aud = append(aud, a)
+			}
+		}
+		claims["aud"] = aud
+		claims["azp"] = clientID
+	}
+}
+
+// accessTokenAudience wraps the AccessTokenClaims hook to replace the
+// `aud` claim with the AccessTokenAudience, an array if there are several.
+func accessTokenAudience(audience []string, hook ClaimsHook) ClaimsHook {
+	if len(audience) == 0 {
+		return hook
+	}
+	return func(session *Session, claims jwt.MapClaims) {
+		if hook != nil {
+			hook(session, claims)
+		}
+		if len(audience) == 1 {
+			claims["aud"] = audience[0]
+			return
+		}
+		claims["aud"] = audience
+	}
+}
+
+// verifyAccessTokenAudience checks the `aud` claim of an access token is
+// the client ID or one of the AccessTokenAudience
+func (m *MockOIDC) verifyAccessTokenAudience(claims jwt.MapClaims) bool {
+	if claims.VerifyAudience(m.ClientID, true) {
+		return true
+	}
+	for _, aud := range m.AccessTokenAudience {
+		if claims.VerifyAudience(aud, true) {
+			return true
+		}
+	}
+	return false
+}
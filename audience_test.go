@@ -0,0 +1,46 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_TokenAudience(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(&mockoidc.Config{
+		IDTokenAudience:     []string{"api", m.ClientID},
+		AccessTokenAudience: []string{"https://api.example.com", "https://other.example.com"},
+	})
+
+	tokens := issueTokens(t, m)
+	claims := func(token string) jwt.MapClaims {
+		parsed, err := m.Keypair.VerifyJWT(token)
+		assert.NoError(t, err)
+		return parsed.Claims.(jwt.MapClaims)
+	}
+
+	id := claims(tokens["id_token"].(string))
+	assert.Equal(t, []interface{}{m.ClientID, "api"}, id["aud"])
+	assert.Equal(t, m.ClientID, id["azp"])
+
+	access := claims(tokens["access_token"].(string))
+	assert.Equal(t, []interface{}{"https://api.example.com", "https://other.example.com"}, access["aud"])
+	assert.NotContains(t, access, "azp")
+
+	// the access token is still accepted by the userinfo endpoint
+	req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	rr := httptest.NewRecorder()
+	m.Userinfo(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	m.AccessTokenAudience = []string{"https://api.example.com"}
+	access = claims(issueTokens(t, m)["access_token"].(string))
+	assert.Equal(t, "https://api.example.com", access["aud"])
+}
@@ -0,0 +1,123 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Capabilities is a machine-readable report of the mock behavior a
+// MockOIDC is configured with, so CI logs self-document which behavior a
+// failing test ran against.
+type Capabilities struct {
+	Profile   string            `json:"profile,omitempty"`
+	Issuer    string            `json:"issuer"`
+	Endpoints map[string]string `json:"endpoints"`
+
+	GrantTypes               []string `json:"grant_types"`
+	ResponseTypes            []string `json:"response_types"`
+	ResponseModes            []string `json:"response_modes"`
+	IDTokenSigningAlgs       []string `json:"id_token_signing_algs"`
+	UserinfoSigningAlgs      []string `json:"userinfo_signing_algs"`
+	CodeChallengeMethods     []string `json:"code_challenge_methods"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods"`
+	Scopes                   []string `json:"scopes"`
+
+	// Features are the optional behaviors that are enabled, e.g.
+	// `lenient_claims` or `chaos`.
+	Features []string `json:"features"`
+}
+
+// Capabilities returns the current Capabilities report
+func (m *MockOIDC) Capabilities() *Capabilities {
+	c := &Capabilities{
+		Profile:   m.Profile,
+		Issuer:    m.Issuer(),
+		Endpoints: map[string]string{},
+
+		GrantTypes:               GrantTypesSupported,
+		ResponseTypes:            ResponseTypesSupported,
+		ResponseModes:            ResponseModesSupported,
+		IDTokenSigningAlgs:       IDTokenSigningAlgValuesSupported,
+		UserinfoSigningAlgs:      UserinfoSigningAlgValuesSupported,
+		CodeChallengeMethods:     m.CodeChallengeMethodsSupported,
+		TokenEndpointAuthMethods: TokenEndpointAuthMethodsSupported,
+		Scopes:                   ScopesSupported,
+		Features:                 []string{},
+	}
+
+	endpoints := map[string]string{
+		"authorization_endpoint": m.AuthorizationEndpoint(),
+		"token_endpoint":         m.TokenEndpoint(),
+	}
+	if !m.PlainOAuth2 {
+		endpoints["userinfo_endpoint"] = m.UserinfoEndpoint()
+		endpoints["jwks_uri"] = m.JWKSEndpoint()
+		endpoints["discovery_endpoint"] = m.DiscoveryEndpoint()
+		endpoints["authorization_server_metadata_endpoint"] = m.AuthorizationServerMetadataEndpoint()
+	}
+	if m.IdentityAPIs {
+		endpoints["graph_me_endpoint"] = m.GraphMeEndpoint()
+		endpoints["okta_me_endpoint"] = m.OktaMeEndpoint()
+	}
+	if m.IdentityAPIs || m.PlainOAuth2 {
+		endpoints["github_user_endpoint"] = m.GitHubUserEndpoint()
+	}
+	if m.CredentialIssuer {
+		endpoints["credential_issuer_metadata_endpoint"] = m.CredentialIssuerMetadataEndpoint()
+		endpoints["credential_offer_endpoint"] = m.CredentialOfferEndpoint()
+		endpoints["credential_endpoint"] = m.CredentialEndpoint()
+	}
+	if m.Federation {
+		endpoints["federation_endpoint"] = m.FederationEndpoint()
+	}
+	for name, url := range endpoints {
+		if url != "" {
+			c.Endpoints[name] = url
+		}
+	}
+
+	features := map[string]bool{
+		"require_offline_access": m.RequireOfflineAccess,
+		"lenient_claims":         m.LenientClaims,
+		"skip_code_verifier":     m.SkipCodeVerifier,
+		"max_age_login_required": m.MaxAgeLoginRequired,
+		"interaction_required":   m.InteractionRequired,
+		"request_objects":        m.ClientPublicKey != nil,
+		"interaction":            m.Interaction != nil,
+		"negotiate_content":      m.NegotiateContent,
+		"self_issued":            m.SelfIssued,
+		"credential_issuer":      m.CredentialIssuer,
+		"identity_apis":          m.IdentityAPIs,
+		"plain_oauth2":           m.PlainOAuth2,
+		"federation":             m.Federation,
+		"chaos":                  len(m.Chaos) > 0,
+		"cors":                   m.CORS != nil,
+		"admin_api":              m.AdminToken != "",
+		"tls":                    m.tlsConfig != nil,
+		"dual_stack":             m.httpServer != nil,
+		"http2":                  m.HTTP2,
+		"h2c":                    m.H2C,
+	}
+	for name, enabled := range features {
+		if enabled {
+			c.Features = append(c.Features, name)
+		}
+	}
+	sort.Strings(c.Features)
+
+	return c
+}
+
+// writeCapabilities writes the Capabilities report as a line of JSON to
+// the CapabilityReport writer, if one is set.
+func (m *MockOIDC) writeCapabilities() error {
+	if m.CapabilityReport == nil {
+		return nil
+	}
+	report, err := json.Marshal(m.Capabilities())
+	if err != nil {
+		return err
+	}
+	_, err = m.CapabilityReport.Write(append(report, '\n'))
+	return err
+}
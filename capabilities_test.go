@@ -0,0 +1,39 @@
+package mockoidc_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Capabilities(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(mockoidc.StrictSpec().Merge(mockoidc.SPAFriendly()))
+	m.IdentityAPIs = true
+
+	report := &bytes.Buffer{}
+	m.CapabilityReport = report
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+
+	var capabilities mockoidc.Capabilities
+	assert.NoError(t, json.Unmarshal(report.Bytes(), &capabilities))
+	assert.Equal(t, m.Capabilities(), &capabilities)
+
+	assert.Equal(t, "strict-spec+spa-friendly", capabilities.Profile)
+	assert.Equal(t, m.Issuer(), capabilities.Issuer)
+	assert.Equal(t, m.TokenEndpoint(), capabilities.Endpoints["token_endpoint"])
+	assert.Equal(t, m.GraphMeEndpoint(), capabilities.Endpoints["graph_me_endpoint"])
+	assert.NotContains(t, capabilities.Endpoints, "credential_endpoint")
+	assert.Equal(t, mockoidc.GrantTypesSupported, capabilities.GrantTypes)
+	assert.Equal(t, []string{mockoidc.CodeChallengeMethodS256}, capabilities.CodeChallengeMethods)
+	assert.Equal(t, []string{"identity_apis", "require_offline_access"}, capabilities.Features)
+}
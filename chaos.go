@@ -0,0 +1,138 @@
+package mockoidc
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// AllEndpoints is the Chaos key of the ChaosRule applied to endpoints
+// without their own rule.
+const AllEndpoints = "*"
+
+// ChaosRule injects latency and faults into the responses of an endpoint
+// for resilience testing.
+type ChaosRule struct {
+	// Delay is added to every response. Up to Jitter more is added at
+	// random.
+	Delay  time.Duration
+	Jitter time.Duration
+
+	// ErrorRate is the probability (0 to 1) of responding with ErrorStatus
+	// (503 Service Unavailable by default) instead.
+	ErrorRate   float64
+	ErrorStatus int
+
+	// TruncateRate is the probability (0 to 1) of cutting the response
+	// body short of its Content-Length.
+	TruncateRate float64
+
+	// ResetRate is the probability (0 to 1) of aborting the request: the
+	// connection is closed for HTTP/1.1 and the stream is reset for HTTP/2.
+	ResetRate float64
+
+	// GoAwayRate is the probability (0 to 1) of closing the connection
+	// once the response is written: HTTP/2 clients get a GOAWAY, HTTP/1.1
+	// connections aren't kept alive.
+	GoAwayRate float64
+}
+
+// chaos applies the ChaosRule of the requested endpoint
+func (m *MockOIDC) chaos(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rule, ok := m.chaosRule(req)
+		if !ok {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		delay := rule.Delay
+		if rule.Jitter > 0 {
+			delay += time.Duration(m.chaosInt63n(int64(rule.Jitter)))
+		}
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-req.Context().Done():
+				return
+			}
+		}
+
+		if m.chaosChance(rule.ErrorRate) {
+			status := rule.ErrorStatus
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			ErrInternalServerError.Describe("Injected fault for %s", req.URL.Path).
+				WithStatus(status).Write(rw)
+			return
+		}
+
+		if m.chaosChance(rule.ResetRate) {
+			panic(http.ErrAbortHandler)
+		}
+
+		if m.chaosChance(rule.GoAwayRate) {
+			// The HTTP/2 server answers `Connection: close` with a GOAWAY
+			rw.Header().Set("Connection", "close")
+		}
+
+		if !m.chaosChance(rule.TruncateRate) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		buffer := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buffer, req)
+		for key, values := range buffer.header {
+			rw.Header()[key] = values
+		}
+		body := buffer.body.Bytes()
+		rw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		rw.WriteHeader(buffer.status)
+		// Writing less than the Content-Length makes the server close the
+		// connection, so clients see an unexpected EOF.
+		_, _ = rw.Write(body[:len(body)/2])
+	})
+}
+
+func (m *MockOIDC) chaosRule(req *http.Request) (ChaosRule, bool) {
+	if len(m.Chaos) == 0 || req.URL == nil {
+		return ChaosRule{}, false
+	}
+	if rule, ok := m.Chaos[req.URL.Path]; ok {
+		return rule, true
+	}
+	rule, ok := m.Chaos[AllEndpoints]
+	return rule, ok
+}
+
+func (m *MockOIDC) chaosChance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	m.chaosMu.Lock()
+	defer m.chaosMu.Unlock()
+	return m.chaosRand().Float64() < rate
+}
+
+func (m *MockOIDC) chaosInt63n(n int64) int64 {
+	m.chaosMu.Lock()
+	defer m.chaosMu.Unlock()
+	return m.chaosRand().Int63n(n)
+}
+
+// chaosRand must be called with chaosMu held. Changing the ChaosSeed
+// restarts the random sequence.
+func (m *MockOIDC) chaosRand() *rand.Rand {
+	if m.random == nil || m.randomSeed != m.ChaosSeed {
+		seed := m.ChaosSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		m.random = rand.New(rand.NewSource(seed))
+		m.randomSeed = m.ChaosSeed
+	}
+	return m.random
+}
@@ -0,0 +1,93 @@
+package mockoidc_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Chaos(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	m.Chaos = map[string]mockoidc.ChaosRule{
+		mockoidc.JWKSEndpoint:      {ErrorRate: 1, ErrorStatus: http.StatusBadGateway},
+		mockoidc.DiscoveryEndpoint: {Delay: 50 * time.Millisecond, TruncateRate: 1},
+		mockoidc.AllEndpoints:      {ErrorRate: 1},
+	}
+
+	resp, err := httpClient.Get(m.JWKSEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	resp, err = httpClient.Get(m.UserinfoEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	start := time.Now()
+	resp, err = httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(50*time.Millisecond))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = ioutil.ReadAll(resp.Body)
+	assert.Error(t, err)
+}
+
+func TestMockOIDC_ChaosSeed(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	m.ApplyConfig(&mockoidc.Config{ChaosSeed: 42, ChaosErrorRate: 0.5})
+	assert.Equal(t, int64(42), m.Config().ChaosSeed)
+	assert.Equal(t, 0.5, m.Config().ChaosErrorRate)
+
+	statuses := func() []int {
+		var codes []int
+		for i := 0; i < 20; i++ {
+			resp, err := httpClient.Get(m.JWKSEndpoint())
+			assert.NoError(t, err)
+			resp.Body.Close()
+			codes = append(codes, resp.StatusCode)
+		}
+		return codes
+	}
+
+	first := statuses()
+	assert.Contains(t, first, http.StatusOK)
+	assert.Contains(t, first, http.StatusServiceUnavailable)
+
+	// reseeding replays the same faults
+	m.ChaosSeed = 7
+	statuses()
+	m.ChaosSeed = 42
+	assert.Equal(t, first, statuses())
+}
+
+func TestMockOIDC_ChaosDelayCancelled(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Chaos = map[string]mockoidc.ChaosRule{
+		mockoidc.DiscoveryEndpoint: {Delay: time.Hour},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, mockoidc.DiscoveryEndpoint, nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	start := time.Now()
+	m.Handler().ServeHTTP(rr, req)
+	assert.Less(t, int64(time.Since(start)), int64(time.Minute))
+	assert.Empty(t, rr.Body.String())
+}
@@ -0,0 +1,176 @@
+package mockoidc
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// ClientConfig is the OIDC client configuration of an application under
+// test, as checked by CheckClientConfig.
+type ClientConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	// AuthURL & TokenURL are checked against the mock endpoints if set
+	AuthURL  string
+	TokenURL string
+
+	// AuthMethod is the `token_endpoint_auth_method`, checked against
+	// TokenEndpointAuthMethodsSupported if set.
+	AuthMethod string
+}
+
+// ClientConfigIssue is a ClientConfig field that doesn't work with the mock
+type ClientConfigIssue struct {
+	Field   string
+	Message string
+}
+
+// ClientConfigReport lists every issue CheckClientConfig found
+type ClientConfigReport struct {
+	Issues []ClientConfigIssue
+}
+
+// OK is true when no issues were found
+func (r *ClientConfigReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+func (r *ClientConfigReport) String() string {
+	if r.OK() {
+		return "client config OK"
+	}
+	lines := make([]string, 0, len(r.Issues))
+	for _, issue := range r.Issues {
+		lines = append(lines, fmt.Sprintf("%s: %s", issue.Field, issue.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *ClientConfigReport) add(field, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, ClientConfigIssue{
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// oauth2 AuthStyle values, mirrored to read `oauth2.Config` without
+// depending on it.
+const (
+	authStyleInParams = 1
+	authStyleInHeader = 2
+)
+
+// CheckClientConfig cross-validates an application's client configuration
+// against the mock before any HTTP calls are made. It accepts a
+// ClientConfig or any struct shaped like `oauth2.Config`, i.e. with
+// ClientID, ClientSecret, RedirectURL & Scopes fields and an Endpoint
+// with AuthURL, TokenURL & AuthStyle.
+func (m *MockOIDC) CheckClientConfig(client interface{}) *ClientConfigReport {
+	report := &ClientConfigReport{}
+
+	cc, ok := clientConfigOf(client)
+	if !ok {
+		report.add("config", "unsupported client config type %T", client)
+		return report
+	}
+
+	if cc.Issuer != "" && cc.Issuer != m.Issuer() {
+		if strings.TrimSuffix(cc.Issuer, "/") == m.Issuer() {
+			report.add("Issuer", "%s has a trailing slash the issuer %s doesn't have", cc.Issuer, m.Issuer())
+		} else {
+			report.add("Issuer", "%s is not the issuer %s", cc.Issuer, m.Issuer())
+		}
+	}
+	if cc.ClientID != m.ClientID {
+		report.add("ClientID", "%q is not the registered client ID %q", cc.ClientID, m.ClientID)
+	}
+	if cc.AuthMethod != "none" && cc.ClientSecret != m.ClientSecret {
+		report.add("ClientSecret", "does not match the registered client secret")
+	}
+	if cc.AuthMethod != "" && !contains(cc.AuthMethod, TokenEndpointAuthMethodsSupported) {
+		report.add("AuthMethod", "%s is not one of the supported methods %s",
+			cc.AuthMethod, strings.Join(TokenEndpointAuthMethodsSupported, ", "))
+	}
+
+	if cc.RedirectURL == "" {
+		report.add("RedirectURL", "is required")
+	} else if u, err := url.Parse(cc.RedirectURL); err != nil || !u.IsAbs() {
+		report.add("RedirectURL", "%s is not an absolute URL", cc.RedirectURL)
+	} else if u.Fragment != "" {
+		report.add("RedirectURL", "%s must not have a fragment", cc.RedirectURL)
+	}
+
+	if !contains(openidScope, cc.Scopes) {
+		report.add("Scopes", "missing the %s scope", openidScope)
+	}
+	for _, scope := range cc.Scopes {
+		if !contains(scope, ScopesSupported) {
+			report.add("Scopes", "%s is not a supported scope", scope)
+		}
+	}
+
+	if cc.AuthURL != "" && cc.AuthURL != m.AuthorizationEndpoint() {
+		report.add("AuthURL", "%s is not the authorization endpoint %s", cc.AuthURL, m.AuthorizationEndpoint())
+	}
+	if cc.TokenURL != "" && cc.TokenURL != m.TokenEndpoint() {
+		report.add("TokenURL", "%s is not the token endpoint %s", cc.TokenURL, m.TokenEndpoint())
+	}
+
+	return report
+}
+
+// clientConfigOf reads a ClientConfig or an `oauth2.Config` shaped struct
+func clientConfigOf(client interface{}) (*ClientConfig, bool) {
+	switch cc := client.(type) {
+	case *ClientConfig:
+		return cc, cc != nil
+	case ClientConfig:
+		return &cc, true
+	}
+
+	v := reflect.ValueOf(client)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct || !v.FieldByName("ClientID").IsValid() {
+		return nil, false
+	}
+
+	cc := &ClientConfig{
+		Issuer:       stringField(v, "Issuer"),
+		ClientID:     stringField(v, "ClientID"),
+		ClientSecret: stringField(v, "ClientSecret"),
+		RedirectURL:  stringField(v, "RedirectURL"),
+	}
+	if f := v.FieldByName("Scopes"); f.IsValid() && f.CanInterface() {
+		if scopes, ok := f.Interface().([]string); ok {
+			cc.Scopes = scopes
+		}
+	}
+	if endpoint := v.FieldByName("Endpoint"); endpoint.Kind() == reflect.Struct {
+		cc.AuthURL = stringField(endpoint, "AuthURL")
+		cc.TokenURL = stringField(endpoint, "TokenURL")
+		if style := endpoint.FieldByName("AuthStyle"); style.Kind() == reflect.Int {
+			switch style.Int() {
+			case authStyleInParams:
+				cc.AuthMethod = "client_secret_post"
+			case authStyleInHeader:
+				cc.AuthMethod = "client_secret_basic"
+			}
+		}
+	}
+	return cc, true
+}
+
+func stringField(v reflect.Value, name string) string {
+	if f := v.FieldByName(name); f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
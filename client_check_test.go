@@ -0,0 +1,83 @@
+package mockoidc_test
+
+import (
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+// oauth2Config mirrors the shape of `golang.org/x/oauth2.Config`
+type oauth2Config struct {
+	ClientID     string
+	ClientSecret string
+	Endpoint     struct {
+		AuthURL   string
+		TokenURL  string
+		AuthStyle int
+	}
+	RedirectURL string
+	Scopes      []string
+}
+
+func TestMockOIDC_CheckClientConfig(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	valid := mockoidc.ClientConfig{
+		Issuer:       m.Issuer(),
+		ClientID:     m.ClientID,
+		ClientSecret: m.ClientSecret,
+		RedirectURL:  "http://127.0.0.1/oauth2/callback",
+		Scopes:       []string{"openid", "email"},
+		AuthMethod:   "client_secret_basic",
+	}
+	report := m.CheckClientConfig(valid)
+	assert.True(t, report.OK(), report.String())
+
+	invalid := valid
+	invalid.Issuer = m.Issuer() + "/"
+	invalid.ClientSecret = "wrong"
+	invalid.RedirectURL = "/oauth2/callback"
+	invalid.Scopes = []string{"email", "unknown"}
+	invalid.AuthMethod = "private_key_jwt"
+	report = m.CheckClientConfig(&invalid)
+	assert.False(t, report.OK())
+
+	fields := []string{}
+	for _, issue := range report.Issues {
+		fields = append(fields, issue.Field)
+	}
+	assert.Equal(t, []string{"Issuer", "ClientSecret", "AuthMethod", "RedirectURL", "Scopes", "Scopes"}, fields)
+
+	oauth2 := &oauth2Config{
+		ClientID:     m.ClientID,
+		ClientSecret: m.ClientSecret,
+		RedirectURL:  "http://127.0.0.1/oauth2/callback",
+		Scopes:       []string{"openid"},
+	}
+	oauth2.Endpoint.AuthURL = m.AuthorizationEndpoint()
+	oauth2.Endpoint.TokenURL = m.Issuer() + "/token/"
+	oauth2.Endpoint.AuthStyle = 2
+	report = m.CheckClientConfig(oauth2)
+	assert.Len(t, report.Issues, 1)
+	assert.Equal(t, "TokenURL", report.Issues[0].Field)
+
+	// structs without or with unexported scopes
+	assert.NotPanics(t, func() {
+		report = m.CheckClientConfig(struct{ ClientID, ClientSecret, RedirectURL string }{
+			m.ClientID, m.ClientSecret, "http://127.0.0.1/oauth2/callback",
+		})
+	})
+	assert.Equal(t, "Scopes", report.Issues[len(report.Issues)-1].Field)
+	assert.NotPanics(t, func() {
+		report = m.CheckClientConfig(struct {
+			ClientID string
+			scopes   []string
+		}{ClientID: m.ClientID, scopes: []string{"openid"}})
+	})
+
+	report = m.CheckClientConfig("not a config")
+	assert.False(t, report.OK())
+}
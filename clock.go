@@ -0,0 +1,108 @@
+package mockoidc
+
+import "time"
+
+// Clock is a source of time for a MockOIDC. Fake clocks of libraries like
+// `github.com/jonboulle/clockwork` & `github.com/benbjohnson/clock`
+// satisfy it, so tests can drive token lifetimes from the same clock as
+// the rest of the system under test.
+type Clock interface {
+	Now() time.Time
+}
+
+// SetNow moves the MockOIDC's view of time to t. Unless time is frozen,
+// it keeps running from there.
+func (m *MockOIDC) SetNow(t time.Time) {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+	m.fastForward = t.Sub(m.clock())
+}
+
+// FreezeTime stops the MockOIDC's view of time at its current Now, so
+// tokens issued later get identical timestamps. FastForward & SetNow still
+// move the frozen time. It returns the time it froze at.
+func (m *MockOIDC) FreezeTime() time.Time {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+	if !m.frozen {
+		m.frozen, m.frozenAt = true, m.sourceNow()
+	}
+	return m.frozenAt.Add(m.fastForward)
+}
+
+// UnfreezeTime lets the MockOIDC's view of time run again from where it
+// was frozen.
+func (m *MockOIDC) UnfreezeTime() {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+	if !m.frozen {
+		return
+	}
+	now := m.frozenAt.Add(m.fastForward)
+	m.frozen = false
+	m.fastForward = now.Sub(m.sourceNow())
+}
+
+// QueueTokenSkew skews the clock of the next `token_endpoint` response:
+// its tokens' `iat`, `nbf` & `exp` claims are shifted by the skew. A
+// positive skew issues tokens from the future, a negative skew longer
+// than the TTL issues already expired tokens. Skews are used in the order
+// they were queued.
+func (m *MockOIDC) QueueTokenSkew(skew time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokenSkews = append(m.tokenSkews, skew)
+}
+
+// popTokenSkew returns the next queued token skew, zero if none is queued
+func (m *MockOIDC) popTokenSkew() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.tokenSkews) == 0 {
+		return 0
+	}
+	skew := m.tokenSkews[0]
+	m.tokenSkews = m.tokenSkews[1:]
+	return skew
+}
+
+// QueueAccessTokenTTL overrides the AccessTTL of the access token of the
+// next `token_endpoint` response, while its ID & refresh tokens keep
+// their TTLs. A TTL that isn't positive issues an already expired access
+// token, so automatic refreshes can be tested without sleeping. TTLs are
+// used in the order they were queued.
+func (m *MockOIDC) QueueAccessTokenTTL(ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accessTokenTTLs = append(m.accessTokenTTLs, ttl)
+}
+
+// popAccessTokenTTL returns the next queued access token TTL, false if
+// none is queued
+func (m *MockOIDC) popAccessTokenTTL() (time.Duration, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.accessTokenTTLs) == 0 {
+		return 0, false
+	}
+	ttl := m.accessTokenTTLs[0]
+	m.accessTokenTTLs = m.accessTokenTTLs[1:]
+	return ttl, true
+}
+
+// clock is the time Now is offset from: the source time, or the source
+// time when time was frozen. m.clockMu must be held.
+func (m *MockOIDC) clock() time.Time {
+	if m.frozen {
+		return m.frozenAt
+	}
+	return m.sourceNow()
+}
+
+// sourceNow is the time of the Clock, or NowFunc if none is set
+func (m *MockOIDC) sourceNow() time.Time {
+	if m.Clock != nil {
+		return m.Clock.Now()
+	}
+	return NowFunc()
+}
@@ -0,0 +1,215 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_SetNow(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	target := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.SetNow(target)
+	assert.WithinDuration(t, target, m.Now(), time.Second)
+
+	// time keeps running
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, m.Now().After(target))
+}
+
+func TestMockOIDC_ClockConcurrency(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.FastForward(time.Second)
+			m.FreezeTime()
+			m.SetNow(m.Now().Add(time.Second))
+			m.UnfreezeTime()
+		}()
+		go func() {
+			defer wg.Done()
+			m.Now()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMockOIDC_FreezeTime(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	frozen := m.FreezeTime()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, frozen, m.Now())
+
+	m.FastForward(time.Hour)
+	assert.Equal(t, frozen.Add(time.Hour), m.Now())
+
+	target := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.SetNow(target)
+	assert.True(t, target.Equal(m.Now()))
+
+	m.UnfreezeTime()
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, m.Now().After(target))
+	assert.WithinDuration(t, target, m.Now(), time.Second)
+}
+
+func TestMockOIDC_QueueTokenSkew(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	now := m.FreezeTime()
+
+	m.QueueTokenSkew(5 * time.Minute)
+	m.QueueTokenSkew(-time.Hour)
+
+	future := skewedTokenClaims(t, m)
+	assert.Equal(t, float64(now.Add(5*time.Minute).Unix()), future["iat"])
+	assert.Equal(t, float64(now.Add(5*time.Minute).Unix()), future["nbf"])
+
+	expired := skewedTokenClaims(t, m)
+	assert.Less(t, expired["exp"].(float64), float64(now.Unix()))
+
+	// the queue is drained
+	current := skewedTokenClaims(t, m)
+	assert.Equal(t, float64(now.Unix()), current["iat"])
+}
+
+func TestMockOIDC_QueueAccessTokenTTL(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	now := m.FreezeTime().Truncate(time.Second)
+	m.SetNow(now)
+
+	m.QueueAccessTokenTTL(-time.Minute)
+	tokens := issueTokens(t, m)
+	assert.Equal(t, float64(-60), tokens["expires_in"])
+
+	_, err = m.Keypair.VerifyJWT(tokens["access_token"].(string))
+	assert.Error(t, err)
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(tokens["access_token"].(string), claims)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(now.Add(-time.Minute).Unix()), claims["exp"])
+
+	// the ID & refresh tokens keep their TTLs
+	_, err = m.Keypair.VerifyJWT(tokens["id_token"].(string))
+	assert.NoError(t, err)
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("refresh_token", tokens["refresh_token"].(string))
+	data.Set("grant_type", "refresh_token")
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	refreshed := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &refreshed))
+	assert.Equal(t, m.AccessTTL.Seconds(), refreshed["expires_in"])
+	_, err = m.Keypair.VerifyJWT(refreshed["access_token"].(string))
+	assert.NoError(t, err)
+
+	// a zero TTL issues a token that is expired right away
+	m.QueueAccessTokenTTL(0)
+	tokens = issueTokens(t, m)
+	assert.Equal(t, float64(0), tokens["expires_in"])
+	claims = jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(tokens["access_token"].(string), claims)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(now.Unix()-1), claims["exp"])
+	assert.False(t, claims.VerifyExpiresAt(now.Unix(), true))
+}
+
+func skewedTokenClaims(t *testing.T, m *mockoidc.MockOIDC) jwt.MapClaims {
+	session, err := m.SessionStore.NewSession(
+		"openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+	req := httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint, strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	m.Token(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	tokens := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &tokens))
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(tokens["id_token"].(string), claims)
+	assert.NoError(t, err)
+	return claims
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestMockOIDC_Clock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(&mockoidc.Config{Clock: clock})
+	assert.Equal(t, clock, m.Config().Clock)
+
+	assert.Equal(t, clock.now, m.Now())
+	m.FastForward(time.Minute)
+	assert.Equal(t, clock.now.Add(time.Minute), m.Now())
+	m.FastForward(-time.Minute)
+
+	session, err := m.SessionStore.NewSession(
+		"openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+	req := httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint, strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	m.Token(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	tokens := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &tokens))
+
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(tokens["access_token"].(string), claims)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(clock.now.Unix()), claims["iat"])
+
+	userinfo := func() int {
+		req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+		req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+		rr := httptest.NewRecorder()
+		m.Userinfo(rr, req)
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusOK, userinfo())
+
+	// the fake clock expires the token
+	clock.now = clock.now.Add(m.AccessTTL)
+	assert.Equal(t, http.StatusUnauthorized, userinfo())
+}
@@ -0,0 +1,436 @@
+// Command mockoidc runs a standalone mock OIDC provider, so test suites
+// that aren't written in Go can use it, e.g. from docker-compose:
+//
+//	mockoidc serve --port 8080 --client-id app --client-secret secret
+//
+// Every flag can also be set with a `MOCKOIDC_` environment variable, e.g.
+// `MOCKOIDC_CLIENT_ID` for `--client-id`, and the other variables of
+// mockoidc.ConfigFromEnv apply too. Flags take precedence.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+)
+
+// sqlDriver is the database/sql driver of --state-db, registered by
+// builds with the `sqlite` tag
+var sqlDriver string
+
+const usage = `usage: mockoidc serve [flags]
+
+Runs a mock OIDC provider until interrupted. Run 'mockoidc serve -h' for
+the flags.`
+
+// serveOptions are the `serve` flags
+type serveOptions struct {
+	Host                  string
+	Port                  int
+	Config                string
+	ClientID              string
+	ClientSecret          string
+	UserFile              string
+	SessionFile           string
+	StateDB               string
+	RedisAddr             string
+	RedisPassword         string
+	RedisDB               int
+	RedisTLS              bool
+	MaxSessions           int
+	HistoryLimit          int
+	Preset                string
+	IssuerURL             string
+	IssuerPath            string
+	TrustForwardedHeaders bool
+	AdminToken            string
+	AccessTTL             time.Duration
+	RefreshTTL            time.Duration
+	IDTokenTTL            time.Duration
+	CodeTTL               time.Duration
+	IDTokenAudience       string
+	AccessTokenAudience   string
+	RefreshMaxLifetime    time.Duration
+	RefreshIdleTimeout    time.Duration
+	FastTokens            bool
+	StrictValidation      bool
+	RevokeOnCodeReplay    bool
+	DeterministicSeed     int64
+	LoginPage             bool
+	MFACode               string
+	ConsentPage           bool
+	TLSCert               string
+	TLSKey                string
+	Debug                 bool
+
+	lookupEnv func(string) (string, bool)
+	// explicit are the Config fields of the flags set on the command line
+	explicit []mockoidc.ConfigField
+}
+
+// flagFields are the Config fields of the boolean, numeric & duration
+// flags, which turn settings off when set to false or zero
+var flagFields = map[string]mockoidc.ConfigField{
+	"trust-forwarded-headers": mockoidc.FieldTrustForwardedHeaders,
+	"access-ttl":              mockoidc.FieldAccessTTL,
+	"refresh-ttl":             mockoidc.FieldRefreshTTL,
+	"id-token-ttl":            mockoidc.FieldIDTokenTTL,
+	"code-ttl":                mockoidc.FieldCodeTTL,
+	"refresh-max-lifetime":    mockoidc.FieldRefreshMaxLifetime,
+	"refresh-idle-timeout":    mockoidc.FieldRefreshIdleTimeout,
+	"fast-tokens":             mockoidc.FieldFastTokens,
+	"strict-validation":       mockoidc.FieldStrictValidation,
+	"revoke-on-code-replay":   mockoidc.FieldRevokeOnCodeReplay,
+	"deterministic-seed":      mockoidc.FieldDeterministicSeed,
+	"history-limit":           mockoidc.FieldHistoryLimit,
+}
+
+// stderrLogger logs debug messages to stderr
+type stderrLogger struct {
+	*log.Logger
+}
+
+func (l stderrLogger) Debugf(format string, args ...interface{}) {
+	l.Printf(format, args...)
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "serve" {
+		return errors.New(usage)
+	}
+	opts, err := parseServeFlags(args[1:], os.LookupEnv)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return serve(ctx, opts, stdout)
+}
+
+// parseServeFlags parses the `serve` flags, falling back to their
+// environment variables.
+func parseServeFlags(args []string, lookupEnv func(string) (string, bool)) (*serveOptions, error) {
+	opts := &serveOptions{lookupEnv: lookupEnv}
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&opts.Host, "host", "", "interface to listen on, all by default")
+	fs.IntVar(&opts.Port, "port", 8080, "port to listen on, 0 picks a free one")
+	fs.StringVar(&opts.Config, "config", "", "YAML or JSON config file, overridden by the other flags")
+	fs.StringVar(&opts.ClientID, "client-id", "", "client ID, random by default")
+	fs.StringVar(&opts.ClientSecret, "client-secret", "", "client secret, random by default")
+	fs.StringVar(&opts.UserFile, "user-file", "", "JSON file with an array of users selectable with login_hint")
+	fs.StringVar(&opts.SessionFile, "session-file", "", "JSON file sessions are saved to, so refresh tokens survive restarts")
+	fs.StringVar(&opts.StateDB, "state-db", "", "SQLite database the state is restored from on start and saved to on shutdown, needs a build with -tags sqlite")
+	fs.StringVar(&opts.RedisAddr, "redis-addr", "", "host:port of a Redis server sessions are shared with other replicas in")
+	fs.StringVar(&opts.RedisPassword, "redis-password", "", "password to AUTH with Redis")
+	fs.IntVar(&opts.RedisDB, "redis-db", 0, "Redis database number")
+	fs.BoolVar(&opts.RedisTLS, "redis-tls", false, "connect to Redis with TLS")
+	fs.IntVar(&opts.MaxSessions, "max-sessions", 0, "evict the least recently used sessions beyond this many")
+	fs.IntVar(&opts.HistoryLimit, "history-limit", 0, "keep at most about this many recorded requests, issued tokens & events")
+	fs.StringVar(&opts.Preset, "preset", "", "config preset, e.g. strict-spec, lenient, spa-friendly, mobile-native, keycloak, azure-ad, okta, auth0, google or github")
+	fs.StringVar(&opts.IssuerURL, "issuer-url", "", "advertised issuer, e.g. http://mockoidc:8080/oidc")
+	fs.StringVar(&opts.IssuerPath, "issuer-path", "", "path to serve the issuer at instead of /oidc")
+	fs.BoolVar(&opts.TrustForwardedHeaders, "trust-forwarded-headers", false, "advertise the X-Forwarded-Host & X-Forwarded-Proto of requests")
+	fs.StringVar(&opts.AdminToken, "admin-token", "", "bearer token enabling the /admin API")
+	fs.DurationVar(&opts.AccessTTL, "access-ttl", 0, "access token lifetime, and ID token lifetime unless --id-token-ttl is set")
+	fs.DurationVar(&opts.RefreshTTL, "refresh-ttl", 0, "refresh token lifetime")
+	fs.DurationVar(&opts.IDTokenTTL, "id-token-ttl", 0, "ID token lifetime")
+	fs.DurationVar(&opts.CodeTTL, "code-ttl", 0, "how long authorization codes can be redeemed")
+	fs.StringVar(&opts.IDTokenAudience, "id-token-audience", "", "comma separated ID token audiences besides the client ID, making aud an array")
+	fs.StringVar(&opts.AccessTokenAudience, "access-token-audience", "", "comma separated access token audiences instead of the client ID")
+	fs.DurationVar(&opts.RefreshMaxLifetime, "refresh-max-lifetime", 0, "how long sessions can be refreshed after login")
+	fs.DurationVar(&opts.RefreshIdleTimeout, "refresh-idle-timeout", 0, "how long sessions can be refreshed after their last token")
+	fs.BoolVar(&opts.FastTokens, "fast-tokens", false, "sign tokens with a shared 1024 bit key for load tests")
+	fs.BoolVar(&opts.StrictValidation, "strict-validation", false, "reject duplicate parameters and other spec violations")
+	fs.BoolVar(&opts.RevokeOnCodeReplay, "revoke-on-code-replay", false, "revoke the tokens of authorization codes redeemed twice")
+	fs.Int64Var(&opts.DeterministicSeed, "deterministic-seed", 0, "make token responses reproducible with the seed, for golden-file tests")
+	fs.BoolVar(&opts.LoginPage, "login-page", false, "show a login form checking the passwords of --user-file users")
+	fs.StringVar(&opts.MFACode, "mfa-code", "", "one-time password of a second factor page for requests with the multi-factor acr_values")
+	fs.BoolVar(&opts.ConsentPage, "consent-page", false, "show a page to approve or deny the requested scopes after login")
+	fs.StringVar(&opts.TLSCert, "tls-cert", "", "PEM certificate file to serve HTTPS with")
+	fs.StringVar(&opts.TLSKey, "tls-key", "", "PEM key file of the certificate")
+	fs.BoolVar(&opts.Debug, "debug", false, "log every request & token issued to stderr")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if field, ok := flagFields[f.Name]; ok {
+			opts.explicit = append(opts.explicit, field)
+		}
+	})
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		key := mockoidc.EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := lookupEnv(key); ok {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("invalid %s %q: %w", key, value, setErr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Preset != "" && mockoidc.Presets[opts.Preset] == nil {
+		return nil, fmt.Errorf("unknown preset: %s", opts.Preset)
+	}
+	stores := 0
+	for _, set := range []bool{opts.SessionFile != "", opts.RedisAddr != "", opts.MaxSessions > 0} {
+		if set {
+			stores++
+		}
+	}
+	if stores > 1 {
+		return nil, errors.New("only one of --session-file, --redis-addr and --max-sessions can be set")
+	}
+	if opts.StateDB != "" && sqlDriver == "" {
+		return nil, errors.New("--state-db needs a mockoidc built with -tags sqlite")
+	}
+	if (opts.TLSCert == "") != (opts.TLSKey == "") {
+		return nil, errors.New("--tls-cert and --tls-key must be set together")
+	}
+	return opts, nil
+}
+
+// newServer configures a MockOIDC with the config file & options
+func newServer(opts *serveOptions) (*mockoidc.MockOIDC, error) {
+	var (
+		m   *mockoidc.MockOIDC
+		err error
+	)
+	if opts.Config != "" {
+		m, err = mockoidc.NewServerFromConfigFile(opts.Config)
+	} else {
+		m, err = mockoidc.NewServer(nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// every `MOCKOIDC_` variable applies, the preset one was already
+	// parsed as --preset
+	env, err := mockoidc.ConfigFromLookupEnv(func(key string) (string, bool) {
+		if key == mockoidc.EnvPrefix+"PRESET" || opts.lookupEnv == nil {
+			return "", false
+		}
+		return opts.lookupEnv(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg := &mockoidc.Config{}
+	if opts.Preset != "" {
+		cfg = mockoidc.Presets[opts.Preset]()
+	}
+	m.ApplyConfig(cfg.Merge(env).Merge(&mockoidc.Config{
+		ClientID:              opts.ClientID,
+		ClientSecret:          opts.ClientSecret,
+		IssuerURL:             opts.IssuerURL,
+		TrustForwardedHeaders: opts.TrustForwardedHeaders,
+		AdminToken:            opts.AdminToken,
+		AccessTTL:             opts.AccessTTL,
+		RefreshTTL:            opts.RefreshTTL,
+		IDTokenTTL:            opts.IDTokenTTL,
+		CodeTTL:               opts.CodeTTL,
+		IDTokenAudience:       splitList(opts.IDTokenAudience),
+		AccessTokenAudience:   splitList(opts.AccessTokenAudience),
+		RefreshMaxLifetime:    opts.RefreshMaxLifetime,
+		RefreshIdleTimeout:    opts.RefreshIdleTimeout,
+		FastTokens:            opts.FastTokens,
+		StrictValidation:      opts.StrictValidation,
+		RevokeOnCodeReplay:    opts.RevokeOnCodeReplay,
+		DeterministicSeed:     opts.DeterministicSeed,
+		HistoryLimit:          opts.HistoryLimit,
+		Explicit:              opts.explicit,
+	}))
+	if opts.IssuerPath != "" {
+		m.IssuerPath = opts.IssuerPath
+	}
+	if opts.LoginPage {
+		m.LoginPage = true
+	}
+	if opts.MFACode != "" {
+		m.MFACode = opts.MFACode
+	}
+	if opts.ConsentPage {
+		m.ConsentPage = true
+	}
+	if opts.Debug {
+		m.Logger = mockoidc.DebugfLogger(stderrLogger{log.New(os.Stderr, "", log.LstdFlags)})
+	}
+
+	if opts.UserFile != "" {
+		users, err := readUsers(opts.UserFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if err := m.AddUser(user); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if opts.SessionFile != "" {
+		store, err := mockoidc.NewFileSessionStore(opts.SessionFile, m.UserStore)
+		if err != nil {
+			return nil, err
+		}
+		m.SessionStore = store
+	}
+	if opts.RedisAddr != "" {
+		conn := &mockoidc.RedisConn{
+			Addr:     opts.RedisAddr,
+			Password: opts.RedisPassword,
+			DB:       opts.RedisDB,
+		}
+		if opts.RedisTLS {
+			conn.TLSConfig = &tls.Config{}
+		}
+		if err := conn.Ping(context.Background()); err != nil {
+			return nil, err
+		}
+		m.SessionStore = mockoidc.NewRedisSessionStore(conn, m.UserStore)
+	}
+	if opts.MaxSessions > 0 {
+		m.SessionStore = mockoidc.NewLRUSessionStore(opts.MaxSessions)
+	}
+	if opts.StateDB != "" {
+		db, err := sql.Open(sqlDriver, opts.StateDB)
+		if err != nil {
+			return nil, err
+		}
+		m.Persister = &flagPersister{
+			Persister:    &mockoidc.SQLPersister{DB: db},
+			clientID:     opts.ClientID,
+			clientSecret: opts.ClientSecret,
+		}
+	}
+	return m, nil
+}
+
+// flagPersister restores the client credentials of the previous run
+// unless --client-id & --client-secret are set
+type flagPersister struct {
+	mockoidc.Persister
+	clientID     string
+	clientSecret string
+}
+
+func (p *flagPersister) Load() (*mockoidc.State, error) {
+	state, err := p.Persister.Load()
+	if err != nil || state == nil {
+		return state, err
+	}
+	for i := range state.Clients {
+		if p.clientID != "" {
+			state.Clients[i].ClientID = p.clientID
+		}
+		if p.clientSecret != "" {
+			state.Clients[i].ClientSecret = p.clientSecret
+		}
+	}
+	return state, nil
+}
+
+// readUsers reads a JSON array of MockUsers
+func readUsers(path string) ([]*mockoidc.MockUser, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var users []*mockoidc.MockUser
+	if err := json.Unmarshal(data, &users); err != nil {
+		return nil, fmt.Errorf("invalid user file %s: %w", path, err)
+	}
+	return users, nil
+}
+
+// serve runs the MockOIDC until the context is done
+func serve(ctx context.Context, opts *serveOptions, stdout io.Writer) error {
+	m, err := newServer(opts)
+	if err != nil {
+		return err
+	}
+
+	var cfg *tls.Config
+	if opts.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return err
+		}
+		cfg = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(opts.Host, fmt.Sprint(opts.Port)))
+	if err != nil {
+		return err
+	}
+	// servers listening on every interface advertise localhost rather
+	// than the unspecified address
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && addr.IP.IsUnspecified() && opts.IssuerURL == "" {
+		scheme := "http"
+		if cfg != nil {
+			scheme = "https"
+		}
+		m.BaseURL = fmt.Sprintf("%s://localhost:%d", scheme, addr.Port)
+	}
+	if err := m.Start(ln, cfg); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "issuer: %s\n", m.Issuer())
+	fmt.Fprintf(stdout, "discovery: %s\n", m.DiscoveryEndpoint())
+	fmt.Fprintf(stdout, "client_id: %s\n", m.ClientID)
+	fmt.Fprintf(stdout, "client_secret: %s\n", m.ClientSecret)
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), mockoidc.DefaultShutdownTimeout)
+	defer cancel()
+	return m.ShutdownContext(shutdownCtx)
+}
+
+// splitList splits a comma separated flag, nil if it's empty
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	values := strings.Split(value, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	return values
+}
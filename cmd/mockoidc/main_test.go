@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseServeFlags(t *testing.T) {
+	env := map[string]string{
+		"MOCKOIDC_CLIENT_ID":  "env-client",
+		"MOCKOIDC_PORT":       "9000",
+		"MOCKOIDC_ACCESS_TTL": "1m",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+
+	opts, err := parseServeFlags([]string{"--client-id", "flag-client", "--preset", "lenient"}, lookupEnv)
+	assert.NoError(t, err)
+	assert.Equal(t, "flag-client", opts.ClientID)
+	assert.Equal(t, 9000, opts.Port)
+	assert.Equal(t, time.Minute, opts.AccessTTL)
+	assert.Equal(t, "lenient", opts.Preset)
+
+	env["MOCKOIDC_ACCESS_TTL"] = "soon"
+	_, err = parseServeFlags(nil, lookupEnv)
+	assert.EqualError(t, err, `invalid MOCKOIDC_ACCESS_TTL "soon": parse error`)
+
+	_, err = parseServeFlags([]string{"--preset", "unknown"}, func(string) (string, bool) { return "", false })
+	assert.EqualError(t, err, "unknown preset: unknown")
+
+	_, err = parseServeFlags([]string{"--session-file", "sessions.json", "--redis-addr", "redis:6379"},
+		func(string) (string, bool) { return "", false })
+	assert.EqualError(t, err, "only one of --session-file, --redis-addr and --max-sessions can be set")
+
+	if sqlDriver == "" {
+		_, err = parseServeFlags([]string{"--state-db", "state.db"},
+			func(string) (string, bool) { return "", false })
+		assert.EqualError(t, err, "--state-db needs a mockoidc built with -tags sqlite")
+	}
+}
+
+func TestServe(t *testing.T) {
+	userFile := filepath.Join(t.TempDir(), "users.json")
+	assert.NoError(t, ioutil.WriteFile(userFile,
+		[]byte(`[{"Subject": "qa-user", "Email": "qa@example.com"}]`), 0600))
+	sessionFile := filepath.Join(t.TempDir(), "sessions.json")
+
+	opts, err := parseServeFlags([]string{
+		"--host", "127.0.0.1",
+		"--port", "0",
+		"--client-id", "app",
+		"--client-secret", "secret",
+		"--user-file", userFile,
+		"--session-file", sessionFile,
+	}, func(string) (string, bool) { return "", false })
+	assert.NoError(t, err)
+
+	m, err := newServer(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "app", m.ClientID)
+	assert.Equal(t, "secret", m.ClientSecret)
+	user, err := m.UserStore.GetUserByEmail("qa@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "qa-user", user.ID())
+	assert.IsType(t, &mockoidc.FileSessionStore{}, m.SessionStore)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stdout, w := io.Pipe()
+	done := make(chan error)
+	go func() { done <- serve(ctx, opts, w) }()
+
+	var discovery string
+	lines := bufio.NewScanner(stdout)
+	for discovery == "" && lines.Scan() {
+		if strings.HasPrefix(lines.Text(), "discovery: ") {
+			discovery = strings.TrimPrefix(lines.Text(), "discovery: ")
+		}
+	}
+	go io.Copy(ioutil.Discard, stdout)
+
+	resp, err := http.Get(discovery)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestNewServer_Env(t *testing.T) {
+	env := map[string]string{
+		"MOCKOIDC_LENIENT_CLAIMS": "true",
+		"MOCKOIDC_ACCESS_TTL":     "1m",
+		"MOCKOIDC_REFRESH_TTL":    "1h",
+	}
+	lookupEnv := func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	opts, err := parseServeFlags([]string{"--access-ttl", "2m"}, lookupEnv)
+	assert.NoError(t, err)
+
+	m, err := newServer(opts)
+	assert.NoError(t, err)
+	cfg := m.Config()
+	assert.True(t, cfg.LenientClaims)
+	assert.Equal(t, time.Hour, cfg.RefreshTTL)
+	// flags take precedence
+	assert.Equal(t, 2*time.Minute, cfg.AccessTTL)
+
+	opts, err = parseServeFlags([]string{"--fast-tokens=false"}, func(key string) (string, bool) {
+		if key == "MOCKOIDC_FAST_TOKENS" {
+			return "true", true
+		}
+		return "", false
+	})
+	assert.NoError(t, err)
+	m, err = newServer(opts)
+	assert.NoError(t, err)
+	assert.False(t, m.FastTokens)
+}
+
+func TestFlagPersister(t *testing.T) {
+	file := &mockoidc.FilePersister{Path: filepath.Join(t.TempDir(), "state.json")}
+	assert.NoError(t, file.Save(&mockoidc.State{
+		Clients: []mockoidc.PersistedClient{{ClientID: "saved", ClientSecret: "saved-secret"}},
+	}))
+
+	state, err := (&flagPersister{Persister: file}).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "saved", state.Clients[0].ClientID)
+
+	state, err = (&flagPersister{Persister: file, clientID: "flag"}).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "flag", state.Clients[0].ClientID)
+	assert.Equal(t, "saved-secret", state.Clients[0].ClientSecret)
+}
@@ -0,0 +1,14 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+// The SQLite driver of --state-db is pure Go, so the binary stays static.
+// It's only compiled in with the tag:
+//
+//	go build -tags sqlite ./cmd/mockoidc
+import _ "modernc.org/sqlite"
+
+func init() {
+	sqlDriver = "sqlite"
+}
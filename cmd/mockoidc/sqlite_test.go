@@ -0,0 +1,41 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLiteStateDB(t *testing.T) {
+	db, err := sql.Open(sqlDriver, filepath.Join(t.TempDir(), "state.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	persister := &mockoidc.SQLPersister{DB: db}
+
+	state, err := persister.Load()
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	user := &mockoidc.MockUser{Subject: "persisted", Email: "persisted@example.com"}
+	assert.NoError(t, m.AddUser(user))
+	_, err = m.SessionStore.NewSession("openid email", "nonce", user, "", "")
+	assert.NoError(t, err)
+
+	saved := m.Snapshot()
+	assert.NoError(t, persister.Save(saved))
+	assert.NoError(t, persister.Save(saved))
+
+	loaded, err := persister.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, saved.Sessions, loaded.Sessions)
+	assert.Equal(t, saved.Clients, loaded.Clients)
+	assert.Equal(t, saved.Users, loaded.Users)
+}
@@ -0,0 +1,149 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func redeemCode(t *testing.T, m *mockoidc.MockOIDC, code string) (int, map[string]interface{}) {
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", code)
+	data.Set("grant_type", "authorization_code")
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	tokenResp := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &tokenResp))
+	return rr.Code, tokenResp
+}
+
+func TestMockOIDC_CodeReplay(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	events := m.Events()
+
+	session, err := m.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	code, tokenResp := redeemCode(t, m, session.SessionID)
+	assert.Equal(t, http.StatusOK, code)
+	<-events
+
+	code, errResp := redeemCode(t, m, session.SessionID)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, mockoidc.InvalidGrant, errResp["error"])
+	assert.Equal(t, "Code already redeemed: "+session.SessionID, errResp["error_description"])
+	event := <-events
+	assert.Equal(t, mockoidc.CodeReplayed, event.Type)
+	assert.Equal(t, session.SessionID, event.SessionID)
+
+	// tokens of the first redemption stay valid by default
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+tokenResp["access_token"].(string))
+	m.Userinfo(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestMockOIDC_CodeReplay_Revoke(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.RevokeOnCodeReplay = true
+
+	session, err := m.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	// concurrent redemptions of a code only succeed once
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded []map[string]interface{}
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, tokenResp := redeemCode(t, m, session.SessionID)
+			if code == http.StatusOK {
+				mu.Lock()
+				succeeded = append(succeeded, tokenResp)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, succeeded, 1)
+	assert.True(t, session.Revoked)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+succeeded[0]["access_token"].(string))
+	m.Userinfo(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "The token is revoked")
+}
+
+func TestMockOIDC_CodeReplay_FailedPKCE(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.RevokeOnCodeReplay = true
+	events := m.Events()
+
+	challenge, err := mockoidc.GenerateCodeChallenge(mockoidc.CodeChallengeMethodS256, "verifier")
+	assert.NoError(t, err)
+	session, err := m.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(),
+		challenge, mockoidc.CodeChallengeMethodS256)
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+	data.Set("code_verifier", "wrong")
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// a failed attempt doesn't use up the code
+	data.Set("code_verifier", "verifier")
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, session.Revoked)
+	assert.Equal(t, mockoidc.TokenIssued, (<-events).Type)
+}
+
+func TestMockOIDC_CodeTTL(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(&mockoidc.Config{CodeTTL: time.Minute})
+	assert.Equal(t, time.Minute, m.Config().CodeTTL)
+
+	authorize := func() string {
+		rr := httptest.NewRecorder()
+		m.Authorize(rr, httptest.NewRequest(http.MethodGet,
+			mockoidc.AuthorizationEndpoint+"?"+authorizeData(m).Encode(), nil))
+		assert.Equal(t, http.StatusFound, rr.Code)
+		location, err := url.Parse(rr.Header().Get("Location"))
+		assert.NoError(t, err)
+		return location.Query().Get("code")
+	}
+
+	code := authorize()
+	m.FastForward(59 * time.Second)
+	status, _ := redeemCode(t, m, code)
+	assert.Equal(t, http.StatusOK, status)
+
+	code = authorize()
+	m.FastForward(time.Minute)
+	status, errResp := redeemCode(t, m, code)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, mockoidc.InvalidGrant, errResp["error"])
+	assert.Equal(t, "Code expired: "+code, errResp["error_description"])
+}
@@ -0,0 +1,261 @@
+package mockoidc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is a MockOIDC setup declared in a YAML or JSON file, so
+// mock IdP setups can be version-controlled without writing Go.
+type ConfigFile struct {
+	// Preset is the name of a Config preset the settings are layered on,
+	// e.g. `strict-spec`.
+	Preset string `yaml:"preset"`
+
+	ClientID     string        `yaml:"client_id"`
+	ClientSecret string        `yaml:"client_secret"`
+	IssuerURL    string        `yaml:"issuer_url"`
+	IssuerPath   string        `yaml:"issuer_path"`
+	AccessTTL    time.Duration `yaml:"access_ttl"`
+	RefreshTTL   time.Duration `yaml:"refresh_ttl"`
+	IDTokenTTL   time.Duration `yaml:"id_token_ttl"`
+	CodeTTL      time.Duration `yaml:"code_ttl"`
+	AdminToken   string        `yaml:"admin_token"`
+	HistoryLimit int           `yaml:"history_limit"`
+
+	RefreshMaxLifetime time.Duration `yaml:"refresh_max_lifetime"`
+	RefreshIdleTimeout time.Duration `yaml:"refresh_idle_timeout"`
+
+	IDTokenAudience     []string `yaml:"id_token_audience"`
+	AccessTokenAudience []string `yaml:"access_token_audience"`
+
+	// DiscoveryOverrides replaces, adds or removes discovery fields
+	DiscoveryOverrides map[string]interface{} `yaml:"discovery_overrides"`
+
+	// SigningAlg is the token signing algorithm. Tokens are signed with
+	// RS256, so other algorithms are rejected.
+	SigningAlg string `yaml:"signing_alg"`
+
+	// Clients configures clients by client ID
+	Clients map[string]FileClient `yaml:"clients"`
+
+	// Users are added to the UserStore. QueueUsers are the subjects of
+	// Users to queue for `authorization_endpoint` calls, in order.
+	Users      []FileUser `yaml:"users"`
+	QueueUsers []string   `yaml:"queue_users"`
+
+	// Errors are queued error scenarios
+	Errors []FileError `yaml:"errors"`
+}
+
+// FileClient is the per-client configuration of a ConfigFile
+type FileClient struct {
+	UserinfoSignedResponseAlg string `yaml:"userinfo_signed_response_alg"`
+
+	// QueueUsers are the subjects of Users to queue for the client
+	QueueUsers []string `yaml:"queue_users"`
+}
+
+// FileUser is a MockUser declared in a ConfigFile
+type FileUser struct {
+	Subject             string   `yaml:"subject"`
+	Email               string   `yaml:"email"`
+	EmailVerified       bool     `yaml:"email_verified"`
+	PreferredUsername   string   `yaml:"preferred_username"`
+	Name                string   `yaml:"name"`
+	GivenName           string   `yaml:"given_name"`
+	FamilyName          string   `yaml:"family_name"`
+	Picture             string   `yaml:"picture"`
+	Locale              string   `yaml:"locale"`
+	Phone               string   `yaml:"phone"`
+	PhoneNumberVerified bool     `yaml:"phone_number_verified"`
+	Address             string   `yaml:"address"`
+	Groups              []string `yaml:"groups"`
+	Roles               []string `yaml:"roles"`
+	Password            string   `yaml:"password"`
+}
+
+// FileError is an error scenario of a ConfigFile or the admin API.
+// Errors with an Endpoint are queued with QueueEndpointError, with a
+// ClientID with QueueClientError and otherwise with QueueError.
+type FileError struct {
+	Endpoint    string `yaml:"endpoint" json:"endpoint"`
+	ClientID    string `yaml:"client_id" json:"client_id"`
+	Status      int    `yaml:"status" json:"status"`
+	Error       string `yaml:"error" json:"error"`
+	Description string `yaml:"description" json:"description"`
+
+	// Count is how many calls fail, 1 by default
+	Count int `yaml:"count" json:"count"`
+}
+
+// queue queues the error scenario on the MockOIDC
+func (fe *FileError) queue(m *MockOIDC) error {
+	if fe.Status == 0 || fe.Error == "" {
+		return fmt.Errorf("%w: errors need a status & error", ErrInvalidConfig)
+	}
+	count := fe.Count
+	if count == 0 {
+		count = 1
+	}
+	if fe.Endpoint != "" {
+		m.QueueEndpointError(fe.Endpoint, fe.Status, fe.Error, count)
+		return nil
+	}
+	for i := 0; i < count; i++ {
+		se := &ServerError{Code: fe.Status, Error: fe.Error, Description: fe.Description}
+		if fe.ClientID != "" {
+			m.QueueClientError(fe.ClientID, se)
+		} else {
+			m.QueueError(se)
+		}
+	}
+	return nil
+}
+
+// NewServerFromConfigFile configures a new MockOIDC that isn't started
+// from a YAML or JSON ConfigFile.
+func NewServerFromConfigFile(path string) (*MockOIDC, error) {
+	file, err := ReadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := NewServer(nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Apply(m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// ReadConfigFile reads a YAML or JSON ConfigFile. Unknown settings are
+// rejected, so typos don't go unnoticed.
+func ReadConfigFile(path string) (*ConfigFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &ConfigFile{}
+	// JSON is valid YAML
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	return file, nil
+}
+
+// Apply configures the MockOIDC with the ConfigFile
+func (f *ConfigFile) Apply(m *MockOIDC) error {
+	cfg := &Config{}
+	if f.Preset != "" {
+		preset, ok := Presets[f.Preset]
+		if !ok {
+			return fmt.Errorf("%w: unknown preset %s", ErrInvalidConfig, f.Preset)
+		}
+		cfg = preset()
+	}
+	if f.SigningAlg != "" && f.SigningAlg != jwt.SigningMethodRS256.Alg() {
+		return fmt.Errorf("%w: unsupported signing_alg %s", ErrInvalidConfig, f.SigningAlg)
+	}
+	m.ApplyConfig(cfg.Merge(&Config{
+		ClientID:     f.ClientID,
+		ClientSecret: f.ClientSecret,
+		IssuerURL:    f.IssuerURL,
+		AccessTTL:    f.AccessTTL,
+		RefreshTTL:   f.RefreshTTL,
+		IDTokenTTL:   f.IDTokenTTL,
+		CodeTTL:      f.CodeTTL,
+		AdminToken:   f.AdminToken,
+		HistoryLimit: f.HistoryLimit,
+
+		RefreshMaxLifetime: f.RefreshMaxLifetime,
+		RefreshIdleTimeout: f.RefreshIdleTimeout,
+
+		IDTokenAudience:     f.IDTokenAudience,
+		AccessTokenAudience: f.AccessTokenAudience,
+
+		DiscoveryOverrides: f.DiscoveryOverrides,
+	}))
+	if f.IssuerPath != "" {
+		m.IssuerPath = f.IssuerPath
+	}
+
+	users := make(map[string]*MockUser, len(f.Users))
+	for _, fu := range f.Users {
+		user := fu.mockUser()
+		if err := m.AddUser(user); err != nil {
+			return err
+		}
+		users[user.Subject] = user
+	}
+	lookup := func(subject string) (*MockUser, error) {
+		user, ok := users[subject]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown user %s", ErrInvalidConfig, subject)
+		}
+		return user, nil
+	}
+
+	for _, subject := range f.QueueUsers {
+		user, err := lookup(subject)
+		if err != nil {
+			return err
+		}
+		m.QueueUser(user)
+	}
+
+	for clientID, client := range f.Clients {
+		if alg := client.UserinfoSignedResponseAlg; alg != "" {
+			if !contains(alg, UserinfoSigningAlgValuesSupported) {
+				return fmt.Errorf("%w: unsupported userinfo_signed_response_alg %s", ErrInvalidConfig, alg)
+			}
+			if m.UserinfoSignedResponseAlg == nil {
+				m.UserinfoSignedResponseAlg = make(map[string]string)
+			}
+			m.UserinfoSignedResponseAlg[clientID] = alg
+		}
+		for _, subject := range client.QueueUsers {
+			user, err := lookup(subject)
+			if err != nil {
+				return err
+			}
+			m.QueueClientUser(clientID, user)
+		}
+	}
+
+	for i := range f.Errors {
+		if err := f.Errors[i].queue(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fu FileUser) mockUser() *MockUser {
+	return &MockUser{
+		Subject:             fu.Subject,
+		Email:               fu.Email,
+		EmailVerified:       fu.EmailVerified,
+		PreferredUsername:   fu.PreferredUsername,
+		Name:                fu.Name,
+		GivenName:           fu.GivenName,
+		FamilyName:          fu.FamilyName,
+		Picture:             fu.Picture,
+		Locale:              fu.Locale,
+		Phone:               fu.Phone,
+		PhoneNumberVerified: fu.PhoneNumberVerified,
+		Address:             fu.Address,
+		Groups:              fu.Groups,
+		Roles:               fu.Roles,
+		Password:            fu.Password,
+	}
+}
@@ -0,0 +1,111 @@
+package mockoidc_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+const yamlConfig = `
+preset: strict-spec
+client_id: qa-app
+client_secret: qa-secret
+access_ttl: 2m
+signing_alg: RS256
+
+users:
+  - subject: alice
+    email: alice@example.com
+    email_verified: true
+    groups: [admins]
+  - subject: bob
+    email: bob@example.com
+queue_users: [bob]
+
+clients:
+  other-app:
+    userinfo_signed_response_alg: RS256
+    queue_users: [alice]
+
+errors:
+  - endpoint: /oidc/token
+    status: 500
+    error: server_error
+  - status: 400
+    error: invalid_request
+    count: 2
+`
+
+func TestNewServerFromConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mockoidc.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(yamlConfig), 0600))
+
+	m, err := mockoidc.NewServerFromConfigFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "qa-app", m.ClientID)
+	assert.Equal(t, "qa-secret", m.ClientSecret)
+	assert.Equal(t, "strict-spec", m.Profile)
+	assert.Equal(t, 2*time.Minute, m.AccessTTL)
+	assert.True(t, m.RequireOfflineAccess)
+	assert.Equal(t, "RS256", m.UserinfoSignedResponseAlg["other-app"])
+	assert.Equal(t, 2, m.QueuedUsers())
+	assert.Equal(t, 3, m.QueuedErrors())
+
+	alice, err := m.UserStore.GetUserByEmail("alice@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"admins"}, alice.(*mockoidc.MockUser).Groups)
+
+	// JSON is YAML too
+	path = filepath.Join(dir, "mockoidc.json")
+	assert.NoError(t, ioutil.WriteFile(path,
+		[]byte(`{"client_id": "json-app", "refresh_ttl": "1h", "issuer_path": "/realms/qa"}`), 0600))
+	m, err = mockoidc.NewServerFromConfigFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "json-app", m.ClientID)
+	assert.Equal(t, time.Hour, m.RefreshTTL)
+	assert.Equal(t, "/realms/qa", m.IssuerPath)
+
+	for name, config := range map[string]string{
+		"typo":           `client_idd: app`,
+		"preset":         `preset: unknown`,
+		"signing alg":    `signing_alg: HS256`,
+		"unknown user":   `queue_users: [carol]`,
+		"incomplete err": `errors: [{status: 500}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "invalid.yaml")
+			assert.NoError(t, ioutil.WriteFile(path, []byte(config), 0600))
+			_, err := mockoidc.NewServerFromConfigFile(path)
+			assert.True(t, errors.Is(err, mockoidc.ErrInvalidConfig), err)
+		})
+	}
+}
+
+func TestNewServerFromConfigFile_SigningAlg(t *testing.T) {
+	// algorithms tokens aren't signed with are rejected, even if advertised
+	supported := mockoidc.IDTokenSigningAlgValuesSupported
+	defer func() { mockoidc.IDTokenSigningAlgValuesSupported = supported }()
+	mockoidc.IDTokenSigningAlgValuesSupported = append([]string{"ES256"}, supported...)
+
+	path := filepath.Join(t.TempDir(), "mockoidc.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`signing_alg: ES256`), 0600))
+	_, err := mockoidc.NewServerFromConfigFile(path)
+	assert.True(t, errors.Is(err, mockoidc.ErrInvalidConfig), err)
+}
+
+func TestNewServerFromConfigFile_Errors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mockoidc.yaml")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(yamlConfig), 0600))
+
+	m, err := mockoidc.NewServerFromConfigFile(path)
+	assert.NoError(t, err)
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Handler().ServeHTTP, http.MethodPost, nil)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
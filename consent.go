@@ -0,0 +1,75 @@
+package mockoidc
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const consentPage = "consent"
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Consent</title></head>
+<body>
+<h1>{{ .ClientID }} requests access</h1>
+<form method="post" action="{{ .Action }}">
+<input type="hidden" name="interaction" value="{{ .Interaction }}"/>
+{{- range .Scopes }}
+<label><input type="checkbox" id="scope-{{ . }}" name="scope" value="{{ . }}" checked/> {{ . }}</label>
+{{- end }}
+<button type="submit" id="approve" name="consent" value="approve">Approve</button>
+<button type="submit" id="deny" name="consent" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// showConsent renders the consent page asking the User to approve the
+// requested scopes. `prompt=none` requests fail with `consent_required`
+// instead.
+func (m *MockOIDC) showConsent(rw http.ResponseWriter, req *http.Request, a *authorization) {
+	if contains(PromptNone, strings.Fields(req.Form.Get("prompt"))) {
+		authorizeError(rw, req, ConsentRequired, "The user must consent to the request")
+		return
+	}
+
+	id, err := m.pend(req, a, consentPage)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	var scopes []string
+	for _, scope := range strings.Fields(req.Form.Get("scope")) {
+		if scope != openidScope {
+			scopes = append(scopes, scope)
+		}
+	}
+	htmlResponse(rw, consentTemplate, struct {
+		ClientID    string
+		Action      string
+		Interaction string
+		Scopes      []string
+	}{req.Form.Get("client_id"), pageAction(req), id, scopes})
+}
+
+// submitConsent applies the consent page decision: denials fail with
+// `access_denied`, approvals narrow the scope to the approved ones. The
+// `openid` scope is always granted.
+func (m *MockOIDC) submitConsent(rw http.ResponseWriter, req *http.Request, a *authorization, page url.Values) bool {
+	if page.Get("consent") != "approve" {
+		authorizeError(rw, req, AccessDenied, "The user denied consent")
+		return false
+	}
+
+	var granted []string
+	for _, scope := range strings.Fields(req.Form.Get("scope")) {
+		if scope == openidScope || contains(scope, page["scope"]) {
+			granted = append(granted, scope)
+		}
+	}
+	req.Form.Set("scope", strings.Join(granted, " "))
+	a.consented = true
+	return true
+}
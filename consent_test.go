@@ -0,0 +1,94 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+var interactionPattern = regexp.MustCompile(`name="interaction" value="([^"]+)"`)
+
+// showPage GETs the `authorization_endpoint` and returns the interaction
+// ID of the page it rendered
+func showPage(t *testing.T, m *mockoidc.MockOIDC, data url.Values) (*httptest.ResponseRecorder, string) {
+	req := httptest.NewRequest(http.MethodGet, mockoidc.AuthorizationEndpoint+"?"+data.Encode(), nil)
+	rr := httptest.NewRecorder()
+	m.Authorize(rr, req)
+
+	match := interactionPattern.FindStringSubmatch(rr.Body.String())
+	if match == nil {
+		return rr, ""
+	}
+	return rr, match[1]
+}
+
+// submitPage POSTs an interactive page's form
+func submitPage(t *testing.T, m *mockoidc.MockOIDC, interaction string, form url.Values) *url.URL {
+	form.Set("interaction", interaction)
+	req := httptest.NewRequest(http.MethodPost, mockoidc.AuthorizationEndpoint, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	m.Authorize(rr, req)
+	if !assert.Equal(t, http.StatusFound, rr.Code, rr.Body.String()) {
+		return &url.URL{}
+	}
+
+	location, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	return location
+}
+
+func TestMockOIDC_ConsentPage(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ConsentPage = true
+
+	data := authorizeData(m)
+	data.Set("scope", "openid email profile")
+	rr, interaction := showPage(t, m, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rr.Body.String(), `value="email"`)
+	assert.NotContains(t, rr.Body.String(), `value="openid"`)
+	assert.NotEmpty(t, interaction)
+
+	// partial consent narrows the scopes
+	location := submitPage(t, m, interaction, url.Values{
+		"consent": {"approve"},
+		"scope":   {"email"},
+	})
+	assert.Equal(t, "testState", location.Query().Get("state"))
+	session, err := m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email"}, session.Scopes)
+
+	// interactions can't be replayed
+	form := url.Values{"interaction": {interaction}, "consent": {"approve"}}
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, form)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// pending interactions expire with sessions
+	_, interaction = showPage(t, m, data)
+	m.FastForward(m.RefreshTTL)
+	form.Set("interaction", interaction)
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, form)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	_, interaction = showPage(t, m, data)
+	location = submitPage(t, m, interaction, url.Values{"consent": {"deny"}})
+	assert.Equal(t, mockoidc.AccessDenied, location.Query().Get("error"))
+	assert.Equal(t, "testState", location.Query().Get("state"))
+
+	data.Set("prompt", "none")
+	rr, _ = showPage(t, m, data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.ConsentRequired, location.Query().Get("error"))
+}
@@ -0,0 +1,81 @@
+package mockoidc
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSEndpoints are the endpoints browser-based RPs call directly, which
+// CORS applies to.
+var CORSEndpoints = []string{
+	DiscoveryEndpoint,
+	TokenEndpoint,
+	UserinfoEndpoint,
+	JWKSEndpoint,
+}
+
+// CORS allows SPAs running in a real browser to call the CORSEndpoints.
+type CORS struct {
+	// AllowedOrigins are the origins allowed to make requests, e.g.
+	// `http://localhost:3000`. `*` allows any origin.
+	AllowedOrigins []string
+
+	// AllowedHeaders are the request headers preflight requests allow.
+	// They default to `Authorization` & `Content-Type`.
+	AllowedHeaders []string
+
+	// AllowCredentials allows requests with cookies & HTTP auth
+	AllowCredentials bool
+
+	// MaxAge is how long browsers cache preflight responses
+	MaxAge time.Duration
+}
+
+// allowsOrigin is true if the origin is one of the AllowedOrigins
+func (c *CORS) allowsOrigin(origin string) bool {
+	return contains("*", c.AllowedOrigins) || contains(origin, c.AllowedOrigins)
+}
+
+func (c *CORS) allowedHeaders() string {
+	if len(c.AllowedHeaders) == 0 {
+		return "Authorization, Content-Type"
+	}
+	return strings.Join(c.AllowedHeaders, ", ")
+}
+
+// cors sets the CORS headers of requests to the CORSEndpoints from allowed
+// origins, and answers their preflight requests.
+func (m *MockOIDC) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if m.CORS == nil || origin == "" || !contains(req.URL.Path, CORSEndpoints) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		rw.Header().Add("Vary", "Origin")
+		if !m.CORS.allowsOrigin(origin) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+		rw.Header().Set("Access-Control-Allow-Origin", origin)
+		if m.CORS.AllowCredentials {
+			rw.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if req.Method != http.MethodOptions || req.Header.Get("Access-Control-Request-Method") == "" {
+			rw.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate, Retry-After")
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		rw.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		rw.Header().Set("Access-Control-Allow-Headers", m.CORS.allowedHeaders())
+		if m.CORS.MaxAge > 0 {
+			rw.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(m.CORS.MaxAge.Seconds())))
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	})
+}
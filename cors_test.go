@@ -0,0 +1,61 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_CORS(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.CORS = &mockoidc.CORS{
+		AllowedOrigins: []string{"http://localhost:3000"},
+		MaxAge:         time.Hour,
+	}
+	handler := m.Handler()
+
+	serve := func(method, path, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// preflight requests are answered
+	rr := serve(http.MethodOptions, mockoidc.TokenEndpoint, "http://localhost:3000")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "http://localhost:3000", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, Content-Type", rr.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "3600", rr.Header().Get("Access-Control-Max-Age"))
+	assert.Empty(t, m.RequestsTo(mockoidc.TokenEndpoint))
+
+	// actual requests get the allowed origin
+	rr = serve(http.MethodGet, mockoidc.JWKSEndpoint, "http://localhost:3000")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "http://localhost:3000", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", rr.Header().Get("Vary"))
+
+	// other origins & endpoints aren't allowed
+	rr = serve(http.MethodGet, mockoidc.JWKSEndpoint, "http://evil.test")
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+	rr = serve(http.MethodGet, mockoidc.AuthorizationEndpoint, "http://localhost:3000")
+	assert.Empty(t, rr.Header().Get("Access-Control-Allow-Origin"))
+
+	m.CORS.AllowedOrigins = []string{"*"}
+	m.CORS.AllowCredentials = true
+	rr = serve(http.MethodGet, mockoidc.UserinfoEndpoint, "http://app.test")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "http://app.test", rr.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rr.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, rr.Header().Get("Access-Control-Expose-Headers"), "WWW-Authenticate")
+}
@@ -0,0 +1,254 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// Experimental OpenID for Verifiable Credential Issuance (OID4VCI)
+// endpoints, served when CredentialIssuer is enabled.
+const (
+	CredentialIssuerMetadataEndpoint = "/oidc/.well-known/openid-credential-issuer"
+	CredentialOfferEndpoint          = "/oidc/credential_offer"
+	CredentialEndpoint               = "/oidc/credential"
+
+	InvalidCredentialRequest  = "invalid_credential_request"
+	UnsupportedCredentialType = "unsupported_credential_type"
+	InvalidProof              = "invalid_proof"
+
+	// UserCredential is the only credential configuration issued: a
+	// `jwt_vc_json` credential of the User's Userinfo claims.
+	UserCredential        = "UserCredential"
+	CredentialFormatJWTVC = "jwt_vc_json"
+
+	proofTypeJWT         = "jwt"
+	proofJWTType         = "openid4vci-proof+jwt"
+	verifiableCredential = "VerifiableCredential"
+	credentialsContext   = "https://www.w3.org/2018/credentials/v1"
+)
+
+// proofIATSkew is how far the `iat` of a key proof may be from now, so
+// proofs can't be replayed indefinitely
+const proofIATSkew = 5 * time.Minute
+
+type credentialIssuerMetadata struct {
+	CredentialIssuer                  string                                     `json:"credential_issuer"`
+	AuthorizationServers              []string                                   `json:"authorization_servers"`
+	CredentialEndpoint                string                                     `json:"credential_endpoint"`
+	CredentialConfigurationsSupported map[string]credentialConfigurationMetadata `json:"credential_configurations_supported"`
+}
+
+type credentialConfigurationMetadata struct {
+	Format                               string               `json:"format"`
+	CryptographicBindingMethodsSupported []string             `json:"cryptographic_binding_methods_supported"`
+	CredentialSigningAlgValuesSupported  []string             `json:"credential_signing_alg_values_supported"`
+	CredentialDefinition                 credentialDefinition `json:"credential_definition"`
+}
+
+type credentialDefinition struct {
+	Type []string `json:"type"`
+}
+
+type credentialOffer struct {
+	CredentialIssuer           string                     `json:"credential_issuer"`
+	CredentialConfigurationIDs []string                   `json:"credential_configuration_ids"`
+	Grants                     map[string]json.RawMessage `json:"grants"`
+}
+
+type credentialRequest struct {
+	Format                    string                `json:"format"`
+	CredentialConfigurationID string                `json:"credential_configuration_id"`
+	CredentialDefinition      *credentialDefinition `json:"credential_definition"`
+	Proof                     *credentialProof      `json:"proof"`
+}
+
+type credentialProof struct {
+	ProofType string `json:"proof_type"`
+	JWT       string `json:"jwt"`
+}
+
+type credentialResponse struct {
+	Credential string `json:"credential"`
+	Format     string `json:"format"`
+}
+
+// CredentialIssuerMetadata renders the OID4VCI Credential Issuer Metadata
+func (m *MockOIDC) CredentialIssuerMetadata(rw http.ResponseWriter, _ *http.Request) {
+	resp, err := json.Marshal(&credentialIssuerMetadata{
+		CredentialIssuer:     m.Issuer(),
+		AuthorizationServers: []string{m.Issuer()},
+		CredentialEndpoint:   m.CredentialEndpoint(),
+		CredentialConfigurationsSupported: map[string]credentialConfigurationMetadata{
+			UserCredential: {
+				Format:                               CredentialFormatJWTVC,
+				CryptographicBindingMethodsSupported: []string{"jwk"},
+				CredentialSigningAlgValuesSupported:  IDTokenSigningAlgValuesSupported,
+				CredentialDefinition: credentialDefinition{
+					Type: []string{verifiableCredential, UserCredential},
+				},
+			},
+		},
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// CredentialOffer renders a Credential Offer for the UserCredential that
+// wallets obtain with the authorization code flow.
+func (m *MockOIDC) CredentialOffer(rw http.ResponseWriter, _ *http.Request) {
+	resp, err := json.Marshal(&credentialOffer{
+		CredentialIssuer:           m.Issuer(),
+		CredentialConfigurationIDs: []string{UserCredential},
+		Grants: map[string]json.RawMessage{
+			"authorization_code": json.RawMessage(`{}`),
+		},
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// Credential issues a UserCredential JWT VC for the User associated with
+// the passed Access Token. If the request has a `jwt` proof, the
+// credential is bound to the proof's key with a `cnf` claim.
+func (m *MockOIDC) Credential(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", "POST")
+		ErrInvalidRequest.Describe("Unsupported method: %s", req.Method).
+			WithStatus(http.StatusMethodNotAllowed).Write(rw)
+		return
+	}
+
+	session, authorized := m.authorizeBearer(rw, req)
+	if !authorized {
+		return
+	}
+
+	var cr credentialRequest
+	if err := json.NewDecoder(req.Body).Decode(&cr); err != nil {
+		ErrInvalidCredentialRequest.Describe("Invalid credential request: %v", err).Write(rw)
+		return
+	}
+	if !cr.requestsUserCredential() {
+		ErrUnsupportedCredentialType.Describe("Only the UserCredential is supported").Write(rw)
+		return
+	}
+
+	claims, err := m.userCredentialClaims(session)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	if cr.Proof != nil {
+		jwk, err := m.verifyCredentialProof(cr.Proof)
+		if err != nil {
+			ErrInvalidProof.Describe(err.Error()).Write(rw)
+			return
+		}
+		claims["cnf"] = map[string]interface{}{"jwk": jwk}
+	}
+
+	credential, err := m.Keypair.SignJWT(claims)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	resp, err := json.Marshal(&credentialResponse{
+		Credential: credential,
+		Format:     CredentialFormatJWTVC,
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+func (cr *credentialRequest) requestsUserCredential() bool {
+	if cr.CredentialConfigurationID != "" {
+		return cr.CredentialConfigurationID == UserCredential
+	}
+	if cr.Format != CredentialFormatJWTVC || cr.CredentialDefinition == nil {
+		return false
+	}
+	return contains(UserCredential, cr.CredentialDefinition.Type)
+}
+
+// userCredentialClaims builds the JWT VC claims with the Session's
+// Userinfo as the credential subject.
+func (m *MockOIDC) userCredentialClaims(session *Session) (jwt.MapClaims, error) {
+	userinfo, err := session.User.Userinfo(session.ClaimScopes(m.Config()))
+	if err != nil {
+		return nil, err
+	}
+	subject := map[string]interface{}{}
+	if err := json.Unmarshal(userinfo, &subject); err != nil {
+		return nil, err
+	}
+	delete(subject, "sub")
+	subject["id"] = session.User.ID()
+
+	now := m.Now()
+	return jwt.MapClaims{
+		"iss": m.Issuer(),
+		"sub": session.User.ID(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": expiresAt(now, m.AccessTTL),
+		"jti": session.SessionID,
+		"vc": map[string]interface{}{
+			"@context":          []string{credentialsContext},
+			"type":              []string{verifiableCredential, UserCredential},
+			"credentialSubject": subject,
+		},
+	}, nil
+}
+
+// verifyCredentialProof checks a `jwt` key proof is signed by the key in
+// its `jwk` header for our issuer, recently, and returns that key.
+func (m *MockOIDC) verifyCredentialProof(proof *credentialProof) (*jose.JSONWebKey, error) {
+	if proof.ProofType != proofTypeJWT {
+		return nil, fmt.Errorf("Unsupported proof type: %s", proof.ProofType)
+	}
+	signed, err := jose.ParseSigned(proof.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proof: %v", err)
+	}
+	header := signed.Signatures[0].Header
+	if typ, _ := header.ExtraHeaders[jose.HeaderType].(string); typ != proofJWTType {
+		return nil, fmt.Errorf("Invalid proof type header: %s", typ)
+	}
+	if header.JSONWebKey == nil || !header.JSONWebKey.IsPublic() {
+		return nil, fmt.Errorf("Proof is missing a public jwk header")
+	}
+
+	payload, err := signed.Verify(header.JSONWebKey)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid proof signature: %v", err)
+	}
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("Invalid proof claims: %v", err)
+	}
+	if !claims.VerifyAudience(m.Issuer(), true) {
+		return nil, fmt.Errorf("Proof audience must be the credential issuer")
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("Proof is missing iat")
+	}
+	if skew := m.Now().Sub(time.Unix(int64(iat), 0)); skew > proofIATSkew || skew < -proofIATSkew {
+		return nil, fmt.Errorf("Proof iat is more than %s off", proofIATSkew)
+	}
+	return header.JSONWebKey, nil
+}
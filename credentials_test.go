@@ -0,0 +1,122 @@
+package mockoidc_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestMockOIDC_CredentialIssuer(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.CredentialIssuer = true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	err = m.Start(ln, nil)
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	getJSONBody := func(endpoint string) map[string]interface{} {
+		resp, err := httpClient.Get(endpoint)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body := make(map[string]interface{})
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body
+	}
+
+	metadata := getJSONBody(m.CredentialIssuerMetadataEndpoint())
+	assert.Equal(t, m.Issuer(), metadata["credential_issuer"])
+	assert.Equal(t, m.CredentialEndpoint(), metadata["credential_endpoint"])
+	assert.Contains(t, metadata["credential_configurations_supported"], mockoidc.UserCredential)
+
+	offer := getJSONBody(m.CredentialOfferEndpoint())
+	assert.Equal(t, []interface{}{mockoidc.UserCredential}, offer["credential_configuration_ids"])
+
+	session, err := m.SessionStore.NewSession(
+		"openid email", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	accessToken, err := session.AccessToken(m.Config(), m.Keypair, m.Now())
+	assert.NoError(t, err)
+
+	holderKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: holderKey},
+		(&jose.SignerOptions{EmbedJWK: true}).WithType("openid4vci-proof+jwt"))
+	assert.NoError(t, err)
+	signProof := func(iat time.Time) string {
+		proofPayload, _ := json.Marshal(map[string]interface{}{"aud": m.Issuer(), "iat": iat.Unix()})
+		proof, err := signer.Sign(proofPayload)
+		assert.NoError(t, err)
+		proofJWT, err := proof.CompactSerialize()
+		assert.NoError(t, err)
+		return proofJWT
+	}
+	proofJWT := signProof(m.Now())
+
+	credential := func(request map[string]interface{}) *http.Response {
+		body, _ := json.Marshal(request)
+		req, err := http.NewRequest(http.MethodPost, m.CredentialEndpoint(), bytes.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := httpClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := credential(map[string]interface{}{
+		"credential_configuration_id": mockoidc.UserCredential,
+		"proof":                       map[string]string{"proof_type": "jwt", "jwt": proofJWT},
+	})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	credentialResp := make(map[string]string)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&credentialResp))
+	token, err := m.Keypair.VerifyJWT(credentialResp["credential"])
+	assert.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, session.User.ID(), claims["sub"])
+	vc := claims["vc"].(map[string]interface{})
+	subject := vc["credentialSubject"].(map[string]interface{})
+	assert.Equal(t, mockoidc.DefaultUser().Email, subject["email"])
+	cnf := claims["cnf"].(map[string]interface{})
+	assert.Equal(t, "EC", cnf["jwk"].(map[string]interface{})["kty"])
+
+	// unsupported credentials
+	resp = credential(map[string]interface{}{"credential_configuration_id": "Other"})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// invalid proofs
+	resp = credential(map[string]interface{}{
+		"credential_configuration_id": mockoidc.UserCredential,
+		"proof":                       map[string]string{"proof_type": "jwt", "jwt": accessToken},
+	})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// stale proofs
+	resp = credential(map[string]interface{}{
+		"credential_configuration_id": mockoidc.UserCredential,
+		"proof":                       map[string]string{"proof_type": "jwt", "jwt": signProof(m.Now().Add(-time.Hour))},
+	})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&credentialResp))
+	assert.Equal(t, mockoidc.InvalidProof, credentialResp["error"])
+}
@@ -0,0 +1,90 @@
+package mockoidc
+
+import (
+	"encoding/base64"
+	"math/rand"
+	"time"
+)
+
+// DeterministicTime is the time the clock of a Deterministic MockOIDC is
+// frozen at
+var DeterministicTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Deterministic makes token responses byte-for-byte reproducible across
+// runs, for golden-file tests of RP parsing. The client credentials,
+// session IDs & opaque tokens come from a random sequence seeded with the
+// seed, the clock is frozen at DeterministicTime and tokens are signed
+// with the DefaultKeypair, so their `kid` is fixed too. FastTokens is
+// turned off.
+func (m *MockOIDC) Deterministic(seed int64) error {
+	kp, err := DefaultKeypair()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.deterministicSeed = seed
+	m.deterministicRand = rand.New(rand.NewSource(seed))
+	m.Keypair = kp
+	m.retiredKeypairs = nil
+	m.mu.Unlock()
+
+	m.FastTokens = false
+	m.installCodeGenerator()
+	if m.ClientID, err = m.nonce(24); err != nil {
+		return err
+	}
+	if m.ClientSecret, err = m.nonce(24); err != nil {
+		return err
+	}
+
+	m.FreezeTime()
+	m.SetNow(DeterministicTime)
+	return nil
+}
+
+// installCodeGenerator makes the CodeQueues of the SessionStore & the
+// ScopedMocks generate codes from the seeded sequence once Deterministic.
+// Logins call it too, so SessionStores assigned after Deterministic, e.g.
+// by the CLI, are seeded as well. Generators set by the caller are kept.
+func (m *MockOIDC) installCodeGenerator() {
+	m.mu.Lock()
+	if m.deterministicRand == nil {
+		m.mu.Unlock()
+		return
+	}
+	queues := make([]*CodeQueue, 0, len(m.scopes)+1)
+	for _, scope := range m.scopes {
+		queues = append(queues, scope.CodeQueue)
+	}
+	m.mu.Unlock()
+
+	if codes := m.codeQueue(); codes != nil {
+		queues = append(queues, codes)
+	}
+	for _, codes := range queues {
+		codes.Lock()
+		if codes.Generate == nil {
+			codes.Generate = m.seededCode
+		}
+		codes.Unlock()
+	}
+}
+
+// seededCode is a code from the seeded sequence
+func (m *MockOIDC) seededCode() (string, error) {
+	return m.nonce(24)
+}
+
+// nonce is a random nonce, from the seeded sequence once Deterministic
+func (m *MockOIDC) nonce(length int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.deterministicRand == nil {
+		return randomNonce(length)
+	}
+	b := make([]byte, length)
+	m.deterministicRand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
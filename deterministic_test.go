@@ -0,0 +1,102 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+// deterministicLogin runs a code flow and returns the token response body.
+// The setup funcs run after the Config is applied.
+func deterministicLogin(t *testing.T, cfg *mockoidc.Config, setup ...func(*mockoidc.MockOIDC)) string {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(cfg)
+	for _, fn := range setup {
+		fn(m)
+	}
+
+	params := url.Values{
+		"scope":         {"openid email profile"},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://rp.example.com/callback"},
+		"state":         {"state"},
+		"nonce":         {"nonce"},
+		"client_id":     {m.ClientID},
+	}
+	rr := httptest.NewRecorder()
+	m.Authorize(rr, httptest.NewRequest(http.MethodGet,
+		mockoidc.AuthorizationEndpoint+"?"+params.Encode(), nil))
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, url.Values{
+		"client_id":     {m.ClientID},
+		"client_secret": {m.ClientSecret},
+		"code":          {location.Query().Get("code")},
+		"grant_type":    {"authorization_code"},
+	})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	return rr.Body.String()
+}
+
+func TestMockOIDC_Deterministic(t *testing.T) {
+	golden := deterministicLogin(t, &mockoidc.Config{DeterministicSeed: 42})
+	assert.Equal(t, golden, deterministicLogin(t, &mockoidc.Config{DeterministicSeed: 42}))
+	assert.NotEqual(t, golden, deterministicLogin(t, &mockoidc.Config{DeterministicSeed: 7}))
+
+	withClient := deterministicLogin(t, &mockoidc.Config{DeterministicSeed: 42, ClientID: "golden-client"})
+	assert.NotEqual(t, golden, withClient)
+	assert.Equal(t, withClient, deterministicLogin(t, &mockoidc.Config{DeterministicSeed: 42, ClientID: "golden-client"}))
+}
+
+func TestMockOIDC_DeterministicSettings(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	kp, err := mockoidc.RandomKeypair(1024)
+	assert.NoError(t, err)
+	m.Keypair = kp
+	m.FastTokens = true
+
+	assert.NoError(t, m.Deterministic(42))
+	assert.True(t, mockoidc.DeterministicTime.Equal(m.Now()))
+	assert.Equal(t, int64(42), m.Config().DeterministicSeed)
+	assert.False(t, m.FastTokens)
+
+	defaultKeypair, err := mockoidc.DefaultKeypair()
+	assert.NoError(t, err)
+	assert.Equal(t, defaultKeypair.PrivateKey, m.Keypair.PrivateKey)
+
+	first, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Deterministic(42))
+	again, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, first.SessionID, again.SessionID)
+	assert.False(t, strings.ContainsAny(first.SessionID, "+/="))
+}
+
+func TestMockOIDC_Deterministic_ReplacedStore(t *testing.T) {
+	lru := func(m *mockoidc.MockOIDC) {
+		m.SessionStore = mockoidc.NewLRUSessionStore(10)
+	}
+	golden := deterministicLogin(t, &mockoidc.Config{DeterministicSeed: 42}, lru)
+	assert.Equal(t, golden, deterministicLogin(t, &mockoidc.Config{DeterministicSeed: 42}, lru))
+
+	scopedCode := func() string {
+		m, err := mockoidc.NewServer(nil)
+		assert.NoError(t, err)
+		scope := m.Scope("tenant")
+		assert.NoError(t, m.Deterministic(42))
+		code, err := scope.CodeQueue.Pop()
+		assert.NoError(t, err)
+		return code
+	}
+	assert.Equal(t, scopedCode(), scopedCode())
+}
@@ -0,0 +1,152 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// diagnosticsRedactedFields are masked in diagnostics bundles on top of
+// the RedactedFields: Config secrets, Session nonces & PKCE challenges and
+// User profiles, as MockUser fields & as token claims.
+var diagnosticsRedactedFields = []string{
+	"ClientSecret",
+	"AdminToken",
+	"OIDCNonce",
+	"nonce",
+	"CodeChallenge",
+	"code_challenge",
+	"Phone",
+	"Name",
+	"GivenName",
+	"given_name",
+	"FamilyName",
+	"family_name",
+	"PreferredUsername",
+	"preferred_username",
+	"Picture",
+}
+
+// TimelineEntry is a moment of server activity in a diagnostics bundle
+type TimelineEntry struct {
+	Time    time.Time
+	Kind    string
+	Summary string
+}
+
+// DumpDiagnostics writes a forensic bundle of the server to a directory,
+// e.g. when an assertion fails, to debug intermittent integration test
+// failures: its config & capabilities, a State snapshot, the captured
+// requests, the issued tokens, the security lint findings, resource stats
+// and a timeline of all server activity. Tokens, secrets, nonces & PII
+// are Redacted unless DisableRedaction is set.
+func (m *MockOIDC) DumpDiagnostics(path string) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	state := m.Snapshot()
+	requests, tokens := state.Requests, state.IssuedTokens
+	state.Requests, state.IssuedTokens = nil, nil
+	tokens = m.redactTokens(tokens)
+	config := m.Config()
+	config.AdminToken = ""
+
+	files := map[string]interface{}{
+		"config.json":       config,
+		"capabilities.json": m.Capabilities(),
+		"state.json":        state,
+		"requests.json":     requests,
+		"tokens.json":       tokens,
+		"lint.json":         m.SecurityLint(),
+		"stats.json":        m.Stats(),
+		"timeline.json":     m.timeline(requests, tokens),
+	}
+	for name, content := range files {
+		data, err := m.diagnosticsJSON(content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(path, name), data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diagnosticsJSON encodes a diagnostics file, with the RedactedFields &
+// diagnosticsRedactedFields masked unless DisableRedaction is set.
+func (m *MockOIDC) diagnosticsJSON(content interface{}) ([]byte, error) {
+	if m.DisableRedaction {
+		return json.MarshalIndent(content, "", "  ")
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	fields := append(append([]string(nil), RedactedFields...), diagnosticsRedactedFields...)
+	return json.MarshalIndent(redactJSONValue(doc, fields), "", "  ")
+}
+
+// timeline merges every recorded activity in chronological order
+func (m *MockOIDC) timeline(requests []RecordedRequest, tokens []IssuedToken) []TimelineEntry {
+	var entries []TimelineEntry
+	for _, req := range requests {
+		entries = append(entries, TimelineEntry{
+			Time:    req.Time,
+			Kind:    "request",
+			Summary: fmt.Sprintf("%s %s", req.Method, req.Path),
+		})
+	}
+	for _, token := range tokens {
+		entries = append(entries, TimelineEntry{
+			Time:    token.IssuedAt,
+			Kind:    "token",
+			Summary: fmt.Sprintf("%s issued for session %s (%s)", token.Type, token.SessionID, token.GrantType),
+		})
+	}
+	for _, finding := range m.SecurityLint() {
+		entries = append(entries, TimelineEntry{
+			Time:    finding.Time,
+			Kind:    "lint",
+			Summary: fmt.Sprintf("%s: %s", finding.Rule, finding.Message),
+		})
+	}
+
+	m.mu.Lock()
+	for _, event := range m.eventLog {
+		entries = append(entries, TimelineEntry{
+			Time:    event.Time,
+			Kind:    "event",
+			Summary: fmt.Sprintf("%s session %s", event.Type, event.SessionID),
+		})
+	}
+	m.mu.Unlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries
+}
+
+// redactTokens returns a copy of the tokens with their Token Redacted,
+// unless DisableRedaction is set.
+func (m *MockOIDC) redactTokens(tokens []IssuedToken) []IssuedToken {
+	if m.DisableRedaction {
+		return tokens
+	}
+	redacted := make([]IssuedToken, len(tokens))
+	for i, token := range tokens {
+		token.Token = Redacted
+		redacted[i] = token
+	}
+	return redacted
+}
@@ -0,0 +1,117 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_DumpDiagnostics(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	m.QueueCode("diagnostics-code")
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "http://127.0.0.1/callback")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+	data.Set("nonce", "diagnostics-nonce")
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + data.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	tokenData := url.Values{}
+	tokenData.Set("client_id", m.ClientID)
+	tokenData.Set("client_secret", m.ClientSecret)
+	tokenData.Set("grant_type", "authorization_code")
+	tokenData.Set("code", "diagnostics-code")
+	resp, err = httpClient.PostForm(m.TokenEndpoint(), tokenData)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	m.AdminToken = "admin-secret"
+	dir := filepath.Join(t.TempDir(), "bundle")
+	assert.NoError(t, m.DumpDiagnostics(dir))
+
+	read := func(name string, v interface{}) {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(data, v))
+	}
+
+	var config mockoidc.Config
+	read("config.json", &config)
+	assert.Equal(t, m.ClientID, config.ClientID)
+	assert.Empty(t, config.AdminToken)
+	assert.Equal(t, mockoidc.Redacted, config.ClientSecret)
+
+	var state mockoidc.State
+	read("state.json", &state)
+	assert.Len(t, state.Sessions, 1)
+	assert.Empty(t, state.Requests)
+	assert.Equal(t, mockoidc.Redacted, state.Sessions[0].OIDCNonce)
+	if assert.NotNil(t, state.Sessions[0].MockUser) {
+		assert.Equal(t, mockoidc.Redacted, state.Sessions[0].MockUser.Email)
+		assert.Equal(t, mockoidc.Redacted, state.Sessions[0].MockUser.PreferredUsername)
+	}
+
+	var requests []mockoidc.RecordedRequest
+	read("requests.json", &requests)
+	assert.Len(t, requests, 2)
+
+	var tokens []mockoidc.IssuedToken
+	read("tokens.json", &tokens)
+	assert.NotEmpty(t, tokens)
+	for _, token := range tokens {
+		assert.Equal(t, mockoidc.Redacted, token.Token)
+		if token.Claims["nonce"] != nil {
+			assert.Equal(t, mockoidc.Redacted, token.Claims["nonce"])
+		}
+		if token.Claims["email"] != nil {
+			assert.Equal(t, mockoidc.Redacted, token.Claims["email"])
+		}
+	}
+
+	var timeline []mockoidc.TimelineEntry
+	read("timeline.json", &timeline)
+	kinds := map[string]bool{}
+	for i, entry := range timeline {
+		kinds[entry.Kind] = true
+		if i > 0 {
+			assert.False(t, entry.Time.Before(timeline[i-1].Time))
+		}
+	}
+	assert.Equal(t, map[string]bool{"request": true, "token": true, "lint": true, "event": true}, kinds)
+
+	for _, name := range []string{"capabilities.json", "lint.json", "stats.json"} {
+		assert.FileExists(t, filepath.Join(dir, name))
+	}
+}
+
+func TestMockOIDC_DumpDiagnostics_DisableRedaction(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.DisableRedaction = true
+	m.AdminToken = "admin-secret"
+
+	dir := filepath.Join(t.TempDir(), "bundle")
+	assert.NoError(t, m.DumpDiagnostics(dir))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	assert.NoError(t, err)
+	var config mockoidc.Config
+	assert.NoError(t, json.Unmarshal(data, &config))
+	assert.Equal(t, m.ClientSecret, config.ClientSecret)
+	assert.Empty(t, config.AdminToken)
+}
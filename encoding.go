@@ -0,0 +1,52 @@
+package mockoidc
+
+import "net/http"
+
+// utf8BOM is the UTF-8 byte order mark
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// encodeResponses applies JSONContentType & JSONBOM to JSON responses
+func (m *MockOIDC) encodeResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if m.JSONContentType == "" && !m.JSONBOM {
+			next.ServeHTTP(rw, req)
+			return
+		}
+		next.ServeHTTP(&encodedResponse{ResponseWriter: rw, m: m}, req)
+	})
+}
+
+type encodedResponse struct {
+	http.ResponseWriter
+	m           *MockOIDC
+	wroteHeader bool
+	bom         bool
+}
+
+func (e *encodedResponse) WriteHeader(status int) {
+	if e.wroteHeader {
+		return
+	}
+	e.wroteHeader = true
+
+	if e.Header().Get("Content-Type") == applicationJSON {
+		if e.m.JSONContentType != "" {
+			e.Header().Set("Content-Type", e.m.JSONContentType)
+		}
+		e.bom = e.m.JSONBOM
+	}
+	e.ResponseWriter.WriteHeader(status)
+}
+
+func (e *encodedResponse) Write(data []byte) (int, error) {
+	if !e.wroteHeader {
+		e.WriteHeader(http.StatusOK)
+	}
+	if e.bom {
+		e.bom = false
+		if _, err := e.ResponseWriter.Write(utf8BOM); err != nil {
+			return 0, err
+		}
+	}
+	return e.ResponseWriter.Write(data)
+}
@@ -0,0 +1,45 @@
+package mockoidc_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_JSONEncoding(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	get := func(endpoint string) (*http.Response, []byte) {
+		resp, err := httpClient.Get(endpoint)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp, body
+	}
+
+	// bare by default
+	resp, body := get(m.DiscoveryEndpoint())
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, byte('{'), body[0])
+
+	m.JSONContentType = "application/json;charset=UTF-8"
+	m.JSONBOM = true
+
+	bom := []byte{0xEF, 0xBB, 0xBF}
+	resp, body = get(m.DiscoveryEndpoint())
+	assert.Equal(t, "application/json;charset=UTF-8", resp.Header.Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(body, bom))
+
+	// error responses too
+	resp, body = get(m.UserinfoEndpoint())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "application/json;charset=UTF-8", resp.Header.Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(body, bom))
+}
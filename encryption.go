@@ -8,8 +8,8 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 	"gopkg.in/square/go-jose.v2"
@@ -120,19 +120,13 @@ func (k *Keypair) KeyID() (string, error) {
 
 // JWKS is the JSON JWKS representation of the rsa.PublicKey
 func (k *Keypair) JWKS() ([]byte, error) {
-	kid, err := k.KeyID()
+	jwk, err := k.JWK()
 	if err != nil {
 		return nil, err
 	}
 
-	jwk := jose.JSONWebKey{
-		Use:       "sig",
-		Algorithm: string(jose.RS256),
-		Key:       k.PublicKey,
-		KeyID:     kid,
-	}
 	jwks := &jose.JSONWebKeySet{
-		Keys: []jose.JSONWebKey{jwk},
+		Keys: []jose.JSONWebKey{*jwk},
 	}
 
 	return json.Marshal(jwks)
@@ -151,9 +145,28 @@ func (k *Keypair) SignJWT(claims jwt.Claims) (string, error) {
 	return token.SignedString(k.PrivateKey)
 }
 
-// VerifyJWT verifies the signature of a token was signed with this Keypair
+// VerifyJWT verifies the signature of a token was signed with this Keypair.
+// Failures return a *TokenError wrapping ErrKeyIDMismatch for tokens with
+// the wrong `kid`, or the underlying *jwt.ValidationError.
 func (k *Keypair) VerifyJWT(token string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+	return k.verifyJWT(new(jwt.Parser), token)
+}
+
+// verifyJWTAt is VerifyJWT validating the `exp`, `iat` & `nbf` claims
+// against now instead of the global jwt.TimeFunc
+func (k *Keypair) verifyJWTAt(token string, now time.Time) (*jwt.Token, error) {
+	parsed, err := k.verifyJWT(&jwt.Parser{SkipClaimsValidation: true}, token)
+	if err != nil {
+		return parsed, err
+	}
+	if err := validateTimeClaims(parsed, now); err != nil {
+		return parsed, &TokenError{Err: err}
+	}
+	return parsed, nil
+}
+
+func (k *Keypair) verifyJWT(parser *jwt.Parser, token string) (*jwt.Token, error) {
+	parsed, err := parser.Parse(token, func(token *jwt.Token) (interface{}, error) {
 		kid, err := k.KeyID()
 		if err != nil {
 			return nil, err
@@ -161,8 +174,45 @@ func (k *Keypair) VerifyJWT(token string) (*jwt.Token, error) {
 		if tk, ok := token.Header["kid"]; ok && tk == kid {
 			return k.PublicKey, nil
 		}
-		return nil, errors.New("token kid does not match or is not present")
+		return nil, ErrKeyIDMismatch
 	})
+	if err == nil {
+		return parsed, nil
+	}
+	if ve, ok := err.(*jwt.ValidationError); ok && ve.Inner == ErrKeyIDMismatch {
+		return parsed, &TokenError{Err: ErrKeyIDMismatch}
+	}
+	return parsed, &TokenError{Err: err}
+}
+
+// validateTimeClaims validates the `exp`, `iat` & `nbf` claims of a token
+// parsed with SkipClaimsValidation against now, like jwt.Parse does
+// against jwt.TimeFunc
+func validateTimeClaims(token *jwt.Token, now time.Time) error {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+
+	ve := &jwt.ValidationError{}
+	ts := now.Unix()
+	if !claims.VerifyExpiresAt(ts, false) {
+		ve.Inner = fmt.Errorf("Token is expired")
+		ve.Errors |= jwt.ValidationErrorExpired
+	}
+	if !claims.VerifyIssuedAt(ts, false) {
+		ve.Inner = fmt.Errorf("Token used before issued")
+		ve.Errors |= jwt.ValidationErrorIssuedAt
+	}
+	if !claims.VerifyNotBefore(ts, false) {
+		ve.Inner = fmt.Errorf("Token is not valid yet")
+		ve.Errors |= jwt.ValidationErrorNotValidYet
+	}
+	if ve.Errors == 0 {
+		return nil
+	}
+	token.Valid = false
+	return ve
 }
 
 func randomNonce(length int) (string, error) {
@@ -182,6 +232,6 @@ func GenerateCodeChallenge(method, codeVerifier string) (string, error) {
 		shaSum := sha256.Sum256([]byte(codeVerifier))
 		return base64.RawURLEncoding.EncodeToString(shaSum[:]), nil
 	default:
-		return "", fmt.Errorf("unknown challenge method: %v", method)
+		return "", fmt.Errorf("%w: %v", ErrUnknownChallengeMethod, method)
 	}
 }
@@ -3,6 +3,7 @@ package mockoidc_test
 import (
 	"crypto/x509"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"testing"
 	"time"
@@ -77,7 +78,10 @@ func TestKeypair_SignJWTVerifyJWT(t *testing.T) {
 
 			alice.Kid = "WRONG"
 			_, err = alice.VerifyJWT(tokenStr)
-			assert.Error(t, err)
+			assert.True(t, errors.Is(err, mockoidc.ErrKeyIDMismatch))
+			assert.True(t, errors.Is(err, mockoidc.ErrInvalidToken))
+			var tokenErr *mockoidc.TokenError
+			assert.True(t, errors.As(err, &tokenErr))
 
 			const customKid = "USER_DEFINED"
 			bob.Kid = customKid
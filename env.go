@@ -0,0 +1,215 @@
+package mockoidc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes the environment variables ConfigFromEnv reads
+const EnvPrefix = "MOCKOIDC_"
+
+// ConfigFromEnv reads a Config from `MOCKOIDC_` environment variables, so
+// containerized deployments can be configured without code or files:
+//
+//	MOCKOIDC_PRESET                   a Config preset to start from
+//	MOCKOIDC_CLIENT_ID                ClientID
+//	MOCKOIDC_CLIENT_SECRET            ClientSecret
+//	MOCKOIDC_ISSUER_URL               IssuerURL
+//	MOCKOIDC_TRUST_FORWARDED_HEADERS  TrustForwardedHeaders
+//	MOCKOIDC_ADMIN_TOKEN              AdminToken
+//	MOCKOIDC_HOST                     Host
+//	MOCKOIDC_PORT                     Port
+//	MOCKOIDC_ACCESS_TTL               AccessTTL, e.g. `10m`
+//	MOCKOIDC_REFRESH_TTL              RefreshTTL
+//	MOCKOIDC_ID_TOKEN_TTL             IDTokenTTL
+//	MOCKOIDC_CODE_TTL                 CodeTTL
+//	MOCKOIDC_REFRESH_MAX_LIFETIME     RefreshMaxLifetime
+//	MOCKOIDC_REFRESH_IDLE_TIMEOUT     RefreshIdleTimeout
+//	MOCKOIDC_CODE_CHALLENGE_METHODS   CodeChallengeMethodsSupported, comma separated
+//	MOCKOIDC_REQUIRE_OFFLINE_ACCESS   RequireOfflineAccess
+//	MOCKOIDC_LENIENT_CLAIMS           LenientClaims
+//	MOCKOIDC_ID_TOKEN_AUDIENCE        IDTokenAudience, comma separated
+//	MOCKOIDC_ACCESS_TOKEN_AUDIENCE    AccessTokenAudience, comma separated
+//	MOCKOIDC_SELF_ISSUED              SelfIssued
+//	MOCKOIDC_FAST_TOKENS              FastTokens
+//	MOCKOIDC_STRICT_VALIDATION        StrictValidation
+//	MOCKOIDC_REVOKE_ON_CODE_REPLAY    RevokeOnCodeReplay
+//	MOCKOIDC_DETERMINISTIC_SEED       DeterministicSeed
+//	MOCKOIDC_HISTORY_LIMIT            HistoryLimit
+//	MOCKOIDC_CHAOS_SEED               ChaosSeed
+//	MOCKOIDC_CHAOS_ERROR_RATE         ChaosErrorRate
+//	MOCKOIDC_CHAOS_JITTER             ChaosJitter
+//	MOCKOIDC_JSON_CONTENT_TYPE        JSONContentType
+//	MOCKOIDC_JSON_BOM                 JSONBOM
+//
+// Unset variables leave their settings zero, so the Config can be passed
+// to ApplyConfig or merged over another one. Boolean, numeric & duration
+// variables that are set are Explicit, so `false` or `0` turn off the
+// settings of a preset or config file.
+func ConfigFromEnv() (*Config, error) {
+	return ConfigFromLookupEnv(os.LookupEnv)
+}
+
+// ConfigFromLookupEnv reads a Config like ConfigFromEnv, looking the
+// variables up with the function instead, e.g. to layer them under flags.
+func ConfigFromLookupEnv(lookupEnv func(string) (string, bool)) (*Config, error) {
+	env := &envReader{lookupEnv: lookupEnv}
+
+	cfg := &Config{}
+	if name := env.string("PRESET"); name != "" {
+		preset, ok := Presets[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown preset %s", ErrInvalidConfig, name)
+		}
+		cfg = preset()
+	}
+
+	overrides := &Config{
+		ClientID:              env.string("CLIENT_ID"),
+		ClientSecret:          env.string("CLIENT_SECRET"),
+		IssuerURL:             env.string("ISSUER_URL"),
+		TrustForwardedHeaders: env.bool("TRUST_FORWARDED_HEADERS"),
+		AdminToken:            env.string("ADMIN_TOKEN"),
+		Host:                  env.string("HOST"),
+		Port:                  int(env.int("PORT")),
+		AccessTTL:             env.duration("ACCESS_TTL"),
+		RefreshTTL:            env.duration("REFRESH_TTL"),
+		IDTokenTTL:            env.duration("ID_TOKEN_TTL"),
+		CodeTTL:               env.duration("CODE_TTL"),
+		RefreshMaxLifetime:    env.duration("REFRESH_MAX_LIFETIME"),
+		RefreshIdleTimeout:    env.duration("REFRESH_IDLE_TIMEOUT"),
+		RequireOfflineAccess:  env.bool("REQUIRE_OFFLINE_ACCESS"),
+		LenientClaims:         env.bool("LENIENT_CLAIMS"),
+		SelfIssued:            env.bool("SELF_ISSUED"),
+		FastTokens:            env.bool("FAST_TOKENS"),
+		StrictValidation:      env.bool("STRICT_VALIDATION"),
+		RevokeOnCodeReplay:    env.bool("REVOKE_ON_CODE_REPLAY"),
+		DeterministicSeed:     env.int("DETERMINISTIC_SEED"),
+		HistoryLimit:          int(env.int("HISTORY_LIMIT")),
+		ChaosSeed:             env.int("CHAOS_SEED"),
+		ChaosErrorRate:        env.float("CHAOS_ERROR_RATE"),
+		ChaosJitter:           env.duration("CHAOS_JITTER"),
+		JSONContentType:       env.string("JSON_CONTENT_TYPE"),
+		JSONBOM:               env.bool("JSON_BOM"),
+	}
+	for name, field := range envExplicitFields {
+		if env.string(name) != "" {
+			overrides.Explicit = append(overrides.Explicit, field)
+		}
+	}
+	sort.Slice(overrides.Explicit, func(i, j int) bool {
+		return overrides.Explicit[i] < overrides.Explicit[j]
+	})
+	overrides.CodeChallengeMethodsSupported = env.list("CODE_CHALLENGE_METHODS")
+	overrides.IDTokenAudience = env.list("ID_TOKEN_AUDIENCE")
+	overrides.AccessTokenAudience = env.list("ACCESS_TOKEN_AUDIENCE")
+	if env.err != nil {
+		return nil, env.err
+	}
+	return cfg.Merge(overrides), nil
+}
+
+// envExplicitFields are the Config fields of the boolean, numeric &
+// duration variables, which are Explicit when set
+var envExplicitFields = map[string]ConfigField{
+	"TRUST_FORWARDED_HEADERS": FieldTrustForwardedHeaders,
+	"PORT":                    FieldPort,
+	"ACCESS_TTL":              FieldAccessTTL,
+	"REFRESH_TTL":             FieldRefreshTTL,
+	"ID_TOKEN_TTL":            FieldIDTokenTTL,
+	"CODE_TTL":                FieldCodeTTL,
+	"REFRESH_MAX_LIFETIME":    FieldRefreshMaxLifetime,
+	"REFRESH_IDLE_TIMEOUT":    FieldRefreshIdleTimeout,
+	"REQUIRE_OFFLINE_ACCESS":  FieldRequireOfflineAccess,
+	"LENIENT_CLAIMS":          FieldLenientClaims,
+	"SELF_ISSUED":             FieldSelfIssued,
+	"FAST_TOKENS":             FieldFastTokens,
+	"STRICT_VALIDATION":       FieldStrictValidation,
+	"REVOKE_ON_CODE_REPLAY":   FieldRevokeOnCodeReplay,
+	"DETERMINISTIC_SEED":      FieldDeterministicSeed,
+	"HISTORY_LIMIT":           FieldHistoryLimit,
+	"CHAOS_SEED":              FieldChaosSeed,
+	"CHAOS_ERROR_RATE":        FieldChaosErrorRate,
+	"CHAOS_JITTER":            FieldChaosJitter,
+	"JSON_BOM":                FieldJSONBOM,
+}
+
+// Listen listens on the Host & Port, `127.0.0.1` and a random port by
+// default.
+func (c *Config) Listen() (net.Listener, error) {
+	host := c.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	return net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(c.Port)))
+}
+
+// envReader parses `MOCKOIDC_` environment variables, keeping the first
+// error.
+type envReader struct {
+	lookupEnv func(string) (string, bool)
+	err       error
+}
+
+func (e *envReader) string(name string) string {
+	value, _ := e.lookupEnv(EnvPrefix + name)
+	return value
+}
+
+// list splits a comma separated variable
+func (e *envReader) list(name string) []string {
+	var values []string
+	if value := e.string(name); value != "" {
+		for _, v := range strings.Split(value, ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+	}
+	return values
+}
+
+func (e *envReader) parse(name string, parse func(string) error) {
+	value := e.string(name)
+	if value == "" || e.err != nil {
+		return
+	}
+	if err := parse(value); err != nil {
+		e.err = fmt.Errorf("%w: %s%s: %v", ErrInvalidConfig, EnvPrefix, name, err)
+	}
+}
+
+func (e *envReader) bool(name string) (b bool) {
+	e.parse(name, func(value string) (err error) {
+		b, err = strconv.ParseBool(value)
+		return err
+	})
+	return b
+}
+
+func (e *envReader) int(name string) (i int64) {
+	e.parse(name, func(value string) (err error) {
+		i, err = strconv.ParseInt(value, 10, 64)
+		return err
+	})
+	return i
+}
+
+func (e *envReader) float(name string) (f float64) {
+	e.parse(name, func(value string) (err error) {
+		f, err = strconv.ParseFloat(value, 64)
+		return err
+	})
+	return f
+}
+
+func (e *envReader) duration(name string) (d time.Duration) {
+	e.parse(name, func(value string) (err error) {
+		d, err = time.ParseDuration(value)
+		return err
+	})
+	return d
+}
@@ -0,0 +1,58 @@
+package mockoidc_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("MOCKOIDC_PRESET", "spa-friendly")
+	t.Setenv("MOCKOIDC_CLIENT_ID", "env-client")
+	t.Setenv("MOCKOIDC_ACCESS_TTL", "90s")
+	t.Setenv("MOCKOIDC_HOST", "127.0.0.1")
+	t.Setenv("MOCKOIDC_PORT", "0")
+	t.Setenv("MOCKOIDC_REQUIRE_OFFLINE_ACCESS", "true")
+	t.Setenv("MOCKOIDC_CODE_CHALLENGE_METHODS", "plain, S256")
+	t.Setenv("MOCKOIDC_ID_TOKEN_AUDIENCE", "api")
+
+	cfg, err := mockoidc.ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, "spa-friendly", cfg.Profile)
+	assert.Equal(t, "env-client", cfg.ClientID)
+	assert.Equal(t, 90*time.Second, cfg.AccessTTL)
+	assert.Equal(t, 24*time.Hour, cfg.RefreshTTL)
+	assert.True(t, cfg.RequireOfflineAccess)
+	assert.Equal(t, []string{"plain", "S256"}, cfg.CodeChallengeMethodsSupported)
+	assert.Equal(t, []string{"api"}, cfg.IDTokenAudience)
+	assert.Nil(t, cfg.AccessTokenAudience)
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(cfg)
+	assert.Equal(t, "env-client", m.ClientID)
+
+	ln, err := cfg.Listen()
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+	assert.Contains(t, m.Issuer(), "http://127.0.0.1:")
+
+	// set variables turn settings of the preset off
+	t.Setenv("MOCKOIDC_PRESET", "lenient")
+	t.Setenv("MOCKOIDC_LENIENT_CLAIMS", "false")
+	cfg, err = mockoidc.ConfigFromEnv()
+	assert.NoError(t, err)
+	assert.False(t, cfg.LenientClaims)
+	m.ApplyConfig(mockoidc.Lenient())
+	m.ApplyConfig(cfg)
+	assert.False(t, m.LenientClaims)
+
+	t.Setenv("MOCKOIDC_ACCESS_TTL", "soon")
+	_, err = mockoidc.ConfigFromEnv()
+	assert.True(t, errors.Is(err, mockoidc.ErrInvalidConfig))
+	assert.Contains(t, err.Error(), "MOCKOIDC_ACCESS_TTL")
+}
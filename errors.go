@@ -0,0 +1,78 @@
+package mockoidc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the MockOIDC Go API. They are wrapped with details
+// where available, use `errors.Is` to check for them.
+var (
+	// ErrServerStarted is returned when changing a MockOIDC that has
+	// already been started.
+	ErrServerStarted = errors.New("server already started")
+
+	// ErrTLSConfigRequired is returned when starting an HTTPS listener
+	// without a tls.Config.
+	ErrTLSConfigRequired = errors.New("tls config required")
+
+	// ErrH2CUnsupported is returned when starting a cleartext HTTP/2
+	// server with a Go version before 1.24.
+	ErrH2CUnsupported = errors.New("h2c requires go1.24 or later")
+
+	// ErrSessionNotFound is returned when no Session matches a code or
+	// token.
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrUserNotFound is returned when a UserStore has no matching User.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrUserStoreReadOnly is returned when adding Users to a UserStore
+	// that doesn't support it.
+	ErrUserStoreReadOnly = errors.New("user store does not support adding users")
+
+	// ErrSessionStoreReadOnly is returned when restoring Sessions to a
+	// SessionStore that can't list & put them.
+	ErrSessionStoreReadOnly = errors.New("session store does not support restoring sessions")
+
+	// ErrInvalidToken is returned for tokens that aren't valid or are
+	// missing claims.
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrKeyIDMismatch is wrapped in the TokenError returned when a
+	// token's `kid` header doesn't match the Keypair verifying it.
+	ErrKeyIDMismatch = errors.New("token kid does not match or is not present")
+
+	// ErrUnknownInvalidTokenKind is returned when queueing an
+	// InvalidTokenKind that doesn't exist.
+	ErrUnknownInvalidTokenKind = errors.New("unknown invalid token kind")
+
+	// ErrUnknownChallengeMethod is returned for PKCE code challenge
+	// methods that aren't supported.
+	ErrUnknownChallengeMethod = errors.New("unknown challenge method")
+
+	// ErrInvalidConfig is returned for config files with invalid or
+	// unsupported settings.
+	ErrInvalidConfig = errors.New("invalid config")
+)
+
+// TokenError is returned for tokens that fail verification. It matches
+// ErrInvalidToken with `errors.Is` and wraps the reason, ErrKeyIDMismatch
+// or the *jwt.ValidationError, for `errors.Is` & `errors.As`.
+type TokenError struct {
+	Err error
+}
+
+func (e *TokenError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrInvalidToken, e.Err)
+}
+
+// Unwrap returns the reason the token failed verification
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrInvalidToken
+func (e *TokenError) Is(target error) bool {
+	return target == ErrInvalidToken
+}
@@ -0,0 +1,63 @@
+package mockoidc
+
+import "time"
+
+// EventBufferSize is how many Events the Events channel holds before
+// new Events are dropped.
+const EventBufferSize = 100
+
+// EventType identifies the server-side milestone an Event reports
+type EventType string
+
+const (
+	// AuthorizeCompleted is sent when the `authorization_endpoint` starts
+	// a session and redirects with a code.
+	AuthorizeCompleted EventType = "authorize_completed"
+	// TokenIssued is sent when the `token_endpoint` issues tokens.
+	TokenIssued EventType = "token_issued"
+	// RefreshRejected is sent when a `refresh_token` grant is refused.
+	RefreshRejected EventType = "refresh_rejected"
+	// CodeReplayed is sent when an already redeemed authorization code is
+	// presented again.
+	CodeReplayed EventType = "code_replayed"
+)
+
+// Event is a server-side milestone tests can wait on instead of sleeping
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	SessionID string
+	GrantType string
+}
+
+// Events returns a channel of server Events. Events are only recorded
+// once this has been called, and are dropped if the channel is full.
+func (m *MockOIDC) Events() <-chan Event {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.events == nil {
+		m.events = make(chan Event, EventBufferSize)
+	}
+	return m.events
+}
+
+func (m *MockOIDC) emit(event Event) {
+	event.Time = m.Now()
+
+	m.mu.Lock()
+	m.eventLog = append(m.eventLog, event)
+	if drop := m.historyOverflow(len(m.eventLog)); drop > 0 {
+		m.eventLog = append([]Event(nil), m.eventLog[drop:]...)
+	}
+	events := m.events
+	m.mu.Unlock()
+	if events == nil {
+		return
+	}
+
+	select {
+	case events <- event:
+	default:
+	}
+}
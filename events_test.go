@@ -0,0 +1,55 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Events(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	events := m.Events()
+
+	authorize := url.Values{}
+	authorize.Set("scope", "openid")
+	authorize.Set("response_type", "code")
+	authorize.Set("redirect_uri", "example.com")
+	authorize.Set("state", "testState")
+	authorize.Set("client_id", m.ClientID)
+
+	m.QueueCode("code")
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+authorize.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	event := <-events
+	assert.Equal(t, mockoidc.AuthorizeCompleted, event.Type)
+	assert.Equal(t, "code", event.SessionID)
+
+	token := url.Values{}
+	token.Set("client_id", m.ClientID)
+	token.Set("client_secret", m.ClientSecret)
+	token.Set("grant_type", "authorization_code")
+	token.Set("code", "code")
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	event = <-events
+	assert.Equal(t, mockoidc.TokenIssued, event.Type)
+	assert.Equal(t, "code", event.SessionID)
+	assert.Equal(t, "authorization_code", event.GrantType)
+
+	token.Del("code")
+	token.Set("grant_type", "refresh_token")
+	token.Set("refresh_token", "WRONG")
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, token)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	event = <-events
+	assert.Equal(t, mockoidc.RefreshRejected, event.Type)
+	assert.Equal(t, "refresh_token", event.GrantType)
+}
@@ -0,0 +1,151 @@
+package mockoidc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TestingT is the subset of *testing.T that Verify reports failures to
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Expectation is a number of requests an endpoint is expected to receive.
+// Requests to an endpoint with Expectations that match none of them are
+// reported as unexpected by Verify.
+type Expectation struct {
+	Description string
+	Endpoint    string
+	Match       func(RecordedRequest) bool
+
+	min   int
+	max   int
+	count int
+}
+
+// Times expects exactly n matching requests
+func (e *Expectation) Times(n int) *Expectation {
+	e.min, e.max = n, n
+	return e
+}
+
+// AtLeast expects n or more matching requests
+func (e *Expectation) AtLeast(n int) *Expectation {
+	e.min, e.max = n, -1
+	return e
+}
+
+// AnyTimes allows any number of matching requests, including none
+func (e *Expectation) AnyTimes() *Expectation {
+	return e.AtLeast(0)
+}
+
+func (e *Expectation) matches(req RecordedRequest) bool {
+	return req.Path == e.Endpoint && (e.Match == nil || e.Match(req))
+}
+
+func (e *Expectation) String() string {
+	if e.max < 0 {
+		return fmt.Sprintf("%s at least %d time(s)", e.Description, e.min)
+	}
+	return fmt.Sprintf("%s %d time(s)", e.Description, e.min)
+}
+
+// Expect registers an Expectation of exactly one request to the endpoint
+// that the match function accepts. A nil match accepts any request.
+func (m *MockOIDC) Expect(endpoint, description string, match func(RecordedRequest) bool) *Expectation {
+	e := &Expectation{
+		Description: description,
+		Endpoint:    m.endpointPath(endpoint),
+		Match:       match,
+		min:         1,
+		max:         1,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// ExpectTokenRequests expects exactly n `token_endpoint` requests
+func (m *MockOIDC) ExpectTokenRequests(n int) *Expectation {
+	return m.Expect(TokenEndpoint, "token request", nil).Times(n)
+}
+
+// ExpectAuthorizeWithScope expects at least one `authorization_endpoint`
+// request with the scope.
+func (m *MockOIDC) ExpectAuthorizeWithScope(scope string) *Expectation {
+	description := fmt.Sprintf("authorize request with scope %q", scope)
+	return m.Expect(AuthorizationEndpoint, description, func(req RecordedRequest) bool {
+		return contains(scope, strings.Fields(req.Params.Get("scope")))
+	}).AtLeast(1)
+}
+
+// Verify fails the test with every unmet Expectation and every request
+// that matched none of its endpoint's Expectations.
+func (m *MockOIDC) Verify(t TestingT) {
+	t.Helper()
+
+	m.mu.Lock()
+	unexpected := append([]string(nil), m.unexpected...)
+	var unmet []string
+	for _, e := range m.expectations {
+		if e.count < e.min || (e.max >= 0 && e.count > e.max) {
+			unmet = append(unmet, fmt.Sprintf("expected %s, got %d", e, e.count))
+		}
+	}
+	m.mu.Unlock()
+
+	for _, msg := range append(unexpected, unmet...) {
+		t.Errorf("mockoidc: %s", msg)
+	}
+}
+
+// countExpected counts a received request towards the Expectations it
+// matches. Requests to an expected endpoint that match none of them are
+// remembered for Verify.
+func (m *MockOIDC) countExpected(req RecordedRequest) {
+	m.mu.Lock()
+	expectations := append([]*Expectation(nil), m.expectations...)
+	m.mu.Unlock()
+
+	// Match functions run without the lock, they may call the MockOIDC
+	expected := false
+	var matched []*Expectation
+	for _, e := range expectations {
+		if req.Path != e.Endpoint {
+			continue
+		}
+		expected = true
+		if e.matches(req) {
+			matched = append(matched, e)
+		}
+	}
+	if !expected {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range matched {
+		e.count++
+	}
+	if len(matched) == 0 {
+		m.unexpected = append(m.unexpected,
+			fmt.Sprintf("unexpected %s request to %s", req.Method, req.Path))
+		if drop := m.historyOverflow(len(m.unexpected)); drop > 0 {
+			m.unexpected = append([]string(nil), m.unexpected[drop:]...)
+		}
+	}
+}
+
+// ClearExpectations forgets every registered Expectation and the
+// unexpected requests
+func (m *MockOIDC) ClearExpectations() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectations = nil
+	m.unexpected = nil
+}
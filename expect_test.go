@@ -0,0 +1,88 @@
+package mockoidc_test
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestMockOIDC_Verify(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	authorize := func(scope string) {
+		data := url.Values{}
+		data.Set("scope", scope)
+		data.Set("response_type", "code")
+		data.Set("redirect_uri", "example.com")
+		data.Set("state", "testState")
+		data.Set("client_id", m.ClientID)
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + data.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	token := func() {
+		resp, err := httpClient.PostForm(m.TokenEndpoint(), url.Values{"grant_type": {"refresh_token"}})
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	m.ExpectTokenRequests(2)
+	m.ExpectAuthorizeWithScope("offline_access")
+
+	authorize("openid offline_access")
+	token()
+
+	ft := &fakeT{}
+	m.Verify(ft)
+	assert.Equal(t, []string{"mockoidc: expected token request 2 time(s), got 1"}, ft.errors)
+
+	token()
+	authorize("openid")
+
+	ft = &fakeT{}
+	m.Verify(ft)
+	assert.Equal(t, []string{
+		fmt.Sprintf("mockoidc: unexpected GET request to %s", mockoidc.AuthorizationEndpoint),
+	}, ft.errors)
+
+	m.ClearRequests()
+	m.ClearExpectations()
+	m.Expect(m.UserinfoEndpoint(), "userinfo request", nil).AnyTimes()
+	ft = &fakeT{}
+	m.Verify(ft)
+	assert.Empty(t, ft.errors)
+}
+
+func TestMockOIDC_VerifyHistoryLimit(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+	m.HistoryLimit = 2
+
+	m.ExpectTokenRequests(10)
+	for i := 0; i < 10; i++ {
+		resp, err := httpClient.PostForm(m.TokenEndpoint(), url.Values{"grant_type": {"refresh_token"}})
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Less(t, len(m.Requests()), 10)
+
+	ft := &fakeT{}
+	m.Verify(ft)
+	assert.Empty(t, ft.errors)
+}
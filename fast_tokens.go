@@ -0,0 +1,33 @@
+package mockoidc
+
+import "sync"
+
+// fastKeypairBits is the size of the FastTokens Keypair: the smallest RSA
+// key crypto/rsa accepts, about 3.5x faster to sign with than 2048 bits.
+const fastKeypairBits = 1024
+
+var fastKeypair struct {
+	once sync.Once
+	kp   *Keypair
+	err  error
+}
+
+// FastKeypair returns the Keypair tokens are signed with in FastTokens
+// mode. It's generated once per process, so servers started by a test
+// suite share it.
+func FastKeypair() (*Keypair, error) {
+	fastKeypair.once.Do(func() {
+		fastKeypair.kp, fastKeypair.err = RandomKeypair(fastKeypairBits)
+	})
+	return fastKeypair.kp, fastKeypair.err
+}
+
+// signingKeypair returns the Keypair the `token_endpoint` signs with
+func (m *MockOIDC) signingKeypair() (*Keypair, error) {
+	if m.FastTokens {
+		return FastKeypair()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Keypair, nil
+}
@@ -0,0 +1,59 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestMockOIDC_FastTokens(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(&mockoidc.Config{FastTokens: true})
+	assert.True(t, m.Config().FastTokens)
+
+	fast, err := mockoidc.FastKeypair()
+	assert.NoError(t, err)
+	assert.Equal(t, 1024, fast.PrivateKey.N.BitLen())
+	again, err := mockoidc.FastKeypair()
+	assert.NoError(t, err)
+	assert.Same(t, fast, again)
+
+	session, err := m.SessionStore.NewSession("openid profile", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	tokenResp := make(map[string]interface{})
+	assert.NoError(t, getJSON(rr, &tokenResp))
+
+	for _, field := range []string{"access_token", "id_token", "refresh_token"} {
+		_, err := fast.VerifyJWT(tokenResp[field].(string))
+		assert.NoError(t, err)
+	}
+
+	// the FastKeypair is published first
+	rr = testResponse(t, mockoidc.JWKSEndpoint, m.JWKS, http.MethodGet, nil)
+	jwks := jose.JSONWebKeySet{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jwks))
+	kid, err := fast.KeyID()
+	assert.NoError(t, err)
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, kid, jwks.Keys[0].KeyID)
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+tokenResp["access_token"].(string))
+	m.Userinfo(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
@@ -0,0 +1,230 @@
+package mockoidc
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// Experimental OpenID Federation endpoints, served when Federation is
+// enabled. The trust anchor is a fixture superior of the MockOIDC, so a
+// complete trust chain can be resolved.
+const (
+	FederationEndpoint       = "/oidc/.well-known/openid-federation"
+	TrustAnchorBase          = "/federation/anchor"
+	TrustAnchorEndpoint      = "/federation/anchor/.well-known/openid-federation"
+	TrustAnchorFetchEndpoint = "/federation/anchor/fetch"
+	SignedJWKSEndpoint       = "/oidc/.well-known/signed-jwks"
+
+	NotFound = "not_found"
+
+	applicationEntityStatement = "application/entity-statement+jwt"
+	entityStatementType        = "entity-statement+jwt"
+	applicationJWKSetJWT       = "application/jwk-set+jwt"
+	jwkSetType                 = "jwk-set+jwt"
+	entityStatementTTL         = 24 * time.Hour
+)
+
+// EntityConfiguration serves the signed Entity Configuration of the
+// MockOIDC as an OpenID Provider subordinate to the trust anchor.
+func (m *MockOIDC) EntityConfiguration(rw http.ResponseWriter, req *http.Request) {
+	claims, err := m.providerConfiguration(req)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	m.signedResponse(rw, claims, m.Keypair, entityStatementType, applicationEntityStatement)
+}
+
+// TrustAnchorConfiguration serves the signed Entity Configuration of the
+// trust anchor fixture.
+func (m *MockOIDC) TrustAnchorConfiguration(rw http.ResponseWriter, _ *http.Request) {
+	anchor, err := m.trustAnchorKeypair()
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	claims, err := m.entityStatement(m.TrustAnchorID(), m.TrustAnchorID(), anchor)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	claims["metadata"] = map[string]interface{}{
+		"federation_entity": map[string]string{
+			"federation_fetch_endpoint": m.endpoint(TrustAnchorFetchEndpoint),
+		},
+	}
+
+	m.signedResponse(rw, claims, anchor, entityStatementType, applicationEntityStatement)
+}
+
+// TrustAnchorFetch serves the Subordinate Statement the trust anchor
+// fixture issues about the MockOIDC, its only subordinate.
+func (m *MockOIDC) TrustAnchorFetch(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	if !assertPresence([]string{"sub"}, rw, req) {
+		return
+	}
+	if req.Form.Get("sub") != m.Issuer() {
+		ErrNotFound.Describe("Unknown subordinate").Write(rw)
+		return
+	}
+
+	anchor, err := m.trustAnchorKeypair()
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	claims, err := m.entityStatement(m.TrustAnchorID(), m.Issuer(), m.Keypair)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	m.signedResponse(rw, claims, anchor, entityStatementType, applicationEntityStatement)
+}
+
+// SignedJWKS serves the JWKS as a JWT signed with the MockOIDC Keypair,
+// the `signed_jwks_uri` of its `openid_provider` metadata.
+func (m *MockOIDC) SignedJWKS(rw http.ResponseWriter, _ *http.Request) {
+	claims, err := m.entityStatement(m.Issuer(), m.Issuer(), m.Keypair)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jwks := claims["jwks"].(jose.JSONWebKeySet)
+	delete(claims, "jwks")
+	delete(claims, "exp")
+	claims["keys"] = jwks.Keys
+
+	m.signedResponse(rw, claims, m.Keypair, jwkSetType, applicationJWKSetJWT)
+}
+
+// TrustChain returns the fixture trust chain of the MockOIDC: its Entity
+// Configuration, the trust anchor's Subordinate Statement about it and
+// the trust anchor's Entity Configuration.
+func (m *MockOIDC) TrustChain() ([]string, error) {
+	anchor, err := m.trustAnchorKeypair()
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := m.providerConfiguration(&http.Request{})
+	if err != nil {
+		return nil, err
+	}
+	subordinate, err := m.entityStatement(m.TrustAnchorID(), m.Issuer(), m.Keypair)
+	if err != nil {
+		return nil, err
+	}
+	root, err := m.entityStatement(m.TrustAnchorID(), m.TrustAnchorID(), anchor)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make([]string, 0, 3)
+	for _, statement := range []struct {
+		claims jwt.MapClaims
+		kp     *Keypair
+	}{{leaf, m.Keypair}, {subordinate, anchor}, {root, anchor}} {
+		signed, err := signTyped(statement.kp, statement.claims, entityStatementType)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, signed)
+	}
+	return chain, nil
+}
+
+// providerConfiguration builds the Entity Configuration claims of the
+// MockOIDC with its discovery document as `openid_provider` metadata.
+func (m *MockOIDC) providerConfiguration(req *http.Request) (jwt.MapClaims, error) {
+	claims, err := m.entityStatement(m.Issuer(), m.Issuer(), m.Keypair)
+	if err != nil {
+		return nil, err
+	}
+	discovery, err := m.discoveryDocument(req)
+	if err != nil {
+		return nil, err
+	}
+	claims["authority_hints"] = []string{m.TrustAnchorID()}
+	claims["metadata"] = map[string]interface{}{
+		"openid_provider": discovery,
+	}
+	return claims, nil
+}
+
+// TrustAnchorID returns the Entity Identifier of the trust anchor fixture
+func (m *MockOIDC) TrustAnchorID() string {
+	return m.endpoint(TrustAnchorBase)
+}
+
+// trustAnchorKeypair returns the TrustAnchorKeypair, generating a random
+// one on first use.
+func (m *MockOIDC) trustAnchorKeypair() (*Keypair, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.TrustAnchorKeypair == nil {
+		kp, err := RandomKeypair(2048)
+		if err != nil {
+			return nil, err
+		}
+		m.TrustAnchorKeypair = kp
+	}
+	return m.TrustAnchorKeypair, nil
+}
+
+// entityStatement builds the claims of a statement about the subject
+// entity, publishing the subject's federation signing key.
+func (m *MockOIDC) entityStatement(iss, sub string, subjectKey *Keypair) (jwt.MapClaims, error) {
+	jwk, err := subjectKey.JWK()
+	if err != nil {
+		return nil, err
+	}
+	now := m.Now()
+	return jwt.MapClaims{
+		"iss":  iss,
+		"sub":  sub,
+		"iat":  now.Unix(),
+		"exp":  expiresAt(now, entityStatementTTL),
+		"jwks": jose.JSONWebKeySet{Keys: []jose.JSONWebKey{*jwk}},
+	}, nil
+}
+
+func (m *MockOIDC) signedResponse(rw http.ResponseWriter, claims jwt.MapClaims, kp *Keypair, typ, contentType string) {
+	signed, err := signTyped(kp, claims, typ)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	noCache(rw)
+	rw.Header().Set("Content-Type", contentType)
+	rw.WriteHeader(http.StatusOK)
+
+	_, err = rw.Write([]byte(signed))
+	if err != nil {
+		internalServerError(rw, err.Error())
+	}
+}
+
+// signTyped signs the claims with a `typ` header
+func signTyped(kp *Keypair, claims jwt.MapClaims, typ string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+
+	kid, err := kp.KeyID()
+	if err != nil {
+		return "", err
+	}
+	token.Header["kid"] = kid
+	token.Header["typ"] = typ
+
+	return token.SignedString(kp.PrivateKey)
+}
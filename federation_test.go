@@ -0,0 +1,77 @@
+package mockoidc_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Federation(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Federation = true
+	anchor, err := mockoidc.RandomKeypair(2048)
+	assert.NoError(t, err)
+	m.TrustAnchorKeypair = anchor
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+
+	fetchTyped := func(endpoint, typ string, kp *mockoidc.Keypair) jwt.MapClaims {
+		resp, err := http.Get(endpoint)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/"+typ, resp.Header.Get("Content-Type"))
+
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		token, err := kp.VerifyJWT(string(body))
+		assert.NoError(t, err)
+		assert.Equal(t, typ, token.Header["typ"])
+		return token.Claims.(jwt.MapClaims)
+	}
+	fetch := func(endpoint string, kp *mockoidc.Keypair) jwt.MapClaims {
+		return fetchTyped(endpoint, "entity-statement+jwt", kp)
+	}
+
+	leaf := fetch(m.FederationEndpoint(), m.Keypair)
+	assert.Equal(t, m.Issuer(), leaf["iss"])
+	assert.Equal(t, m.Issuer(), leaf["sub"])
+	assert.Equal(t, []interface{}{m.TrustAnchorID()}, leaf["authority_hints"])
+	provider := leaf["metadata"].(map[string]interface{})["openid_provider"].(map[string]interface{})
+	assert.Equal(t, m.TokenEndpoint(), provider["token_endpoint"])
+
+	signedJWKS := fetchTyped(provider["signed_jwks_uri"].(string), "jwk-set+jwt", m.Keypair)
+	assert.Equal(t, leaf["jwks"].(map[string]interface{})["keys"], signedJWKS["keys"])
+
+	root := fetch(m.Addr()+mockoidc.TrustAnchorEndpoint, anchor)
+	assert.Equal(t, m.TrustAnchorID(), root["iss"])
+	fetchEndpoint := root["metadata"].(map[string]interface{})["federation_entity"].(map[string]interface{})["federation_fetch_endpoint"].(string)
+
+	subordinate := fetch(fetchEndpoint+"?"+url.Values{"sub": {m.Issuer()}}.Encode(), anchor)
+	assert.Equal(t, m.TrustAnchorID(), subordinate["iss"])
+	assert.Equal(t, m.Issuer(), subordinate["sub"])
+	assert.Equal(t, leaf["jwks"], subordinate["jwks"])
+
+	resp, err := http.Get(fetchEndpoint + "?sub=https://unknown.example.com")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	chain, err := m.TrustChain()
+	assert.NoError(t, err)
+	assert.Len(t, chain, 3)
+	for i, kp := range []*mockoidc.Keypair{m.Keypair, anchor, anchor} {
+		_, err := kp.VerifyJWT(chain[i])
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build go1.24
+// +build go1.24
+
+package mockoidc
+
+import "net/http"
+
+// enableH2C serves cleartext HTTP/2 with prior knowledge alongside
+// HTTP/1.1
+func enableH2C(srv *http.Server) error {
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv.Protocols = protocols
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !go1.24
+// +build !go1.24
+
+package mockoidc
+
+import "net/http"
+
+// enableH2C needs the Go 1.24 `http.Protocols` API
+func enableH2C(_ *http.Server) error {
+	return ErrH2CUnsupported
+}
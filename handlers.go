@@ -1,11 +1,14 @@
 package mockoidc
 
 import (
+	"bytes"
 	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"html/template"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,11 +28,31 @@ const (
 	InvalidGrant         = "invalid_grant"
 	UnsupportedGrantType = "unsupported_grant_type"
 	InvalidScope         = "invalid_scope"
+	InvalidToken         = "invalid_token"
+	InsufficientScope    = "insufficient_scope"
 	//UnauthorizedClient = "unauthorized_client"
-	InternalServerError = "internal_server_error"
+	InternalServerError             = "internal_server_error"
+	UnmetAuthenticationRequirements = "unmet_authentication_requirements"
+	LoginRequired                   = "login_required"
+	InteractionRequired             = "interaction_required"
+	InvalidRequestObject            = "invalid_request_object"
+	InvalidRequestURI               = "invalid_request_uri"
+	RequestNotSupported             = "request_not_supported"
+	AccessDenied                    = "access_denied"
+	ConsentRequired                 = "consent_required"
+	UnsupportedResponseType         = "unsupported_response_type"
 
-	applicationJSON = "application/json"
-	openidScope     = "openid"
+	PromptNone          = "none"
+	PromptLogin         = "login"
+	PromptConsent       = "consent"
+	PromptSelectAccount = "select_account"
+
+	ResponseModeQuery    = "query"
+	ResponseModeFormPost = "form_post"
+
+	applicationJSON    = "application/json"
+	openidScope        = "openid"
+	offlineAccessScope = "offline_access"
 )
 
 var (
@@ -40,17 +63,34 @@ var (
 	ResponseTypesSupported = []string{
 		"code",
 	}
+	ResponseModesSupported = []string{
+		ResponseModeQuery,
+		ResponseModeFormPost,
+	}
 	SubjectTypesSupported = []string{
 		"public",
 	}
 	IDTokenSigningAlgValuesSupported = []string{
 		"RS256",
 	}
+	UserinfoSigningAlgValuesSupported = []string{
+		"RS256",
+	}
+	PromptValuesSupported = []string{
+		PromptNone,
+		PromptLogin,
+		PromptConsent,
+		PromptSelectAccount,
+	}
 	ScopesSupported = []string{
 		"openid",
 		"email",
 		"groups",
 		"profile",
+		"phone",
+		"address",
+		"roles",
+		"offline_access",
 	}
 	TokenEndpointAuthMethodsSupported = []string{
 		"client_secret_basic",
@@ -61,31 +101,62 @@ var (
 		"email",
 		"email_verified",
 		"preferred_username",
+		"name",
+		"given_name",
+		"family_name",
+		"locale",
+		"updated_at",
 		"phone_number",
+		"phone_number_verified",
 		"address",
 		"groups",
+		"roles",
 		"iss",
 		"aud",
+		"acr",
+		"amr",
+		"auth_time",
+		"sid",
 	}
 )
 
 // Authorize implements the `authorization_endpoint` in the OIDC flow.
 // It is the initial request that "authenticates" a user in the OAuth2
-// flow and redirects the client to the application `redirect_uri`.
+// flow and redirects the client to the application `redirect_uri`. It
+// accepts GET requests and form encoded POSTs (OIDC Core 3.1.2.1).
 func (m *MockOIDC) Authorize(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		rw.Header().Set("Allow", "GET, POST")
+		ErrInvalidRequest.Describe("Unsupported method: %s", req.Method).
+			WithStatus(http.StatusMethodNotAllowed).Write(rw)
+		return
+	}
 	err := req.ParseForm()
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
+	if id := req.PostForm.Get(interactionParam); id != "" {
+		m.resumeAuthorize(rw, req, id)
+		return
+	}
+	if !m.parseRequestObject(m.authorizeErrors(rw, req), req) {
+		return
+	}
+	m.lintAuthorize(req)
+	m.collectSessions()
 
+	rw = m.authorizeErrors(rw, req)
+	if !m.strictAuthorize(rw, req) {
+		return
+	}
 	valid := assertPresence(
 		[]string{"scope", "state", "client_id", "response_type", "redirect_uri"}, rw, req)
 	if !valid {
 		return
 	}
 
-	if !validateScope(rw, req) {
+	if !m.PlainOAuth2 && !validateScope(rw, req) {
 		return
 	}
 	validClient := assertEqual("client_id", m.ClientID,
@@ -101,38 +172,257 @@ func (m *MockOIDC) Authorize(rw http.ResponseWriter, req *http.Request) {
 	if !validateCodeChallengeMethodSupported(rw, req.Form.Get("code_challenge_method"), m.CodeChallengeMethodsSupported) {
 		return
 	}
+	if mode := req.Form.Get("response_mode"); mode != "" && !contains(mode, ResponseModesSupported) {
+		ErrInvalidRequest.Describe("Unsupported response mode: %s", mode).Write(rw)
+		return
+	}
+	acr, valid := m.selectACR(rw, req)
+	if !valid {
+		return
+	}
 
-	session, err := m.SessionStore.NewSession(
-		req.Form.Get("scope"),
-		req.Form.Get("nonce"),
-		m.UserQueue.Pop(),
-		req.Form.Get("code_challenge"),
-		req.Form.Get("code_challenge_method"),
-	)
-	if err != nil {
-		internalServerError(rw, err.Error())
+	a := &authorization{acr: acr}
+	if m.LoginPage {
+		m.showLogin(rw, req, a, "")
+		return
+	}
+	user, pop := m.selectUser(req)
+	if !m.login(rw, req, a, user) {
 		return
 	}
+	pop()
+	m.continueAuthorize(rw, req, a)
+}
 
-	redirectURI, err := url.Parse(req.Form.Get("redirect_uri"))
+// login runs the Interaction for the User of an authorization and
+// authenticates them.
+func (m *MockOIDC) login(rw http.ResponseWriter, req *http.Request, a *authorization, user User) bool {
+	user, valid := m.interact(rw, req, user)
+	if !valid {
+		return false
+	}
+	authTime, valid := m.authenticate(rw, req, user)
+	if !valid {
+		return false
+	}
+	a.user, a.authTime = user, authTime
+	return true
+}
+
+// completeAuthorize creates the Session of an authorization and redirects
+// its code to the client.
+func (m *MockOIDC) completeAuthorize(rw http.ResponseWriter, req *http.Request, a *authorization) {
+	session, err := m.newSession(req, a.user)
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
-	params, _ := url.ParseQuery(redirectURI.RawQuery)
+	session.ACR = a.acr
+	session.AMR = append([]string(nil), m.AMR...)
+	if a.amr != nil {
+		session.AMR = a.amr
+	}
+	session.AuthTime = a.authTime
+	session.Prompts = strings.Fields(req.Form.Get("prompt"))
+	session.ClientID = req.Form.Get("client_id")
+	session.CodeIssuedAt = m.Now()
+	session.ExpiresAt = m.Now().Add(m.sessionTTL())
+	if scope := requestScope(req); scope != nil {
+		session.Namespace = scope.Name
+	}
+	if err := m.saveSession(session); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	if err := m.limitSessions(session); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	params := url.Values{}
 	params.Set("code", session.SessionID)
-	params.Set("state", req.Form.Get("state"))
-	redirectURI.RawQuery = params.Encode()
+	authorizeRedirect(rw, req, params)
 
-	http.Redirect(rw, req, redirectURI.String(), http.StatusFound)
+	m.emit(Event{Type: AuthorizeCompleted, SessionID: session.SessionID})
+}
+
+// newSession creates the Session of an authorization. ScopedMock logins
+// take their code off the ScopedMock's CodeQueue instead of the
+// SessionStore's, if the store can save Sessions.
+func (m *MockOIDC) newSession(req *http.Request, user User) (*Session, error) {
+	m.installCodeGenerator()
+	_, ok := m.SessionStore.(interface{ PutSession(*Session) })
+	scope := requestScope(req)
+	if scope == nil || !ok {
+		return m.SessionStore.NewSession(
+			req.Form.Get("scope"),
+			req.Form.Get("nonce"),
+			user,
+			req.Form.Get("code_challenge"),
+			req.Form.Get("code_challenge_method"),
+		)
+	}
+
+	code, err := scope.CodeQueue.Pop()
+	if err != nil {
+		return nil, err
+	}
+	session := newSession(code,
+		req.Form.Get("scope"),
+		req.Form.Get("nonce"),
+		user,
+		req.Form.Get("code_challenge"),
+		req.Form.Get("code_challenge_method"),
+	)
+	if err := m.saveSession(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// selectUser finds the User named by the `login_hint` or the next one of
+// the ScopedMock's, the client's or the shared UserQueue. Queued Users are
+// only taken off their queue by calling pop, once they logged in, so
+// failed logins don't use them up.
+func (m *MockOIDC) selectUser(req *http.Request) (user User, pop func()) {
+	if hint := req.Form.Get("login_hint"); hint != "" && m.UserStore != nil {
+		if user, err := m.UserStore.GetUserByID(hint); err == nil {
+			return user, func() {}
+		}
+		if user, err := m.UserStore.GetUserByEmail(hint); err == nil {
+			return user, func() {}
+		}
+	}
+	queues := []*UserQueue{m.ClientUserQueue(req.Form.Get("client_id")), m.UserQueue}
+	if scope := requestScope(req); scope != nil {
+		queues = []*UserQueue{scope.UserQueue}
+	}
+	for _, queue := range queues {
+		if user := queue.Peek(); user != nil {
+			queue := queue
+			return user, func() { queue.pop() }
+		}
+	}
+	return DefaultUser(), func() {}
+}
+
+// authenticate returns when the User last logged in. Users are logged in
+// again if they never have been, if `prompt=login` was requested or if the
+// requested `max_age` has elapsed (unless MaxAgeLoginRequired is set).
+// `prompt=none` requests fail instead of logging a User in.
+func (m *MockOIDC) authenticate(rw http.ResponseWriter, req *http.Request, user User) (time.Time, bool) {
+	maxAge := time.Duration(-1)
+	if value := req.Form.Get("max_age"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			ErrInvalidRequest.Describe("Invalid max_age: %s", value).Write(rw)
+			return time.Time{}, false
+		}
+		maxAge = time.Duration(seconds) * time.Second
+	}
+	prompts := strings.Fields(req.Form.Get("prompt"))
+	for _, prompt := range prompts {
+		if !contains(prompt, PromptValuesSupported) ||
+			(prompt == PromptNone && len(prompts) > 1) {
+			ErrInvalidRequest.Describe("Invalid prompt: %s", req.Form.Get("prompt")).Write(rw)
+			return time.Time{}, false
+		}
+	}
+
+	now := m.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	last, loggedIn := m.authTimes[user.ID()]
+	expired := loggedIn && maxAge >= 0 && now.Sub(last) >= maxAge
+	if contains(PromptNone, prompts) {
+		switch {
+		case !loggedIn || expired:
+			authorizeError(rw, req, LoginRequired, "The user is not logged in")
+			return time.Time{}, false
+		case m.InteractionRequired:
+			authorizeError(rw, req, InteractionRequired, "The user must interact with the server")
+			return time.Time{}, false
+		}
+		return last, true
+	}
+	if loggedIn && !expired && !contains(PromptLogin, prompts) {
+		return last, true
+	}
+	if expired && m.MaxAgeLoginRequired {
+		authorizeError(rw, req, LoginRequired, "The max_age since the last login has elapsed")
+		return time.Time{}, false
+	}
+
+	if m.authTimes == nil {
+		m.authTimes = make(map[string]time.Time)
+	}
+	m.authTimes[user.ID()] = now
+	return now, true
+}
+
+// limitSessions revokes the oldest sessions of a User & client once there
+// are more than MaxSessionsPerUser, and the oldest sessions of a client
+// once there are more than MaxSessionsPerClient. Revoked & expired
+// sessions don't count and are forgotten.
+func (m *MockOIDC) limitSessions(session *Session) error {
+	if m.MaxSessionsPerUser <= 0 && m.MaxSessionsPerClient <= 0 {
+		return nil
+	}
+	now := m.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.MaxSessionsPerUser > 0 {
+		if m.userSessions == nil {
+			m.userSessions = make(map[string][]string)
+		}
+		key := session.ClientID + " " + session.User.ID()
+		ids, err := m.capSessions(m.userSessions[key], session.SessionID,
+			m.MaxSessionsPerUser, now)
+		m.userSessions[key] = ids
+		if err != nil {
+			return err
+		}
+	}
+	if m.MaxSessionsPerClient > 0 {
+		if m.clientSessions == nil {
+			m.clientSessions = make(map[string][]string)
+		}
+		ids, err := m.capSessions(m.clientSessions[session.ClientID], session.SessionID,
+			m.MaxSessionsPerClient, now)
+		m.clientSessions[session.ClientID] = ids
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// capSessions adds a session to the IDs of the live sessions it counts
+// against and revokes the oldest ones beyond the limit. It must be called
+// with the lock held.
+func (m *MockOIDC) capSessions(ids []string, id string, limit int, now time.Time) ([]string, error) {
+	ids = append(m.liveSessionIDs(ids, now), id)
+	for len(ids) > limit {
+		if oldest, err := m.peekSession(ids[0]); err == nil {
+			oldest.Revoked = true
+			if err := m.saveSession(oldest); err != nil {
+				return ids, err
+			}
+		}
+		ids = ids[1:]
+	}
+	return ids, nil
 }
 
 type tokenResponse struct {
-	AccessToken  string        `json:"access_token,omitempty"`
-	RefreshToken string        `json:"refresh_token,omitempty"`
-	IDToken      string        `json:"id_token,omitempty"`
-	TokenType    string        `json:"token_type"`
-	ExpiresIn    time.Duration `json:"expires_in"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Scope        string `json:"scope,omitempty"`
 }
 
 // Token implements the `token_endpoint` in OIDC and responds to requests
@@ -149,12 +439,18 @@ func (m *MockOIDC) Token(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if !m.validateTokenParams(rw, req) {
+	m.lintQuery(req)
+	if tr, ok := m.popTokenResponse(); ok {
+		tr.write(rw)
+		return
+	}
+	if !m.strictToken(rw, req) || !m.validateTokenParams(rw, req) {
 		return
 	}
 
 	var (
 		session *Session
+		issued  *Session
 		valid   bool
 	)
 	grantType := req.Form.Get("grant_type")
@@ -167,26 +463,51 @@ func (m *MockOIDC) Token(rw http.ResponseWriter, req *http.Request) {
 		if !m.validateCodeChallenge(rw, req, session) {
 			return
 		}
+		issued = session
 	case "refresh_token":
 		if session, valid = m.validateRefreshGrant(rw, req); !valid {
+			m.emit(Event{Type: RefreshRejected, GrantType: grantType})
+			return
+		}
+		if issued, valid = refreshScopes(rw, req, session); !valid {
+			m.emit(Event{Type: RefreshRejected, GrantType: grantType})
 			return
 		}
 	default:
-		errorResponse(rw, InvalidRequest,
-			fmt.Sprintf("Invalid grant type: %s", grantType), http.StatusBadRequest)
+		ErrInvalidRequest.Describe("Invalid grant type: %s", grantType).Write(rw)
+		return
+	}
+
+	if !m.allowIssuance(rw, req, req.Form.Get("client_id")) {
+		return
+	}
+	if grantType == "authorization_code" && !m.redeemCodeGrant(rw, session) {
 		return
 	}
 
 	tr := &tokenResponse{
 		RefreshToken: req.Form.Get("refresh_token"),
 		TokenType:    "bearer",
-		ExpiresIn:    m.AccessTTL,
+		ExpiresIn:    ttlSeconds(m.AccessTTL),
+	}
+	if issued != session {
+		tr.Scope = strings.Join(issued.Scopes, " ")
 	}
-	err = m.setTokens(tr, session, grantType)
+	err = m.setTokens(tr, issued, grantType, req)
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
+	now := m.Now()
+	if session.IssuedAt.IsZero() {
+		session.IssuedAt = now
+	}
+	session.RefreshedAt = now
+	session.ExpiresAt = now.Add(m.sessionTTL())
+	if err := m.saveSession(session); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
 
 	resp, err := json.Marshal(tr)
 	if err != nil {
@@ -195,6 +516,8 @@ func (m *MockOIDC) Token(rw http.ResponseWriter, req *http.Request) {
 	}
 	noCache(rw)
 	jsonResponse(rw, resp)
+
+	m.emit(Event{Type: TokenIssued, SessionID: session.SessionID, GrantType: grantType})
 }
 
 func (m *MockOIDC) validateTokenParams(rw http.ResponseWriter, req *http.Request) bool {
@@ -228,41 +551,131 @@ func (m *MockOIDC) validateCodeGrant(rw http.ResponseWriter, req *http.Request)
 
 	code := req.Form.Get("code")
 	session, err := m.SessionStore.GetSessionByID(code)
-	if err != nil || session.Granted {
-		errorResponse(rw, InvalidGrant, fmt.Sprintf("Invalid code: %s", code),
-			http.StatusUnauthorized)
+	if err != nil || session.Revoked || session.Namespace != requestNamespace(req) {
+		ErrInvalidGrant.Describe("Invalid code: %s", code).Write(rw)
+		return nil, false
+	}
+	if m.CodeTTL > 0 && !session.CodeIssuedAt.IsZero() &&
+		!m.Now().Before(session.CodeIssuedAt.Add(m.CodeTTL)) {
+		ErrInvalidGrant.Describe("Code expired: %s", code).Write(rw)
+		return nil, false
+	}
+	m.mu.Lock()
+	granted := session.Granted
+	m.mu.Unlock()
+	if granted {
+		if err := m.codeReplayed(session); err != nil {
+			internalServerError(rw, err.Error())
+			return nil, false
+		}
+		ErrInvalidGrant.Describe("Code already redeemed: %s", code).Write(rw)
 		return nil, false
 	}
-	session.Granted = true
 
 	return session, true
 }
 
+// redeemCodeGrant redeems the code of a validated `authorization_code`
+// grant, so requests failing validation don't use it up.
+func (m *MockOIDC) redeemCodeGrant(rw http.ResponseWriter, session *Session) bool {
+	redeemed, err := m.redeemCode(session)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return false
+	}
+	if !redeemed {
+		ErrInvalidGrant.Describe("Code already redeemed: %s", session.SessionID).Write(rw)
+		return false
+	}
+	return true
+}
+
+// redeemCode marks the code of a Session as redeemed. It is false if it
+// already was. Concurrent redemptions of the same code only succeed once
+// with in-memory SessionStores, which share Sessions between requests,
+// and with SessionStores that redeem codes atomically themselves, like the
+// RedisSessionStore. With RevokeOnCodeReplay, the Session is revoked then.
+func (m *MockOIDC) redeemCode(session *Session) (bool, error) {
+	m.installSessionClock()
+	m.mu.Lock()
+	replayed := session.Granted
+	session.Granted = true
+	m.mu.Unlock()
+
+	store, ok := m.SessionStore.(interface {
+		RedeemCode(*Session) (bool, error)
+	})
+	if ok && !replayed {
+		redeemed, err := store.RedeemCode(session)
+		if err != nil {
+			return false, err
+		}
+		replayed = !redeemed
+	}
+	if !replayed {
+		return true, nil
+	}
+	return false, m.codeReplayed(session)
+}
+
+// codeReplayed revokes the Session of a replayed code with
+// RevokeOnCodeReplay and emits a CodeReplayed Event
+func (m *MockOIDC) codeReplayed(session *Session) error {
+	if m.RevokeOnCodeReplay {
+		m.mu.Lock()
+		session.Revoked = true
+		m.mu.Unlock()
+		if err := m.saveSession(session); err != nil {
+			return err
+		}
+	}
+	m.emit(Event{Type: CodeReplayed, SessionID: session.SessionID, GrantType: "authorization_code"})
+	return nil
+}
+
 func (m *MockOIDC) validateCodeChallenge(rw http.ResponseWriter, req *http.Request, session *Session) bool {
 	if session.CodeChallenge == "" || session.CodeChallengeMethod == "" {
 		return true
 	}
+	if m.SkipCodeVerifier {
+		m.recordPKCEDowngrade(req, session)
+		return true
+	}
 
 	codeVerifier := req.Form.Get("code_verifier")
 	if codeVerifier == "" {
-		errorResponse(rw, InvalidGrant, "Invalid code verifier. Expected code but client sent none.", http.StatusUnauthorized)
+		ErrInvalidGrant.Describe("Invalid code verifier. Expected code but client sent none.").
+			Write(rw)
 		return false
 	}
 
 	challenge, err := GenerateCodeChallenge(session.CodeChallengeMethod, codeVerifier)
 	if err != nil {
-		errorResponse(rw, InvalidRequest, fmt.Sprintf("Invalid code verifier. %v", err.Error()), http.StatusUnauthorized)
+		ErrInvalidRequest.Describe("Invalid code verifier. %v", err.Error()).
+			WithStatus(http.StatusUnauthorized).Write(rw)
 		return false
 	}
 
 	if challenge != session.CodeChallenge {
-		errorResponse(rw, InvalidGrant, "Invalid code verifier. Code challenge did not match hashed code verifier.", http.StatusUnauthorized)
+		ErrInvalidGrant.Describe("Invalid code verifier. Code challenge did not match hashed code verifier.").
+			Write(rw)
 		return false
 	}
 
 	return true
 }
 
+func (m *MockOIDC) recordPKCEDowngrade(req *http.Request, session *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pkceDowngrades = append(m.pkceDowngrades, PKCEDowngrade{
+		Code:                session.SessionID,
+		CodeChallenge:       session.CodeChallenge,
+		CodeChallengeMethod: session.CodeChallengeMethod,
+		CodeVerifier:        req.Form.Get("code_verifier"),
+	})
+}
+
 func (m *MockOIDC) validateRefreshGrant(rw http.ResponseWriter, req *http.Request) (*Session, bool) {
 	if !assertPresence([]string{"refresh_token"}, rw, req) {
 		return nil, false
@@ -281,56 +694,157 @@ func (m *MockOIDC) validateRefreshGrant(rw http.ResponseWriter, req *http.Reques
 	}
 
 	session, err := m.SessionStore.GetSessionByToken(token)
-	if err != nil {
-		errorResponse(rw, InvalidGrant, "Invalid refresh token",
-			http.StatusUnauthorized)
+	if err != nil || session.Revoked {
+		ErrInvalidGrant.Describe("Invalid refresh token").Write(rw)
+		return nil, false
+	}
+
+	now := m.Now()
+	if m.RefreshMaxLifetime > 0 && !now.Before(session.IssuedAt.Add(m.RefreshMaxLifetime)) {
+		ErrInvalidGrant.Describe("Session max lifetime exceeded").Write(rw)
+		return nil, false
+	}
+	if m.RefreshIdleTimeout > 0 && !now.Before(session.RefreshedAt.Add(m.RefreshIdleTimeout)) {
+		ErrInvalidGrant.Describe("Session idle timeout exceeded").Write(rw)
 		return nil, false
 	}
 	return session, true
 }
 
-func (m *MockOIDC) setTokens(tr *tokenResponse, s *Session, grantType string) error {
-	var err error
-	tr.AccessToken, err = s.AccessToken(m.Config(), m.Keypair, m.Now())
+// refreshScopes returns the Session tokens of a `refresh_token` grant are
+// issued for. With a `scope` parameter, it's a copy of the Session
+// narrowed down to the requested scopes, which must all have been granted.
+func refreshScopes(rw http.ResponseWriter, req *http.Request, session *Session) (*Session, bool) {
+	requested := strings.Fields(req.Form.Get("scope"))
+	if len(requested) == 0 {
+		return session, true
+	}
+	for _, scope := range requested {
+		if !contains(scope, session.Scopes) {
+			ErrInvalidScope.Describe("The scope exceeds the granted scope: %s", scope).Write(rw)
+			return nil, false
+		}
+	}
+
+	narrowed := *session
+	narrowed.Scopes = nil
+	for _, scope := range session.Scopes {
+		if contains(scope, requested) {
+			narrowed.Scopes = append(narrowed.Scopes, scope)
+		}
+	}
+	return &narrowed, true
+}
+
+func (m *MockOIDC) setTokens(tr *tokenResponse, s *Session, grantType string, req *http.Request) error {
+	kp, err := m.signingKeypair()
+	if err != nil {
+		return err
+	}
+	now := m.Now().Add(m.popTokenSkew())
+	invalid := m.popInvalidToken()
+	config := m.sessionConfig(s, req)
+	accessTTL := m.AccessTTL
+	if ttl, ok := m.popAccessTokenTTL(); ok {
+		config.IDTokenTTL = config.idTokenTTL()
+		config.AccessTTL, accessTTL = ttl, ttl
+		tr.ExpiresIn = ttlSeconds(ttl)
+	}
+	if m.PlainOAuth2 {
+		tr.AccessToken, err = m.nonce(30)
+		tr.Scope = strings.Join(s.Scopes, " ")
+	} else if tr.AccessToken, err = s.AccessToken(config, kp, now); err == nil {
+		tr.AccessToken, err = invalidate(invalid, tr.AccessToken, kp, now)
+	}
 	if err != nil {
 		return err
 	}
-	if len(s.Scopes) > 0 && s.Scopes[0] == openidScope {
-		tr.IDToken, err = s.IDToken(m.Config(), m.Keypair, m.Now())
+	m.recordToken(AccessTokenType, tr.AccessToken, s, grantType, now, accessTTL)
+	if !m.PlainOAuth2 && len(s.Scopes) > 0 && s.Scopes[0] == openidScope {
+		tr.IDToken, err = s.IDToken(config, kp, now)
 		if err != nil {
 			return err
 		}
+		tr.IDToken, err = invalidate(invalid, tr.IDToken, kp, now)
+		if err != nil {
+			return err
+		}
+		m.recordToken(IDTokenType, tr.IDToken, s, grantType, now, config.idTokenTTL())
 	}
-	if grantType != "refresh_token" {
-		tr.RefreshToken, err = s.RefreshToken(m.Config(), m.Keypair, m.Now())
+	if grantType != "refresh_token" && m.issueRefreshToken(s) {
+		tr.RefreshToken, err = s.RefreshToken(config, kp, now)
 		if err != nil {
 			return err
 		}
+		m.recordToken(RefreshTokenType, tr.RefreshToken, s, grantType, now, m.RefreshTTL)
 	}
 	return nil
 }
 
+func (m *MockOIDC) issueRefreshToken(s *Session) bool {
+	return !m.RequireOfflineAccess || contains(offlineAccessScope, s.Scopes)
+}
+
 // Userinfo returns the User details for the User associated with the passed
 // Access Token. Data is scoped down to the session's access scope set in the
-// initial `authorization_endpoint` call.
+// initial `authorization_endpoint` call. It accepts GET & POST requests with
+// the Access Token in any of the RFC 6750 locations.
 func (m *MockOIDC) Userinfo(rw http.ResponseWriter, req *http.Request) {
-	token, authorized := m.authorizeBearer(rw, req)
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		rw.Header().Set("Allow", "GET, POST")
+		ErrInvalidRequest.Describe("Unsupported method: %s", req.Method).
+			WithStatus(http.StatusMethodNotAllowed).Write(rw)
+		return
+	}
+
+	session, authorized := m.authorizeBearer(rw, req)
 	if !authorized {
 		return
 	}
+	if m.StrictValidation && !m.PlainOAuth2 && !contains(openidScope, session.Scopes) {
+		rw.Header().Set("WWW-Authenticate",
+			bearerChallenge(InsufficientScope, "The openid scope is required")+`, scope="openid"`)
+		ErrInsufficientScope.Describe("The openid scope is required").Write(rw)
+		return
+	}
 
-	session, err := m.SessionStore.GetSessionByToken(token)
+	resp, err := session.User.Userinfo(session.ClaimScopes(m.Config()))
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
+	if alg, ok := m.UserinfoSignedResponseAlg[session.ClientID]; ok {
+		if !contains(alg, UserinfoSigningAlgValuesSupported) {
+			internalServerError(rw, fmt.Sprintf(
+				"Unsupported userinfo_signed_response_alg: %s", alg))
+			return
+		}
+		m.signedUserinfoResponse(rw, req, session, resp)
+		return
+	}
+	if m.wantsJWT(req) {
+		m.signedUserinfoResponse(rw, req, session, resp)
+		return
+	}
+	jsonResponse(rw, resp)
+}
 
-	resp, err := session.User.Userinfo(session.Scopes)
-	if err != nil {
+// signedUserinfoResponse responds with the Userinfo JSON as the claims of
+// a JWT signed by the server Keypair.
+func (m *MockOIDC) signedUserinfoResponse(rw http.ResponseWriter, req *http.Request, session *Session, userinfo []byte) {
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(userinfo, &claims); err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
-	jsonResponse(rw, resp)
+	claims["sub"] = session.User.ID()
+	claims["iss"] = m.sessionConfig(session, req).Issuer
+	claims["aud"] = m.ClientID
+	if session.ClientID != "" {
+		claims["aud"] = session.ClientID
+	}
+
+	m.jwtResponse(rw, claims)
 }
 
 type discoveryResponse struct {
@@ -342,46 +856,102 @@ type discoveryResponse struct {
 
 	GrantTypesSupported               []string `json:"grant_types_supported"`
 	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
 	SubjectTypesSupported             []string `json:"subject_types_supported"`
 	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	UserinfoSigningAlgValuesSupported []string `json:"userinfo_signing_alg_values_supported"`
 	ScopesSupported                   []string `json:"scopes_supported"`
 	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
 	ClaimsSupported                   []string `json:"claims_supported"`
 	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ACRValuesSupported                []string `json:"acr_values_supported,omitempty"`
+	RequestParameterSupported         bool     `json:"request_parameter_supported"`
+	RequestURIParameterSupported      bool     `json:"request_uri_parameter_supported"`
+	SubjectSyntaxTypesSupported       []string `json:"subject_syntax_types_supported,omitempty"`
+	SignedJWKSUri                     string   `json:"signed_jwks_uri,omitempty"`
 }
 
 // Discovery renders the OIDC discovery document and partial RFC-8414 authorization
 // server metadata hosted at `/.well-known/openid-configuration`.
-func (m *MockOIDC) Discovery(rw http.ResponseWriter, _ *http.Request) {
+func (m *MockOIDC) Discovery(rw http.ResponseWriter, req *http.Request) {
+	document, err := m.discoveryDocument(req)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	resp, err := json.Marshal(document)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// discovery builds the discovery document for the MockOIDC or the
+// ScopedMock a request was made to.
+func (m *MockOIDC) discovery(req *http.Request) *discoveryResponse {
+	endpoint := func(path string) string {
+		if scope := requestScope(req); scope != nil {
+			return scope.endpointFor(req, path)
+		}
+		return m.endpointFor(req, path)
+	}
 	discovery := &discoveryResponse{
-		Issuer:                m.Issuer(),
-		AuthorizationEndpoint: m.AuthorizationEndpoint(),
-		TokenEndpoint:         m.TokenEndpoint(),
-		JWKSUri:               m.JWKSEndpoint(),
-		UserinfoEndpoint:      m.UserinfoEndpoint(),
+		Issuer:                endpoint(IssuerBase),
+		AuthorizationEndpoint: endpoint(AuthorizationEndpoint),
+		TokenEndpoint:         endpoint(TokenEndpoint),
+		JWKSUri:               endpoint(JWKSEndpoint),
+		UserinfoEndpoint:      endpoint(UserinfoEndpoint),
 
 		GrantTypesSupported:               GrantTypesSupported,
 		ResponseTypesSupported:            ResponseTypesSupported,
+		ResponseModesSupported:            ResponseModesSupported,
 		SubjectTypesSupported:             SubjectTypesSupported,
 		IDTokenSigningAlgValuesSupported:  IDTokenSigningAlgValuesSupported,
+		UserinfoSigningAlgValuesSupported: UserinfoSigningAlgValuesSupported,
 		ScopesSupported:                   ScopesSupported,
 		TokenEndpointAuthMethodsSupported: TokenEndpointAuthMethodsSupported,
 		ClaimsSupported:                   ClaimsSupported,
 		CodeChallengeMethodsSupported:     m.CodeChallengeMethodsSupported,
+		ACRValuesSupported:                m.ACRValuesSupported,
+		RequestParameterSupported:         m.ClientPublicKey != nil,
+		RequestURIParameterSupported:      m.ClientPublicKey != nil,
+	}
+	if m.SelfIssued {
+		discovery.SubjectSyntaxTypesSupported = []string{SubjectSyntaxJWKThumbprint}
+	}
+	if m.Federation {
+		discovery.SignedJWKSUri = endpoint(SignedJWKSEndpoint)
 	}
+	return discovery
+}
 
-	resp, err := json.Marshal(discovery)
+// discoveryDocument is the discovery document with the DiscoveryOverrides
+// applied. Overrides with a nil value remove the field.
+func (m *MockOIDC) discoveryDocument(req *http.Request) (map[string]interface{}, error) {
+	data, err := json.Marshal(m.discovery(req))
 	if err != nil {
-		internalServerError(rw, err.Error())
-		return
+		return nil, err
 	}
-	jsonResponse(rw, resp)
+	document := map[string]interface{}{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	for field, value := range m.DiscoveryOverrides {
+		if value == nil {
+			delete(document, field)
+		} else {
+			document[field] = value
+		}
+	}
+	return document, nil
 }
 
 // JWKS returns the public key in JWKS format to verify in tokens
-// signed with our Keypair.PrivateKey.
+// signed with our Keypair.PrivateKey, along with any retired Keypairs.
 func (m *MockOIDC) JWKS(rw http.ResponseWriter, _ *http.Request) {
-	jwks, err := m.Keypair.JWKS()
+	jwks, err := m.jwks()
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
@@ -390,40 +960,178 @@ func (m *MockOIDC) JWKS(rw http.ResponseWriter, _ *http.Request) {
 	jsonResponse(rw, jwks)
 }
 
-func (m *MockOIDC) authorizeBearer(rw http.ResponseWriter, req *http.Request) (*jwt.Token, bool) {
-	header := req.Header.Get("Authorization")
-	parts := strings.SplitN(header, " ", 2)
-	if len(parts) < 2 || parts[0] != "Bearer" {
-		errorResponse(rw, InvalidRequest, "Invalid authorization header",
-			http.StatusUnauthorized)
+// authorizeBearer verifies the RFC 6750 bearer token of a request is live
+// and for our client and returns its Session. Failures respond
+// with a `WWW-Authenticate` challenge.
+func (m *MockOIDC) authorizeBearer(rw http.ResponseWriter, req *http.Request) (*Session, bool) {
+	t, err := bearerToken(req)
+	if err != nil {
+		rw.Header().Set("WWW-Authenticate", bearerChallenge(InvalidRequest, err.Error()))
+		ErrInvalidRequest.Describe(err.Error()).Write(rw)
 		return nil, false
 	}
+	m.lintQuery(req)
+	if t == "" {
+		rw.Header().Set("WWW-Authenticate", bearerChallenge("", ""))
+		ErrInvalidRequest.Describe("Missing bearer token").
+			WithStatus(http.StatusUnauthorized).Write(rw)
+		return nil, false
+	}
+
+	session, err := m.verifyAccessToken(t)
+	if err != nil {
+		rw.Header().Set("WWW-Authenticate", bearerChallenge(InvalidToken, err.Error()))
+		ErrInvalidBearerToken.Describe(err.Error()).Write(rw)
+		return nil, false
+	}
+	return m.tokenSession(t, session), true
+}
+
+// verifyAccessToken checks a token beyond its signature & expiry: it must
+// be an access token for our client, from a Session that wasn't revoked.
+// Refresh & ID tokens are rejected: they are issued as other types in the
+// IssuedToken registry and, like any token without a `scope` claim, aren't
+// access tokens. Opaque PlainOAuth2 tokens are looked up in the
+// IssuedToken registry instead.
+func (m *MockOIDC) verifyAccessToken(t string) (*Session, error) {
+	if session, opaque, err := m.verifyOpaqueToken(t); opaque {
+		return session, err
+	}
+
+	token, err := m.verifyToken(t)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if !m.verifyAccessTokenAudience(claims) {
+		return nil, fmt.Errorf("The token audience is invalid")
+	}
+
+	session, err := m.SessionStore.GetSessionByToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("The token session is invalid")
+	}
+	if session.Revoked {
+		return nil, fmt.Errorf("The token is revoked")
+	}
+	scope, ok := claims["scope"].(string)
+	if issued, found := m.issuedToken(t); !ok || found && issued.Type != AccessTokenType {
+		return nil, fmt.Errorf("The token is not an access token")
+	}
+	return tokenScopes(session, scope), nil
+}
+
+// tokenScopes returns the Session narrowed down to the `scope` claim of
+// its access token, so scopes narrowed by a `refresh_token` grant hold
+// with any SessionStore and on any replica. The claim never widens them.
+func tokenScopes(session *Session, scope string) *Session {
+	granted := strings.Fields(scope)
+	narrowed := *session
+	narrowed.Scopes = nil
+	for _, scope := range session.Scopes {
+		if contains(scope, granted) {
+			narrowed.Scopes = append(narrowed.Scopes, scope)
+		}
+	}
+	return &narrowed
+}
+
+// bearerToken extracts the token from the Authorization header, the form
+// body of POST requests or the `access_token` query parameter. Clients
+// must use exactly one of them.
+func bearerToken(req *http.Request) (string, error) {
+	if err := req.ParseForm(); err != nil {
+		return "", err
+	}
+
+	var tokens []string
+	if header := req.Header.Get("Authorization"); header != "" {
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) < 2 || !strings.EqualFold(parts[0], "Bearer") {
+			return "", fmt.Errorf("Invalid authorization header")
+		}
+		tokens = append(tokens, parts[1])
+	}
+	if token := req.PostForm.Get("access_token"); token != "" {
+		tokens = append(tokens, token)
+	}
+	if req.URL != nil {
+		if token := req.URL.Query().Get("access_token"); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+
+	switch len(tokens) {
+	case 0:
+		return "", nil
+	case 1:
+		return tokens[0], nil
+	default:
+		return "", fmt.Errorf("Multiple bearer token methods used")
+	}
+}
 
-	return m.authorizeToken(parts[1], rw)
+// bearerChallenge builds an RFC 6750 `WWW-Authenticate` header value. Requests
+// without any credentials get a challenge without an error code.
+func bearerChallenge(errorCode, description string) string {
+	challenge := `Bearer realm="mockoidc"`
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error="%s"`, errorCode)
+	}
+	if description = challengeText(description); description != "" {
+		challenge += fmt.Sprintf(`, error_description="%s"`, description)
+	}
+	return challenge
+}
+
+// challengeText drops the characters RFC 6750 doesn't allow in challenge
+// attribute values, double quotes become single ones.
+func challengeText(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '"':
+			return '\''
+		case r == '\\' || r < 0x20 || r > 0x7e:
+			return -1
+		}
+		return r
+	}, text)
 }
 
 func (m *MockOIDC) authorizeToken(t string, rw http.ResponseWriter) (*jwt.Token, bool) {
-	token, err := m.Keypair.VerifyJWT(t)
+	token, err := m.verifyToken(t)
 	if err != nil {
-		errorResponse(rw, InvalidRequest, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
+		ErrInvalidRequest.Describe(err.Error()).WithStatus(http.StatusUnauthorized).Write(rw)
 		return nil, false
 	}
+	return token, true
+}
+
+// verifyToken checks the signature and expiry of a token
+func (m *MockOIDC) verifyToken(t string) (*jwt.Token, error) {
+	token, err := m.verifyJWT(t)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid token: %v", err)
+	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		internalServerError(rw, "Unable to extract token claims")
-		return nil, false
+		return nil, fmt.Errorf("Unable to extract token claims")
 	}
 	exp, ok := claims["exp"].(float64)
 	if !ok {
-		internalServerError(rw, "Unable to extract token expiration")
-		return nil, false
+		return nil, fmt.Errorf("Unable to extract token expiration")
 	}
-	if m.Now().Unix() > int64(exp) {
-		errorResponse(rw, InvalidRequest, "The token is expired", http.StatusUnauthorized)
-		return nil, false
+	expired := m.Now().Unix() > int64(exp)
+	// Tokens we issued expire at their exact (sub-second) TTL
+	if issued, ok := m.issuedToken(t); ok {
+		expired = issued.Expired || !m.Now().Before(issued.ExpiresAt)
 	}
-	return token, true
+	if expired {
+		return nil, fmt.Errorf("The token is expired")
+	}
+	return token, nil
 }
 
 func assertPresence(params []string, rw http.ResponseWriter, req *http.Request) bool {
@@ -431,12 +1139,8 @@ func assertPresence(params []string, rw http.ResponseWriter, req *http.Request)
 		if req.Form.Get(param) != "" {
 			continue
 		}
-		errorResponse(
-			rw,
-			InvalidRequest,
-			fmt.Sprintf("The request is missing the required parameter: %s", param),
-			http.StatusBadRequest,
-		)
+		ErrInvalidRequest.Describe("The request is missing the required parameter: %s", param).
+			Write(rw)
 		return false
 	}
 	return true
@@ -445,8 +1149,7 @@ func assertPresence(params []string, rw http.ResponseWriter, req *http.Request)
 func assertEqual(param, value, errorType, errorMsg string, rw http.ResponseWriter, req *http.Request) bool {
 	formValue := req.Form.Get(param)
 	if subtle.ConstantTimeCompare([]byte(value), []byte(formValue)) == 0 {
-		errorResponse(rw, errorType, fmt.Sprintf("%s: %s", errorMsg, formValue),
-			http.StatusUnauthorized)
+		NewOAuthError(errorType, fmt.Sprintf("%s: %s", errorMsg, formValue), http.StatusUnauthorized).Write(rw)
 		return false
 	}
 	return true
@@ -461,44 +1164,133 @@ func validateScope(rw http.ResponseWriter, req *http.Request) bool {
 	scopes := strings.Split(req.Form.Get("scope"), " ")
 	for _, scope := range scopes {
 		if _, ok := allowed[scope]; !ok {
-			errorResponse(rw, InvalidScope, fmt.Sprintf("Unsupported scope: %s", scope),
-				http.StatusBadRequest)
+			ErrInvalidScope.Describe("Unsupported scope: %s", scope).Write(rw)
 			return false
 		}
 	}
 	return true
 }
 
+// selectACR picks the first requested `acr_values` entry the server
+// supports. Without `acr_values`, the server default ACR is used.
+func (m *MockOIDC) selectACR(rw http.ResponseWriter, req *http.Request) (string, bool) {
+	requested := strings.Fields(req.Form.Get("acr_values"))
+	if len(requested) == 0 {
+		return m.ACR, true
+	}
+	if len(m.ACRValuesSupported) == 0 {
+		return requested[0], true
+	}
+	for _, acr := range requested {
+		if contains(acr, m.ACRValuesSupported) {
+			return acr, true
+		}
+	}
+	ErrUnmetAuthenticationRequirements.Describe("Unsupported acr values: %s", req.Form.Get("acr_values")).
+		Write(rw)
+	return "", false
+}
+
 func validateCodeChallengeMethodSupported(rw http.ResponseWriter, method string, supportedMethods []string) bool {
 	if method != "" && !contains(method, supportedMethods) {
-		errorResponse(rw, InvalidRequest, "Invalid code challenge method", http.StatusBadRequest)
+		ErrInvalidRequest.Describe("Invalid code challenge method").Write(rw)
 		return false
 	}
 	return true
 }
 
-func errorResponse(rw http.ResponseWriter, error, description string, statusCode int) {
-	errJSON := map[string]string{
-		"error":             error,
-		"error_description": description,
+// authorizeRedirect sends the client back to its `redirect_uri` with the
+// passed params and the request `state`. With `response_mode=form_post`
+// the params are POSTed by an auto-submitting form instead.
+func authorizeRedirect(rw http.ResponseWriter, req *http.Request, params url.Values) {
+	redirectURI, err := url.Parse(req.Form.Get("redirect_uri"))
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
 	}
-	resp, err := json.Marshal(errJSON)
+	if req.Form.Get("response_mode") == ResponseModeFormPost {
+		params.Set("state", req.Form.Get("state"))
+		formPostResponse(rw, redirectURI.String(), params)
+		return
+	}
+	query, _ := url.ParseQuery(redirectURI.RawQuery)
+	for key, values := range params {
+		query[key] = values
+	}
+	query.Set("state", req.Form.Get("state"))
+	redirectURI.RawQuery = query.Encode()
+
+	http.Redirect(rw, req, redirectURI.String(), http.StatusFound)
+}
+
+var formPostTemplate = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Submit This Form</title></head>
+<body onload="javascript:document.forms[0].submit()">
+<form method="post" action="{{ .Action }}">
+{{- range $key, $values := .Params }}{{ range $values }}
+<input type="hidden" name="{{ $key }}" value="{{ . }}"/>
+{{- end }}{{ end }}
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>
+`))
+
+func formPostResponse(rw http.ResponseWriter, action string, params url.Values) {
+	var body bytes.Buffer
+	err := formPostTemplate.Execute(&body, struct {
+		Action string
+		Params url.Values
+	}{action, params})
 	if err != nil {
-		http.Error(rw, error, http.StatusInternalServerError)
+		internalServerError(rw, err.Error())
+		return
 	}
 
 	noCache(rw)
-	rw.Header().Set("Content-Type", applicationJSON)
-	rw.WriteHeader(statusCode)
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
 
-	_, err = rw.Write(resp)
-	if err != nil {
-		panic(err)
+	_, _ = rw.Write(body.Bytes())
+}
+
+// errorRedirect is a ResponseWriter errorResponse redirects the errors of
+// an `authorization_endpoint` request to the client `redirect_uri` on.
+type errorRedirect struct {
+	http.ResponseWriter
+	req *http.Request
+}
+
+// authorizeErrors returns the ResponseWriter `authorization_endpoint`
+// errors are written to. With RedirectAuthorizeErrors, requests from the
+// client with a `redirect_uri` get their errors redirected to it per
+// RFC 6749 section 4.1.2.1, others get an error response.
+func (m *MockOIDC) authorizeErrors(rw http.ResponseWriter, req *http.Request) http.ResponseWriter {
+	if !m.RedirectAuthorizeErrors || req.Form.Get("redirect_uri") == "" {
+		return rw
+	}
+	clientID := req.Form.Get("client_id")
+	if subtle.ConstantTimeCompare([]byte(clientID), []byte(m.ClientID)) == 0 {
+		return rw
+	}
+	if _, err := url.Parse(req.Form.Get("redirect_uri")); err != nil {
+		return rw
 	}
+	return &errorRedirect{ResponseWriter: rw, req: req}
+}
+
+// authorizeError redirects an `authorization_endpoint` error to the
+// client `redirect_uri`.
+func authorizeError(rw http.ResponseWriter, req *http.Request, error, description string) {
+	params := url.Values{}
+	params.Set("error", error)
+	params.Set("error_description", description)
+	authorizeRedirect(rw, req, params)
 }
 
 func internalServerError(rw http.ResponseWriter, errorMsg string) {
-	errorResponse(rw, InternalServerError, errorMsg, http.StatusInternalServerError)
+	ErrInternalServerError.Describe(errorMsg).Write(rw)
 }
 
 func jsonResponse(rw http.ResponseWriter, data []byte) {
@@ -506,10 +1298,7 @@ func jsonResponse(rw http.ResponseWriter, data []byte) {
 	rw.Header().Set("Content-Type", applicationJSON)
 	rw.WriteHeader(http.StatusOK)
 
-	_, err := rw.Write(data)
-	if err != nil {
-		panic(err)
-	}
+	_, _ = rw.Write(data)
 }
 
 func noCache(rw http.ResponseWriter) {
@@ -11,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/oauth2-proxy/mockoidc"
 	"github.com/stretchr/testify/assert"
 )
@@ -67,6 +68,369 @@ func TestMockOIDC_Authorize(t *testing.T) {
 	}
 }
 
+func TestMockOIDC_Authorize_Post(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize,
+		http.MethodPost, authorizeData(m))
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, "testState", location.Query().Get("state"))
+
+	session, err := m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"openid"}, session.Scopes)
+
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize,
+		http.MethodPut, authorizeData(m))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, POST", rr.Header().Get("Allow"))
+
+	// strict validation requires a form encoded body
+	m.StrictValidation = true
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize,
+		http.MethodPost, authorizeData(m))
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	req := httptest.NewRequest(http.MethodPost, mockoidc.AuthorizationEndpoint,
+		strings.NewReader(`{"scope": "openid"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	m.Authorize(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Unsupported Content-Type: application/json")
+}
+
+func TestMockOIDC_Authorize_ACR(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ACR = "default"
+	m.AMR = []string{"pwd"}
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	// no acr_values gets the default
+	m.QueueCode("default-code")
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	session, err := m.SessionStore.GetSessionByID("default-code")
+	assert.NoError(t, err)
+	assert.Equal(t, "default", session.ACR)
+	assert.Equal(t, []string{"pwd"}, session.AMR)
+
+	// requested acr_values are honored
+	m.ACRValuesSupported = []string{"silver", "gold"}
+	data.Set("acr_values", "platinum gold")
+	m.QueueCode("gold-code")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	session, err = m.SessionStore.GetSessionByID("gold-code")
+	assert.NoError(t, err)
+	assert.Equal(t, "gold", session.ACR)
+
+	idToken, err := session.IDToken(m.Config(), m.Keypair, m.Now())
+	assert.NoError(t, err)
+	token, err := m.Keypair.VerifyJWT(idToken)
+	assert.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, "gold", claims["acr"])
+	assert.Equal(t, []interface{}{"pwd"}, claims["amr"])
+
+	// unsupported acr_values are rejected
+	data.Set("acr_values", "platinum")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	body, err := ioutil.ReadAll(rr.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), mockoidc.UnmetAuthenticationRequirements)
+}
+
+func TestMockOIDC_Authorize_MaxAge(t *testing.T) {
+	setTime()
+	defer resetTime()
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	reset := m.Synchronize()
+	defer reset()
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	authorize := func(code string) *httptest.ResponseRecorder {
+		m.QueueCode(code)
+		return testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+			m.Authorize, http.MethodGet, nil)
+	}
+
+	// first login sets auth_time
+	rr := authorize("first")
+	assert.Equal(t, http.StatusFound, rr.Code)
+	first, err := m.SessionStore.GetSessionByID("first")
+	assert.NoError(t, err)
+	assert.Equal(t, m.Now(), first.AuthTime)
+
+	// within max_age reuses the login
+	m.FastForward(time.Minute)
+	data.Set("max_age", "120")
+	rr = authorize("second")
+	assert.Equal(t, http.StatusFound, rr.Code)
+	second, err := m.SessionStore.GetSessionByID("second")
+	assert.NoError(t, err)
+	assert.Equal(t, first.AuthTime, second.AuthTime)
+
+	idToken, err := second.IDToken(m.Config(), m.Keypair, m.Now())
+	assert.NoError(t, err)
+	token, err := m.Keypair.VerifyJWT(idToken)
+	assert.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, float64(first.AuthTime.Unix()), claims["auth_time"])
+
+	// exceeded max_age logs in again
+	data.Set("max_age", "30")
+	rr = authorize("third")
+	assert.Equal(t, http.StatusFound, rr.Code)
+	third, err := m.SessionStore.GetSessionByID("third")
+	assert.NoError(t, err)
+	assert.Equal(t, m.Now(), third.AuthTime)
+
+	// or returns login_required
+	m.MaxAgeLoginRequired = true
+	m.FastForward(time.Minute)
+	rr = authorize("fourth")
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.LoginRequired, location.Query().Get("error"))
+	assert.Equal(t, "testState", location.Query().Get("state"))
+
+	// invalid max_age
+	data.Set("max_age", "forever")
+	rr = authorize("fifth")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestMockOIDC_Authorize_Prompt(t *testing.T) {
+	setTime()
+	defer resetTime()
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	authorize := func(prompt string) (*httptest.ResponseRecorder, url.Values) {
+		data.Set("prompt", prompt)
+		rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+			m.Authorize, http.MethodGet, nil)
+		location, err := url.Parse(rr.Header().Get("Location"))
+		assert.NoError(t, err)
+		return rr, location.Query()
+	}
+
+	// prompt=none without a login, which doesn't use up the queued Users
+	m.QueueUser(mockoidc.DefaultUser())
+	m.QueueClientUser(m.ClientID, mockoidc.DefaultUser())
+	_, query := authorize(mockoidc.PromptNone)
+	assert.Equal(t, mockoidc.LoginRequired, query.Get("error"))
+	assert.Equal(t, 2, m.QueuedUsers())
+
+	// an interactive login
+	_, query = authorize(mockoidc.PromptConsent + " " + mockoidc.PromptSelectAccount)
+	assert.NotEmpty(t, query.Get("code"))
+	assert.Equal(t, 1, m.QueuedUsers())
+	assert.Nil(t, m.ClientUserQueue(m.ClientID).Peek())
+	session, err := m.SessionStore.GetSessionByID(query.Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{mockoidc.PromptConsent, mockoidc.PromptSelectAccount}, session.Prompts)
+	loginTime := session.AuthTime
+
+	// prompt=none reuses the login
+	m.FastForward(time.Minute)
+	_, query = authorize(mockoidc.PromptNone)
+	session, err = m.SessionStore.GetSessionByID(query.Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, loginTime, session.AuthTime)
+
+	// unless interaction is required
+	m.InteractionRequired = true
+	_, query = authorize(mockoidc.PromptNone)
+	assert.Equal(t, mockoidc.InteractionRequired, query.Get("error"))
+
+	// prompt=login forces a new login
+	_, query = authorize(mockoidc.PromptLogin)
+	session, err = m.SessionStore.GetSessionByID(query.Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, m.Now(), session.AuthTime)
+
+	// invalid prompts
+	for _, prompt := range []string{"none login", "unknown"} {
+		rr, _ := authorize(prompt)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestMockOIDC_Authorize_LoginHint(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	alice := &mockoidc.MockUser{Subject: "alice", Email: "alice@example.com"}
+	bob := &mockoidc.MockUser{Subject: "bob", Email: "bob@example.com"}
+	assert.NoError(t, m.AddUser(alice))
+	assert.NoError(t, m.AddUser(bob))
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	testCases := map[string]struct {
+		LoginHint    string
+		ExpectedUser string
+	}{
+		"by subject":   {LoginHint: "bob", ExpectedUser: "bob"},
+		"by email":     {LoginHint: "alice@example.com", ExpectedUser: "alice"},
+		"unknown hint": {LoginHint: "carol", ExpectedUser: mockoidc.DefaultUser().Subject},
+		"no hint":      {LoginHint: "", ExpectedUser: mockoidc.DefaultUser().Subject},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			data.Set("login_hint", tc.LoginHint)
+			m.QueueCode(name)
+			rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+				m.Authorize, http.MethodGet, nil)
+			assert.Equal(t, http.StatusFound, rr.Code)
+
+			session, err := m.SessionStore.GetSessionByID(name)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.ExpectedUser, session.User.ID())
+		})
+	}
+}
+
+func TestMockOIDC_Authorize_NilUserStore(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.UserStore = nil
+	m.LoginPage = true
+
+	data := authorizeData(m)
+	data.Set("login_hint", "alice")
+	_, interaction := showPage(t, m, data)
+	form := url.Values{
+		"interaction": {interaction},
+		"username":    {"alice"},
+		"password":    {"hunter2"},
+	}
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, form)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid username or password")
+
+	assert.NoError(t, m.Restore(m.Snapshot()))
+
+	// AddUser creates a MemoryUserStore
+	assert.NoError(t, m.AddUser(&mockoidc.MockUser{Subject: "alice", Password: "hunter2"}))
+	assert.IsType(t, &mockoidc.MemoryUserStore{}, m.UserStore)
+	_, interaction = showPage(t, m, data)
+	form.Set("interaction", interaction)
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, form)
+	assert.Equal(t, http.StatusFound, rr.Code)
+}
+
+func TestMockOIDC_Authorize_FormPost(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "https://example.com/callback")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+	data.Set("response_mode", mockoidc.ResponseModeFormPost)
+
+	m.QueueCode("form-code")
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+
+	body := rr.Body.String()
+	assert.Contains(t, body, `action="https://example.com/callback"`)
+	assert.Contains(t, body, `name="code" value="form-code"`)
+	assert.Contains(t, body, `name="state" value="testState"`)
+
+	// unknown response modes are rejected
+	data.Set("response_mode", "fragment")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestMockOIDC_Authorize_RedirectErrors(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(mockoidc.StrictSpec())
+	assert.True(t, m.RedirectAuthorizeErrors)
+
+	authorize := func(data url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, mockoidc.AuthorizationEndpoint+"?"+data.Encode(), nil)
+		rr := httptest.NewRecorder()
+		m.Authorize(rr, req)
+		return rr
+	}
+
+	data := authorizeData(m)
+	data.Set("scope", "openid unknown")
+	rr := authorize(data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.InvalidScope, location.Query().Get("error"))
+	assert.Equal(t, "Unsupported scope: unknown", location.Query().Get("error_description"))
+	assert.Equal(t, "testState", location.Query().Get("state"))
+
+	data = authorizeData(m)
+	data.Set("max_age", "-1")
+	rr = authorize(data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	// errors aren't redirected to unverified redirect URIs
+	data = authorizeData(m)
+	data.Set("client_id", "unknown")
+	data.Set("scope", "openid unknown")
+	assert.Equal(t, http.StatusBadRequest, authorize(data).Code)
+	data = authorizeData(m)
+	data.Del("redirect_uri")
+	assert.Equal(t, http.StatusBadRequest, authorize(data).Code)
+
+	m.RedirectAuthorizeErrors = false
+	data = authorizeData(m)
+	data.Set("scope", "openid unknown")
+	assert.Equal(t, http.StatusBadRequest, authorize(data).Code)
+}
+
 func TestMockOIDC_Token_CodeGrant(t *testing.T) {
 	m, err := mockoidc.NewServer(nil)
 	assert.NoError(t, err)
@@ -143,6 +507,39 @@ func TestMockOIDC_Token_CodeGrant(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, rrDup.Code)
 }
 
+func TestMockOIDC_Token_CodeGrant_RequireOfflineAccess(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.RequireOfflineAccess = true
+
+	for scope, expectRefresh := range map[string]bool{
+		"openid email":                false,
+		"openid email offline_access": true,
+	} {
+		t.Run(scope, func(t *testing.T) {
+			session, err := m.SessionStore.NewSession(
+				scope, "nonce", mockoidc.DefaultUser(), "", "")
+			assert.NoError(t, err)
+
+			data := url.Values{}
+			data.Set("client_id", m.ClientID)
+			data.Set("client_secret", m.ClientSecret)
+			data.Set("code", session.SessionID)
+			data.Set("grant_type", "authorization_code")
+
+			rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			tokenResp := make(map[string]interface{})
+			err = getJSON(rr, &tokenResp)
+			assert.NoError(t, err)
+
+			_, ok := tokenResp["refresh_token"]
+			assert.Equal(t, expectRefresh, ok)
+		})
+	}
+}
+
 func TestMockOIDC_Token_CodeGrant_CodeChallengePlain(t *testing.T) {
 	m, err := mockoidc.NewServer(nil)
 	assert.NoError(t, err)
@@ -243,6 +640,36 @@ func TestMockOIDC_Token_CodeGrant_CodeChallengeHash(t *testing.T) {
 	assert.Contains(t, string(body), mockoidc.InvalidGrant)
 }
 
+func TestMockOIDC_Token_CodeGrant_SkipCodeVerifier(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.SkipCodeVerifier = true
+
+	codeChallenge, err := mockoidc.GenerateCodeChallenge(mockoidc.CodeChallengeMethodS256, "sum")
+	assert.NoError(t, err)
+	session, _ := m.SessionStore.NewSession(
+		"openid email profile", "nonce", mockoidc.DefaultUser(),
+		codeChallenge, mockoidc.CodeChallengeMethodS256)
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+	data.Set("code_verifier", "WRONG")
+
+	// bad verifier is accepted and reported
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, []mockoidc.PKCEDowngrade{{
+		Code:                session.SessionID,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: mockoidc.CodeChallengeMethodS256,
+		CodeVerifier:        "WRONG",
+	}}, m.PKCEDowngrades())
+}
+
 func TestMockOIDC_Token_RefreshGrant(t *testing.T) {
 	m, err := mockoidc.NewServer(nil)
 	assert.NoError(t, err)
@@ -299,6 +726,304 @@ func TestMockOIDC_Token_RefreshGrant(t *testing.T) {
 	assert.Contains(t, string(body), mockoidc.InvalidRequest)
 }
 
+func TestMockOIDC_Token_RefreshDownScoping(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	session, _ := m.SessionStore.NewSession(
+		"openid email profile", "sessionNonce", mockoidc.DefaultUser(), "", "")
+	refreshToken, _ := session.RefreshToken(m.Config(), m.Keypair, m.Now())
+
+	refresh := func(scope string) (int, map[string]interface{}) {
+		data := url.Values{}
+		data.Set("client_id", m.ClientID)
+		data.Set("client_secret", m.ClientSecret)
+		data.Set("refresh_token", refreshToken)
+		data.Set("grant_type", "refresh_token")
+		data.Set("scope", scope)
+		rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+		tokenResp := make(map[string]interface{})
+		assert.NoError(t, getJSON(rr, &tokenResp))
+		return rr.Code, tokenResp
+	}
+
+	code, tokenResp := refresh("email openid")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "openid email", tokenResp["scope"])
+
+	idToken, err := m.Keypair.VerifyJWT(tokenResp["id_token"].(string))
+	assert.NoError(t, err)
+	claims := idToken.Claims.(jwt.MapClaims)
+	assert.Contains(t, claims, "email")
+	assert.NotContains(t, claims, "preferred_username")
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+tokenResp["access_token"].(string))
+	m.Userinfo(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "preferred_username")
+
+	// the access token carries its scopes, so another replica sharing the
+	// SessionStore doesn't widen them
+	accessToken, err := m.Keypair.VerifyJWT(tokenResp["access_token"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, "openid email", accessToken.Claims.(jwt.MapClaims)["scope"])
+	replica, err := mockoidc.NewServer(m.Keypair.PrivateKey)
+	assert.NoError(t, err)
+	replica.ClientID = m.ClientID
+	replica.SessionStore = m.SessionStore
+	rr = httptest.NewRecorder()
+	replica.Userinfo(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "email")
+	assert.NotContains(t, rr.Body.String(), "preferred_username")
+
+	// refresh & ID tokens aren't access tokens, on either replica
+	for _, server := range []*mockoidc.MockOIDC{m, replica} {
+		for _, token := range []string{refreshToken, tokenResp["id_token"].(string)} {
+			rr = httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			server.Userinfo(rr, req)
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+			assert.Contains(t, rr.Body.String(), "The token is not an access token")
+		}
+	}
+
+	// the refresh token keeps the originally granted scopes
+	assert.Equal(t, []string{"openid", "email", "profile"}, session.Scopes)
+	code, tokenResp = refresh("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, tokenResp, "scope")
+
+	code, tokenResp = refresh("openid groups")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, mockoidc.InvalidScope, tokenResp["error"])
+	assert.Equal(t, "The scope exceeds the granted scope: groups", tokenResp["error_description"])
+}
+
+func TestMockOIDC_Token_SubSecondTTL(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.AccessTTL = 200 * time.Millisecond
+
+	session, _ := m.SessionStore.NewSession(
+		"openid email", "sessionNonce", mockoidc.DefaultUser(), "", "")
+	refreshToken, _ := session.RefreshToken(m.Config(), m.Keypair, m.Now())
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	tokenResp := make(map[string]interface{})
+	err = getJSON(rr, &tokenResp)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), tokenResp["expires_in"])
+
+	userinfo := func() int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenResp["access_token"].(string))
+		m.Userinfo(rr, req)
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusOK, userinfo())
+
+	m.FastForward(200 * time.Millisecond)
+	assert.Equal(t, http.StatusUnauthorized, userinfo())
+}
+
+func TestMockOIDC_Token_RefreshLimits(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.RefreshTTL = 24 * time.Hour
+	m.RefreshMaxLifetime = 2 * time.Hour
+	m.RefreshIdleTimeout = 30 * time.Minute
+	reset := m.Synchronize()
+	defer reset()
+
+	login := func() string {
+		session, _ := m.SessionStore.NewSession(
+			"openid", "sessionNonce", mockoidc.DefaultUser(), "", "")
+		data := url.Values{}
+		data.Set("client_id", m.ClientID)
+		data.Set("client_secret", m.ClientSecret)
+		data.Set("code", session.SessionID)
+		data.Set("grant_type", "authorization_code")
+		rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		tokenResp := make(map[string]interface{})
+		assert.NoError(t, getJSON(rr, &tokenResp))
+		return tokenResp["refresh_token"].(string)
+	}
+	refresh := func(refreshToken string) (int, string) {
+		data := url.Values{}
+		data.Set("client_id", m.ClientID)
+		data.Set("client_secret", m.ClientSecret)
+		data.Set("refresh_token", refreshToken)
+		data.Set("grant_type", "refresh_token")
+		rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+
+		tokenResp := make(map[string]interface{})
+		assert.NoError(t, getJSON(rr, &tokenResp))
+		description, _ := tokenResp["error_description"].(string)
+		return rr.Code, description
+	}
+
+	// regular use keeps the session alive until its max lifetime
+	refreshToken := login()
+	for i := 0; i < 4; i++ {
+		m.FastForward(25 * time.Minute)
+		code, _ := refresh(refreshToken)
+		assert.Equal(t, http.StatusOK, code)
+	}
+	m.FastForward(25 * time.Minute)
+	code, description := refresh(refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "Session max lifetime exceeded", description)
+
+	// idle sessions can't be refreshed
+	refreshToken = login()
+	m.FastForward(30 * time.Minute)
+	code, description = refresh(refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, "Session idle timeout exceeded", description)
+}
+
+func TestMockOIDC_MaxSessionsPerUser(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.MaxSessionsPerUser = 2
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	var refreshTokens []string
+	for _, code := range []string{"first", "second", "third"} {
+		m.QueueCode(code)
+		rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+			m.Authorize, http.MethodGet, nil)
+		assert.Equal(t, http.StatusFound, rr.Code)
+
+		session, err := m.SessionStore.GetSessionByID(code)
+		assert.NoError(t, err)
+		refreshToken, err := session.RefreshToken(m.Config(), m.Keypair, m.Now())
+		assert.NoError(t, err)
+		refreshTokens = append(refreshTokens, refreshToken)
+	}
+
+	refresh := url.Values{}
+	refresh.Set("client_id", m.ClientID)
+	refresh.Set("client_secret", m.ClientSecret)
+	refresh.Set("grant_type", "refresh_token")
+
+	// the oldest session was revoked
+	refresh.Set("refresh_token", refreshTokens[0])
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, refresh)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	body, err := ioutil.ReadAll(rr.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), mockoidc.InvalidGrant)
+
+	for _, refreshToken := range refreshTokens[1:] {
+		refresh.Set("refresh_token", refreshToken)
+		rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, refresh)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	// revoked sessions don't count against the limit
+	m.RevokeOnCodeReplay = true
+	code, _ := redeemCode(t, m, "third")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = redeemCode(t, m, "third")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	m.QueueCode("fourth")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	refresh.Set("refresh_token", refreshTokens[1])
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, refresh)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+// copyingSessionStore hands out copies of its sessions, like stores that
+// serialize them do
+type copyingSessionStore struct {
+	*mockoidc.ShardedSessionStore
+}
+
+func (s copyingSessionStore) GetSessionByID(id string) (*mockoidc.Session, error) {
+	session, err := s.ShardedSessionStore.GetSessionByID(id)
+	if err != nil {
+		return nil, err
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func TestMockOIDC_MaxSessionsPerClient(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.SessionStore = copyingSessionStore{mockoidc.NewShardedSessionStore(0)}
+	m.MaxSessionsPerClient = 2
+	m.RevokeOnCodeReplay = true
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	refreshTokens := map[string]string{}
+	login := func(subject string) {
+		m.QueueUser(&mockoidc.MockUser{Subject: subject})
+		m.QueueCode(subject)
+		rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+			m.Authorize, http.MethodGet, nil)
+		assert.Equal(t, http.StatusFound, rr.Code)
+
+		code, tokens := redeemCode(t, m, subject)
+		assert.Equal(t, http.StatusOK, code)
+		refreshTokens[subject], _ = tokens["refresh_token"].(string)
+	}
+	refresh := func(subject string) int {
+		values := url.Values{}
+		values.Set("client_id", m.ClientID)
+		values.Set("client_secret", m.ClientSecret)
+		values.Set("grant_type", "refresh_token")
+		values.Set("refresh_token", refreshTokens[subject])
+		return testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, values).Code
+	}
+
+	login("alice")
+	login("bob")
+	login("carol")
+
+	// the client's oldest session was revoked, whoever it belonged to
+	assert.Equal(t, http.StatusUnauthorized, refresh("alice"))
+	assert.Equal(t, http.StatusOK, refresh("bob"))
+	assert.Equal(t, http.StatusOK, refresh("carol"))
+
+	// sessions revoked since are read back from the store and don't count
+	code, _ := redeemCode(t, m, "bob")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	login("dave")
+	assert.Equal(t, http.StatusOK, refresh("carol"))
+	assert.Equal(t, http.StatusOK, refresh("dave"))
+}
+
 func TestMockOIDC_Discovery(t *testing.T) {
 	m := &mockoidc.MockOIDC{
 		Server: &http.Server{
@@ -319,6 +1044,202 @@ func TestMockOIDC_Discovery(t *testing.T) {
 	assert.Equal(t, oidcCfg["userinfo_endpoint"], m.UserinfoEndpoint())
 	assert.Equal(t, oidcCfg["jwks_uri"], m.JWKSEndpoint())
 	assert.ElementsMatch(t, oidcCfg["code_challenge_methods_supported"], m.CodeChallengeMethodsSupported)
+	assert.ElementsMatch(t, oidcCfg["userinfo_signing_alg_values_supported"], mockoidc.UserinfoSigningAlgValuesSupported)
+}
+
+func TestMockOIDC_Discovery_Overrides(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.BaseURL = "http://127.0.0.1:8080"
+	m.ApplyConfig(&mockoidc.Config{
+		DiscoveryOverrides: map[string]interface{}{
+			"end_session_endpoint":             "http://127.0.0.1:8080/oidc/logout",
+			"code_challenge_methods_supported": []string{"S256"},
+			"request_parameter_supported":      nil,
+		},
+	})
+	m.ApplyConfig(&mockoidc.Config{
+		DiscoveryOverrides: map[string]interface{}{
+			"x_vendor_tenant": "qa",
+		},
+	})
+
+	recorder := httptest.NewRecorder()
+	m.Discovery(recorder, &http.Request{})
+
+	oidcCfg := make(map[string]interface{})
+	err = getJSON(recorder, &oidcCfg)
+	assert.NoError(t, err)
+
+	assert.Equal(t, m.Issuer(), oidcCfg["issuer"])
+	assert.Equal(t, "http://127.0.0.1:8080/oidc/logout", oidcCfg["end_session_endpoint"])
+	assert.Equal(t, []interface{}{"S256"}, oidcCfg["code_challenge_methods_supported"])
+	assert.Equal(t, "qa", oidcCfg["x_vendor_tenant"])
+	assert.NotContains(t, oidcCfg, "request_parameter_supported")
+}
+
+func TestMockOIDC_Userinfo_BearerToken(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	session, err := m.SessionStore.NewSession(
+		"openid email", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	accessToken, err := session.AccessToken(m.Config(), m.Keypair, m.Now())
+	assert.NoError(t, err)
+
+	userinfo := func(method, query, body, header string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, mockoidc.UserinfoEndpoint+"?"+query, strings.NewReader(body))
+		if method == http.MethodPost {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		m.Userinfo(rr, req)
+		return rr
+	}
+	tokenParam := "access_token=" + accessToken
+
+	rr := userinfo(http.MethodGet, "", "", "bearer "+accessToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = userinfo(http.MethodPost, "", tokenParam, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = userinfo(http.MethodGet, tokenParam, "", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	lint := m.SecurityLint()
+	assert.Len(t, lint, 1)
+	assert.Equal(t, mockoidc.LintSecretInQuery, lint[0].Rule)
+
+	rr = userinfo(http.MethodPost, "", tokenParam, "Bearer "+accessToken)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Header().Get("WWW-Authenticate"), `error="invalid_request"`)
+
+	rr = userinfo(http.MethodGet, "", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, `Bearer realm="mockoidc"`, rr.Header().Get("WWW-Authenticate"))
+
+	rr = userinfo(http.MethodGet, "", "", "Bearer invalid")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+	assert.Contains(t, rr.Body.String(), mockoidc.InvalidToken)
+
+	rr = userinfo(http.MethodPut, "", "", "Bearer "+accessToken)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestMockOIDC_Userinfo_InsufficientScope(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	session, err := m.SessionStore.NewSession(
+		"profile email", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	accessToken, err := session.AccessToken(m.Config(), m.Keypair, m.Now())
+	assert.NoError(t, err)
+
+	userinfo := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		m.Userinfo(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusOK, userinfo().Code)
+
+	m.StrictValidation = true
+	rr := userinfo()
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, `Bearer realm="mockoidc", error="insufficient_scope", `+
+		`error_description="The openid scope is required", scope="openid"`,
+		rr.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, rr.Body.String(), mockoidc.InsufficientScope)
+}
+
+func TestMockOIDC_Userinfo_TokenValidation(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	session, err := m.SessionStore.NewSession(
+		"openid email", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	userinfo := func(accessToken string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		m.Userinfo(rr, req)
+		return rr
+	}
+	assertInvalidToken := func(rr *httptest.ResponseRecorder, description string) {
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+		assert.Contains(t, rr.Body.String(), mockoidc.InvalidToken)
+		assert.Contains(t, rr.Body.String(), description)
+	}
+
+	accessToken, err := session.AccessToken(m.Config(), m.Keypair, m.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, userinfo(accessToken).Code)
+
+	// expired
+	expiredToken, err := session.AccessToken(
+		m.Config(), m.Keypair, m.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assertInvalidToken(userinfo(expiredToken), "expired")
+
+	// wrong audience
+	otherConfig := m.Config()
+	otherConfig.ClientID = "other-client"
+	otherToken, err := session.AccessToken(otherConfig, m.Keypair, m.Now())
+	assert.NoError(t, err)
+	assertInvalidToken(userinfo(otherToken), "audience")
+
+	// revoked
+	session.Revoked = true
+	assertInvalidToken(userinfo(accessToken), "revoked")
+}
+
+func TestMockOIDC_Userinfo_SignedResponse(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.UserinfoSignedResponseAlg = map[string]string{"signed-client": "RS256"}
+
+	userinfo := func(clientID string) *httptest.ResponseRecorder {
+		session, err := m.SessionStore.NewSession(
+			"openid email", "nonce", mockoidc.DefaultUser(), "", "")
+		assert.NoError(t, err)
+		session.ClientID = clientID
+		accessToken, err := session.AccessToken(m.Config(), m.Keypair, m.Now())
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		m.Userinfo(rr, req)
+		return rr
+	}
+
+	rr := userinfo("other-client")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	rr = userinfo("signed-client")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/jwt", rr.Header().Get("Content-Type"))
+	token, err := m.Keypair.VerifyJWT(rr.Body.String())
+	assert.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, "signed-client", claims["aud"])
+	assert.Equal(t, mockoidc.DefaultUser().Email, claims["email"])
+
+	m.UserinfoSignedResponseAlg["signed-client"] = "HS256"
+	rr = userinfo("signed-client")
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
 func getJSON(res *httptest.ResponseRecorder, target interface{}) error {
@@ -0,0 +1,64 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Health endpoints for Kubernetes probes & docker-compose healthchecks.
+// They are served outside the issuer and aren't recorded.
+const (
+	HealthEndpoint = "/healthz"
+	ReadyEndpoint  = "/ready"
+)
+
+type healthResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Health reports the server is alive
+func (m *MockOIDC) Health(rw http.ResponseWriter, _ *http.Request) {
+	healthJSON(rw, http.StatusOK, &healthResponse{Status: "ok"})
+}
+
+// Ready reports whether the server can serve OIDC flows: its Keypair is
+// generated and its listener is bound (or its BaseURL is set).
+func (m *MockOIDC) Ready(rw http.ResponseWriter, _ *http.Request) {
+	if reason := m.notReady(); reason != "" {
+		healthJSON(rw, http.StatusServiceUnavailable, &healthResponse{Status: "unavailable", Reason: reason})
+		return
+	}
+	healthJSON(rw, http.StatusOK, &healthResponse{Status: "ok"})
+}
+
+// notReady is the reason the server isn't ready, if any. Both the Keypair
+// and the signing Keypair, the FastKeypair in FastTokens mode, must be
+// usable.
+func (m *MockOIDC) notReady() string {
+	m.mu.Lock()
+	kp := m.Keypair
+	m.mu.Unlock()
+	signing, err := m.signingKeypair()
+	switch {
+	case kp == nil || kp.PrivateKey == nil:
+		return "keypair not generated"
+	case err != nil || signing == nil || signing.PrivateKey == nil:
+		return "signing keypair unavailable"
+	case m.Addr() == "":
+		return "listener not bound"
+	}
+	return ""
+}
+
+func healthJSON(rw http.ResponseWriter, status int, health *healthResponse) {
+	resp, err := json.Marshal(health)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	noCache(rw)
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(status)
+	_, _ = rw.Write(resp)
+}
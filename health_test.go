@@ -0,0 +1,59 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Health(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	handler := m.Handler()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr := get(mockoidc.HealthEndpoint)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, rr.Body.String())
+
+	rr = get(mockoidc.ReadyEndpoint)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"status": "unavailable", "reason": "listener not bound"}`, rr.Body.String())
+
+	m.BaseURL = "http://mockoidc:8080"
+	rr = get(mockoidc.ReadyEndpoint)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// probes aren't recorded
+	assert.Empty(t, m.Requests())
+
+	m.Keypair = nil
+	rr = get(mockoidc.ReadyEndpoint)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "keypair not generated")
+
+	// the real Keypair counts with FastTokens too
+	m.FastTokens = true
+	rr = get(mockoidc.ReadyEndpoint)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "keypair not generated")
+}
+
+func TestMockOIDC_Ready_Started(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	resp, err := http.Get(m.Addr() + mockoidc.ReadyEndpoint)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
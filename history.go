@@ -0,0 +1,140 @@
+package mockoidc
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RecordedRequest is a snapshot of a request the server received. Params
+// & Header are redacted unless DisableRedaction is set.
+type RecordedRequest struct {
+	Method    string
+	Path      string
+	Params    url.Values
+	Header    http.Header
+	Namespace string
+	Time      time.Time
+}
+
+// Requests returns every request received so far, in order
+func (m *MockOIDC) Requests() []RecordedRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RecordedRequest(nil), m.requests...)
+}
+
+// historyOverflow is how many of the oldest entries of a history of the
+// length to drop to get back to the HistoryLimit. Histories are trimmed
+// once they're a quarter over it, so recording stays cheap. m.mu must be
+// held.
+func (m *MockOIDC) historyOverflow(length int) int {
+	if m.HistoryLimit <= 0 || length <= m.HistoryLimit+m.HistoryLimit/4 {
+		return 0
+	}
+	return length - m.HistoryLimit
+}
+
+// FindRequests returns the received requests the filter matches
+func (m *MockOIDC) FindRequests(filter func(RecordedRequest) bool) []RecordedRequest {
+	var found []RecordedRequest
+	for _, req := range m.Requests() {
+		if filter(req) {
+			found = append(found, req)
+		}
+	}
+	return found
+}
+
+// RequestsTo returns the requests received by an endpoint, a path like
+// `mockoidc.TokenEndpoint` or a full URL like `m.TokenEndpoint()`.
+func (m *MockOIDC) RequestsTo(endpoint string) []RecordedRequest {
+	path := m.endpointPath(endpoint)
+	return m.FindRequests(func(req RecordedRequest) bool {
+		return req.Path == path
+	})
+}
+
+// LastRequest returns the latest request received by an endpoint
+func (m *MockOIDC) LastRequest(endpoint string) (RecordedRequest, bool) {
+	requests := m.RequestsTo(endpoint)
+	if len(requests) == 0 {
+		return RecordedRequest{}, false
+	}
+	return requests[len(requests)-1], true
+}
+
+// ClearRequests forgets every received request
+func (m *MockOIDC) ClearRequests() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = nil
+}
+
+// Requests returns every request received through the ScopedMock
+func (s *ScopedMock) Requests() []RecordedRequest {
+	return s.m.FindRequests(func(req RecordedRequest) bool {
+		return req.Namespace == s.Name
+	})
+}
+
+// recordRequests adds every request to the request history
+func (m *MockOIDC) recordRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		recorded := RecordedRequest{
+			Method: req.Method,
+			Time:   m.Now(),
+		}
+		if req.URL != nil {
+			recorded.Path = req.URL.Path
+		}
+		if scope := requestScope(req); scope != nil {
+			recorded.Namespace = scope.Name
+		}
+		// Parsing the form here leaves it in req.Form for the handlers
+		_ = req.ParseForm()
+		if m.DisableRedaction {
+			recorded.Params = cloneValues(req.Form)
+			recorded.Header = req.Header.Clone()
+		} else {
+			recorded.Params = RedactValues(req.Form)
+			recorded.Header = RedactHeader(req.Header)
+		}
+
+		m.mu.Lock()
+		m.requests = append(m.requests, recorded)
+		if drop := m.historyOverflow(len(m.requests)); drop > 0 {
+			m.requests = append([]RecordedRequest(nil), m.requests[drop:]...)
+		}
+		m.mu.Unlock()
+		m.countExpected(recorded)
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+func cloneValues(values url.Values) url.Values {
+	cloned := make(url.Values, len(values))
+	for key, vals := range values {
+		cloned[key] = append([]string(nil), vals...)
+	}
+	return cloned
+}
+
+// endpointPath is the path of an endpoint passed as a path or full URL,
+// mapped from the IssuerPath & EndpointPaths back to the endpoint
+// constants.
+func (m *MockOIDC) endpointPath(endpoint string) string {
+	path := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Path != "" {
+		path = u.Path
+	}
+	if endpoint, ok := m.aliasedEndpoint(path); ok {
+		return endpoint
+	}
+	if issuerPath := m.issuerPath(); issuerPath != IssuerBase && underPath(path, issuerPath) {
+		return IssuerBase + strings.TrimPrefix(path, issuerPath)
+	}
+	return path
+}
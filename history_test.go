@@ -0,0 +1,71 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Requests(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("nonce", "testNonce")
+	data.Set("client_id", m.ClientID)
+	data.Set("code_challenge", "challenge")
+	data.Set("code_challenge_method", "plain")
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + data.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	tokenData := url.Values{}
+	tokenData.Set("client_id", m.ClientID)
+	tokenData.Set("client_secret", m.ClientSecret)
+	tokenData.Set("grant_type", "authorization_code")
+	tokenData.Set("code", "some-code")
+	resp, err = httpClient.PostForm(m.TokenEndpoint(), tokenData)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Len(t, m.Requests(), 2)
+
+	authorize, ok := m.LastRequest(m.AuthorizationEndpoint())
+	assert.True(t, ok)
+	assert.Equal(t, http.MethodGet, authorize.Method)
+	assert.Equal(t, mockoidc.AuthorizationEndpoint, authorize.Path)
+	assert.Equal(t, "testNonce", authorize.Params.Get("nonce"))
+	assert.Equal(t, "challenge", authorize.Params.Get("code_challenge"))
+
+	token, ok := m.LastRequest(mockoidc.TokenEndpoint)
+	assert.True(t, ok)
+	assert.Equal(t, http.MethodPost, token.Method)
+	assert.Equal(t, mockoidc.Redacted, token.Params.Get("client_secret"))
+	assert.Equal(t, "authorization_code", token.Params.Get("grant_type"))
+
+	posts := m.FindRequests(func(req mockoidc.RecordedRequest) bool {
+		return req.Method == http.MethodPost
+	})
+	assert.Len(t, posts, 1)
+
+	_, ok = m.LastRequest(m.UserinfoEndpoint())
+	assert.False(t, ok)
+
+	m.ClearRequests()
+	assert.Empty(t, m.Requests())
+
+	m.DisableRedaction = true
+	resp, err = httpClient.PostForm(m.TokenEndpoint(), tokenData)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	token, _ = m.LastRequest(mockoidc.TokenEndpoint)
+	assert.Equal(t, m.ClientSecret, token.Params.Get("client_secret"))
+}
@@ -0,0 +1,55 @@
+package mockoidc
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// RequestHook is called with each request before its endpoint handles it.
+// Tests can use it to synchronize on server activity or change the
+// MockOIDC behavior for the request.
+type RequestHook func(endpoint string, req *http.Request)
+
+// ResponseHook is called with the status & body of each response after it
+// was written.
+type ResponseHook func(endpoint string, status int, body []byte)
+
+// hooks calls the OnRequest & OnResponse hooks around each request
+func (m *MockOIDC) hooks(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		endpoint := req.URL.Path
+		if m.OnRequest != nil {
+			m.OnRequest(endpoint, req)
+		}
+		if m.OnResponse == nil {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		tee := &teeResponse{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(tee, req)
+		m.OnResponse(endpoint, tee.status, tee.body.Bytes())
+	})
+}
+
+// teeResponse copies the status & body of a response as it's written
+type teeResponse struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (t *teeResponse) WriteHeader(status int) {
+	if !t.wroteHeader {
+		t.wroteHeader = true
+		t.status = status
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *teeResponse) Write(data []byte) (int, error) {
+	t.wroteHeader = true
+	t.body.Write(data)
+	return t.ResponseWriter.Write(data)
+}
@@ -0,0 +1,52 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Hooks(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	var requested []string
+	responses := make(chan int, 1)
+	var body []byte
+	m.ApplyConfig(&mockoidc.Config{
+		OnRequest: func(endpoint string, req *http.Request) {
+			requested = append(requested, endpoint)
+			// Hooks can change the behavior of the request they see
+			if req.URL.Query().Get("fail") != "" {
+				m.QueueError(&mockoidc.ServerError{
+					Code:  http.StatusServiceUnavailable,
+					Error: mockoidc.InternalServerError,
+				})
+			}
+		},
+		OnResponse: func(endpoint string, status int, b []byte) {
+			body = b
+			responses <- status
+		},
+	})
+
+	resp, err := http.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, <-responses)
+	discovery := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(body, &discovery))
+	assert.Equal(t, m.Issuer(), discovery["issuer"])
+
+	resp, err = http.Get(m.JWKSEndpoint() + "?fail=true")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, http.StatusServiceUnavailable, <-responses)
+
+	assert.Equal(t, []string{mockoidc.DiscoveryEndpoint, mockoidc.JWKSEndpoint}, requested)
+}
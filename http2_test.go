@@ -0,0 +1,74 @@
+package mockoidc_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_HTTP2(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.HTTP2 = true
+	m.Chaos = map[string]mockoidc.ChaosRule{
+		mockoidc.JWKSEndpoint:     {ResetRate: 1},
+		mockoidc.UserinfoEndpoint: {GoAwayRate: 1},
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, selfSignedTLSConfig(t)))
+	defer m.Shutdown()
+
+	var dials int32
+	dialer := &net.Dialer{}
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+			ForceAttemptHTTP2: true,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+
+	resp, err := client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+
+	// injected resets abort the stream, not the connection
+	_, err = client.Get(m.JWKSEndpoint())
+	assert.Error(t, err)
+
+	resp, err = client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&dials))
+
+	// an injected GOAWAY lets the response through, then the client has to
+	// open a new connection
+	resp, err = client.Get(m.UserinfoEndpoint())
+	assert.NoError(t, err)
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&dials))
+}
@@ -0,0 +1,177 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	GraphMeEndpoint    = "/v1.0/me"
+	OktaMeEndpoint     = "/api/v1/users/me"
+	GitHubUserEndpoint = "/user"
+)
+
+type graphMeResponse struct {
+	ID                string `json:"id"`
+	DisplayName       string `json:"displayName,omitempty"`
+	GivenName         string `json:"givenName,omitempty"`
+	Surname           string `json:"surname,omitempty"`
+	Mail              string `json:"mail,omitempty"`
+	UserPrincipalName string `json:"userPrincipalName,omitempty"`
+	MobilePhone       string `json:"mobilePhone,omitempty"`
+}
+
+type gitHubUserResponse struct {
+	Login     string      `json:"login"`
+	ID        interface{} `json:"id"`
+	Name      string      `json:"name,omitempty"`
+	Email     string      `json:"email,omitempty"`
+	AvatarURL string      `json:"avatar_url,omitempty"`
+}
+
+type oktaMeResponse struct {
+	ID      string          `json:"id"`
+	Status  string          `json:"status"`
+	Profile oktaUserProfile `json:"profile"`
+}
+
+type oktaUserProfile struct {
+	Login       string `json:"login,omitempty"`
+	FirstName   string `json:"firstName,omitempty"`
+	LastName    string `json:"lastName,omitempty"`
+	Email       string `json:"email,omitempty"`
+	MobilePhone string `json:"mobilePhone,omitempty"`
+}
+
+// GraphMe emulates the Microsoft Graph `/v1.0/me` API for the User
+// associated with the passed Access Token.
+func (m *MockOIDC) GraphMe(rw http.ResponseWriter, req *http.Request) {
+	session, info, ok := m.identityAPIUser(rw, req)
+	if !ok {
+		return
+	}
+
+	principal := info.PreferredUsername
+	if principal == "" {
+		principal = info.Email
+	}
+	displayName := info.Name
+	if displayName == "" {
+		displayName = info.PreferredUsername
+	}
+	resp, err := json.Marshal(&graphMeResponse{
+		ID:                session.User.ID(),
+		DisplayName:       displayName,
+		GivenName:         info.GivenName,
+		Surname:           info.FamilyName,
+		Mail:              info.Email,
+		UserPrincipalName: principal,
+		MobilePhone:       info.Phone,
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// OktaMe emulates the Okta `/api/v1/users/me` API for the User associated
+// with the passed Access Token.
+func (m *MockOIDC) OktaMe(rw http.ResponseWriter, req *http.Request) {
+	session, info, ok := m.identityAPIUser(rw, req)
+	if !ok {
+		return
+	}
+
+	login := info.Email
+	if login == "" {
+		login = info.PreferredUsername
+	}
+	resp, err := json.Marshal(&oktaMeResponse{
+		ID:     session.User.ID(),
+		Status: "ACTIVE",
+		Profile: oktaUserProfile{
+			Login:       login,
+			FirstName:   info.GivenName,
+			LastName:    info.FamilyName,
+			Email:       info.Email,
+			MobilePhone: info.Phone,
+		},
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// GitHubUser emulates the GitHub `/user` API for the User associated with
+// the passed Access Token. Like GitHub, it also accepts the token in a
+// `token` Authorization header and returns the whole profile regardless
+// of the scopes granted.
+func (m *MockOIDC) GitHubUser(rw http.ResponseWriter, req *http.Request) {
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "token ") {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+strings.TrimPrefix(auth, "token "))
+	}
+	session, authorized := m.authorizeBearer(rw, req)
+	if !authorized {
+		return
+	}
+
+	userinfo, err := session.User.Userinfo(ScopesSupported)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	info := &mockUserinfo{mockProfile: &mockProfile{}}
+	if err := json.Unmarshal(userinfo, info); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	login := info.PreferredUsername
+	if login == "" {
+		login = info.Subject
+	}
+	// GitHub user IDs are numbers, so numeric IDs are returned as such
+	var id interface{} = info.Subject
+	if n, err := strconv.ParseInt(info.Subject, 10, 64); err == nil {
+		id = n
+	}
+	resp, err := json.Marshal(&gitHubUserResponse{
+		Login:     login,
+		ID:        id,
+		Name:      info.Name,
+		Email:     info.Email,
+		AvatarURL: info.Picture,
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// identityAPIUser looks up the Session of the bearer token and its
+// Userinfo, so identity APIs return the same data as the OIDC endpoints.
+func (m *MockOIDC) identityAPIUser(rw http.ResponseWriter, req *http.Request) (*Session, *mockUserinfo, bool) {
+	session, authorized := m.authorizeBearer(rw, req)
+	if !authorized {
+		return nil, nil, false
+	}
+
+	userinfo, err := session.User.Userinfo(session.ClaimScopes(m.Config()))
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return nil, nil, false
+	}
+	info := &mockUserinfo{mockProfile: &mockProfile{}}
+	if err := json.Unmarshal(userinfo, info); err != nil {
+		internalServerError(rw, err.Error())
+		return nil, nil, false
+	}
+	return session, info, true
+}
@@ -0,0 +1,52 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_IdentityAPIs(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	session, err := m.SessionStore.NewSession(
+		"openid email profile phone", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	accessToken, err := session.AccessToken(m.Config(), m.Keypair, m.Now())
+	assert.NoError(t, err)
+
+	call := func(handler http.HandlerFunc, endpoint string) map[string]interface{} {
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		data := make(map[string]interface{})
+		assert.NoError(t, getJSON(rr, &data))
+		return data
+	}
+
+	user := mockoidc.DefaultUser()
+
+	graph := call(m.GraphMe, mockoidc.GraphMeEndpoint)
+	assert.Equal(t, user.Subject, graph["id"])
+	assert.Equal(t, user.Email, graph["mail"])
+	assert.Equal(t, user.PreferredUsername, graph["userPrincipalName"])
+
+	okta := call(m.OktaMe, mockoidc.OktaMeEndpoint)
+	assert.Equal(t, user.Subject, okta["id"])
+	profile := okta["profile"].(map[string]interface{})
+	assert.Equal(t, user.Email, profile["login"])
+	assert.Equal(t, user.Phone, profile["mobilePhone"])
+
+	// no token
+	assert.HTTPStatusCode(t, m.GraphMe, http.MethodGet,
+		mockoidc.GraphMeEndpoint, nil, http.StatusUnauthorized)
+}
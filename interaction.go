@@ -0,0 +1,140 @@
+package mockoidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// InteractionWebhookTimeout is how long InteractionWebhook waits for a
+// decision before failing the request.
+const InteractionWebhookTimeout = 10 * time.Second
+
+// InteractionRequest describes an `authorization_endpoint` request that
+// needs an interactive decision.
+type InteractionRequest struct {
+	ClientID    string   `json:"client_id"`
+	Scopes      []string `json:"scopes"`
+	State       string   `json:"state"`
+	RedirectURI string   `json:"redirect_uri"`
+	Prompt      string   `json:"prompt,omitempty"`
+	LoginHint   string   `json:"login_hint,omitempty"`
+	ACRValues   string   `json:"acr_values,omitempty"`
+	UserID      string   `json:"user_id"`
+
+	ctx context.Context
+}
+
+// Context returns the context of the `authorization_endpoint` request, so
+// InteractionFuncs stop waiting when the client goes away.
+func (ir *InteractionRequest) Context() context.Context {
+	if ir.ctx == nil {
+		return context.Background()
+	}
+	return ir.ctx
+}
+
+// InteractionDecision is the outcome of an interactive login. Deny fails
+// the request with `access_denied`. UserID switches to a User in the
+// UserStore and Scopes narrows the scopes (and so claims) granted, they
+// must have been requested. A nil decision logs the User in unchanged.
+type InteractionDecision struct {
+	Deny   bool     `json:"deny"`
+	UserID string   `json:"user_id,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// InteractionFunc decides the outcome of interactive logins
+type InteractionFunc func(*InteractionRequest) (*InteractionDecision, error)
+
+// InteractionWebhook returns an InteractionFunc that POSTs the
+// InteractionRequest as JSON to an external URL and expects an
+// InteractionDecision JSON response within the InteractionWebhookTimeout.
+func InteractionWebhook(webhookURL string) InteractionFunc {
+	client := &http.Client{Timeout: InteractionWebhookTimeout}
+	return func(ir *InteractionRequest) (*InteractionDecision, error) {
+		body, err := json.Marshal(ir)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ir.Context(), http.MethodPost,
+			webhookURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", applicationJSON)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("interaction webhook returned status %d", resp.StatusCode)
+		}
+		decision := &InteractionDecision{}
+		if err := json.NewDecoder(resp.Body).Decode(decision); err != nil {
+			return nil, err
+		}
+		return decision, nil
+	}
+}
+
+// interact applies the Interaction decision to the request, returning the
+// User to log in.
+func (m *MockOIDC) interact(rw http.ResponseWriter, req *http.Request, user User) (User, bool) {
+	if m.Interaction == nil {
+		return user, true
+	}
+
+	decision, err := m.Interaction(&InteractionRequest{
+		ClientID:    req.Form.Get("client_id"),
+		Scopes:      strings.Split(req.Form.Get("scope"), " "),
+		State:       req.Form.Get("state"),
+		RedirectURI: req.Form.Get("redirect_uri"),
+		Prompt:      req.Form.Get("prompt"),
+		LoginHint:   req.Form.Get("login_hint"),
+		ACRValues:   req.Form.Get("acr_values"),
+		UserID:      user.ID(),
+		ctx:         req.Context(),
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return nil, false
+	}
+	if decision == nil {
+		return user, true
+	}
+
+	if decision.Deny {
+		authorizeError(rw, req, AccessDenied, "The user denied the request")
+		return nil, false
+	}
+	if decision.UserID != "" && decision.UserID != user.ID() {
+		if m.UserStore == nil {
+			internalServerError(rw, fmt.Sprintf("%v: %s", ErrUserNotFound, decision.UserID))
+			return nil, false
+		}
+		selected, err := m.UserStore.GetUserByID(decision.UserID)
+		if err != nil {
+			internalServerError(rw, err.Error())
+			return nil, false
+		}
+		user = selected
+	}
+	if len(decision.Scopes) > 0 {
+		requested := strings.Fields(req.Form.Get("scope"))
+		for _, scope := range decision.Scopes {
+			if !contains(scope, requested) || (!m.PlainOAuth2 && !contains(scope, ScopesSupported)) {
+				internalServerError(rw, fmt.Sprintf("Interaction granted an unrequested scope: %s", scope))
+				return nil, false
+			}
+		}
+		req.Form.Set("scope", strings.Join(decision.Scopes, " "))
+	}
+	return user, true
+}
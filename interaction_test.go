@@ -0,0 +1,104 @@
+package mockoidc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_InteractionWebhook(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	err = m.AddUser(&mockoidc.MockUser{Subject: "alice", Email: "alice@example.com"})
+	assert.NoError(t, err)
+
+	var decision mockoidc.InteractionDecision
+	var received mockoidc.InteractionRequest
+	webhook := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&received))
+		assert.NoError(t, json.NewEncoder(rw).Encode(&decision))
+	}))
+	defer webhook.Close()
+	m.Interaction = mockoidc.InteractionWebhook(webhook.URL)
+
+	data := url.Values{}
+	data.Set("scope", "openid email profile")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	authorize := func(code string) url.Values {
+		m.QueueCode(code)
+		rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+			m.Authorize, http.MethodGet, nil)
+		assert.Equal(t, http.StatusFound, rr.Code)
+		location, err := url.Parse(rr.Header().Get("Location"))
+		assert.NoError(t, err)
+		return location.Query()
+	}
+
+	// approve as a different user with fewer scopes
+	decision = mockoidc.InteractionDecision{UserID: "alice", Scopes: []string{"openid", "email"}}
+	authorize("approved")
+	assert.Equal(t, m.ClientID, received.ClientID)
+	assert.Equal(t, mockoidc.DefaultUser().Subject, received.UserID)
+
+	session, err := m.SessionStore.GetSessionByID("approved")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", session.User.ID())
+	assert.Equal(t, []string{"openid", "email"}, session.Scopes)
+
+	// deny
+	decision = mockoidc.InteractionDecision{Deny: true}
+	query := authorize("denied")
+	assert.Equal(t, mockoidc.AccessDenied, query.Get("error"))
+	assert.Equal(t, "testState", query.Get("state"))
+
+	// widening the scopes fails the request
+	decision = mockoidc.InteractionDecision{Scopes: []string{"openid", "groups"}}
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "unrequested scope: groups")
+}
+
+func TestMockOIDC_InteractionNilDecision(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Interaction = func(*mockoidc.InteractionRequest) (*mockoidc.InteractionDecision, error) {
+		return nil, nil
+	}
+
+	assert.HTTPStatusCode(t, m.Authorize, http.MethodGet,
+		mockoidc.AuthorizationEndpoint, authorizeData(m), http.StatusFound)
+}
+
+func TestInteractionWebhook_Context(t *testing.T) {
+	stalled := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		<-stalled
+	}))
+	defer webhook.Close()
+	defer close(stalled)
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Interaction = mockoidc.InteractionWebhook(webhook.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet,
+		mockoidc.AuthorizationEndpoint+"?"+authorizeData(m).Encode(), nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	m.Authorize(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "context deadline exceeded")
+}
@@ -0,0 +1,127 @@
+package mockoidc
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// interactionParam is the form field interactive pages post the ID of
+// their pending authorization in
+const interactionParam = "interaction"
+
+// authorization is an `authorization_endpoint` request on its way through
+// the interactive pages
+type authorization struct {
+	form     url.Values
+	page     string
+	user     User
+	acr      string
+	amr      []string
+	authTime time.Time
+	expires  time.Time
+
+	passwordChecked bool
+	consented       bool
+}
+
+// continueAuthorize shows the next interactive page the authorization
+// needs, or completes it.
+func (m *MockOIDC) continueAuthorize(rw http.ResponseWriter, req *http.Request, a *authorization) {
+	if m.needsMFA(a) {
+		m.showMFA(rw, req, a, "")
+		return
+	}
+	if m.ConsentPage && !a.consented {
+		m.showConsent(rw, req, a)
+		return
+	}
+	m.completeAuthorize(rw, req, a)
+}
+
+// resumeAuthorize continues a pending authorization with the form posted
+// by its interactive page. The request parameters are restored from the
+// original `authorization_endpoint` request.
+func (m *MockOIDC) resumeAuthorize(rw http.ResponseWriter, req *http.Request, id string) {
+	m.mu.Lock()
+	a, ok := m.authorizations[id]
+	delete(m.authorizations, id)
+	m.mu.Unlock()
+	if !ok || !m.Now().Before(a.expires) {
+		ErrInvalidRequest.Describe("Unknown interaction").Write(rw)
+		return
+	}
+
+	page := req.PostForm
+	req.Form = a.form
+	switch a.page {
+	case loginPage:
+		if !m.submitLogin(rw, req, a, page) {
+			return
+		}
+	case mfaPage:
+		if !m.submitMFA(rw, req, a, page) {
+			return
+		}
+	case consentPage:
+		if !m.submitConsent(rw, req, a, page) {
+			return
+		}
+	}
+	m.continueAuthorize(rw, req, a)
+}
+
+// pend keeps an authorization pending until its page is posted back, for
+// as long as a session lives, and returns the interaction ID the page
+// posts. Expired authorizations are forgotten.
+func (m *MockOIDC) pend(req *http.Request, a *authorization, page string) (string, error) {
+	id, err := m.nonce(24)
+	if err != nil {
+		return "", err
+	}
+	a.page = page
+	a.form = url.Values{}
+	for key, values := range req.Form {
+		a.form[key] = append([]string(nil), values...)
+	}
+
+	now := m.Now()
+	a.expires = now.Add(m.sessionTTL())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.authorizations == nil {
+		m.authorizations = make(map[string]*authorization)
+	}
+	for pending, other := range m.authorizations {
+		if !now.Before(other.expires) {
+			delete(m.authorizations, pending)
+		}
+	}
+	m.authorizations[id] = a
+	return id, nil
+}
+
+// pageAction is the path interactive pages post back to: the path the
+// request was made to, before issuer path & scope rewrites.
+func pageAction(req *http.Request) string {
+	if u, err := url.ParseRequestURI(req.RequestURI); err == nil {
+		return u.Path
+	}
+	return req.URL.Path
+}
+
+func htmlResponse(rw http.ResponseWriter, tmpl *template.Template, data interface{}) {
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	noCache(rw)
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(body.Bytes())
+}
@@ -0,0 +1,109 @@
+package mockoidc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// InvalidTokenKind is a class of invalid token QueueInvalidToken issues
+type InvalidTokenKind string
+
+// InvalidTokenKinds an RP must reject
+const (
+	// InvalidTokenBadSignature tokens have a corrupted signature
+	InvalidTokenBadSignature InvalidTokenKind = "bad-signature"
+	// InvalidTokenAlgNone tokens are unsigned with the `none` algorithm
+	InvalidTokenAlgNone InvalidTokenKind = "alg=none"
+	// InvalidTokenWrongIssuer tokens are signed with another `iss` claim
+	InvalidTokenWrongIssuer InvalidTokenKind = "wrong-issuer"
+	// InvalidTokenWrongAudience tokens are signed with another `aud` claim
+	InvalidTokenWrongAudience InvalidTokenKind = "wrong-audience"
+	// InvalidTokenExpired tokens are signed with an `exp` claim an hour ago
+	InvalidTokenExpired InvalidTokenKind = "expired"
+	// InvalidTokenGarbled tokens have a payload that isn't base64url
+	InvalidTokenGarbled InvalidTokenKind = "garbled"
+)
+
+const (
+	wrongIssuer   = "https://wrong-issuer.invalid"
+	wrongAudience = "wrong-audience"
+)
+
+// QueueInvalidToken makes the ID & access tokens of the next
+// `token_endpoint` response invalid in the way of the kind, to test that
+// an RP rejects them. Opaque PlainOAuth2 access tokens are left as is.
+// Kinds are used in the order they were queued.
+func (m *MockOIDC) QueueInvalidToken(kind InvalidTokenKind) error {
+	switch kind {
+	case InvalidTokenBadSignature, InvalidTokenAlgNone, InvalidTokenWrongIssuer,
+		InvalidTokenWrongAudience, InvalidTokenExpired, InvalidTokenGarbled:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownInvalidTokenKind, kind)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.invalidTokens = append(m.invalidTokens, kind)
+	return nil
+}
+
+// popInvalidToken returns the next queued InvalidTokenKind, empty if none
+// is queued
+func (m *MockOIDC) popInvalidToken() InvalidTokenKind {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.invalidTokens) == 0 {
+		return ""
+	}
+	kind := m.invalidTokens[0]
+	m.invalidTokens = m.invalidTokens[1:]
+	return kind
+}
+
+// invalidate makes a signed token invalid in the way of the kind
+func invalidate(kind InvalidTokenKind, token string, kp *Keypair, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if kind == "" || len(parts) != 3 {
+		return token, nil
+	}
+
+	switch kind {
+	case InvalidTokenBadSignature:
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return "", err
+		}
+		for i := range sig {
+			sig[i] ^= 0xff
+		}
+		parts[2] = base64.RawURLEncoding.EncodeToString(sig)
+		return strings.Join(parts, "."), nil
+	case InvalidTokenGarbled:
+		parts[1] = "%garbled%" + parts[1]
+		return strings.Join(parts, "."), nil
+	}
+
+	claims := jwt.MapClaims{}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, claims)
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case InvalidTokenAlgNone:
+		unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+		return unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	case InvalidTokenWrongIssuer:
+		claims["iss"] = wrongIssuer
+	case InvalidTokenWrongAudience:
+		claims["aud"] = wrongAudience
+	case InvalidTokenExpired:
+		claims["iat"] = now.Add(-2 * time.Hour).Unix()
+		claims["nbf"] = now.Add(-2 * time.Hour).Unix()
+		claims["exp"] = now.Add(-time.Hour).Unix()
+	}
+	return parsed.SignedString(kp.PrivateKey)
+}
@@ -0,0 +1,100 @@
+package mockoidc_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_QueueInvalidToken(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.FreezeTime()
+
+	assert.ErrorIs(t, m.QueueInvalidToken("unknown"), mockoidc.ErrUnknownInvalidTokenKind)
+
+	verify := func(token string) (jwt.MapClaims, error) {
+		parsed, err := m.Keypair.VerifyJWT(token)
+		if err != nil {
+			return nil, err
+		}
+		return parsed.Claims.(jwt.MapClaims), nil
+	}
+
+	tests := map[mockoidc.InvalidTokenKind]func(t *testing.T, token string){
+		mockoidc.InvalidTokenBadSignature: func(t *testing.T, token string) {
+			_, err := verify(token)
+			assert.ErrorIs(t, err, mockoidc.ErrInvalidToken)
+			var ve *jwt.ValidationError
+			assert.True(t, errors.As(err, &ve))
+			assert.NotZero(t, ve.Errors&jwt.ValidationErrorSignatureInvalid)
+		},
+		mockoidc.InvalidTokenAlgNone: func(t *testing.T, token string) {
+			assert.True(t, strings.HasSuffix(token, "."))
+			_, err := verify(token)
+			assert.Error(t, err)
+		},
+		mockoidc.InvalidTokenWrongIssuer: func(t *testing.T, token string) {
+			claims, err := verify(token)
+			assert.NoError(t, err)
+			assert.NotEqual(t, m.Issuer(), claims["iss"])
+		},
+		mockoidc.InvalidTokenWrongAudience: func(t *testing.T, token string) {
+			claims, err := verify(token)
+			assert.NoError(t, err)
+			assert.False(t, claims.VerifyAudience(m.ClientID, true))
+		},
+		mockoidc.InvalidTokenExpired: func(t *testing.T, token string) {
+			_, err := verify(token)
+			assert.ErrorIs(t, err, mockoidc.ErrInvalidToken)
+			var ve *jwt.ValidationError
+			assert.True(t, errors.As(err, &ve))
+			assert.NotZero(t, ve.Errors&jwt.ValidationErrorExpired)
+		},
+		mockoidc.InvalidTokenGarbled: func(t *testing.T, token string) {
+			_, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+			assert.Error(t, err)
+		},
+	}
+	for kind, check := range tests {
+		t.Run(string(kind), func(t *testing.T) {
+			assert.NoError(t, m.QueueInvalidToken(kind))
+			tokens := issueTokens(t, m)
+			check(t, tokens["id_token"].(string))
+			check(t, tokens["access_token"].(string))
+		})
+	}
+
+	// the queue is drained
+	tokens := issueTokens(t, m)
+	_, err = verify(tokens["id_token"].(string))
+	assert.NoError(t, err)
+}
+
+func issueTokens(t *testing.T, m *mockoidc.MockOIDC) map[string]interface{} {
+	session, err := m.SessionStore.NewSession(
+		"openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+	req := httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint, strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	m.Token(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	tokens := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &tokens))
+	return tokens
+}
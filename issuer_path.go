@@ -0,0 +1,75 @@
+package mockoidc
+
+import (
+	"net/http"
+	"strings"
+)
+
+// issuerPath is the path of the Issuer, IssuerPath or IssuerBase
+func (m *MockOIDC) issuerPath() string {
+	if m.IssuerPath == "" {
+		return IssuerBase
+	}
+	return "/" + strings.Trim(m.IssuerPath, "/")
+}
+
+// route maps an endpoint path to its EndpointPaths path, or a path under
+// IssuerBase to the IssuerPath it is served under.
+func (m *MockOIDC) route(path string) string {
+	if alias, ok := m.EndpointPaths[path]; ok {
+		return alias
+	}
+	if !underPath(path, IssuerBase) {
+		return path
+	}
+	return m.issuerPath() + strings.TrimPrefix(path, IssuerBase)
+}
+
+// issuerPathHandler serves the endpoints under IssuerBase at the
+// IssuerPath instead. Requests are rewritten to the IssuerBase paths, so
+// Chaos rules, queued errors & recorded requests keep using the endpoint
+// constants. The same goes for EndpointPaths.
+func (m *MockOIDC) issuerPathHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if endpoint, ok := m.aliasedEndpoint(req.URL.Path); ok {
+			rewritten := req.Clone(req.Context())
+			rewritten.URL.Path = endpoint
+			rewritten.URL.RawPath = ""
+			next.ServeHTTP(rw, rewritten)
+			return
+		}
+
+		issuerPath := m.issuerPath()
+		if issuerPath == IssuerBase {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		switch {
+		case underPath(req.URL.Path, issuerPath):
+			rewritten := req.Clone(req.Context())
+			rewritten.URL.Path = IssuerBase + strings.TrimPrefix(req.URL.Path, issuerPath)
+			rewritten.URL.RawPath = ""
+			next.ServeHTTP(rw, rewritten)
+		case underPath(req.URL.Path, IssuerBase):
+			http.NotFound(rw, req)
+		default:
+			next.ServeHTTP(rw, req)
+		}
+	})
+}
+
+// underPath is true for the path itself and the paths below it
+func underPath(path, base string) bool {
+	return path == base || strings.HasPrefix(path, base+"/")
+}
+
+// aliasedEndpoint is the endpoint constant EndpointPaths serves at the path
+func (m *MockOIDC) aliasedEndpoint(path string) (string, bool) {
+	for endpoint, alias := range m.EndpointPaths {
+		if alias == path {
+			return endpoint, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,107 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_IssuerPath(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.IssuerPath = "/realms/test/"
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+
+	assert.Equal(t, m.Addr()+"/realms/test", m.Issuer())
+	assert.Equal(t, m.Issuer()+"/.well-known/openid-configuration", m.DiscoveryEndpoint())
+	assert.Equal(t, m.Issuer()+"/token", m.TokenEndpoint())
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	discovery := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	resp.Body.Close()
+	assert.Equal(t, m.Issuer(), discovery["issuer"])
+	assert.Equal(t, m.AuthorizationEndpoint(), discovery["authorization_endpoint"])
+	assert.Equal(t, m.JWKSEndpoint(), discovery["jwks_uri"])
+
+	// the default paths aren't served
+	resp, err = httpClient.Get(m.Addr() + mockoidc.DiscoveryEndpoint)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	m.QueueCode("prefixed-code")
+	query := url.Values{}
+	query.Set("scope", "openid")
+	query.Set("response_type", "code")
+	query.Set("redirect_uri", "http://127.0.0.1/callback")
+	query.Set("state", "state")
+	query.Set("client_id", m.ClientID)
+	resp, err = httpClient.Get(discovery["authorization_endpoint"].(string) + "?" + query.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	form := url.Values{}
+	form.Set("client_id", m.ClientID)
+	form.Set("client_secret", m.ClientSecret)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", "prefixed-code")
+	resp, err = httpClient.PostForm(discovery["token_endpoint"].(string), form)
+	assert.NoError(t, err)
+	tokens := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(tokens["id_token"].(string), claims)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Issuer(), claims["iss"])
+
+	// requests are recorded at the endpoint constants
+	assert.Len(t, m.RequestsTo(mockoidc.TokenEndpoint), 1)
+	assert.Len(t, m.RequestsTo(m.TokenEndpoint()), 1)
+}
+
+func TestMockOIDC_EndpointPaths(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.EndpointPaths = map[string]string{
+		mockoidc.JWKSEndpoint: "/discovery/keys",
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+
+	assert.Equal(t, m.Addr()+"/discovery/keys", m.JWKSEndpoint())
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	discovery := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	resp.Body.Close()
+	assert.Equal(t, m.JWKSEndpoint(), discovery["jwks_uri"])
+
+	for _, path := range []string{"/discovery/keys", mockoidc.JWKSEndpoint} {
+		resp, err = httpClient.Get(m.Addr() + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+	}
+	assert.Len(t, m.RequestsTo(mockoidc.JWKSEndpoint), 2)
+	assert.Len(t, m.RequestsTo(m.JWKSEndpoint()), 2)
+}
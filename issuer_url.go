@@ -0,0 +1,66 @@
+package mockoidc
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// endpointFor returns the full URL of an endpoint path as advertised to
+// the request, or to direct API calls if the request is nil.
+func (m *MockOIDC) endpointFor(req *http.Request, path string) string {
+	_, aliased := m.EndpointPaths[path]
+	if m.IssuerURL != "" && underPath(path, IssuerBase) && !aliased {
+		issuer := m.forwarded(req, strings.TrimSuffix(m.IssuerURL, "/"))
+		return issuer + strings.TrimPrefix(path, IssuerBase)
+	}
+	addr := m.advertisedAddr(req)
+	if addr == "" {
+		return ""
+	}
+	return addr + m.route(path)
+}
+
+// advertisedAddr is the base URL endpoint paths are advertised under: the
+// IssuerURL without the issuer path (or its origin) if set, otherwise
+// Addr. The request's forwarded host & scheme replace its own if
+// TrustForwardedHeaders is set.
+func (m *MockOIDC) advertisedAddr(req *http.Request) string {
+	addr := m.Addr()
+	if m.IssuerURL != "" {
+		issuer := strings.TrimSuffix(m.IssuerURL, "/")
+		if strings.HasSuffix(issuer, m.issuerPath()) {
+			addr = strings.TrimSuffix(issuer, m.issuerPath())
+		} else if u, err := url.Parse(issuer); err == nil {
+			addr = u.Scheme + "://" + u.Host
+		}
+	}
+	return m.forwarded(req, addr)
+}
+
+// forwarded replaces the host & scheme of a URL with the
+// `X-Forwarded-Host` & `X-Forwarded-Proto` of the request, if
+// TrustForwardedHeaders is set.
+func (m *MockOIDC) forwarded(req *http.Request, addr string) string {
+	if !m.TrustForwardedHeaders || req == nil || addr == "" {
+		return addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return addr
+	}
+	if proto := forwardedValue(req, "X-Forwarded-Proto"); proto != "" {
+		u.Scheme = proto
+	}
+	if host := forwardedValue(req, "X-Forwarded-Host"); host != "" {
+		u.Host = host
+	}
+	return u.String()
+}
+
+// forwardedValue is the first value of a forwarded header, the one set by
+// the proxy closest to the client.
+func forwardedValue(req *http.Request, header string) string {
+	value := strings.SplitN(req.Header.Get(header), ",", 2)[0]
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,97 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_IssuerURL(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(&mockoidc.Config{IssuerURL: "http://mockoidc:8080/oidc/"})
+
+	assert.Equal(t, "http://mockoidc:8080/oidc", m.Issuer())
+	assert.Equal(t, "http://mockoidc:8080/oidc/token", m.TokenEndpoint())
+	assert.Equal(t, m.Issuer(), m.Config().Issuer)
+
+	discovery := discover(t, m, nil)
+	assert.Equal(t, "http://mockoidc:8080/oidc", discovery["issuer"])
+	assert.Equal(t, "http://mockoidc:8080/oidc/.well-known/jwks.json", discovery["jwks_uri"])
+
+	claims := issueIDToken(t, m, nil)
+	assert.Equal(t, "http://mockoidc:8080/oidc", claims["iss"])
+}
+
+func TestMockOIDC_TrustForwardedHeaders(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.BaseURL = "http://127.0.0.1:8080"
+
+	forwarded := http.Header{}
+	forwarded.Set("X-Forwarded-Proto", "https")
+	forwarded.Set("X-Forwarded-Host", "idp.test, proxy.internal")
+
+	// ignored unless trusted
+	discovery := discover(t, m, forwarded)
+	assert.Equal(t, "http://127.0.0.1:8080/oidc", discovery["issuer"])
+
+	m.TrustForwardedHeaders = true
+	discovery = discover(t, m, forwarded)
+	assert.Equal(t, "https://idp.test/oidc", discovery["issuer"])
+	assert.Equal(t, "https://idp.test/oidc/token", discovery["token_endpoint"])
+
+	claims := issueIDToken(t, m, forwarded)
+	assert.Equal(t, "https://idp.test/oidc", claims["iss"])
+
+	// direct API calls aren't forwarded
+	assert.Equal(t, "http://127.0.0.1:8080/oidc", m.Issuer())
+	assert.Equal(t, "http://127.0.0.1:8080/oidc", discover(t, m, nil)["issuer"])
+}
+
+func discover(t *testing.T, m *mockoidc.MockOIDC, header http.Header) map[string]interface{} {
+	req := httptest.NewRequest(http.MethodGet, mockoidc.DiscoveryEndpoint, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rr := httptest.NewRecorder()
+	m.Discovery(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	discovery := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &discovery))
+	return discovery
+}
+
+func issueIDToken(t *testing.T, m *mockoidc.MockOIDC, header http.Header) jwt.MapClaims {
+	session, err := m.SessionStore.NewSession(
+		"openid email profile", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+
+	req := httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint, strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rr := httptest.NewRecorder()
+	m.Token(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	tokens := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &tokens))
+	token, err := m.Keypair.VerifyJWT(tokens["id_token"].(string))
+	assert.NoError(t, err)
+	return token.Claims.(jwt.MapClaims)
+}
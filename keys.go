@@ -0,0 +1,72 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/golang-jwt/jwt"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// RotateKeypair replaces the Keypair signing tokens with a new random one,
+// to test RPs refetching the JWKS. Retired Keypairs stay in the JWKS and
+// keep verifying the tokens they signed.
+func (m *MockOIDC) RotateKeypair() (*Keypair, error) {
+	kp, err := RandomKeypair(2048)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retiredKeypairs = append(m.retiredKeypairs, m.Keypair)
+	m.Keypair = kp
+	return kp, nil
+}
+
+// keypairs returns the Keypair followed by the retired ones, after the
+// FastKeypair in FastTokens mode.
+func (m *MockOIDC) keypairs() []*Keypair {
+	var keypairs []*Keypair
+	if m.FastTokens {
+		if kp, err := FastKeypair(); err == nil {
+			keypairs = append(keypairs, kp)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keypairs = append(keypairs, m.Keypair)
+	return append(keypairs, m.retiredKeypairs...)
+}
+
+// jwks is the JSON JWKS of the Keypair & retired Keypairs
+func (m *MockOIDC) jwks() ([]byte, error) {
+	jwks := &jose.JSONWebKeySet{}
+	for _, kp := range m.keypairs() {
+		jwk, err := kp.JWK()
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, *jwk)
+	}
+	return json.Marshal(jwks)
+}
+
+// verifyJWT verifies a token with the Keypair or the retired Keypair
+// matching its `kid`. Its `exp`, `iat` & `nbf` claims are validated
+// against m.Now.
+func (m *MockOIDC) verifyJWT(token string) (*jwt.Token, error) {
+	var (
+		parsed *jwt.Token
+		err    error
+	)
+	now := m.Now()
+	for _, kp := range m.keypairs() {
+		parsed, err = kp.verifyJWTAt(token, now)
+		if !errors.Is(err, ErrKeyIDMismatch) {
+			return parsed, err
+		}
+	}
+	return parsed, err
+}
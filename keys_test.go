@@ -0,0 +1,45 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestMockOIDC_RotateKeypair(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	session, err := m.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	accessToken, err := session.AccessToken(m.Config(), m.Keypair, m.Now())
+	assert.NoError(t, err)
+
+	retired := m.Keypair
+	kp, err := m.RotateKeypair()
+	assert.NoError(t, err)
+	assert.Equal(t, kp, m.Keypair)
+	assert.NotEqual(t, retired, kp)
+
+	rr := testResponse(t, mockoidc.JWKSEndpoint, m.JWKS, http.MethodGet, nil)
+	jwks := jose.JSONWebKeySet{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jwks))
+	assert.Len(t, jwks.Keys, 2)
+
+	retiredKid, err := retired.KeyID()
+	assert.NoError(t, err)
+	assert.Len(t, jwks.Key(retiredKid), 1)
+
+	// tokens signed by the retired Keypair still work
+	req, err := http.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	rr = httptest.NewRecorder()
+	m.Userinfo(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
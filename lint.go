@@ -0,0 +1,139 @@
+package mockoidc
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Security lint rules flagged by SecurityLint
+const (
+	LintMissingState      = "missing_state"
+	LintMissingNonce      = "missing_nonce"
+	LintMissingPKCE       = "missing_pkce"
+	LintPlainPKCE         = "plain_pkce"
+	LintSharedRedirectURI = "shared_redirect_uri"
+	LintSecretInQuery     = "secret_in_query"
+)
+
+// querySecrets are parameters that shouldn't be sent in a URL query where
+// they end up in logs and browser history.
+var querySecrets = []string{
+	"client_secret",
+	"access_token",
+	"refresh_token",
+	"code_verifier",
+	"password",
+}
+
+// LintFinding is an insecure client behavior spotted in a request
+type LintFinding struct {
+	Rule      string
+	Endpoint  string
+	ClientID  string
+	Message   string
+	Time      time.Time
+	Namespace string `json:",omitempty"`
+}
+
+// SecurityLint returns the insecure client behaviors spotted so far:
+// missing `state`, `nonce` or PKCE, redirect URIs shared across clients
+// and secrets sent in query strings. Findings of ScopedMock requests are
+// reported by their ScopedMock.
+func (m *MockOIDC) SecurityLint() []LintFinding {
+	return m.lintFindingsOf("")
+}
+
+func (m *MockOIDC) lintFindingsOf(namespace string) []LintFinding {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var findings []LintFinding
+	for _, finding := range m.lintFindings {
+		if finding.Namespace == namespace {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+func (m *MockOIDC) lintAuthorize(req *http.Request) {
+	clientID := req.Form.Get("client_id")
+	if req.Form.Get("state") == "" {
+		m.flag(req, LintMissingState, clientID, "Authorization request has no state")
+	}
+	if contains(openidScope, strings.Split(req.Form.Get("scope"), " ")) && req.Form.Get("nonce") == "" {
+		m.flag(req, LintMissingNonce, clientID, "OpenID authorization request has no nonce")
+	}
+	switch req.Form.Get("code_challenge_method") {
+	case "":
+		if req.Form.Get("code_challenge") == "" {
+			m.flag(req, LintMissingPKCE, clientID, "Authorization request has no PKCE code_challenge")
+		} else {
+			m.flag(req, LintPlainPKCE, clientID, "PKCE code_challenge_method defaults to plain")
+		}
+	case CodeChallengeMethodPlain:
+		m.flag(req, LintPlainPKCE, clientID, "PKCE code_challenge_method is plain")
+	}
+
+	if redirectURI := req.Form.Get("redirect_uri"); redirectURI != "" {
+		m.mu.Lock()
+		if m.redirectURIClients == nil {
+			m.redirectURIClients = make(map[string]string)
+		}
+		key := requestNamespace(req) + " " + redirectURI
+		owner, ok := m.redirectURIClients[key]
+		if !ok {
+			m.redirectURIClients[key] = clientID
+			m.redirectURIs = append(m.redirectURIs, key)
+			if drop := m.historyOverflow(len(m.redirectURIs)); drop > 0 {
+				for _, old := range m.redirectURIs[:drop] {
+					delete(m.redirectURIClients, old)
+				}
+				m.redirectURIs = append([]string(nil), m.redirectURIs[drop:]...)
+			}
+		}
+		m.mu.Unlock()
+
+		if ok && owner != clientID {
+			m.flag(req, LintSharedRedirectURI, clientID,
+				fmt.Sprintf("Redirect URI %s is also used by client %s", redirectURI, owner))
+		}
+	}
+
+	m.lintQuery(req)
+}
+
+func (m *MockOIDC) lintQuery(req *http.Request) {
+	if req.URL == nil {
+		return
+	}
+	query := req.URL.Query()
+	for _, param := range querySecrets {
+		if query.Get(param) != "" {
+			m.flag(req, LintSecretInQuery, req.Form.Get("client_id"),
+				fmt.Sprintf("Secret parameter %s was sent in the query string", param))
+		}
+	}
+}
+
+func (m *MockOIDC) flag(req *http.Request, rule, clientID, message string) {
+	finding := LintFinding{
+		Rule:      rule,
+		ClientID:  clientID,
+		Message:   message,
+		Time:      m.Now(),
+		Namespace: requestNamespace(req),
+	}
+	if req.URL != nil {
+		finding.Endpoint = req.URL.Path
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lintFindings = append(m.lintFindings, finding)
+	if drop := m.historyOverflow(len(m.lintFindings)); drop > 0 {
+		m.lintFindings = append([]LintFinding(nil), m.lintFindings[drop:]...)
+	}
+}
@@ -0,0 +1,95 @@
+package mockoidc_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_SecurityLint(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	rules := func() []string {
+		var flagged []string
+		for _, finding := range m.SecurityLint() {
+			flagged = append(flagged, finding.Rule)
+		}
+		return flagged
+	}
+
+	// a well-behaved client
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "https://example.com/callback")
+	data.Set("state", "testState")
+	data.Set("nonce", "testNonce")
+	data.Set("client_id", m.ClientID)
+	data.Set("code_challenge", "challenge")
+	data.Set("code_challenge_method", mockoidc.CodeChallengeMethodS256)
+	testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Empty(t, rules())
+
+	// a sloppy client
+	data.Del("state")
+	data.Del("nonce")
+	data.Set("code_challenge_method", mockoidc.CodeChallengeMethodPlain)
+	data.Set("client_id", "another-client")
+	testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.ElementsMatch(t, []string{
+		mockoidc.LintMissingState,
+		mockoidc.LintMissingNonce,
+		mockoidc.LintPlainPKCE,
+		mockoidc.LintSharedRedirectURI,
+	}, rules())
+
+	// secrets in the token endpoint query string
+	token := url.Values{}
+	token.Set("client_id", m.ClientID)
+	token.Set("client_secret", m.ClientSecret)
+	testResponse(t, mockoidc.TokenEndpoint+"?"+token.Encode(), m.Token, http.MethodPost, nil)
+
+	findings := m.SecurityLint()
+	last := findings[len(findings)-1]
+	assert.Equal(t, mockoidc.LintSecretInQuery, last.Rule)
+	assert.Equal(t, mockoidc.TokenEndpoint, last.Endpoint)
+	assert.Equal(t, m.ClientID, last.ClientID)
+}
+
+func TestMockOIDC_SecurityLintHistoryLimit(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.HistoryLimit = 4
+
+	for i := 0; i < 20; i++ {
+		data := url.Values{}
+		data.Set("scope", "openid")
+		data.Set("response_type", "code")
+		data.Set("redirect_uri", fmt.Sprintf("https://example.com/callback/%d", i))
+		data.Set("client_id", m.ClientID)
+		testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+			m.Authorize, http.MethodGet, nil)
+	}
+
+	findings := m.SecurityLint()
+	assert.LessOrEqual(t, len(findings), 5)
+	assert.Equal(t, mockoidc.LintMissingPKCE, findings[len(findings)-1].Rule)
+
+	// a recently seen redirect URI is still tracked
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "https://example.com/callback/19")
+	data.Set("client_id", "another-client")
+	testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+		m.Authorize, http.MethodGet, nil)
+	findings = m.SecurityLint()
+	assert.Equal(t, mockoidc.LintSharedRedirectURI, findings[len(findings)-1].Rule)
+}
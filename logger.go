@@ -0,0 +1,96 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Logger receives debug logs of every request, token issuance and
+// validation failure, as a message with alternating key & value pairs.
+// A `*slog.Logger` satisfies it, other loggers can be adapted.
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+}
+
+// DebugfLogger adapts loggers with a Debugf method, like a logrus Logger
+// or Entry, to a Logger. Key & value pairs are formatted as `key=value`.
+func DebugfLogger(logger interface {
+	Debugf(format string, args ...interface{})
+}) Logger {
+	return &debugfLogger{logger: logger}
+}
+
+type debugfLogger struct {
+	logger interface {
+		Debugf(format string, args ...interface{})
+	}
+}
+
+func (l *debugfLogger) Debug(msg string, keysAndValues ...interface{}) {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{} = "(MISSING)"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		fmt.Fprintf(&b, " %v=%v", keysAndValues[i], value)
+	}
+	l.logger.Debugf("%s", b.String())
+}
+
+// debug logs to the Logger, if any
+func (m *MockOIDC) debug(msg string, keysAndValues ...interface{}) {
+	if m.Logger != nil {
+		m.Logger.Debug(msg, keysAndValues...)
+	}
+}
+
+// logRequests logs every request with its response status. Error
+// responses are logged with their OAuth error & description, so it's
+// clear why a request was rejected.
+func (m *MockOIDC) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if m.Logger == nil {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		start := time.Now()
+		tee := &teeResponse{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(tee, req)
+
+		params := req.Form
+		if !m.DisableRedaction {
+			params = RedactValues(params)
+		}
+		keysAndValues := []interface{}{
+			"method", req.Method,
+			"endpoint", req.URL.Path,
+			"status", tee.status,
+			"duration", time.Since(start),
+			"params", params.Encode(),
+		}
+		if scope := requestScope(req); scope != nil {
+			keysAndValues = append(keysAndValues, "scope", scope.Name)
+		}
+		if tee.status < http.StatusBadRequest {
+			m.debug("request", keysAndValues...)
+			return
+		}
+
+		oauthError := struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}{}
+		if json.Unmarshal(tee.body.Bytes(), &oauthError) == nil && oauthError.Error != "" {
+			keysAndValues = append(keysAndValues,
+				"error", oauthError.Error,
+				"error_description", oauthError.Description)
+		}
+		m.debug("request failed", keysAndValues...)
+	})
+}
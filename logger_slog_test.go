@@ -0,0 +1,26 @@
+//go:build go1.21
+// +build go1.21
+
+package mockoidc_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Logger_Slog(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	m.Logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	m.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, mockoidc.JWKSEndpoint, nil))
+	assert.Contains(t, buf.String(), "level=DEBUG msg=request method=GET endpoint=/oidc/.well-known/jwks.json status=200")
+}
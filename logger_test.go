@@ -0,0 +1,59 @@
+package mockoidc_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+// debugfLogger collects logs like a logrus Logger
+type debugfLogger struct {
+	lines []string
+}
+
+func (l *debugfLogger) Debugf(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestMockOIDC_Logger(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	logs := &debugfLogger{}
+	m.Logger = mockoidc.DebugfLogger(logs)
+	handler := m.Handler()
+
+	session, err := m.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	token := func(values url.Values) {
+		req := httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	token(url.Values{"grant_type": {"authorization_code"}})
+	assert.Len(t, logs.lines, 1)
+	assert.Contains(t, logs.lines[0], "request failed method=POST endpoint=/oidc/token status=400")
+	assert.Contains(t, logs.lines[0], "error=invalid_request error_description=The request is missing the required parameter: client_id")
+
+	logs.lines = nil
+	token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {m.ClientID},
+		"client_secret": {m.ClientSecret},
+		"code":          {session.SessionID},
+	})
+	assert.Len(t, logs.lines, 4)
+	assert.Contains(t, logs.lines[0], "token issued type=access_token session="+session.SessionID)
+	assert.Contains(t, logs.lines[1], "token issued type=id_token")
+	assert.Contains(t, logs.lines[2], "token issued type=refresh_token")
+	assert.Contains(t, logs.lines[3], "request method=POST endpoint=/oidc/token status=200")
+	assert.Contains(t, logs.lines[3], "client_secret=%5BREDACTED%5D")
+	assert.NotContains(t, logs.lines[3], m.ClientSecret)
+}
@@ -0,0 +1,102 @@
+package mockoidc
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const loginPage = "login"
+
+var loginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Log In</title></head>
+<body>
+<h1>Log in to {{ .ClientID }}</h1>
+{{- if .Error }}
+<p id="error">{{ .Error }}</p>
+{{- end }}
+<form method="post" action="{{ .Action }}">
+<input type="hidden" name="interaction" value="{{ .Interaction }}"/>
+<label>Username <input type="text" id="username" name="username" value="{{ .Username }}" autocomplete="username"/></label>
+<label>Password <input type="password" id="password" name="password" autocomplete="current-password"/></label>
+<button type="submit" id="login">Log In</button>
+</form>
+</body>
+</html>
+`))
+
+// showLogin renders the login form, prefilled with the `login_hint`.
+// `prompt=none` requests fail with `login_required` instead.
+func (m *MockOIDC) showLogin(rw http.ResponseWriter, req *http.Request, a *authorization, loginError string) {
+	if contains(PromptNone, strings.Fields(req.Form.Get("prompt"))) {
+		authorizeError(rw, req, LoginRequired, "The user is not logged in")
+		return
+	}
+
+	id, err := m.pend(req, a, loginPage)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	htmlResponse(rw, loginTemplate, struct {
+		ClientID    string
+		Action      string
+		Interaction string
+		Username    string
+		Error       string
+	}{req.Form.Get("client_id"), pageAction(req), id, req.Form.Get("login_hint"), loginError})
+}
+
+// submitLogin checks the posted credentials against the UserStore and
+// logs the User in. Invalid credentials render the login form again.
+func (m *MockOIDC) submitLogin(rw http.ResponseWriter, req *http.Request, a *authorization, page url.Values) bool {
+	user := m.findUser(page.Get("username"))
+	if user == nil {
+		m.showLogin(rw, req, a, "Invalid username or password")
+		return false
+	}
+	valid, checked := checkPassword(user, page.Get("password"))
+	if !valid {
+		m.showLogin(rw, req, a, "Invalid username or password")
+		return false
+	}
+	a.passwordChecked = checked
+	return m.login(rw, req, a, user)
+}
+
+// findUser looks up a User in the UserStore by ID, email or MockUser
+// preferred username
+func (m *MockOIDC) findUser(username string) User {
+	if username == "" || m.UserStore == nil {
+		return nil
+	}
+	if user, err := m.UserStore.GetUserByID(username); err == nil {
+		return user
+	}
+	if user, err := m.UserStore.GetUserByEmail(username); err == nil {
+		return user
+	}
+	for _, user := range m.UserStore.ListUsers() {
+		if mu, ok := user.(*MockUser); ok && mu.PreferredUsername == username {
+			return user
+		}
+	}
+	return nil
+}
+
+// checkPassword checks the password of Users with a
+// `CheckPassword(string) bool` method, others log in with any password.
+// checked reports whether the password was actually checked, which it
+// isn't for Users whose `HasPassword() bool` method reports none.
+func checkPassword(user User, password string) (valid, checked bool) {
+	checker, ok := user.(interface{ CheckPassword(string) bool })
+	if !ok {
+		return true, false
+	}
+	if p, ok := user.(interface{ HasPassword() bool }); ok && !p.HasPassword() {
+		return true, false
+	}
+	return checker.CheckPassword(password), true
+}
@@ -0,0 +1,87 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_LoginPage(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.LoginPage = true
+	m.ConsentPage = true
+	alice := &mockoidc.MockUser{
+		Subject:           "alice",
+		Email:             "alice@example.com",
+		PreferredUsername: "alice.smith",
+		Password:          "hunter2",
+	}
+	assert.NoError(t, m.AddUser(alice))
+	m.QueueUser(mockoidc.DefaultUser())
+
+	data := authorizeData(m)
+	data.Set("login_hint", "alice@example.com")
+	rr, interaction := showPage(t, m, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `value="alice@example.com"`)
+
+	// wrong passwords show the form again
+	form := url.Values{
+		"interaction": {interaction},
+		"username":    {"alice.smith"},
+		"password":    {"wrong"},
+	}
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, form)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid username or password")
+	match := interactionPattern.FindStringSubmatch(rr.Body.String())
+	assert.NotNil(t, match)
+
+	// then the consent page follows the login
+	form.Set("interaction", match[1])
+	form.Set("password", "hunter2")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, form)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	match = interactionPattern.FindStringSubmatch(rr.Body.String())
+	assert.NotNil(t, match)
+
+	location := submitPage(t, m, match[1], url.Values{"consent": {"approve"}})
+	session, err := m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", session.User.ID())
+
+	// the UserQueue isn't popped
+	assert.Equal(t, 1, m.QueuedUsers())
+
+	data.Set("prompt", "none")
+	rr, _ = showPage(t, m, data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.LoginRequired, location.Query().Get("error"))
+}
+
+func TestMockUser_CheckPassword(t *testing.T) {
+	user := &mockoidc.MockUser{Password: "hunter2"}
+	assert.True(t, user.CheckPassword("hunter2"))
+	assert.False(t, user.CheckPassword("hunter"))
+	assert.True(t, mockoidc.DefaultUser().CheckPassword("anything"))
+
+	// passwords are never serialized
+	data, err := json.Marshal(user)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	_, err = m.SessionStore.NewSession("openid", "nonce", user, "", "")
+	assert.NoError(t, err)
+	data, err = json.Marshal(m.Snapshot())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "hunter2")
+}
@@ -0,0 +1,64 @@
+package mockoidc
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// BackchannelLogoutEvent is the `events` member of logout tokens
+	BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	// LogoutTokenTTL is how long logout tokens are valid. They are meant
+	// to be delivered right away, OIDC Back-Channel Logout recommends an
+	// `exp` of at most two minutes.
+	LogoutTokenTTL = 2 * time.Minute
+)
+
+// LogoutTokenClaims are the claims of a back-channel logout token
+type LogoutTokenClaims struct {
+	Events map[string]struct{} `json:"events"`
+	SID    string              `json:"sid"`
+	*jwt.StandardClaims
+}
+
+// SessionFor looks up the Session of a `sid` claim. ID & logout tokens
+// carry the ID of their Session as a stable `sid`.
+func (m *MockOIDC) SessionFor(sid string) (*Session, error) {
+	return m.SessionStore.GetSessionByID(sid)
+}
+
+// LogoutToken signs a back-channel logout token for the Session of a
+// `sid`, for tests to POST to an RP's `backchannel_logout_uri`. It expires
+// LogoutTokenTTL after m.Now.
+func (m *MockOIDC) LogoutToken(sid string) (string, error) {
+	session, err := m.SessionFor(sid)
+	if err != nil {
+		return "", err
+	}
+	kp, err := m.signingKeypair()
+	if err != nil {
+		return "", err
+	}
+	jti, err := m.nonce(24)
+	if err != nil {
+		return "", err
+	}
+
+	config := m.sessionConfig(session, nil)
+	now := m.Now()
+	claims := &LogoutTokenClaims{
+		Events: map[string]struct{}{BackchannelLogoutEvent: {}},
+		SID:    session.SessionID,
+		StandardClaims: &jwt.StandardClaims{
+			Audience:  config.ClientID,
+			ExpiresAt: now.Add(LogoutTokenTTL).Unix(),
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			Issuer:    config.Issuer,
+			Subject:   session.User.ID(),
+		},
+	}
+	return kp.SignJWT(claims)
+}
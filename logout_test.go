@@ -0,0 +1,63 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_SessionFor(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	tokens := issueTokens(t, m)
+	parsed, err := m.Keypair.VerifyJWT(tokens["id_token"].(string))
+	assert.NoError(t, err)
+	sid, ok := parsed.Claims.(jwt.MapClaims)["sid"].(string)
+	assert.True(t, ok)
+
+	session, err := m.SessionFor(sid)
+	assert.NoError(t, err)
+	assert.Equal(t, sid, session.SessionID)
+
+	// the sid is stable across refreshes
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("refresh_token", tokens["refresh_token"].(string))
+	data.Set("grant_type", "refresh_token")
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	refreshed := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &refreshed))
+	parsed, err = m.Keypair.VerifyJWT(refreshed["id_token"].(string))
+	assert.NoError(t, err)
+	assert.Equal(t, sid, parsed.Claims.(jwt.MapClaims)["sid"])
+
+	m.FreezeTime()
+	m.FastForward(time.Hour)
+	logout, err := m.LogoutToken(sid)
+	assert.NoError(t, err)
+	// the mock's clock is ahead, so its time claims aren't validated here
+	parsed, err = (&jwt.Parser{SkipClaimsValidation: true}).Parse(logout,
+		func(*jwt.Token) (interface{}, error) { return m.Keypair.PublicKey, nil })
+	assert.NoError(t, err)
+	claims := parsed.Claims.(jwt.MapClaims)
+	assert.Equal(t, float64(m.Now().Unix()), claims["iat"])
+	assert.Equal(t, float64(m.Now().Add(mockoidc.LogoutTokenTTL).Unix()), claims["exp"])
+	assert.Equal(t, sid, claims["sid"])
+	assert.Equal(t, session.User.ID(), claims["sub"])
+	assert.Equal(t, m.ClientID, claims["aud"])
+	assert.Contains(t, claims["events"], mockoidc.BackchannelLogoutEvent)
+	assert.NotContains(t, claims, "nonce")
+
+	_, err = m.SessionFor("unknown")
+	assert.ErrorIs(t, err, mockoidc.ErrSessionNotFound)
+	_, err = m.LogoutToken("unknown")
+	assert.ErrorIs(t, err, mockoidc.ErrSessionNotFound)
+}
@@ -0,0 +1,38 @@
+package mockoidc
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// MetricsEndpoint serves the counters of MockOIDC in the Prometheus text
+// format. Like the health endpoints, it's served outside the issuer and
+// isn't recorded.
+const MetricsEndpoint = "/metrics"
+
+// Metrics writes the SigningFailures of the MockOIDC and its ScopedMocks
+// as the `mockoidc_signing_failures_total` counter, labeled by mechanism,
+// reason & scope.
+func (m *MockOIDC) Metrics(rw http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	var lines []string
+	for namespace, failures := range m.signingFailures {
+		for failure, count := range failures {
+			lines = append(lines, fmt.Sprintf(
+				"mockoidc_signing_failures_total{mechanism=%q,reason=%q,scope=%q} %d",
+				failure.Mechanism, failure.Reason, namespace, count))
+		}
+	}
+	m.mu.Unlock()
+	sort.Strings(lines)
+
+	noCache(rw)
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = fmt.Fprintf(rw, "# HELP mockoidc_signing_failures_total Signed requests that failed verification.\n"+
+		"# TYPE mockoidc_signing_failures_total counter\n")
+	if len(lines) > 0 {
+		_, _ = fmt.Fprintln(rw, strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,81 @@
+package mockoidc
+
+import (
+	"crypto/subtle"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultMFAACR is the `acr` of logins with a second factor unless MFAACR
+// is set
+const DefaultMFAACR = "http://schemas.openid.net/pape/policies/2007/06/multi-factor"
+
+const mfaPage = "mfa"
+
+var mfaTemplate = template.Must(template.New("mfa").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Verification Code</title></head>
+<body>
+<h1>Enter your verification code</h1>
+{{- if .Error }}
+<p id="error">{{ .Error }}</p>
+{{- end }}
+<form method="post" action="{{ .Action }}">
+<input type="hidden" name="interaction" value="{{ .Interaction }}"/>
+<label>Code <input type="text" id="otp" name="otp" inputmode="numeric" autocomplete="one-time-code"/></label>
+<button type="submit" id="verify">Verify</button>
+</form>
+</body>
+</html>
+`))
+
+// mfaACR is the `acr` requiring the second factor
+func (m *MockOIDC) mfaACR() string {
+	if m.MFAACR != "" {
+		return m.MFAACR
+	}
+	return DefaultMFAACR
+}
+
+// needsMFA reports whether the authorization asked for the MFAACR and
+// hasn't passed the second factor yet
+func (m *MockOIDC) needsMFA(a *authorization) bool {
+	return m.MFACode != "" && a.acr == m.mfaACR() && a.amr == nil
+}
+
+// showMFA renders the one-time password page. `prompt=none` requests
+// fail with `interaction_required` instead.
+func (m *MockOIDC) showMFA(rw http.ResponseWriter, req *http.Request, a *authorization, mfaError string) {
+	if contains(PromptNone, strings.Fields(req.Form.Get("prompt"))) {
+		authorizeError(rw, req, InteractionRequired, "The user must enter a verification code")
+		return
+	}
+
+	id, err := m.pend(req, a, mfaPage)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	htmlResponse(rw, mfaTemplate, struct {
+		Action      string
+		Interaction string
+		Error       string
+	}{pageAction(req), id, mfaError})
+}
+
+// submitMFA checks the posted one-time password against the MFACode. The
+// Session then gets `amr` ["otp"], preceded by "pwd" if the login page
+// checked the User's password. Wrong codes render the page again.
+func (m *MockOIDC) submitMFA(rw http.ResponseWriter, req *http.Request, a *authorization, page url.Values) bool {
+	if subtle.ConstantTimeCompare([]byte(page.Get("otp")), []byte(m.MFACode)) != 1 {
+		m.showMFA(rw, req, a, "Invalid verification code")
+		return false
+	}
+	a.amr = []string{"otp"}
+	if a.passwordChecked {
+		a.amr = []string{"pwd", "otp"}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_MFACode(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.MFACode = "123456"
+
+	// requests without the multi-factor acr skip the second factor
+	rr, _ := showPage(t, m, authorizeData(m))
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	data := authorizeData(m)
+	data.Set("acr_values", mockoidc.DefaultMFAACR)
+	rr, interaction := showPage(t, m, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `id="otp"`)
+
+	form := url.Values{"interaction": {interaction}, "otp": {"654321"}}
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, form)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid verification code")
+	match := interactionPattern.FindStringSubmatch(rr.Body.String())
+	assert.NotNil(t, match)
+
+	location := submitPage(t, m, match[1], url.Values{"otp": {"123456"}})
+	session, err := m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.DefaultMFAACR, session.ACR)
+	// no password was checked without the login page
+	assert.Equal(t, []string{"otp"}, session.AMR)
+
+	m.LoginPage = true
+	assert.NoError(t, m.AddUser(&mockoidc.MockUser{Subject: "alice", Password: "hunter2"}))
+	_, interaction = showPage(t, m, data)
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, url.Values{
+		"interaction": {interaction},
+		"username":    {"alice"},
+		"password":    {"hunter2"},
+	})
+	match = interactionPattern.FindStringSubmatch(rr.Body.String())
+	assert.NotNil(t, match)
+	location = submitPage(t, m, match[1], url.Values{"otp": {"123456"}})
+	session, err = m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pwd", "otp"}, session.AMR)
+
+	// nor for Users without a password
+	assert.NoError(t, m.AddUser(&mockoidc.MockUser{Subject: "bob"}))
+	_, interaction = showPage(t, m, data)
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, url.Values{
+		"interaction": {interaction},
+		"username":    {"bob"},
+		"password":    {"anything"},
+	})
+	match = interactionPattern.FindStringSubmatch(rr.Body.String())
+	assert.NotNil(t, match)
+	location = submitPage(t, m, match[1], url.Values{"otp": {"123456"}})
+	session, err = m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"otp"}, session.AMR)
+
+	m.LoginPage = false
+	data.Set("prompt", "none")
+	rr, _ = showPage(t, m, data)
+	location, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.InteractionRequired, location.Query().Get("error"))
+}
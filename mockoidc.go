@@ -1,13 +1,22 @@
 package mockoidc
 
 import (
+	"bytes"
 	"context"
 	"crypto/rsa"
 	"crypto/tls"
-	"errors"
+	"crypto/x509"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"mime"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
@@ -17,6 +26,9 @@ import (
 // manipulate time can use their own `func() Time` function.
 var NowFunc = time.Now
 
+// DefaultShutdownTimeout is the ShutdownTimeout used if it isn't set
+const DefaultShutdownTimeout = 5 * time.Second
+
 // MockOIDC is a minimal OIDC server for use in OIDC authentication
 // integration testing.
 type MockOIDC struct {
@@ -26,19 +38,365 @@ type MockOIDC struct {
 	AccessTTL  time.Duration
 	RefreshTTL time.Duration
 
+	// IDTokenTTL is the lifetime of ID Tokens. It defaults to AccessTTL.
+	IDTokenTTL time.Duration
+
+	// CodeTTL is how long authorization codes can be redeemed after
+	// they're issued. Zero means they don't expire.
+	CodeTTL time.Duration
+
+	// RefreshMaxLifetime & RefreshIdleTimeout reject `refresh_token`
+	// grants once the session's first tokens were issued longer ago than
+	// the max lifetime, or its last tokens longer ago than the idle
+	// timeout. Zero means no limit.
+	RefreshMaxLifetime time.Duration
+	RefreshIdleTimeout time.Duration
+
+	// Clock is the source of time, instead of NowFunc. FastForward,
+	// SetNow & FreezeTime work on top of it.
+	Clock Clock
+
 	CodeChallengeMethodsSupported []string
 
+	// RequireOfflineAccess only issues refresh tokens to sessions that
+	// requested the `offline_access` scope.
+	RequireOfflineAccess bool
+
+	// LenientClaims returns every User claim in ID Tokens & Userinfo
+	// regardless of the scopes requested.
+	LenientClaims bool
+
+	// AccessTokenClaims & IDTokenClaims are called with the claims of
+	// each token before it is signed.
+	AccessTokenClaims ClaimsHook
+	IDTokenClaims     ClaimsHook
+
+	// IDTokenAudience are audiences of ID tokens besides the client ID.
+	// Setting any makes the `aud` claim an array and adds an `azp` claim.
+	// AccessTokenAudience replaces the client ID as the audience of access
+	// tokens, e.g. with an API's identifier.
+	IDTokenAudience     []string
+	AccessTokenAudience []string
+
+	// OnRequest & OnResponse are called around every request so tests
+	// can synchronize on server activity without writing middleware.
+	OnRequest  RequestHook
+	OnResponse ResponseHook
+
+	// ACR & AMR are set on sessions that don't request specific
+	// `acr_values`. If ACRValuesSupported is set, requested `acr_values`
+	// that aren't in it are rejected.
+	ACR                string
+	AMR                []string
+	ACRValuesSupported []string
+
+	// SkipCodeVerifier simulates a PKCE downgrade: the `token_endpoint`
+	// accepts codes without validating the `code_verifier`. Skipped
+	// validations are reported by PKCEDowngrades.
+	SkipCodeVerifier bool
+
+	// MaxAgeLoginRequired makes requests whose `max_age` has elapsed since
+	// the User last logged in fail with `login_required` instead of
+	// logging the User in again.
+	MaxAgeLoginRequired bool
+
+	// RedirectAuthorizeErrors redirects `authorization_endpoint` errors
+	// to the `redirect_uri` with the `error`, `error_description` & `state`
+	// per RFC 6749, unless the client_id or redirect_uri are invalid.
+	// Otherwise errors get a 4xx error response.
+	RedirectAuthorizeErrors bool
+
+	// StrictValidation rejects requests violating the spec in ways that
+	// are let through otherwise, e.g. duplicate parameters, unknown
+	// response types, OpenID requests without the `openid` scope and
+	// token requests that aren't form encoded POSTs.
+	StrictValidation bool
+
+	// RevokeOnCodeReplay revokes the Session of an authorization code
+	// that is redeemed more than once, so the tokens of its first
+	// redemption stop working (RFC 6749 section 4.1.2).
+	RevokeOnCodeReplay bool
+
+	// InteractionRequired makes `prompt=none` requests from logged in
+	// Users fail with `interaction_required`.
+	InteractionRequired bool
+
+	// MaxSessionsPerUser caps the active sessions of a User with a client.
+	// Logins beyond it revoke the oldest session; revoked & expired
+	// sessions don't count. Zero means no limit.
+	MaxSessionsPerUser int
+
+	// MaxSessionsPerClient caps the active sessions of a client across
+	// Users the same way.
+	MaxSessionsPerClient int
+
+	// ClientPublicKey verifies signed Request Objects passed to the
+	// `authorization_endpoint` in `request` or `request_uri`. Request
+	// Objects are rejected if it isn't set.
+	ClientPublicKey *rsa.PublicKey
+
+	// RequestURIAllowlist limits the `request_uri`s Request Objects are
+	// fetched from to URLs with one of its prefixes. No URL is fetched if
+	// it's empty.
+	RequestURIAllowlist []string
+
+	// Interaction decides the outcome of each `authorization_endpoint`
+	// login, e.g. with an InteractionWebhook. Logins are approved as is
+	// if it isn't set.
+	Interaction InteractionFunc
+
+	// LoginPage shows an HTML login form instead of popping the UserQueue.
+	// Users in the UserStore log in with their ID, email or preferred
+	// username and their password.
+	LoginPage bool
+
+	// MFACode is the static one-time password of a second factor page
+	// shown after login to requests whose `acr` is the MFAACR
+	// (DefaultMFAACR if it's empty), e.g. from their `acr_values`. Their
+	// Sessions get `amr` ["otp"], or ["pwd", "otp"] if the LoginPage
+	// checked the User's password.
+	MFACode string
+	MFAACR  string
+
+	// ConsentPage shows an HTML page after login where the User approves
+	// some or all of the requested scopes, or denies the request.
+	ConsentPage bool
+
+	// NegotiateContent honors Accept headers: Userinfo can respond with
+	// a signed JWT and errors are rendered as HTML pages for browsers.
+	// Otherwise responses are always JSON.
+	NegotiateContent bool
+
+	// UserinfoSignedResponseAlg maps client IDs to the
+	// `userinfo_signed_response_alg` registered for them. Those clients
+	// always get Userinfo as a signed JWT. Only RS256 is supported.
+	UserinfoSignedResponseAlg map[string]string
+
+	// SelfIssued is an experimental Self-Issued OP v2 (SIOPv2) mode. ID
+	// Tokens are issued by SelfIssuedIssuer with the JWK thumbprint of the
+	// signing key as their subject.
+	SelfIssued bool
+
+	// CredentialIssuer serves experimental OpenID for Verifiable Credential
+	// Issuance (OID4VCI) endpoints issuing JWT VCs of Userinfo claims.
+	CredentialIssuer bool
+
+	// Federation serves experimental OpenID Federation Entity
+	// Configurations for the MockOIDC and a trust anchor fixture that is
+	// its superior, signed with TrustAnchorKeypair (random if not set).
+	Federation         bool
+	TrustAnchorKeypair *Keypair
+
+	// DiscoveryOverrides replaces or adds fields of the discovery
+	// document, e.g. `end_session_endpoint` or vendor-specific fields.
+	// A nil value removes the field.
+	DiscoveryOverrides map[string]interface{}
+
+	// Logger receives debug logs of every request, token issuance and
+	// validation failure.
+	Logger Logger
+
+	// AdminToken enables the admin API under AdminBase, authenticated
+	// with the token as a bearer token.
+	AdminToken string
+
+	// CORS allows browser-based RPs to call the CORSEndpoints directly
+	CORS *CORS
+
+	// Quotas cap the tokens issued to clients, keyed by client ID
+	Quotas map[string]Quota
+
+	// Persister saves the State on Shutdown and restores it on Start, so
+	// shared, long-lived deployments survive restarts.
+	Persister Persister
+
+	// Chaos injects latency and faults into responses for resilience
+	// testing. Rules are keyed by endpoint path, e.g. JWKSEndpoint, or
+	// AllEndpoints.
+	Chaos map[string]ChaosRule
+
+	// ChaosSeed makes the Chaos random draws reproducible across runs.
+	// Zero seeds them from the clock.
+	ChaosSeed int64
+
+	// JSONContentType replaces the `application/json` Content-Type of JSON
+	// responses, e.g. with `application/json;charset=UTF-8`. JSONBOM
+	// prefixes their bodies with a UTF-8 byte order mark.
+	JSONContentType string
+	JSONBOM         bool
+
+	// DisableRedaction records requests with their tokens, secrets and
+	// PII intact instead of Redacted.
+	DisableRedaction bool
+
+	// HistoryLimit caps the recorded requests, issued tokens, events &
+	// security lint findings, dropping the oldest, so sustained load tests
+	// have predictable memory usage. Zero keeps them all.
+	HistoryLimit int
+
+	// Profile names the Config presets applied with ApplyConfig. It is
+	// reported by Capabilities.
+	Profile string
+
+	// CapabilityReport receives the Capabilities report as a line of
+	// JSON on Start, e.g. `os.Stderr` to self-document CI logs.
+	CapabilityReport io.Writer
+
+	// IdentityAPIs serves the provider identity APIs clients call after
+	// login (Microsoft Graph `/v1.0/me`, Okta `/api/v1/users/me`, GitHub
+	// `/user`).
+	IdentityAPIs bool
+
+	// PlainOAuth2 turns the MockOIDC into a GitHub style OAuth 2.0
+	// provider without OIDC: no ID Tokens, opaque access tokens, any
+	// scopes, no userinfo, JWKS or discovery endpoints and the GitHubUser
+	// profile API instead.
+	PlainOAuth2 bool
+
+	// FastTokens signs tokens with the shared 1024 bit FastKeypair
+	// instead of the Keypair, raising token throughput for load tests
+	// of downstream gateways where key strength doesn't matter. The
+	// FastKeypair is published in the JWKS first.
+	FastTokens bool
+
+	// TLS settings applied over the tls.Config passed to Start. Zero
+	// values keep the tls.Config settings.
+	TLSMinVersion   uint16
+	TLSMaxVersion   uint16
+	TLSCipherSuites []uint16
+
+	// ShutdownTimeout is how long servers started with StartContext wait
+	// for requests to drain once their context is done. It defaults to
+	// DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+
+	// HTTP2 negotiates HTTP/2 with TLS clients. H2C serves cleartext
+	// HTTP/2 with prior knowledge to non-TLS clients, which needs Go 1.24.
+	HTTP2 bool
+	H2C   bool
+
+	// CanonicalScheme is the scheme (`http` or `https`) of the Issuer of
+	// servers started with StartDualStack. It defaults to `https`.
+	// RedirectHTTP redirects every request to their HTTP listener to
+	// HTTPS instead of serving it.
+	CanonicalScheme string
+	RedirectHTTP    bool
+
+	// IssuerPath serves the Issuer and every endpoint under it at another
+	// path than IssuerBase, e.g. `/realms/test` like Keycloak.
+	IssuerPath string
+
+	// EndpointPaths serves endpoints at other paths of the server as well,
+	// keyed by their endpoint constant, e.g. TokenEndpoint at
+	// `/realms/test/protocol/openid-connect/token`. The endpoints are
+	// advertised at these paths.
+	EndpointPaths map[string]string
+
+	// IssuerURL overrides the advertised Issuer, e.g. with
+	// `http://mockoidc:8080/oidc` so an RP in a Docker network can reach
+	// it. Endpoints are advertised under it, while the server keeps
+	// listening on its own address.
+	IssuerURL string
+
+	// TrustForwardedHeaders advertises the host & scheme of the
+	// `X-Forwarded-Host` & `X-Forwarded-Proto` request headers in the
+	// discovery document & issued tokens, for mocks behind a test
+	// reverse proxy.
+	TrustForwardedHeaders bool
+
+	// BaseURL is the address the MockOIDC is reachable at when it is
+	// served with Handler instead of Start, e.g. the URL of the
+	// `httptest.Server` it's mounted in plus the mount path prefix.
+	BaseURL string
+
 	// Normally, these would be private. Expose them publicly for
 	// power users.
 	Server       *http.Server
 	Keypair      *Keypair
-	SessionStore *SessionStore
+	SessionStore SessionStore
 	UserQueue    *UserQueue
+	UserStore    UserStore
 	ErrorQueue   *ErrorQueue
 
-	tlsConfig   *tls.Config
-	middleware  []func(http.Handler) http.Handler
+	tlsConfig     *tls.Config
+	httpServer    *http.Server
+	testServer    *httptest.Server
+	certPool      *x509.CertPool
+	middleware    []func(http.Handler) http.Handler
+	muxMiddleware []func(http.Handler) http.Handler
+
+	// clockMu guards the view of time, handlers read it concurrently
+	clockMu     sync.RWMutex
 	fastForward time.Duration
+	frozen      bool
+	frozenAt    time.Time
+
+	// stateMu serializes Snapshot & Restore
+	stateMu sync.Mutex
+
+	// shutdownOnce stops a started server once, whether its context was
+	// cancelled or ShutdownContext was called, or both
+	shutdownOnce sync.Once
+	shutdownErr  error
+
+	// chaosMu guards the Chaos random source, so delays & faults don't
+	// contend with the handlers for mu
+	chaosMu    sync.Mutex
+	random     *rand.Rand
+	randomSeed int64
+
+	mu             sync.Mutex
+	pkceDowngrades []PKCEDowngrade
+	authTimes      map[string]time.Time
+	userSessions   map[string][]string
+	clientSessions map[string][]string
+	events         chan Event
+	eventLog       []Event
+
+	clientUserQueues  map[string]*UserQueue
+	clientErrorQueues map[string]*ErrorQueue
+	endpointErrors    map[string]*ErrorQueue
+	tokenResponses    []TokenResponse
+	authorizations    map[string]*authorization
+
+	signingFailures map[string]map[SigningFailure]int
+	usedJTIs        map[string]time.Time
+	tokenSkews      []time.Duration
+	accessTokenTTLs []time.Duration
+	invalidTokens   []InvalidTokenKind
+	lastSessionGC   time.Time
+
+	requests     []RecordedRequest
+	issuances    map[string][]time.Time
+	expectations []*Expectation
+	unexpected   []string
+
+	scopes map[string]*ScopedMock
+
+	deterministicRand *rand.Rand
+	deterministicSeed int64
+
+	retiredKeypairs []*Keypair
+
+	tenants    map[string]*tenant
+	parent     *MockOIDC
+	tenantName string
+
+	issuedTokens       []IssuedToken
+	issuedIndex        map[string]int
+	lintFindings       []LintFinding
+	redirectURIClients map[string]string
+	redirectURIs       []string
+}
+
+// PKCEDowngrade records a `token_endpoint` code exchange where the
+// `code_verifier` validation was skipped because of SkipCodeVerifier.
+// CodeVerifier is what the client sent, empty if it sent none.
+type PKCEDowngrade struct {
+	Code                string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	CodeVerifier        string
 }
 
 // Config gives the various settings MockOIDC starts with that a test
@@ -48,10 +406,80 @@ type Config struct {
 	ClientSecret string
 	Issuer       string
 
+	// IssuerPath & EndpointPaths configure where endpoints are served
+	IssuerPath    string
+	EndpointPaths map[string]string
+
+	// IssuerURL & TrustForwardedHeaders configure the advertised Issuer
+	IssuerURL             string
+	TrustForwardedHeaders bool
+
+	// Profile names the presets the Config is made of
+	Profile string
+
+	// AdminToken enables the admin API
+	AdminToken string
+
+	// DiscoveryOverrides replaces, adds or removes discovery fields
+	DiscoveryOverrides map[string]interface{}
+
+	// Host & Port are the address Listen listens on. ApplyConfig ignores
+	// them.
+	Host string
+	Port int
+
 	AccessTTL  time.Duration
 	RefreshTTL time.Duration
+	IDTokenTTL time.Duration
+	CodeTTL    time.Duration
+
+	RefreshMaxLifetime time.Duration
+	RefreshIdleTimeout time.Duration
+
+	Clock Clock `json:"-"`
+
+	// SessionStore replaces the default ShardedSessionStore
+	SessionStore SessionStore `json:"-"`
 
 	CodeChallengeMethodsSupported []string
+
+	RequireOfflineAccess    bool
+	LenientClaims           bool
+	SelfIssued              bool
+	PlainOAuth2             bool
+	IdentityAPIs            bool
+	FastTokens              bool
+	RedirectAuthorizeErrors bool
+	StrictValidation        bool
+	RevokeOnCodeReplay      bool
+
+	// DeterministicSeed makes the MockOIDC Deterministic with the seed
+	DeterministicSeed int64
+
+	HistoryLimit int
+
+	AccessTokenClaims ClaimsHook `json:"-"`
+	IDTokenClaims     ClaimsHook `json:"-"`
+
+	IDTokenAudience     []string
+	AccessTokenAudience []string
+
+	OnRequest  RequestHook  `json:"-"`
+	OnResponse ResponseHook `json:"-"`
+
+	// ChaosSeed, ChaosErrorRate & ChaosJitter configure the AllEndpoints
+	// ChaosRule reproducibly.
+	ChaosSeed      int64
+	ChaosErrorRate float64
+	ChaosJitter    time.Duration
+
+	JSONContentType string
+	JSONBOM         bool
+
+	// Explicit names the settings that Merge applies even though they
+	// are false or zero, e.g. `[]ConfigField{FieldLenientClaims}` to turn
+	// LenientClaims off again.
+	Explicit []ConfigField `json:"-"`
 }
 
 // NewServer configures a new MockOIDC that isn't started. An existing
@@ -78,8 +506,9 @@ func NewServer(key *rsa.PrivateKey) (*MockOIDC, error) {
 		RefreshTTL:                    time.Duration(60) * time.Minute,
 		CodeChallengeMethodsSupported: []string{"plain", "S256"},
 		Keypair:                       keypair,
-		SessionStore:                  NewSessionStore(),
+		SessionStore:                  NewShardedSessionStore(DefaultSessionShards),
 		UserQueue:                     &UserQueue{},
+		UserStore:                     NewMemoryUserStore(),
 		ErrorQueue:                    &ErrorQueue{},
 	}, nil
 }
@@ -106,59 +535,336 @@ func RunTLS(cfg *tls.Config) (*MockOIDC, error) {
 // Start starts the MockOIDC server in its own Goroutine on the provided
 // net.Listener. In generic `Run`, this defaults to `127.0.0.1:0`
 func (m *MockOIDC) Start(ln net.Listener, cfg *tls.Config) error {
+	return m.StartContext(context.Background(), ln, cfg)
+}
+
+// StartContext is Start with a context. The server is gracefully shut
+// down when it is done: it stops accepting connections and waits up to
+// ShutdownTimeout for the requests in flight to drain.
+func (m *MockOIDC) StartContext(ctx context.Context, ln net.Listener, cfg *tls.Config) error {
 	if m.Server != nil {
-		return errors.New("server already started")
+		return ErrServerStarted
+	}
+	if err := m.loadState(); err != nil {
+		return err
 	}
 
-	handler := http.NewServeMux()
-	handler.Handle(AuthorizationEndpoint, m.chainMiddleware(m.Authorize))
-	handler.Handle(TokenEndpoint, m.chainMiddleware(m.Token))
-	handler.Handle(UserinfoEndpoint, m.chainMiddleware(m.Userinfo))
-	handler.Handle(JWKSEndpoint, m.chainMiddleware(m.JWKS))
-	handler.Handle(DiscoveryEndpoint, m.chainMiddleware(m.Discovery))
+	cfg = m.applyTLSSettings(cfg)
+	if cfg != nil {
+		ln = tls.NewListener(ln, cfg)
+	}
+
+	srv := &http.Server{
+		Addr:      listenerAddr(ln),
+		Handler:   m.newHandler(),
+		TLSConfig: cfg,
+	}
+	if cfg == nil && m.H2C {
+		if err := enableH2C(srv); err != nil {
+			return err
+		}
+	}
+	m.Server = srv
+	// Track this to know if we are https
+	m.tlsConfig = cfg
+
+	if err := m.writeCapabilities(); err != nil {
+		return err
+	}
 
+	go serve(m.Server, ln)
+	if ctx.Done() != nil {
+		go func() {
+			<-ctx.Done()
+			timeout, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout())
+			defer cancel()
+			_ = m.ShutdownContext(timeout)
+		}()
+	}
+
+	return nil
+}
+
+// Serve starts the MockOIDC server without TLS on a caller provided
+// net.Listener, e.g. a unix socket, an in-memory listener or a pre-bound
+// port. Non-TCP listeners are addressed as `localhost` unless BaseURL is
+// set.
+func (m *MockOIDC) Serve(ln net.Listener) error {
+	return m.Start(ln, nil)
+}
+
+// StartDualStack starts the MockOIDC server on both an HTTP and an HTTPS
+// net.Listener. CanonicalScheme picks which of them is the Issuer.
+func (m *MockOIDC) StartDualStack(httpLn, httpsLn net.Listener, cfg *tls.Config) error {
+	if m.Server != nil {
+		return ErrServerStarted
+	}
+	cfg = m.applyTLSSettings(cfg)
+	if cfg == nil {
+		return ErrTLSConfigRequired
+	}
+	if err := m.loadState(); err != nil {
+		return err
+	}
+
+	handler := m.newHandler()
+	httpsLn = tls.NewListener(httpsLn, cfg)
 	m.Server = &http.Server{
-		Addr:      ln.Addr().String(),
+		Addr:      listenerAddr(httpsLn),
 		Handler:   handler,
 		TLSConfig: cfg,
 	}
-	// Track this to know if we are https
 	m.tlsConfig = cfg
 
-	go func() {
-		err := m.Server.Serve(ln)
-		if err != nil && err != http.ErrServerClosed {
-			panic(err)
-		}
-	}()
+	httpHandler := handler
+	if m.RedirectHTTP {
+		httpHandler = m.redirectToHTTPS()
+	}
+	m.httpServer = &http.Server{
+		Addr:    listenerAddr(httpLn),
+		Handler: httpHandler,
+	}
+
+	if err := m.writeCapabilities(); err != nil {
+		return err
+	}
+
+	go serve(m.Server, httpsLn)
+	go serve(m.httpServer, httpLn)
 
 	return nil
 }
 
+// Handler wires every endpoint onto a mux without starting the server, so
+// it can be mounted in an existing `httptest.Server` or test router. Set
+// BaseURL to the address it's mounted at. Middleware must be added
+// before calling it.
+func (m *MockOIDC) Handler() http.Handler {
+	return m.newHandler()
+}
+
+// newHandler routes every endpoint through the middleware chain
+func (m *MockOIDC) newHandler() http.Handler {
+	handler := http.NewServeMux()
+	handler.Handle(AuthorizationEndpoint, m.chainMiddleware(m.Authorize))
+	handler.Handle(TokenEndpoint, m.chainMiddleware(m.Token))
+	if !m.PlainOAuth2 {
+		handler.Handle(UserinfoEndpoint, m.chainMiddleware(m.Userinfo))
+		handler.Handle(JWKSEndpoint, m.chainMiddleware(m.JWKS))
+		handler.Handle(DiscoveryEndpoint, m.chainMiddleware(m.Discovery))
+		handler.Handle(AuthorizationServerMetadataEndpoint, m.chainMiddleware(m.AuthorizationServerMetadata))
+	}
+	if m.IdentityAPIs {
+		handler.Handle(GraphMeEndpoint, m.chainMiddleware(m.GraphMe))
+		handler.Handle(OktaMeEndpoint, m.chainMiddleware(m.OktaMe))
+	}
+	if m.IdentityAPIs || m.PlainOAuth2 {
+		handler.Handle(GitHubUserEndpoint, m.chainMiddleware(m.GitHubUser))
+	}
+	if m.CredentialIssuer {
+		handler.Handle(CredentialIssuerMetadataEndpoint, m.chainMiddleware(m.CredentialIssuerMetadata))
+		handler.Handle(CredentialOfferEndpoint, m.chainMiddleware(m.CredentialOffer))
+		handler.Handle(CredentialEndpoint, m.chainMiddleware(m.Credential))
+	}
+	if m.Federation {
+		handler.Handle(FederationEndpoint, m.chainMiddleware(m.EntityConfiguration))
+		handler.Handle(TrustAnchorEndpoint, m.chainMiddleware(m.TrustAnchorConfiguration))
+		handler.Handle(TrustAnchorFetchEndpoint, m.chainMiddleware(m.TrustAnchorFetch))
+		handler.Handle(SignedJWKSEndpoint, m.chainMiddleware(m.SignedJWKS))
+	}
+
+	issuer := m.issuerPathHandler(handler)
+	root := http.NewServeMux()
+	root.Handle("/", issuer)
+	root.Handle(ScopesBase, m.scopeHandler(issuer))
+	root.Handle(TenantsBase, m.tenantHandler())
+	root.Handle(authorizationServerMetadataPath+"/", wellKnownHandler(root))
+	root.HandleFunc(HealthEndpoint, m.Health)
+	root.HandleFunc(ReadyEndpoint, m.Ready)
+	root.HandleFunc(MetricsEndpoint, m.Metrics)
+	if m.AdminToken != "" {
+		root.Handle(AdminBase+"/", m.adminHandler())
+	}
+
+	var mux http.Handler = root
+	for i := len(m.muxMiddleware) - 1; i >= 0; i-- {
+		mux = m.muxMiddleware[i](mux)
+	}
+	return mux
+}
+
+// redirectToHTTPS permanently redirects HTTP requests to the same URL on
+// the HTTPS listener. 308 keeps the method & body of POST requests.
+func (m *MockOIDC) redirectToHTTPS() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.Redirect(rw, req, m.HTTPSAddr()+req.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// listenerAddr is the host & port of TCP listeners. Other listeners have
+// no address clients can dial by URL, so they're addressed as localhost.
+func listenerAddr(ln net.Listener) string {
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok {
+		return addr.String()
+	}
+	return "localhost"
+}
+
+func serve(srv *http.Server, ln net.Listener) {
+	err := srv.Serve(ln)
+	if err != nil && err != http.ErrServerClosed {
+		panic(err)
+	}
+}
+
+func (m *MockOIDC) applyTLSSettings(cfg *tls.Config) *tls.Config {
+	if cfg == nil {
+		return nil
+	}
+	cfg = cfg.Clone()
+	if m.TLSMinVersion != 0 {
+		cfg.MinVersion = m.TLSMinVersion
+	}
+	if m.TLSMaxVersion != 0 {
+		cfg.MaxVersion = m.TLSMaxVersion
+	}
+	if len(m.TLSCipherSuites) > 0 {
+		cfg.CipherSuites = m.TLSCipherSuites
+	}
+	if m.HTTP2 && !contains("h2", cfg.NextProtos) {
+		cfg.NextProtos = append([]string{"h2"}, cfg.NextProtos...)
+		if !contains("http/1.1", cfg.NextProtos) {
+			cfg.NextProtos = append(cfg.NextProtos, "http/1.1")
+		}
+	}
+	return cfg
+}
+
 // Shutdown stops the MockOIDC server. Use this to cleanup test runs.
+// The State is saved if a Persister is set.
 func (m *MockOIDC) Shutdown() error {
-	return m.Server.Shutdown(context.Background())
+	return m.ShutdownContext(context.Background())
+}
+
+// ShutdownContext gracefully stops the MockOIDC server: it stops accepting
+// connections and drains the requests in flight. If the context is done
+// first, the remaining connections are closed and the context error is
+// returned. Pending writes of the SessionStore, e.g. a FileSessionStore,
+// are flushed. A started server is only shut down once, later calls return
+// the result of the first.
+func (m *MockOIDC) ShutdownContext(ctx context.Context) error {
+	if m.Server == nil && m.testServer == nil {
+		return m.shutdownContext(ctx)
+	}
+	m.shutdownOnce.Do(func() {
+		m.shutdownErr = m.shutdownContext(ctx)
+	})
+	return m.shutdownErr
+}
+
+func (m *MockOIDC) shutdownContext(ctx context.Context) error {
+	if err := m.shutdown(ctx); err != nil {
+		return err
+	}
+	if store, ok := m.SessionStore.(interface{ Flush() error }); ok {
+		if err := store.Flush(); err != nil {
+			return err
+		}
+	}
+	return m.saveState()
+}
+
+func (m *MockOIDC) shutdown(ctx context.Context) error {
+	if m.testServer != nil {
+		m.testServer.Close()
+		return nil
+	}
+	for _, srv := range []*http.Server{m.httpServer, m.Server} {
+		if srv == nil {
+			continue
+		}
+		if err := srv.Shutdown(ctx); err != nil {
+			_ = srv.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MockOIDC) shutdownTimeout() time.Duration {
+	if m.ShutdownTimeout > 0 {
+		return m.ShutdownTimeout
+	}
+	return DefaultShutdownTimeout
 }
 
 func (m *MockOIDC) AddMiddleware(mw func(http.Handler) http.Handler) error {
 	if m.Server != nil {
-		return errors.New("server already started")
+		return ErrServerStarted
 	}
 
 	m.middleware = append(m.middleware, mw)
 	return nil
 }
 
+// Use wraps the whole server mux in middleware before it is started.
+// Unlike AddMiddleware, it also sees requests no endpoint handles. The
+// first middleware passed is the outermost.
+func (m *MockOIDC) Use(mw ...func(http.Handler) http.Handler) error {
+	if m.Server != nil {
+		return ErrServerStarted
+	}
+
+	m.muxMiddleware = append(m.muxMiddleware, mw...)
+	return nil
+}
+
 // Config returns the Config with options a connection application or unit
 // tests need to be aware of.
 func (m *MockOIDC) Config() *Config {
+	chaos := m.Chaos[AllEndpoints]
 	return &Config{
 		ClientID:                      m.ClientID,
 		ClientSecret:                  m.ClientSecret,
 		Issuer:                        m.Issuer(),
+		IssuerPath:                    m.IssuerPath,
+		EndpointPaths:                 m.EndpointPaths,
+		IssuerURL:                     m.IssuerURL,
+		TrustForwardedHeaders:         m.TrustForwardedHeaders,
+		AdminToken:                    m.AdminToken,
+		DiscoveryOverrides:            m.DiscoveryOverrides,
+		Profile:                       m.Profile,
 		CodeChallengeMethodsSupported: m.CodeChallengeMethodsSupported,
 		AccessTTL:                     m.AccessTTL,
 		RefreshTTL:                    m.RefreshTTL,
+		IDTokenTTL:                    m.IDTokenTTL,
+		CodeTTL:                       m.CodeTTL,
+		RefreshMaxLifetime:            m.RefreshMaxLifetime,
+		RefreshIdleTimeout:            m.RefreshIdleTimeout,
+		Clock:                         m.Clock,
+		SessionStore:                  m.SessionStore,
+		RequireOfflineAccess:          m.RequireOfflineAccess,
+		LenientClaims:                 m.LenientClaims,
+		SelfIssued:                    m.SelfIssued,
+		PlainOAuth2:                   m.PlainOAuth2,
+		IdentityAPIs:                  m.IdentityAPIs,
+		FastTokens:                    m.FastTokens,
+		RedirectAuthorizeErrors:       m.RedirectAuthorizeErrors,
+		StrictValidation:              m.StrictValidation,
+		RevokeOnCodeReplay:            m.RevokeOnCodeReplay,
+		DeterministicSeed:             m.deterministicSeed,
+		HistoryLimit:                  m.HistoryLimit,
+		AccessTokenClaims:             m.AccessTokenClaims,
+		IDTokenClaims:                 m.IDTokenClaims,
+		IDTokenAudience:               m.IDTokenAudience,
+		AccessTokenAudience:           m.AccessTokenAudience,
+		OnRequest:                     m.OnRequest,
+		OnResponse:                    m.OnResponse,
+		ChaosSeed:                     m.ChaosSeed,
+		ChaosErrorRate:                chaos.ErrorRate,
+		ChaosJitter:                   chaos.Jitter,
+		JSONContentType:               m.JSONContentType,
+		JSONBOM:                       m.JSONBOM,
 	}
 }
 
@@ -169,12 +875,97 @@ func (m *MockOIDC) QueueUser(user User) {
 	m.UserQueue.Push(user)
 }
 
+// AddUser adds a mock User to the UserStore, a new MemoryUserStore if it
+// isn't set. `authorization_endpoint` calls with a matching `login_hint`
+// (the User's ID or email) select it instead of popping the UserQueue.
+func (m *MockOIDC) AddUser(user User) error {
+	if m.UserStore == nil {
+		m.UserStore = NewMemoryUserStore()
+	}
+	store, ok := m.UserStore.(interface{ AddUser(User) })
+	if !ok {
+		return ErrUserStoreReadOnly
+	}
+	store.AddUser(user)
+	return nil
+}
+
+// QueueClientUser queues a mock User for `authorization_endpoint` calls
+// with the client_id only. Client queues take precedence over the shared
+// UserQueue, so parallel tests using their own clients don't interfere.
+func (m *MockOIDC) QueueClientUser(clientID string, user User) {
+	m.ClientUserQueue(clientID).Push(user)
+}
+
+// ClientUserQueue returns the UserQueue of a client_id
+func (m *MockOIDC) ClientUserQueue(clientID string) *UserQueue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.clientUserQueues == nil {
+		m.clientUserQueues = make(map[string]*UserQueue)
+	}
+	if _, ok := m.clientUserQueues[clientID]; !ok {
+		m.clientUserQueues[clientID] = &UserQueue{}
+	}
+	return m.clientUserQueues[clientID]
+}
+
+// PeekUser returns the next User the UserQueue will return without
+// removing it, or nil if the queue is empty.
+func (m *MockOIDC) PeekUser() User {
+	return m.UserQueue.Peek()
+}
+
+// ClearQueue removes every queued User, code, error and TokenResponse,
+// including the client and endpoint queues.
+func (m *MockOIDC) ClearQueue() {
+	m.UserQueue.Clear()
+	if codes := m.codeQueue(); codes != nil {
+		codes.Clear()
+	}
+	m.ErrorQueue.Clear()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clientUserQueues = nil
+	m.clientErrorQueues = nil
+	m.endpointErrors = nil
+	m.tokenResponses = nil
+}
+
 // QueueCode allows adding mock code strings to the authentication queue.
 // Calls to the `authorization_endpoint` will pop these code strings
 // off the queue and create a session with them and return them as the
-// code parameter in the response.
+// code parameter in the response. It's a no-op with SessionStores that
+// don't have a CodeQueue.
 func (m *MockOIDC) QueueCode(code string) {
-	m.SessionStore.CodeQueue.Push(code)
+	if codes := m.codeQueue(); codes != nil {
+		codes.Push(code)
+	}
+}
+
+// saveSession puts a changed Session back in SessionStores that support
+// it, so persistent stores save the change. Stores with a
+// `SaveSession(*Session) error` method report failed saves.
+func (m *MockOIDC) saveSession(session *Session) error {
+	m.installSessionClock()
+	switch store := m.SessionStore.(type) {
+	case interface{ SaveSession(*Session) error }:
+		return store.SaveSession(session)
+	case interface{ PutSession(*Session) }:
+		store.PutSession(session)
+	}
+	return nil
+}
+
+// codeQueue returns the CodeQueue of the SessionStore, if it has one
+func (m *MockOIDC) codeQueue() *CodeQueue {
+	store, ok := m.SessionStore.(interface{ Codes() *CodeQueue })
+	if !ok {
+		return nil
+	}
+	return store.Codes()
 }
 
 // QueueError allows queueing arbitrary errors for the next handler calls
@@ -183,16 +974,112 @@ func (m *MockOIDC) QueueError(se *ServerError) {
 	m.ErrorQueue.Push(se)
 }
 
+// QueueClientError queues an error for the next handler call whose
+// request has the client_id (as a parameter or Basic auth user). Client
+// queues take precedence over the shared ErrorQueue.
+func (m *MockOIDC) QueueClientError(clientID string, se *ServerError) {
+	m.ClientErrorQueue(clientID).Push(se)
+}
+
+// ClientErrorQueue returns the ErrorQueue of a client_id
+func (m *MockOIDC) ClientErrorQueue(clientID string) *ErrorQueue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.clientErrorQueues == nil {
+		m.clientErrorQueues = make(map[string]*ErrorQueue)
+	}
+	if _, ok := m.clientErrorQueues[clientID]; !ok {
+		m.clientErrorQueues[clientID] = &ErrorQueue{}
+	}
+	return m.clientErrorQueues[clientID]
+}
+
+// QueueEndpointError makes the next count calls to an endpoint fail with
+// the status and OAuth error, e.g. a 500 from the JWKSEndpoint. The
+// endpoint can be a path like `mockoidc.JWKSEndpoint` or a full URL like
+// `m.JWKSEndpoint()`. Endpoint errors take precedence over other queues.
+func (m *MockOIDC) QueueEndpointError(endpoint string, status int, oauthError string, count int) {
+	endpoint = m.endpointPath(endpoint)
+
+	m.mu.Lock()
+	if m.endpointErrors == nil {
+		m.endpointErrors = make(map[string]*ErrorQueue)
+	}
+	if _, ok := m.endpointErrors[endpoint]; !ok {
+		m.endpointErrors[endpoint] = &ErrorQueue{}
+	}
+	q := m.endpointErrors[endpoint]
+	m.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		q.Push(&ServerError{
+			Code:        status,
+			Error:       oauthError,
+			Description: fmt.Sprintf("Injected %s error for %s", oauthError, endpoint),
+		})
+	}
+}
+
+// QueuedUsers is the number of Users in the UserQueue and client queues
+func (m *MockOIDC) QueuedUsers() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queued := m.UserQueue.Len()
+	for _, q := range m.clientUserQueues {
+		queued += q.Len()
+	}
+	return queued
+}
+
+// QueuedErrors is the number of errors in the ErrorQueue, client and
+// endpoint queues
+func (m *MockOIDC) QueuedErrors() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queued := m.ErrorQueue.Len()
+	for _, q := range m.clientErrorQueues {
+		queued += q.Len()
+	}
+	for _, q := range m.endpointErrors {
+		queued += q.Len()
+	}
+	return queued
+}
+
+// PKCEDowngrades returns every code exchange where the `code_verifier`
+// check was skipped due to SkipCodeVerifier.
+func (m *MockOIDC) PKCEDowngrades() []PKCEDowngrade {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]PKCEDowngrade(nil), m.pkceDowngrades...)
+}
+
 // FastForward moves the MockOIDC's internal view of time forward.
-// Use this to test token expirations in your tests.
+// Use this to test token expirations in your tests. The total offset
+// saturates instead of overflowing on very large durations.
 func (m *MockOIDC) FastForward(d time.Duration) time.Duration {
-	m.fastForward = m.fastForward + d
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+
+	switch {
+	case d > 0 && m.fastForward > math.MaxInt64-d:
+		m.fastForward = math.MaxInt64
+	case d < 0 && m.fastForward < math.MinInt64-d:
+		m.fastForward = math.MinInt64
+	default:
+		m.fastForward = m.fastForward + d
+	}
 	return m.fastForward
 }
 
 // Now is what MockOIDC thinks time.Now is
 func (m *MockOIDC) Now() time.Time {
-	return NowFunc().Add(m.fastForward)
+	m.clockMu.RLock()
+	defer m.clockMu.RUnlock()
+	return m.clock().Add(m.fastForward)
 }
 
 // TimeReset is a function that resets time
@@ -208,11 +1095,22 @@ func (m *MockOIDC) Synchronize() TimeReset {
 	return func() { jwt.TimeFunc = original }
 }
 
-// Addr returns the server address (if started)
+// Addr returns the server address (if started) or the BaseURL. Dual
+// stack servers return the address of their CanonicalScheme, tenants the
+// address of their prefix on the server hosting them.
 func (m *MockOIDC) Addr() string {
+	if m.BaseURL != "" {
+		return strings.TrimSuffix(m.BaseURL, "/")
+	}
+	if m.parent != nil {
+		return m.tenantAddr()
+	}
 	if m.Server == nil {
 		return ""
 	}
+	if m.httpServer != nil && m.CanonicalScheme == "http" {
+		return m.HTTPAddr()
+	}
 	proto := "http"
 	if m.tlsConfig != nil {
 		proto = "https"
@@ -220,56 +1118,100 @@ func (m *MockOIDC) Addr() string {
 	return fmt.Sprintf("%s://%s", proto, m.Server.Addr)
 }
 
-// Issuer returns the OIDC Issuer that will be in `iss` token claims
-func (m *MockOIDC) Issuer() string {
-	if m.Server == nil {
+// endpoint returns the full URL of an endpoint path (if started)
+func (m *MockOIDC) endpoint(path string) string {
+	return m.endpointFor(nil, path)
+}
+
+// HTTPAddr returns the address of the HTTP listener of a dual stack
+// server, or of a server started without TLS.
+func (m *MockOIDC) HTTPAddr() string {
+	switch {
+	case m.httpServer != nil:
+		return "http://" + m.httpServer.Addr
+	case m.Server != nil && m.tlsConfig == nil:
+		return "http://" + m.Server.Addr
+	}
+	return ""
+}
+
+// HTTPSAddr returns the address of the HTTPS listener, if any
+func (m *MockOIDC) HTTPSAddr() string {
+	if m.Server == nil || m.tlsConfig == nil {
 		return ""
 	}
-	return m.Addr() + IssuerBase
+	return "https://" + m.Server.Addr
+}
+
+// Issuer returns the OIDC Issuer that will be in `iss` token claims
+func (m *MockOIDC) Issuer() string {
+	return m.endpoint(IssuerBase)
 }
 
 // DiscoveryEndpoint returns the full `/.well-known/openid-configuration` URL
 func (m *MockOIDC) DiscoveryEndpoint() string {
-	if m.Server == nil {
-		return ""
-	}
-	return m.Addr() + DiscoveryEndpoint
+	return m.endpoint(DiscoveryEndpoint)
 }
 
 // AuthorizationEndpoint returns the OIDC `authorization_endpoint`
 func (m *MockOIDC) AuthorizationEndpoint() string {
-	if m.Server == nil {
-		return ""
-	}
-	return m.Addr() + AuthorizationEndpoint
+	return m.endpoint(AuthorizationEndpoint)
 }
 
 // TokenEndpoint returns the OIDC `token_endpoint`
 func (m *MockOIDC) TokenEndpoint() string {
-	if m.Server == nil {
-		return ""
-	}
-	return m.Addr() + TokenEndpoint
+	return m.endpoint(TokenEndpoint)
 }
 
 // UserinfoEndpoint returns the OIDC `userinfo_endpoint`
 func (m *MockOIDC) UserinfoEndpoint() string {
-	if m.Server == nil {
-		return ""
-	}
-	return m.Addr() + UserinfoEndpoint
+	return m.endpoint(UserinfoEndpoint)
 }
 
 // JWKSEndpoint returns the OIDC `jwks_uri`
 func (m *MockOIDC) JWKSEndpoint() string {
-	if m.Server == nil {
-		return ""
-	}
-	return m.Addr() + JWKSEndpoint
+	return m.endpoint(JWKSEndpoint)
+}
+
+// GraphMeEndpoint returns the Microsoft Graph `/v1.0/me` URL
+func (m *MockOIDC) GraphMeEndpoint() string {
+	return m.endpoint(GraphMeEndpoint)
+}
+
+// GitHubUserEndpoint returns the GitHub `/user` URL
+func (m *MockOIDC) GitHubUserEndpoint() string {
+	return m.endpoint(GitHubUserEndpoint)
+}
+
+// OktaMeEndpoint returns the Okta `/api/v1/users/me` URL
+func (m *MockOIDC) OktaMeEndpoint() string {
+	return m.endpoint(OktaMeEndpoint)
+}
+
+// CredentialIssuerMetadataEndpoint returns the OID4VCI
+// `/.well-known/openid-credential-issuer` URL
+func (m *MockOIDC) CredentialIssuerMetadataEndpoint() string {
+	return m.endpoint(CredentialIssuerMetadataEndpoint)
+}
+
+// CredentialOfferEndpoint returns the OID4VCI Credential Offer URL
+func (m *MockOIDC) CredentialOfferEndpoint() string {
+	return m.endpoint(CredentialOfferEndpoint)
+}
+
+// CredentialEndpoint returns the OID4VCI `credential_endpoint`
+func (m *MockOIDC) CredentialEndpoint() string {
+	return m.endpoint(CredentialEndpoint)
+}
+
+// FederationEndpoint returns the OpenID Federation
+// `/.well-known/openid-federation` URL
+func (m *MockOIDC) FederationEndpoint() string {
+	return m.endpoint(FederationEndpoint)
 }
 
 func (m *MockOIDC) chainMiddleware(endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
-	chain := m.forceError(http.HandlerFunc(endpoint))
+	chain := m.cors(m.recordRequests(m.logRequests(m.hooks(m.chaos(m.encodeResponses(m.negotiateContent(m.forceError(http.HandlerFunc(endpoint)))))))))
 	for i := len(m.middleware) - 1; i >= 0; i-- {
 		mw := m.middleware[i]
 		chain = mw(chain)
@@ -277,10 +1219,80 @@ func (m *MockOIDC) chainMiddleware(endpoint func(http.ResponseWriter, *http.Requ
 	return chain
 }
 
+// popError pops the next error queued for the request's ScopedMock, or its
+// endpoint or client, falling back to the shared ErrorQueue.
+func (m *MockOIDC) popError(req *http.Request) *ServerError {
+	if scope := requestScope(req); scope != nil {
+		return scope.ErrorQueue.Pop()
+	}
+
+	m.mu.Lock()
+	var endpointQueue *ErrorQueue
+	if req.URL != nil {
+		endpointQueue = m.endpointErrors[req.URL.Path]
+	}
+	clientQueues := len(m.clientErrorQueues) > 0
+	m.mu.Unlock()
+
+	if endpointQueue != nil {
+		if se := endpointQueue.Pop(); se != nil {
+			return se
+		}
+	}
+	if clientQueues {
+		if se := m.ClientErrorQueue(requestClientID(req)).Pop(); se != nil {
+			return se
+		}
+	}
+	return m.ErrorQueue.Pop()
+}
+
+// maxPeekedForm is how much of a form body requestClientID reads, as much
+// as ParseForm does
+const maxPeekedForm = 10 << 20
+
+// requestClientID is the client_id of a request from its Basic auth
+// credentials or parameters. It doesn't parse the form of the request:
+// a form body is read and put back, so handlers get the whole body.
+func requestClientID(req *http.Request) string {
+	if clientID, _, ok := req.BasicAuth(); ok {
+		return clientID
+	}
+	if req.Form != nil {
+		return req.Form.Get("client_id")
+	}
+	if req.Body != nil && hasFormBody(req) {
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxPeekedForm))
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		if err == nil {
+			// like ParseForm, body parameters take precedence
+			if values, _ := url.ParseQuery(string(body)); values.Get("client_id") != "" {
+				return values.Get("client_id")
+			}
+		}
+	}
+	return req.URL.Query().Get("client_id")
+}
+
+// hasFormBody reports whether ParseForm would parse the body of the
+// request
+func hasFormBody(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
 func (m *MockOIDC) forceError(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		if se := m.ErrorQueue.Pop(); se != nil {
-			errorResponse(rw, se.Error, se.Description, se.Code)
+		if se := m.popError(req); se != nil {
+			NewOAuthError(se.Error, se.Description, se.Code).Write(rw)
 		} else {
 			next.ServeHTTP(rw, req)
 		}
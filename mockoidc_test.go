@@ -2,12 +2,24 @@ package mockoidc_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -139,7 +151,7 @@ func TestRun(t *testing.T) {
 	// ************************************************************************
 	userinfoReq, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
 	assert.NoError(t, err)
-	userinfoReq.Header.Add("Authorization", fmt.Sprintf("Bearer %s", tokens["id_token"]))
+	userinfoReq.Header.Add("Authorization", fmt.Sprintf("Bearer %s", tokens["access_token"]))
 
 	resp, err = httpClient.Do(userinfoReq)
 	assert.NoError(t, err)
@@ -152,7 +164,7 @@ func TestRun(t *testing.T) {
 
 	expiredReq, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
 	assert.NoError(t, err)
-	userinfoReq.Header.Add("Authorization", fmt.Sprintf("Bearer %s", tokens["id_token"]))
+	userinfoReq.Header.Add("Authorization", fmt.Sprintf("Bearer %s", tokens["access_token"]))
 
 	resp, err = httpClient.Do(expiredReq)
 	assert.NoError(t, err)
@@ -202,7 +214,7 @@ func TestRun(t *testing.T) {
 	userinfoReq2, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
 	assert.NoError(t, err)
 	userinfoReq2.Header.Add("Authorization",
-		fmt.Sprintf("Bearer %s", refreshedTokens["id_token"]))
+		fmt.Sprintf("Bearer %s", refreshedTokens["access_token"]))
 
 	resp, err = httpClient.Do(userinfoReq2)
 	assert.NoError(t, err)
@@ -302,6 +314,122 @@ func TestMockOIDC_QueueError(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
+func TestMockOIDC_QueueEndpointError(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	m.QueueEndpointError(mockoidc.JWKSEndpoint, http.StatusInternalServerError,
+		mockoidc.InternalServerError, 2)
+	m.QueueEndpointError(m.DiscoveryEndpoint(), http.StatusServiceUnavailable,
+		mockoidc.InternalServerError, 1)
+	assert.Equal(t, 3, m.QueuedErrors())
+
+	get := func(endpoint string) int {
+		resp, err := httpClient.Get(endpoint)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// other endpoints are unaffected
+	assert.Equal(t, http.StatusUnauthorized, get(m.UserinfoEndpoint()))
+
+	assert.Equal(t, http.StatusInternalServerError, get(m.JWKSEndpoint()))
+	assert.Equal(t, http.StatusInternalServerError, get(m.JWKSEndpoint()))
+	assert.Equal(t, http.StatusOK, get(m.JWKSEndpoint()))
+
+	assert.Equal(t, http.StatusServiceUnavailable, get(m.DiscoveryEndpoint()))
+	assert.Equal(t, http.StatusOK, get(m.DiscoveryEndpoint()))
+	assert.Equal(t, 0, m.QueuedErrors())
+}
+
+func TestMockOIDC_ClientQueues(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	alice := &mockoidc.MockUser{Subject: "alice"}
+	bob := &mockoidc.MockUser{Subject: "bob"}
+	m.QueueUser(alice)
+	m.QueueClientUser(m.ClientID, bob)
+	m.QueueClientError("other-client", &mockoidc.ServerError{
+		Code:        http.StatusServiceUnavailable,
+		Error:       mockoidc.InternalServerError,
+		Description: "Other Client Error",
+	})
+
+	assert.Equal(t, alice, m.PeekUser())
+	assert.Equal(t, 2, m.QueuedUsers())
+	assert.Equal(t, 1, m.QueuedErrors())
+	assert.Equal(t, bob, m.ClientUserQueue(m.ClientID).Peek())
+
+	authorize := func(clientID, code string) *http.Response {
+		m.QueueCode(code)
+		data := url.Values{}
+		data.Set("scope", "openid")
+		data.Set("response_type", "code")
+		data.Set("redirect_uri", "example.com")
+		data.Set("state", "testState")
+		data.Set("client_id", clientID)
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + data.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	sessionUser := func(code string) mockoidc.User {
+		session, err := m.SessionStore.GetSessionByID(code)
+		assert.NoError(t, err)
+		return session.User
+	}
+
+	// client queues take precedence, other clients' queues are untouched
+	authorize(m.ClientID, "code-1")
+	assert.Equal(t, bob, sessionUser("code-1"))
+	assert.Equal(t, 1, m.QueuedErrors())
+
+	authorize(m.ClientID, "code-2")
+	assert.Equal(t, alice, sessionUser("code-2"))
+
+	resp := authorize("other-client", "code-3")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 0, m.QueuedErrors())
+
+	// the client_id of form bodies is read without consuming them
+	m.QueueClientError("other-client", &mockoidc.ServerError{
+		Code:  http.StatusServiceUnavailable,
+		Error: mockoidc.InternalServerError,
+	})
+	postAuthorize := func(clientID string) *http.Response {
+		resp, err := httpClient.PostForm(m.AuthorizationEndpoint(), url.Values{
+			"scope":         {"openid"},
+			"response_type": {"code"},
+			"redirect_uri":  {"example.com"},
+			"state":         {"testState"},
+			"client_id":     {clientID},
+		})
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	resp = postAuthorize(m.ClientID)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, "testState", location.Query().Get("state"))
+	assert.Equal(t, 1, m.QueuedErrors())
+	resp = postAuthorize("other-client")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 0, m.QueuedErrors())
+
+	// ClearQueue empties every queue
+	m.QueueUser(alice)
+	m.QueueClientUser(m.ClientID, bob)
+	m.ClearQueue()
+	assert.Nil(t, m.PeekUser())
+	assert.Equal(t, 0, m.QueuedUsers())
+}
+
 func TestMockOIDC_AddMiddleware(t *testing.T) {
 	before := 0
 	after := 0
@@ -344,7 +472,290 @@ func TestMockOIDC_AddMiddleware(t *testing.T) {
 
 	// no new middleware allowed after starting
 	err = m.AddMiddleware(flagger)
+	assert.True(t, errors.Is(err, mockoidc.ErrServerStarted))
+}
+
+func TestMockOIDC_Use(t *testing.T) {
+	var order []string
+	tagger := func(tag string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				order = append(order, tag+" "+req.URL.Path)
+				rw.Header().Add("X-Middleware", tag)
+				next.ServeHTTP(rw, req)
+			})
+		}
+	}
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Use(tagger("outer"), tagger("inner")))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"outer", "inner"}, resp.Header.Values("X-Middleware"))
+
+	// requests no endpoint handles go through the middleware too
+	resp, err = httpClient.Get(m.Addr() + "/unknown")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, []string{
+		"outer " + mockoidc.DiscoveryEndpoint,
+		"inner " + mockoidc.DiscoveryEndpoint,
+		"outer /unknown",
+		"inner /unknown",
+	}, order)
+
+	err = m.Use(tagger("late"))
+	assert.True(t, errors.Is(err, mockoidc.ErrServerStarted))
+}
+
+func TestMockOIDC_Handler(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", m.Issuer())
+
+	router := http.NewServeMux()
+	router.Handle("/idp/", http.StripPrefix("/idp", m.Handler()))
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	m.BaseURL = srv.URL + "/idp/"
+
+	assert.Equal(t, srv.URL+"/idp"+mockoidc.IssuerBase, m.Issuer())
+	assert.Equal(t, srv.URL+"/idp"+mockoidc.TokenEndpoint, m.TokenEndpoint())
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	discovery := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	assert.Equal(t, m.Issuer(), discovery["issuer"])
+	assert.Equal(t, m.JWKSEndpoint(), discovery["jwks_uri"])
+
+	resp, err = httpClient.Get(discovery["jwks_uri"].(string))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMockOIDC_Serve(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "mockoidc.sock")
+	ln, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Serve(ln))
+	defer m.Shutdown()
+	assert.Equal(t, "http://localhost"+mockoidc.IssuerBase, m.Issuer())
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	resp, err := client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	discovery := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	assert.Equal(t, m.TokenEndpoint(), discovery["token_endpoint"])
+
+	assert.True(t, errors.Is(m.Serve(ln), mockoidc.ErrServerStarted))
+}
+
+func TestMockOIDC_StartContext(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	started, release := make(chan struct{}), make(chan struct{})
+	cancelled := make(chan error, 1)
+	m.OnRequest = func(endpoint string, req *http.Request) {
+		if !strings.HasSuffix(endpoint, mockoidc.JWKSEndpoint) {
+			return
+		}
+		close(started)
+		<-release
+		cancelled <- req.Context().Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.StartContext(ctx, ln, nil))
+
+	done := make(chan int)
+	go func() {
+		resp, err := http.Get(m.JWKSEndpoint())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+	<-started
+	cancel()
+
+	// new connections are refused while the request in flight is drained
+	assert.Eventually(t, func() bool {
+		_, err := http.Get(m.DiscoveryEndpoint())
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	close(release)
+	assert.NoError(t, <-cancelled)
+	assert.Equal(t, http.StatusOK, <-done)
+}
+
+func TestMockOIDC_ShutdownContext(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	started, release := make(chan struct{}), make(chan struct{})
+	m.OnRequest = func(string, *http.Request) {
+		close(started)
+		<-release
+	}
+	handled := make(chan struct{})
+	m.OnResponse = func(string, int, []byte) {
+		close(handled)
+	}
+
+	go func() {
+		resp, err := http.Get(m.JWKSEndpoint())
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = m.ShutdownContext(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	close(release)
+	<-handled
+}
+
+// flushCountingStore counts the Flush calls of a shutdown
+type flushCountingStore struct {
+	mockoidc.SessionStore
+	flushes int32
+}
+
+func (s *flushCountingStore) Flush() error {
+	atomic.AddInt32(&s.flushes, 1)
+	return nil
+}
+
+func TestMockOIDC_ShutdownOnce(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	store := &flushCountingStore{SessionStore: m.SessionStore}
+	m.SessionStore = store
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.StartContext(ctx, ln, nil))
+
+	// the cancelled context & Shutdown race to stop the server
+	cancel()
+	assert.NoError(t, m.Shutdown())
+	assert.NoError(t, m.Shutdown())
+	_, err = http.Get(m.DiscoveryEndpoint())
 	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&store.flushes))
+}
+
+func TestMockOIDC_TLSSettings(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.TLSMinVersion = tls.VersionTLS12
+	m.TLSMaxVersion = tls.VersionTLS12
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	err = m.Start(ln, selfSignedTLSConfig(t))
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	dial := func(minVersion, maxVersion uint16) error {
+		conn, err := tls.Dial("tcp", m.Server.Addr, &tls.Config{
+			InsecureSkipVerify: true,
+			MinVersion:         minVersion,
+			MaxVersion:         maxVersion,
+		})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	assert.NoError(t, dial(tls.VersionTLS12, tls.VersionTLS13))
+	assert.Error(t, dial(tls.VersionTLS13, tls.VersionTLS13))
+}
+
+func TestMockOIDC_StartDualStack(t *testing.T) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: httpClient.CheckRedirect,
+	}
+	listen := func() net.Listener {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		return ln
+	}
+	issuer := func(addr string) string {
+		resp, err := client.Get(addr + mockoidc.DiscoveryEndpoint)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		discovery := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+		return discovery["issuer"].(string)
+	}
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	err = m.StartDualStack(listen(), listen(), nil)
+	assert.True(t, errors.Is(err, mockoidc.ErrTLSConfigRequired))
+
+	assert.NoError(t, m.StartDualStack(listen(), listen(), selfSignedTLSConfig(t)))
+	defer m.Shutdown()
+
+	assert.Equal(t, m.HTTPSAddr()+mockoidc.IssuerBase, m.Issuer())
+	assert.Equal(t, m.Issuer(), issuer(m.HTTPAddr()))
+	assert.Equal(t, m.Issuer(), issuer(m.HTTPSAddr()))
+
+	m.CanonicalScheme = "http"
+	assert.Equal(t, m.HTTPAddr()+mockoidc.IssuerBase, m.Issuer())
+	assert.Equal(t, m.Issuer(), issuer(m.HTTPSAddr()))
+
+	redirecting, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	redirecting.RedirectHTTP = true
+	assert.NoError(t, redirecting.StartDualStack(listen(), listen(), selfSignedTLSConfig(t)))
+	defer redirecting.Shutdown()
+
+	resp, err := client.Get(redirecting.HTTPAddr() + mockoidc.DiscoveryEndpoint + "?a=b")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, redirecting.DiscoveryEndpoint()+"?a=b", resp.Header.Get("Location"))
 }
 
 func TestMockOIDC_FastForward(t *testing.T) {
@@ -360,6 +771,30 @@ func TestMockOIDC_FastForward(t *testing.T) {
 	ff2 := m.FastForward(time.Duration(456))
 	assert.Equal(t, time.Duration(579), ff2)
 	assert.Equal(t, mockoidc.NowFunc().Add(time.Duration(579)), m.Now())
+
+	ff3 := m.FastForward(time.Duration(math.MaxInt64))
+	assert.Equal(t, time.Duration(math.MaxInt64), ff3)
+}
+
+func selfSignedTLSConfig(t *testing.T) *tls.Config {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}},
+	}
 }
 
 func setTime() {
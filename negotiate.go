@@ -0,0 +1,160 @@
+package mockoidc
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	applicationJWT = "application/jwt"
+	textHTML       = "text/html"
+)
+
+var errorPageTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{ .Error }}</title></head>
+<body>
+<h1>{{ .Error }}</h1>
+<p>{{ .Description }}</p>
+</body>
+</html>
+`))
+
+// preferredContentType returns the offer the Accept header ranks highest.
+// Ties go to the earliest offer, and an empty Accept header accepts the
+// first offer. It returns "" if no offer is acceptable.
+func preferredContentType(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q := acceptQuality(accept, offer)
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q-value the Accept header gives a media type,
+// using the most specific matching range.
+func acceptQuality(accept, mediaType string) float64 {
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		accepted, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch {
+		case accepted == mediaType:
+			s = 2
+		case accepted == "*/*":
+			s = 0
+		case strings.HasSuffix(accepted, "/*") &&
+			strings.HasPrefix(mediaType, strings.TrimSuffix(accepted, "*")):
+			s = 1
+		default:
+			continue
+		}
+		if s < specificity {
+			continue
+		}
+
+		partQ := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				partQ = parsed
+			}
+		}
+		q, specificity = partQ, s
+	}
+	return q
+}
+
+// wantsJWT reports whether content negotiation picked a JWT response
+func (m *MockOIDC) wantsJWT(req *http.Request) bool {
+	return m.NegotiateContent &&
+		preferredContentType(req.Header.Get("Accept"), []string{applicationJSON, applicationJWT}) == applicationJWT
+}
+
+// jwtResponse signs the JSON claims as the response body
+func (m *MockOIDC) jwtResponse(rw http.ResponseWriter, claims jwt.MapClaims) {
+	signed, err := m.Keypair.SignJWT(claims)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	noCache(rw)
+	rw.Header().Set("Content-Type", applicationJWT)
+	rw.WriteHeader(http.StatusOK)
+
+	_, _ = rw.Write([]byte(signed))
+}
+
+// negotiateContent renders JSON error responses as HTML pages for clients
+// that prefer HTML, when NegotiateContent is enabled.
+func (m *MockOIDC) negotiateContent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		offers := []string{applicationJSON, applicationJWT, textHTML}
+		if !m.NegotiateContent ||
+			preferredContentType(req.Header.Get("Accept"), offers) != textHTML {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		buffer := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buffer, req)
+
+		for key, values := range buffer.header {
+			rw.Header()[key] = values
+		}
+
+		errJSON := map[string]string{}
+		if buffer.status >= http.StatusBadRequest &&
+			strings.HasPrefix(buffer.header.Get("Content-Type"), applicationJSON) &&
+			json.Unmarshal(buffer.body.Bytes(), &errJSON) == nil {
+			var page bytes.Buffer
+			err := errorPageTemplate.Execute(&page, struct {
+				Error       string
+				Description string
+			}{errJSON["error"], errJSON["error_description"]})
+			if err == nil {
+				rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+				buffer.body = page
+			}
+		}
+
+		rw.WriteHeader(buffer.status)
+		_, _ = rw.Write(buffer.body.Bytes())
+	})
+}
+
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
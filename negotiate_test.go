@@ -0,0 +1,69 @@
+package mockoidc_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_NegotiateContent(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	session, err := m.SessionStore.NewSession(
+		"openid email", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	accessToken, err := session.AccessToken(m.Config(), m.Keypair, m.Now())
+	assert.NoError(t, err)
+
+	get := func(endpoint, accept string, authorized bool) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Accept", accept)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		resp, err := httpClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp, string(body)
+	}
+
+	// disabled by default
+	resp, _ := get(m.UserinfoEndpoint(), "application/jwt", true)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	m.NegotiateContent = true
+
+	// signed userinfo
+	resp, body := get(m.UserinfoEndpoint(), "application/jwt, application/json;q=0.5", true)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/jwt", resp.Header.Get("Content-Type"))
+	token, err := m.Keypair.VerifyJWT(body)
+	assert.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, mockoidc.DefaultUser().Subject, claims["sub"])
+	assert.Equal(t, mockoidc.DefaultUser().Email, claims["email"])
+
+	// JSON preferred
+	resp, _ = get(m.UserinfoEndpoint(), "application/json, application/jwt;q=0.5", true)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	// HTML error pages
+	resp, body = get(m.UserinfoEndpoint(), "text/html,application/xhtml+xml,*/*;q=0.8", false)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+	assert.Contains(t, body, "<h1>"+mockoidc.InvalidRequest+"</h1>")
+
+	// successful responses stay JSON
+	resp, _ = get(m.DiscoveryEndpoint(), "text/html,*/*;q=0.8", false)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+}
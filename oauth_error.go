@@ -0,0 +1,115 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// OAuthError is an OAuth 2.0 error response. Every handler responds with
+// them, so custom handlers can write consistent errors with Write.
+// `errors.Is` matches OAuthErrors by Code, e.g. against ErrInvalidGrant.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	StatusCode  int    `json:"-"`
+}
+
+// OAuthErrors of the error codes MockOIDC responds with, with the status
+// codes its handlers use. They are values: Describe & WithStatus return
+// copies with an `error_description` or another status code, so
+// describing an error doesn't change it for other handlers. Don't
+// reassign them, the handlers respond with them.
+var (
+	ErrInvalidRequest                  = OAuthError{Code: InvalidRequest, StatusCode: http.StatusBadRequest}
+	ErrInvalidClient                   = OAuthError{Code: InvalidClient, StatusCode: http.StatusUnauthorized}
+	ErrInvalidGrant                    = OAuthError{Code: InvalidGrant, StatusCode: http.StatusUnauthorized}
+	ErrUnsupportedGrantType            = OAuthError{Code: UnsupportedGrantType, StatusCode: http.StatusBadRequest}
+	ErrInvalidScope                    = OAuthError{Code: InvalidScope, StatusCode: http.StatusBadRequest}
+	ErrInvalidBearerToken              = OAuthError{Code: InvalidToken, StatusCode: http.StatusUnauthorized}
+	ErrInsufficientScope               = OAuthError{Code: InsufficientScope, StatusCode: http.StatusForbidden}
+	ErrInternalServerError             = OAuthError{Code: InternalServerError, StatusCode: http.StatusInternalServerError}
+	ErrUnmetAuthenticationRequirements = OAuthError{Code: UnmetAuthenticationRequirements, StatusCode: http.StatusBadRequest}
+	ErrLoginRequired                   = OAuthError{Code: LoginRequired, StatusCode: http.StatusBadRequest}
+	ErrInteractionRequired             = OAuthError{Code: InteractionRequired, StatusCode: http.StatusBadRequest}
+	ErrConsentRequired                 = OAuthError{Code: ConsentRequired, StatusCode: http.StatusBadRequest}
+	ErrAccessDenied                    = OAuthError{Code: AccessDenied, StatusCode: http.StatusForbidden}
+	ErrInvalidRequestObject            = OAuthError{Code: InvalidRequestObject, StatusCode: http.StatusBadRequest}
+	ErrInvalidRequestURI               = OAuthError{Code: InvalidRequestURI, StatusCode: http.StatusBadRequest}
+	ErrRequestNotSupported             = OAuthError{Code: RequestNotSupported, StatusCode: http.StatusBadRequest}
+	ErrUnsupportedResponseType         = OAuthError{Code: UnsupportedResponseType, StatusCode: http.StatusBadRequest}
+	ErrInvalidCredentialRequest        = OAuthError{Code: InvalidCredentialRequest, StatusCode: http.StatusBadRequest}
+	ErrUnsupportedCredentialType       = OAuthError{Code: UnsupportedCredentialType, StatusCode: http.StatusBadRequest}
+	ErrInvalidProof                    = OAuthError{Code: InvalidProof, StatusCode: http.StatusBadRequest}
+	ErrNotFound                        = OAuthError{Code: NotFound, StatusCode: http.StatusNotFound}
+)
+
+// NewOAuthError creates an OAuthError
+func NewOAuthError(code, description string, statusCode int) *OAuthError {
+	return &OAuthError{
+		Code:        code,
+		Description: description,
+		StatusCode:  statusCode,
+	}
+}
+
+// Error returns the code and description
+func (e OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// Is reports whether the target is an OAuthError with the same Code
+func (e OAuthError) Is(target error) bool {
+	switch t := target.(type) {
+	case OAuthError:
+		return t.Code == e.Code
+	case *OAuthError:
+		return t != nil && t.Code == e.Code
+	}
+	return false
+}
+
+// Describe returns a copy of the OAuthError with a formatted description
+func (e OAuthError) Describe(format string, args ...interface{}) *OAuthError {
+	description := format
+	if len(args) > 0 {
+		description = fmt.Sprintf(format, args...)
+	}
+	return NewOAuthError(e.Code, description, e.StatusCode)
+}
+
+// WithStatus returns a copy of the OAuthError with another status code
+func (e OAuthError) WithStatus(statusCode int) *OAuthError {
+	return NewOAuthError(e.Code, e.Description, statusCode)
+}
+
+// Write writes the OAuthError as a JSON error response. Errors of
+// `authorization_endpoint` requests are redirected to the client instead
+// with RedirectAuthorizeErrors. It returns the error of writing the body,
+// e.g. when the client went away.
+func (e OAuthError) Write(rw http.ResponseWriter) error {
+	if r, ok := rw.(*errorRedirect); ok {
+		authorizeError(r.ResponseWriter, r.req, e.Code, e.Description)
+		return nil
+	}
+
+	statusCode := e.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusBadRequest
+	}
+	resp, err := json.Marshal(e)
+	if err != nil {
+		http.Error(rw, e.Code, http.StatusInternalServerError)
+		return err
+	}
+
+	noCache(rw)
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(statusCode)
+
+	_, err = rw.Write(resp)
+	return err
+}
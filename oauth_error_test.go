@@ -0,0 +1,81 @@
+package mockoidc_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOAuthError(t *testing.T) {
+	err := mockoidc.ErrInvalidGrant.Describe("Invalid code: %s", "abc")
+	assert.Equal(t, "invalid_grant: Invalid code: abc", err.Error())
+	assert.Equal(t, http.StatusUnauthorized, err.StatusCode)
+	assert.Empty(t, mockoidc.ErrInvalidGrant.Description)
+
+	wrapped := fmt.Errorf("token exchange: %w", err.WithStatus(http.StatusBadRequest))
+	assert.True(t, errors.Is(wrapped, mockoidc.ErrInvalidGrant))
+	assert.False(t, errors.Is(wrapped, mockoidc.ErrInvalidClient))
+
+	var oauthErr *mockoidc.OAuthError
+	assert.True(t, errors.As(wrapped, &oauthErr))
+	assert.Equal(t, http.StatusBadRequest, oauthErr.StatusCode)
+	assert.Equal(t, "Invalid code: abc", oauthErr.Description)
+	assert.Equal(t, http.StatusUnauthorized, mockoidc.ErrInvalidGrant.StatusCode)
+}
+
+func TestOAuthError_Write(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	custom := func(rw http.ResponseWriter, req *http.Request) {
+		mockoidc.ErrAccessDenied.Describe("Custom handlers can deny too").Write(rw)
+	}
+
+	rr := httptest.NewRecorder()
+	custom(rr, httptest.NewRequest(http.MethodGet, "/custom", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"access_denied","error_description":"Custom handlers can deny too"}`,
+		rr.Body.String())
+
+	// built-in handlers respond with the same error model
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, nil)
+	errResp := mockoidc.OAuthError{}
+	assert.NoError(t, getJSON(rr, &errResp))
+	assert.True(t, errors.Is(&errResp, mockoidc.ErrInvalidRequest))
+}
+
+// failingWriter is a ResponseWriter of a client that went away
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func TestOAuthError_WriteError(t *testing.T) {
+	rw := failingWriter{httptest.NewRecorder()}
+	err := mockoidc.ErrInvalidRequest.Describe("Too late").Write(rw)
+	assert.EqualError(t, err, "connection reset by peer")
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestMockOIDC_WriteError(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.NegotiateContent = true
+
+	// responses to clients that went away don't panic
+	for _, accept := range []string{"application/json", "text/html"} {
+		rw := failingWriter{httptest.NewRecorder()}
+		req := httptest.NewRequest(http.MethodGet, mockoidc.DiscoveryEndpoint, nil)
+		req.Header.Set("Accept", accept)
+		assert.NotPanics(t, func() { m.Handler().ServeHTTP(rw, req) })
+		assert.Equal(t, http.StatusOK, rw.Code)
+	}
+}
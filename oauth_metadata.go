@@ -0,0 +1,55 @@
+package mockoidc
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AuthorizationServerMetadataEndpoint serves the RFC 8414 OAuth 2.0
+// Authorization Server Metadata relative to the issuer. It's also served
+// at the RFC 8414 location, with the well-known path inserted before the
+// issuer path, e.g. `/.well-known/oauth-authorization-server/oidc`.
+const (
+	AuthorizationServerMetadataEndpoint = "/oidc/.well-known/oauth-authorization-server"
+
+	authorizationServerMetadataPath = "/.well-known/oauth-authorization-server"
+)
+
+// AuthorizationServerMetadata serves the RFC 8414 metadata that plain
+// OAuth 2.0 libraries look up. The OpenID Connect discovery document is a
+// superset of it, so the same document is served.
+func (m *MockOIDC) AuthorizationServerMetadata(rw http.ResponseWriter, req *http.Request) {
+	m.Discovery(rw, req)
+}
+
+// AuthorizationServerMetadataEndpoint returns the full RFC 8414
+// `/.well-known/oauth-authorization-server` URL of the Issuer
+func (m *MockOIDC) AuthorizationServerMetadataEndpoint() string {
+	u, err := url.Parse(m.Issuer())
+	if err != nil || m.Issuer() == "" {
+		return ""
+	}
+	u.Path = authorizationServerMetadataPath + u.Path
+	return u.String()
+}
+
+// wellKnownHandler serves requests to the RFC 8414 location by rewriting
+// them to the metadata endpoint under the issuer path that follows the
+// well-known path. Issuer paths under the well-known path are rejected, as
+// they'd be rewritten back to this handler.
+func wellKnownHandler(root http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		issuerPath := strings.TrimPrefix(req.URL.Path, authorizationServerMetadataPath)
+		if issuerPath == "" || issuerPath == "/" ||
+			strings.HasPrefix(issuerPath+"/", authorizationServerMetadataPath+"/") {
+			http.NotFound(rw, req)
+			return
+		}
+
+		rewritten := req.Clone(req.Context())
+		rewritten.URL.Path = strings.TrimSuffix(issuerPath, "/") + authorizationServerMetadataPath
+		rewritten.URL.RawPath = ""
+		root.ServeHTTP(rw, rewritten)
+	})
+}
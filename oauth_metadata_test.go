@@ -0,0 +1,53 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_AuthorizationServerMetadata(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.IssuerPath = "/realms/test"
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+
+	assert.Equal(t, m.Addr()+"/.well-known/oauth-authorization-server/realms/test",
+		m.AuthorizationServerMetadataEndpoint())
+
+	for _, endpoint := range []string{
+		m.AuthorizationServerMetadataEndpoint(),
+		m.Issuer() + "/.well-known/oauth-authorization-server",
+	} {
+		resp, err := http.Get(endpoint)
+		assert.NoError(t, err)
+		metadata := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&metadata))
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, m.Issuer(), metadata["issuer"])
+		assert.Equal(t, m.TokenEndpoint(), metadata["token_endpoint"])
+		assert.Contains(t, metadata, "code_challenge_methods_supported")
+	}
+	assert.Len(t, m.RequestsTo(mockoidc.AuthorizationServerMetadataEndpoint), 2)
+
+	for _, path := range []string{
+		"/.well-known/oauth-authorization-server",
+		"/.well-known/oauth-authorization-server/.well-known/oauth-authorization-server",
+		"/.well-known/oauth-authorization-server/.well-known/oauth-authorization-server/x",
+	} {
+		resp, err := http.Get(m.Addr() + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
@@ -0,0 +1,264 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// State is the persistable runtime state of a MockOIDC: its sessions,
+// clients, the MockUsers of its UserStore and the request & token audit
+// log.
+type State struct {
+	Sessions     []PersistedSession
+	Clients      []PersistedClient
+	Users        []*MockUser
+	Requests     []RecordedRequest
+	IssuedTokens []IssuedToken
+}
+
+// PersistedClient is the credentials of a client, so RPs configured with
+// random default ones keep working after a restart.
+type PersistedClient struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// PersistedSession is a Session with its User saved by ID. MockUsers are
+// saved in full.
+type PersistedSession struct {
+	SessionID           string
+	Scopes              []string
+	OIDCNonce           string
+	UserID              string
+	MockUser            *MockUser `json:",omitempty"`
+	Granted             bool
+	CodeChallenge       string
+	CodeChallengeMethod string
+	ACR                 string
+	AMR                 []string
+	AuthTime            time.Time
+	ClientID            string
+	Revoked             bool
+	Namespace           string
+	CodeIssuedAt        time.Time
+	IssuedAt            time.Time
+	RefreshedAt         time.Time
+	ExpiresAt           time.Time
+}
+
+// Persister saves & loads the State of shared, long-lived MockOIDC
+// deployments so they survive restarts.
+type Persister interface {
+	Save(*State) error
+	// Load returns a nil State if nothing was saved yet
+	Load() (*State, error)
+}
+
+// FilePersister persists the State as a JSON file that can be inspected
+// while debugging.
+type FilePersister struct {
+	Path string
+}
+
+// Save writes the State to the file
+func (p *FilePersister) Save(state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.Path, data, 0600)
+}
+
+// Load reads the State from the file
+func (p *FilePersister) Load() (*State, error) {
+	data, err := ioutil.ReadFile(p.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &State{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Snapshot returns the current State
+func (m *MockOIDC) Snapshot() *State {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	var sessions []*Session
+	if store, ok := m.SessionStore.(interface{ ListSessions() []*Session }); ok {
+		sessions = store.ListSessions()
+	}
+
+	m.mu.Lock()
+	state := &State{
+		Clients:      []PersistedClient{{ClientID: m.ClientID, ClientSecret: m.ClientSecret}},
+		Requests:     append([]RecordedRequest(nil), m.requests...),
+		IssuedTokens: append([]IssuedToken(nil), m.issuedTokens...),
+	}
+	for _, session := range sessions {
+		state.Sessions = append(state.Sessions, persistSession(session))
+	}
+	m.mu.Unlock()
+
+	sort.Slice(state.Sessions, func(i, j int) bool {
+		return state.Sessions[i].SessionID < state.Sessions[j].SessionID
+	})
+
+	if m.UserStore != nil {
+		for _, user := range m.UserStore.ListUsers() {
+			if mu, ok := user.(*MockUser); ok {
+				state.Users = append(state.Users, mu)
+			}
+		}
+	}
+	return state
+}
+
+// Restore replaces the sessions, client credentials & audit log with
+// those of the State and adds its Users to the UserStore. Sessions of
+// Users that aren't MockUsers are looked up in the UserStore by ID.
+func (m *MockOIDC) Restore(state *State) error {
+	store, ok := m.SessionStore.(interface {
+		ListSessions() []*Session
+		PutSession(*Session)
+	})
+	if !ok {
+		return ErrSessionStoreReadOnly
+	}
+
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	if m.UserStore != nil {
+		for _, user := range state.Users {
+			if _, err := m.UserStore.GetUserByID(user.ID()); err == nil {
+				continue
+			}
+			if err := m.AddUser(user); err != nil {
+				return err
+			}
+		}
+	}
+
+	sessions := make([]*Session, 0, len(state.Sessions))
+	for _, persisted := range state.Sessions {
+		session, err := persisted.session(m.UserStore)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, session)
+	}
+	for _, session := range store.ListSessions() {
+		m.SessionStore.Delete(session.SessionID)
+	}
+	for _, session := range sessions {
+		if err := m.saveSession(session); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(state.Clients) > 0 {
+		m.ClientID = state.Clients[0].ClientID
+		m.ClientSecret = state.Clients[0].ClientSecret
+	}
+	m.requests = append([]RecordedRequest(nil), state.Requests...)
+	m.issuedTokens = append([]IssuedToken(nil), state.IssuedTokens...)
+	m.issuedIndex = nil
+	return nil
+}
+
+// persistSession saves the User of a Session by ID, or in full if it's a
+// MockUser.
+func persistSession(session *Session) PersistedSession {
+	persisted := PersistedSession{
+		SessionID:           session.SessionID,
+		Scopes:              session.Scopes,
+		OIDCNonce:           session.OIDCNonce,
+		Granted:             session.Granted,
+		CodeChallenge:       session.CodeChallenge,
+		CodeChallengeMethod: session.CodeChallengeMethod,
+		ACR:                 session.ACR,
+		AMR:                 session.AMR,
+		AuthTime:            session.AuthTime,
+		ClientID:            session.ClientID,
+		Revoked:             session.Revoked,
+		Namespace:           session.Namespace,
+		CodeIssuedAt:        session.CodeIssuedAt,
+		IssuedAt:            session.IssuedAt,
+		RefreshedAt:         session.RefreshedAt,
+		ExpiresAt:           session.ExpiresAt,
+	}
+	if session.User != nil {
+		persisted.UserID = session.User.ID()
+		persisted.MockUser, _ = session.User.(*MockUser)
+	}
+	return persisted
+}
+
+// session restores the Session, looking its User up in the UserStore
+// unless it's a MockUser.
+func (p PersistedSession) session(users UserStore) (*Session, error) {
+	var user User = p.MockUser
+	if p.MockUser == nil {
+		if users == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, p.UserID)
+		}
+		found, err := users.GetUserByID(p.UserID)
+		if err != nil {
+			return nil, err
+		}
+		user = found
+	}
+	return &Session{
+		SessionID:           p.SessionID,
+		Scopes:              p.Scopes,
+		OIDCNonce:           p.OIDCNonce,
+		User:                user,
+		Granted:             p.Granted,
+		CodeChallenge:       p.CodeChallenge,
+		CodeChallengeMethod: p.CodeChallengeMethod,
+		ACR:                 p.ACR,
+		AMR:                 p.AMR,
+		AuthTime:            p.AuthTime,
+		ClientID:            p.ClientID,
+		Revoked:             p.Revoked,
+		Namespace:           p.Namespace,
+		CodeIssuedAt:        p.CodeIssuedAt,
+		IssuedAt:            p.IssuedAt,
+		RefreshedAt:         p.RefreshedAt,
+		ExpiresAt:           p.ExpiresAt,
+	}, nil
+}
+
+// loadState restores the State saved by the Persister, if any
+func (m *MockOIDC) loadState() error {
+	if m.Persister == nil {
+		return nil
+	}
+	state, err := m.Persister.Load()
+	if err != nil || state == nil {
+		return err
+	}
+	return m.Restore(state)
+}
+
+// saveState saves the State with the Persister, if any
+func (m *MockOIDC) saveState() error {
+	if m.Persister == nil {
+		return nil
+	}
+	return m.Persister.Save(m.Snapshot())
+}
@@ -0,0 +1,150 @@
+package mockoidc
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// sqlTables are the tables SQLPersister saves each part of the State in
+var sqlTables = []string{
+	"mockoidc_sessions",
+	"mockoidc_clients",
+	"mockoidc_users",
+	"mockoidc_requests",
+	"mockoidc_tokens",
+}
+
+// SQLPersister persists the State in a SQL database, e.g. SQLite, so it
+// can be inspected with SQL while debugging. Every table has a row per
+// session, client, user, request or token, with an `id`, its `position`
+// in the State and the JSON `data`. The database/sql driver is up to the
+// caller; the standalone binary registers SQLite when built with the
+// `sqlite` tag.
+type SQLPersister struct {
+	DB *sql.DB
+}
+
+// Save replaces the saved State in a single transaction
+func (p *SQLPersister) Save(state *State) error {
+	if err := p.createTables(); err != nil {
+		return err
+	}
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := saveSQLState(tx, state); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Load reads the State, or returns nil if nothing was saved yet
+func (p *SQLPersister) Load() (*State, error) {
+	if err := p.createTables(); err != nil {
+		return nil, err
+	}
+
+	state := &State{}
+	targets := []interface{}{&state.Sessions, &state.Clients, &state.Users, &state.Requests, &state.IssuedTokens}
+	empty := true
+	for i, table := range sqlTables {
+		rows, err := p.loadRows(table)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		empty = false
+		if err := json.Unmarshal(rows, targets[i]); err != nil {
+			return nil, fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	if empty {
+		return nil, nil
+	}
+	return state, nil
+}
+
+func (p *SQLPersister) createTables() error {
+	for _, table := range sqlTables {
+		_, err := p.DB.Exec("CREATE TABLE IF NOT EXISTS " + table +
+			" (id TEXT PRIMARY KEY, position INTEGER NOT NULL, data TEXT NOT NULL)")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadRows reads the data of a table as a JSON array, or nil if it has no
+// rows.
+func (p *SQLPersister) loadRows(table string) (json.RawMessage, error) {
+	rows, err := p.DB.Query("SELECT data FROM " + table + " ORDER BY position")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []json.RawMessage
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		items = append(items, json.RawMessage(data))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(items)
+}
+
+func saveSQLState(tx *sql.Tx, state *State) error {
+	rows := map[string][]sqlRow{}
+	for _, session := range state.Sessions {
+		rows["mockoidc_sessions"] = append(rows["mockoidc_sessions"], sqlRow{session.SessionID, session})
+	}
+	for _, client := range state.Clients {
+		rows["mockoidc_clients"] = append(rows["mockoidc_clients"], sqlRow{client.ClientID, client})
+	}
+	for _, user := range state.Users {
+		rows["mockoidc_users"] = append(rows["mockoidc_users"], sqlRow{user.ID(), user})
+	}
+	for i, req := range state.Requests {
+		rows["mockoidc_requests"] = append(rows["mockoidc_requests"], sqlRow{fmt.Sprint(i), req})
+	}
+	for i, token := range state.IssuedTokens {
+		rows["mockoidc_tokens"] = append(rows["mockoidc_tokens"], sqlRow{fmt.Sprint(i), token})
+	}
+
+	for _, table := range sqlTables {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+		for i, row := range rows[table] {
+			data, err := json.Marshal(row.value)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO "+table+" (id, position, data) VALUES (?, ?, ?)",
+				row.id, i, string(data))
+			if err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sqlRow is a row of a SQLPersister table
+type sqlRow struct {
+	id    string
+	value interface{}
+}
@@ -0,0 +1,147 @@
+package mockoidc_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSQL is a database/sql driver understanding the statements of the
+// SQLPersister, keeping the tables of each DSN in memory
+type fakeSQL struct {
+	sync.Mutex
+	dbs map[string]map[string][]fakeSQLRow
+}
+
+type fakeSQLRow struct {
+	position int64
+	data     string
+}
+
+var fakeSQLDriver = &fakeSQL{dbs: map[string]map[string][]fakeSQLRow{}}
+
+func init() {
+	sql.Register("fakesql", fakeSQLDriver)
+}
+
+func (d *fakeSQL) Open(name string) (driver.Conn, error) {
+	d.Lock()
+	defer d.Unlock()
+	if d.dbs[name] == nil {
+		d.dbs[name] = map[string][]fakeSQLRow{}
+	}
+	return &fakeSQLConn{driver: d, tables: d.dbs[name]}, nil
+}
+
+type fakeSQLConn struct {
+	driver *fakeSQL
+	tables map[string][]fakeSQLRow
+}
+
+func (c *fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeSQLStmt{conn: c, fields: strings.Fields(query)}, nil
+}
+
+func (c *fakeSQLConn) Close() error              { return nil }
+func (c *fakeSQLConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *fakeSQLConn) Commit() error             { return nil }
+func (c *fakeSQLConn) Rollback() error           { return nil }
+
+type fakeSQLStmt struct {
+	conn   *fakeSQLConn
+	fields []string
+}
+
+func (s *fakeSQLStmt) Close() error { return nil }
+
+func (s *fakeSQLStmt) NumInput() int {
+	if s.fields[0] == "INSERT" {
+		return 3
+	}
+	return 0
+}
+
+func (s *fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.conn.driver.Lock()
+	defer s.conn.driver.Unlock()
+
+	switch s.fields[0] {
+	case "CREATE":
+		table := s.fields[5]
+		if _, ok := s.conn.tables[table]; !ok {
+			s.conn.tables[table] = nil
+		}
+	case "DELETE":
+		s.conn.tables[s.fields[2]] = nil
+	case "INSERT":
+		table := s.fields[2]
+		s.conn.tables[table] = append(s.conn.tables[table], fakeSQLRow{
+			position: args[1].(int64),
+			data:     args[2].(string),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported statement: %s", strings.Join(s.fields, " "))
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.conn.driver.Lock()
+	defer s.conn.driver.Unlock()
+
+	rows := append([]fakeSQLRow(nil), s.conn.tables[s.fields[3]]...)
+	sort.Slice(rows, func(i, j int) bool { return rows[i].position < rows[j].position })
+	return &fakeSQLRows{rows: rows}, nil
+}
+
+type fakeSQLRows struct {
+	rows []fakeSQLRow
+}
+
+func (r *fakeSQLRows) Columns() []string { return []string{"data"} }
+func (r *fakeSQLRows) Close() error      { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.rows[0].data
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLPersister(t *testing.T) {
+	db, err := sql.Open("fakesql", t.Name())
+	assert.NoError(t, err)
+	defer db.Close()
+	persister := &mockoidc.SQLPersister{DB: db}
+
+	state, err := persister.Load()
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	user := &mockoidc.MockUser{Subject: "persisted", Email: "persisted@example.com"}
+	assert.NoError(t, m.AddUser(user))
+	_, err = m.SessionStore.NewSession("openid email", "nonce", user, "", "")
+	assert.NoError(t, err)
+
+	saved := m.Snapshot()
+	assert.NoError(t, persister.Save(saved))
+	assert.NoError(t, persister.Save(saved))
+
+	loaded, err := persister.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, saved.Sessions, loaded.Sessions)
+	assert.Equal(t, saved.Clients, loaded.Clients)
+	assert.Equal(t, saved.Users, loaded.Users)
+}
@@ -0,0 +1,83 @@
+package mockoidc_test
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Persister(t *testing.T) {
+	persister := &mockoidc.FilePersister{Path: filepath.Join(t.TempDir(), "state.json")}
+
+	start := func() *mockoidc.MockOIDC {
+		m, err := mockoidc.NewServer(nil)
+		assert.NoError(t, err)
+		m.Persister = persister
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		assert.NoError(t, m.Start(ln, nil))
+		return m
+	}
+
+	m := start()
+	user := &mockoidc.MockUser{Subject: "persisted", Email: "persisted@example.com"}
+	assert.NoError(t, m.AddUser(user))
+	session, err := m.SessionStore.NewSession("openid email", "nonce", user, "", "")
+	assert.NoError(t, err)
+	session.ClientID = m.ClientID
+	resp, err := http.Get(m.JWKSEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.NoError(t, m.Shutdown())
+
+	restarted := start()
+	defer restarted.Shutdown()
+
+	restored, err := restarted.SessionStore.GetSessionByID(session.SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, session.Scopes, restored.Scopes)
+	assert.Equal(t, m.ClientID, restored.ClientID)
+	assert.Equal(t, user, restored.User)
+
+	found, err := restarted.UserStore.GetUserByEmail("persisted@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "persisted", found.ID())
+
+	// random default client credentials are restored
+	assert.Equal(t, m.ClientID, restarted.ClientID)
+	assert.Equal(t, m.ClientSecret, restarted.ClientSecret)
+
+	requests := restarted.RequestsTo(mockoidc.JWKSEndpoint)
+	assert.Len(t, requests, 1)
+
+	assert.Equal(t, m.Snapshot().Sessions, restarted.Snapshot().Sessions)
+}
+
+func TestFilePersister_LoadMissing(t *testing.T) {
+	persister := &mockoidc.FilePersister{Path: filepath.Join(t.TempDir(), "missing.json")}
+	state, err := persister.Load()
+	assert.NoError(t, err)
+	assert.Nil(t, state)
+}
+
+func TestMockOIDC_Restore_NoUserStore(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	user := &mockoidc.MockUser{Subject: "persisted"}
+	_, err = m.SessionStore.NewSession("openid", "nonce", user, "", "")
+	assert.NoError(t, err)
+	state := m.Snapshot()
+	state.Users = []*mockoidc.MockUser{user}
+
+	restored, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	restored.UserStore = nil
+	assert.NotPanics(t, func() {
+		assert.NoError(t, restored.Restore(state))
+	})
+	assert.Len(t, restored.Snapshot().Sessions, 1)
+}
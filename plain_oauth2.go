@@ -0,0 +1,27 @@
+package mockoidc
+
+import "fmt"
+
+// verifyOpaqueToken returns the Session of a live opaque access token
+// issued in PlainOAuth2 mode. It is false for any other token.
+func (m *MockOIDC) verifyOpaqueToken(t string) (*Session, bool, error) {
+	if !m.PlainOAuth2 {
+		return nil, false, nil
+	}
+	issued, ok := m.issuedToken(t)
+	if !ok || issued.Type != AccessTokenType {
+		return nil, false, nil
+	}
+
+	if issued.Expired || !m.Now().Before(issued.ExpiresAt) {
+		return nil, true, fmt.Errorf("The token is expired")
+	}
+	session, err := m.SessionStore.GetSessionByID(issued.SessionID)
+	if err != nil {
+		return nil, true, fmt.Errorf("The token session is invalid")
+	}
+	if session.Revoked {
+		return nil, true, fmt.Errorf("The token is revoked")
+	}
+	return session, true, nil
+}
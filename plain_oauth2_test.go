@@ -0,0 +1,95 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_PlainOAuth2(t *testing.T) {
+	m := startPreset(t, mockoidc.GitHub())
+	defer m.Shutdown()
+
+	assert.Equal(t, m.Addr()+"/login/oauth/authorize", m.AuthorizationEndpoint())
+	assert.Equal(t, m.Addr()+"/login/oauth/access_token", m.TokenEndpoint())
+	assert.Equal(t, m.Addr()+"/user", m.GitHubUserEndpoint())
+
+	// no OIDC endpoints
+	for _, endpoint := range []string{m.DiscoveryEndpoint(), m.JWKSEndpoint(), m.UserinfoEndpoint()} {
+		resp, err := httpClient.Get(endpoint)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, endpoint)
+	}
+
+	m.QueueUser(&mockoidc.MockUser{
+		Subject:           "583231",
+		PreferredUsername: "octocat",
+		Name:              "The Octocat",
+		Email:             "octocat@github.com",
+		Picture:           "https://avatars.githubusercontent.com/u/583231",
+	})
+	m.QueueCode("github-code")
+	query := url.Values{}
+	query.Set("scope", "read:user user:email")
+	query.Set("response_type", "code")
+	query.Set("redirect_uri", "http://127.0.0.1/callback")
+	query.Set("state", "state")
+	query.Set("client_id", m.ClientID)
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + query.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	form := url.Values{}
+	form.Set("client_id", m.ClientID)
+	form.Set("client_secret", m.ClientSecret)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", "github-code")
+	resp, err = httpClient.PostForm(m.TokenEndpoint(), form)
+	assert.NoError(t, err)
+	tokens := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Nil(t, tokens["id_token"])
+	assert.Equal(t, "read:user user:email", tokens["scope"])
+	accessToken := tokens["access_token"].(string)
+	_, _, err = new(jwt.Parser).ParseUnverified(accessToken, jwt.MapClaims{})
+	assert.Error(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, m.GitHubUserEndpoint(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "token "+accessToken)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	profile := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&profile))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, map[string]interface{}{
+		"login":      "octocat",
+		"id":         float64(583231),
+		"name":       "The Octocat",
+		"email":      "octocat@github.com",
+		"avatar_url": "https://avatars.githubusercontent.com/u/583231",
+	}, profile)
+
+	m.ExpireAccessTokens()
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	caps := m.Capabilities()
+	assert.Contains(t, caps.Features, "plain_oauth2")
+	assert.NotContains(t, caps.Endpoints, "discovery_endpoint")
+	assert.Equal(t, m.GitHubUserEndpoint(), caps.Endpoints["github_user_endpoint"])
+}
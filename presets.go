@@ -0,0 +1,367 @@
+package mockoidc
+
+import (
+	"strings"
+	"time"
+)
+
+// Presets maps the Profile name of every Config preset to it
+var Presets = map[string]func() *Config{
+	"strict-spec":   StrictSpec,
+	"lenient":       Lenient,
+	"spa-friendly":  SPAFriendly,
+	"mobile-native": MobileNative,
+	"keycloak":      func() *Config { return Keycloak("master") },
+	"azure-ad":      func() *Config { return AzureAD(DefaultAzureTenantID) },
+	"okta":          func() *Config { return Okta("default") },
+	"auth0":         func() *Config { return Auth0(DefaultAuth0Namespace) },
+	"google":        Google,
+	"github":        GitHub,
+}
+
+// ConfigField names a Config setting for Explicit
+type ConfigField int
+
+// The ConfigFields of the settings Merge applies when they are Explicit
+const (
+	FieldClientID ConfigField = iota
+	FieldClientSecret
+	FieldIssuer
+	FieldIssuerPath
+	FieldIssuerURL
+	FieldTrustForwardedHeaders
+	FieldAdminToken
+	FieldHost
+	FieldPort
+	FieldAccessTTL
+	FieldRefreshTTL
+	FieldIDTokenTTL
+	FieldCodeTTL
+	FieldRefreshMaxLifetime
+	FieldRefreshIdleTimeout
+	FieldClock
+	FieldSessionStore
+	FieldCodeChallengeMethodsSupported
+	FieldRequireOfflineAccess
+	FieldLenientClaims
+	FieldSelfIssued
+	FieldPlainOAuth2
+	FieldIdentityAPIs
+	FieldFastTokens
+	FieldRedirectAuthorizeErrors
+	FieldStrictValidation
+	FieldRevokeOnCodeReplay
+	FieldDeterministicSeed
+	FieldHistoryLimit
+	FieldAccessTokenClaims
+	FieldIDTokenClaims
+	FieldIDTokenAudience
+	FieldAccessTokenAudience
+	FieldOnRequest
+	FieldOnResponse
+	FieldChaosSeed
+	FieldChaosErrorRate
+	FieldChaosJitter
+	FieldJSONContentType
+	FieldJSONBOM
+)
+
+// StrictSpec is a Config preset that follows the OIDC & OAuth 2.0 security
+// best practices closely: only S256 PKCE, refresh tokens only with the
+// `offline_access` scope, claims strictly filtered by scope, strict
+// request validation, `authorization_endpoint` errors redirected to the
+// client and Sessions revoked when their code is replayed.
+func StrictSpec() *Config {
+	return &Config{
+		Profile:                       "strict-spec",
+		CodeChallengeMethodsSupported: []string{CodeChallengeMethodS256},
+		RequireOfflineAccess:          true,
+		RedirectAuthorizeErrors:       true,
+		StrictValidation:              true,
+		RevokeOnCodeReplay:            true,
+		Explicit:                      []ConfigField{FieldLenientClaims},
+	}
+}
+
+// Lenient is a Config preset that accepts any supported PKCE method and
+// returns every User claim regardless of the scopes requested.
+func Lenient() *Config {
+	return &Config{
+		Profile:                       "lenient",
+		CodeChallengeMethodsSupported: []string{CodeChallengeMethodPlain, CodeChallengeMethodS256},
+		LenientClaims:                 true,
+	}
+}
+
+// SPAFriendly is a Config preset for browser based single page apps:
+// S256 PKCE with short lived access & refresh tokens.
+func SPAFriendly() *Config {
+	return &Config{
+		Profile:                       "spa-friendly",
+		CodeChallengeMethodsSupported: []string{CodeChallengeMethodS256},
+		AccessTTL:                     time.Duration(5) * time.Minute,
+		RefreshTTL:                    time.Duration(24) * time.Hour,
+	}
+}
+
+// MobileNative is a Config preset for native mobile apps: S256 PKCE with
+// long lived refresh tokens requested with `offline_access`.
+func MobileNative() *Config {
+	return &Config{
+		Profile:                       "mobile-native",
+		CodeChallengeMethodsSupported: []string{CodeChallengeMethodS256},
+		RefreshTTL:                    time.Duration(30*24) * time.Hour,
+		RequireOfflineAccess:          true,
+	}
+}
+
+// Merge layers the non-zero settings of overrides on top of a copy of the
+// Config. Presets can be chained this way, e.g.
+// `StrictSpec().Merge(SPAFriendly()).Merge(&Config{AccessTTL: time.Second})`.
+func (c *Config) Merge(overrides *Config) *Config {
+	merged := *c
+	if overrides == nil {
+		return &merged
+	}
+
+	if overrides.ClientID != "" || overrides.explicit(FieldClientID) {
+		merged.ClientID = overrides.ClientID
+	}
+	if overrides.ClientSecret != "" || overrides.explicit(FieldClientSecret) {
+		merged.ClientSecret = overrides.ClientSecret
+	}
+	if overrides.Issuer != "" || overrides.explicit(FieldIssuer) {
+		merged.Issuer = overrides.Issuer
+	}
+	if overrides.IssuerPath != "" || overrides.explicit(FieldIssuerPath) {
+		merged.IssuerPath = overrides.IssuerPath
+	}
+	if len(overrides.EndpointPaths) > 0 {
+		paths := make(map[string]string, len(merged.EndpointPaths)+len(overrides.EndpointPaths))
+		for endpoint, path := range merged.EndpointPaths {
+			paths[endpoint] = path
+		}
+		for endpoint, path := range overrides.EndpointPaths {
+			paths[endpoint] = path
+		}
+		merged.EndpointPaths = paths
+	}
+	if overrides.IssuerURL != "" || overrides.explicit(FieldIssuerURL) {
+		merged.IssuerURL = overrides.IssuerURL
+	}
+	if overrides.TrustForwardedHeaders || overrides.explicit(FieldTrustForwardedHeaders) {
+		merged.TrustForwardedHeaders = overrides.TrustForwardedHeaders
+	}
+	if overrides.Profile != "" {
+		merged.Profile = mergeProfiles(merged.Profile, overrides.Profile)
+	}
+	if overrides.AdminToken != "" || overrides.explicit(FieldAdminToken) {
+		merged.AdminToken = overrides.AdminToken
+	}
+	if len(overrides.DiscoveryOverrides) > 0 {
+		fields := make(map[string]interface{}, len(merged.DiscoveryOverrides)+len(overrides.DiscoveryOverrides))
+		for field, value := range merged.DiscoveryOverrides {
+			fields[field] = value
+		}
+		for field, value := range overrides.DiscoveryOverrides {
+			fields[field] = value
+		}
+		merged.DiscoveryOverrides = fields
+	}
+	if overrides.Host != "" || overrides.explicit(FieldHost) {
+		merged.Host = overrides.Host
+	}
+	if overrides.Port != 0 || overrides.explicit(FieldPort) {
+		merged.Port = overrides.Port
+	}
+	if overrides.AccessTTL != 0 || overrides.explicit(FieldAccessTTL) {
+		merged.AccessTTL = overrides.AccessTTL
+	}
+	if overrides.RefreshTTL != 0 || overrides.explicit(FieldRefreshTTL) {
+		merged.RefreshTTL = overrides.RefreshTTL
+	}
+	if overrides.IDTokenTTL != 0 || overrides.explicit(FieldIDTokenTTL) {
+		merged.IDTokenTTL = overrides.IDTokenTTL
+	}
+	if overrides.CodeTTL != 0 || overrides.explicit(FieldCodeTTL) {
+		merged.CodeTTL = overrides.CodeTTL
+	}
+	if overrides.RefreshMaxLifetime != 0 || overrides.explicit(FieldRefreshMaxLifetime) {
+		merged.RefreshMaxLifetime = overrides.RefreshMaxLifetime
+	}
+	if overrides.RefreshIdleTimeout != 0 || overrides.explicit(FieldRefreshIdleTimeout) {
+		merged.RefreshIdleTimeout = overrides.RefreshIdleTimeout
+	}
+	if overrides.Clock != nil || overrides.explicit(FieldClock) {
+		merged.Clock = overrides.Clock
+	}
+	if overrides.SessionStore != nil || overrides.explicit(FieldSessionStore) {
+		merged.SessionStore = overrides.SessionStore
+	}
+	if len(overrides.CodeChallengeMethodsSupported) > 0 || overrides.explicit(FieldCodeChallengeMethodsSupported) {
+		merged.CodeChallengeMethodsSupported = overrides.CodeChallengeMethodsSupported
+	}
+	if overrides.RequireOfflineAccess || overrides.explicit(FieldRequireOfflineAccess) {
+		merged.RequireOfflineAccess = overrides.RequireOfflineAccess
+	}
+	if overrides.LenientClaims || overrides.explicit(FieldLenientClaims) {
+		merged.LenientClaims = overrides.LenientClaims
+	}
+	if overrides.SelfIssued || overrides.explicit(FieldSelfIssued) {
+		merged.SelfIssued = overrides.SelfIssued
+	}
+	if overrides.PlainOAuth2 || overrides.explicit(FieldPlainOAuth2) {
+		merged.PlainOAuth2 = overrides.PlainOAuth2
+	}
+	if overrides.IdentityAPIs || overrides.explicit(FieldIdentityAPIs) {
+		merged.IdentityAPIs = overrides.IdentityAPIs
+	}
+	if overrides.FastTokens || overrides.explicit(FieldFastTokens) {
+		merged.FastTokens = overrides.FastTokens
+	}
+	if overrides.RedirectAuthorizeErrors || overrides.explicit(FieldRedirectAuthorizeErrors) {
+		merged.RedirectAuthorizeErrors = overrides.RedirectAuthorizeErrors
+	}
+	if overrides.StrictValidation || overrides.explicit(FieldStrictValidation) {
+		merged.StrictValidation = overrides.StrictValidation
+	}
+	if overrides.RevokeOnCodeReplay || overrides.explicit(FieldRevokeOnCodeReplay) {
+		merged.RevokeOnCodeReplay = overrides.RevokeOnCodeReplay
+	}
+	if overrides.DeterministicSeed != 0 || overrides.explicit(FieldDeterministicSeed) {
+		merged.DeterministicSeed = overrides.DeterministicSeed
+	}
+	if overrides.HistoryLimit != 0 || overrides.explicit(FieldHistoryLimit) {
+		merged.HistoryLimit = overrides.HistoryLimit
+	}
+	if overrides.AccessTokenClaims != nil || overrides.explicit(FieldAccessTokenClaims) {
+		merged.AccessTokenClaims = overrides.AccessTokenClaims
+	}
+	if overrides.IDTokenClaims != nil || overrides.explicit(FieldIDTokenClaims) {
+		merged.IDTokenClaims = overrides.IDTokenClaims
+	}
+	if len(overrides.IDTokenAudience) > 0 || overrides.explicit(FieldIDTokenAudience) {
+		merged.IDTokenAudience = overrides.IDTokenAudience
+	}
+	if len(overrides.AccessTokenAudience) > 0 || overrides.explicit(FieldAccessTokenAudience) {
+		merged.AccessTokenAudience = overrides.AccessTokenAudience
+	}
+	if overrides.OnRequest != nil || overrides.explicit(FieldOnRequest) {
+		merged.OnRequest = overrides.OnRequest
+	}
+	if overrides.OnResponse != nil || overrides.explicit(FieldOnResponse) {
+		merged.OnResponse = overrides.OnResponse
+	}
+	if overrides.ChaosSeed != 0 || overrides.explicit(FieldChaosSeed) {
+		merged.ChaosSeed = overrides.ChaosSeed
+	}
+	if overrides.ChaosErrorRate != 0 || overrides.explicit(FieldChaosErrorRate) {
+		merged.ChaosErrorRate = overrides.ChaosErrorRate
+	}
+	if overrides.ChaosJitter != 0 || overrides.explicit(FieldChaosJitter) {
+		merged.ChaosJitter = overrides.ChaosJitter
+	}
+	if overrides.JSONContentType != "" || overrides.explicit(FieldJSONContentType) {
+		merged.JSONContentType = overrides.JSONContentType
+	}
+	if overrides.JSONBOM || overrides.explicit(FieldJSONBOM) {
+		merged.JSONBOM = overrides.JSONBOM
+	}
+	for _, field := range overrides.Explicit {
+		if !merged.explicit(field) {
+			merged.Explicit = append(merged.Explicit, field)
+		}
+	}
+	return &merged
+}
+
+// mergeProfiles joins the presets of the profiles with `+`, each once, so
+// applying a preset again doesn't change the Profile
+func mergeProfiles(profile, overrides string) string {
+	var names []string
+	if profile != "" {
+		names = strings.Split(profile, "+")
+	}
+	for _, name := range strings.Split(overrides, "+") {
+		if !contains(name, names) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+// explicit reports whether the field is one of the Explicit settings
+func (c *Config) explicit(field ConfigField) bool {
+	for _, explicit := range c.Explicit {
+		if explicit == field {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyConfig sets the non-zero settings of a Config (e.g. a preset) on
+// the MockOIDC. The Issuer is always derived from the server address or
+// the IssuerURL and is ignored.
+func (m *MockOIDC) ApplyConfig(cfg *Config) {
+	merged := m.Config().Merge(cfg)
+
+	m.ClientID = merged.ClientID
+	m.ClientSecret = merged.ClientSecret
+	m.IssuerPath = merged.IssuerPath
+	m.EndpointPaths = merged.EndpointPaths
+	m.IssuerURL = merged.IssuerURL
+	m.TrustForwardedHeaders = merged.TrustForwardedHeaders
+	m.AdminToken = merged.AdminToken
+	m.DiscoveryOverrides = merged.DiscoveryOverrides
+	m.Profile = merged.Profile
+	m.AccessTTL = merged.AccessTTL
+	m.RefreshTTL = merged.RefreshTTL
+	m.IDTokenTTL = merged.IDTokenTTL
+	m.CodeTTL = merged.CodeTTL
+	m.RefreshMaxLifetime = merged.RefreshMaxLifetime
+	m.RefreshIdleTimeout = merged.RefreshIdleTimeout
+	m.Clock = merged.Clock
+	m.SessionStore = merged.SessionStore
+	m.CodeChallengeMethodsSupported = merged.CodeChallengeMethodsSupported
+	m.RequireOfflineAccess = merged.RequireOfflineAccess
+	m.LenientClaims = merged.LenientClaims
+	m.SelfIssued = merged.SelfIssued
+	m.PlainOAuth2 = merged.PlainOAuth2
+	m.IdentityAPIs = merged.IdentityAPIs
+	m.FastTokens = merged.FastTokens
+	m.RedirectAuthorizeErrors = merged.RedirectAuthorizeErrors
+	m.StrictValidation = merged.StrictValidation
+	m.RevokeOnCodeReplay = merged.RevokeOnCodeReplay
+	m.AccessTokenClaims = merged.AccessTokenClaims
+	m.IDTokenClaims = merged.IDTokenClaims
+	m.IDTokenAudience = merged.IDTokenAudience
+	m.AccessTokenAudience = merged.AccessTokenAudience
+	m.OnRequest = merged.OnRequest
+	m.OnResponse = merged.OnResponse
+	m.ChaosSeed = merged.ChaosSeed
+	m.JSONContentType = merged.JSONContentType
+	m.JSONBOM = merged.JSONBOM
+	m.HistoryLimit = merged.HistoryLimit
+	if merged.ChaosErrorRate != 0 || merged.ChaosJitter != 0 ||
+		merged.explicit(FieldChaosErrorRate) || merged.explicit(FieldChaosJitter) {
+		if m.Chaos == nil {
+			m.Chaos = make(map[string]ChaosRule)
+		}
+		rule := m.Chaos[AllEndpoints]
+		rule.ErrorRate = merged.ChaosErrorRate
+		rule.Jitter = merged.ChaosJitter
+		m.Chaos[AllEndpoints] = rule
+	}
+	if merged.DeterministicSeed != m.deterministicSeed {
+		// the DefaultKeypair always parses
+		_ = m.Deterministic(merged.DeterministicSeed)
+		// configured client credentials win over the seeded ones
+		if cfg.ClientID != "" {
+			m.ClientID = cfg.ClientID
+		}
+		if cfg.ClientSecret != "" {
+			m.ClientSecret = cfg.ClientSecret
+		}
+	}
+}
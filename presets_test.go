@@ -0,0 +1,76 @@
+package mockoidc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Merge(t *testing.T) {
+	base := mockoidc.StrictSpec()
+	merged := base.Merge(mockoidc.SPAFriendly()).Merge(&mockoidc.Config{
+		ClientID:  "override",
+		AccessTTL: time.Second,
+	})
+
+	assert.Equal(t, "override", merged.ClientID)
+	assert.Equal(t, time.Second, merged.AccessTTL)
+	assert.Equal(t, 24*time.Hour, merged.RefreshTTL)
+	assert.Equal(t, []string{mockoidc.CodeChallengeMethodS256}, merged.CodeChallengeMethodsSupported)
+	assert.True(t, merged.RequireOfflineAccess)
+	assert.False(t, merged.LenientClaims)
+
+	// The layers themselves are left untouched
+	assert.Equal(t, "", base.ClientID)
+	assert.Equal(t, time.Duration(0), base.AccessTTL)
+}
+
+func TestConfig_Merge_Explicit(t *testing.T) {
+	// StrictSpec turns LenientClaims off again
+	assert.False(t, mockoidc.Lenient().Merge(mockoidc.StrictSpec()).LenientClaims)
+
+	merged := mockoidc.StrictSpec().Merge(&mockoidc.Config{
+		StrictValidation: false,
+		AccessTTL:        0,
+		Explicit:         []mockoidc.ConfigField{mockoidc.FieldStrictValidation},
+	})
+	assert.False(t, merged.StrictValidation)
+	assert.True(t, merged.RequireOfflineAccess)
+
+	azure := mockoidc.AzureAD(mockoidc.DefaultAzureTenantID)
+	assert.True(t, azure.IdentityAPIs)
+	assert.False(t, azure.Merge(&mockoidc.Config{
+		Explicit: []mockoidc.ConfigField{mockoidc.FieldIdentityAPIs},
+	}).IdentityAPIs)
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(mockoidc.StrictSpec())
+	m.ApplyConfig(&mockoidc.Config{Explicit: []mockoidc.ConfigField{mockoidc.FieldRevokeOnCodeReplay, mockoidc.FieldAccessTTL}})
+	assert.False(t, m.RevokeOnCodeReplay)
+	assert.True(t, m.StrictValidation)
+	assert.Equal(t, time.Duration(0), m.AccessTTL)
+}
+
+func TestMockOIDC_ApplyConfig(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	clientID := m.ClientID
+
+	m.ApplyConfig(mockoidc.MobileNative().Merge(mockoidc.Lenient()))
+
+	assert.Equal(t, clientID, m.ClientID)
+	assert.Equal(t, 10*time.Minute, m.AccessTTL)
+	assert.Equal(t, 30*24*time.Hour, m.RefreshTTL)
+	assert.Equal(t, []string{"plain", "S256"}, m.CodeChallengeMethodsSupported)
+	assert.True(t, m.RequireOfflineAccess)
+	assert.True(t, m.LenientClaims)
+	assert.Equal(t, "mobile-native+lenient", m.Profile)
+
+	// applying presets again doesn't change the Profile
+	m.ApplyConfig(mockoidc.Lenient())
+	m.ApplyConfig(mockoidc.MobileNative().Merge(mockoidc.Lenient()))
+	assert.Equal(t, "mobile-native+lenient", m.Profile)
+}
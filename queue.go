@@ -14,6 +14,10 @@ type UserQueue struct {
 type CodeQueue struct {
 	sync.Mutex
 	Queue []string
+
+	// Generate makes the codes popped off an empty Queue, random ones by
+	// default
+	Generate func() (string, error)
 }
 
 // ErrorQueue manages the queue of errors for handlers to return
@@ -39,16 +43,49 @@ func (q *UserQueue) Push(user User) {
 
 // Pop a User from the Queue. If empty, return `DefaultUser()`
 func (q *UserQueue) Pop() User {
+	user, ok := q.pop()
+	if !ok {
+		return DefaultUser()
+	}
+	return user
+}
+
+func (q *UserQueue) pop() (User, bool) {
 	q.Lock()
 	defer q.Unlock()
 
 	if len(q.Queue) == 0 {
-		return DefaultUser()
+		return nil, false
 	}
 
 	var user User
 	user, q.Queue = q.Queue[0], q.Queue[1:]
-	return user
+	return user, true
+}
+
+// Peek returns the next User without removing it. If empty, return nil
+func (q *UserQueue) Peek() User {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.Queue) == 0 {
+		return nil
+	}
+	return q.Queue[0]
+}
+
+// Clear removes every queued User
+func (q *UserQueue) Clear() {
+	q.Lock()
+	defer q.Unlock()
+	q.Queue = nil
+}
+
+// Len returns the number of queued Users
+func (q *UserQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.Queue)
 }
 
 // Push adds a code to the Queue to be returned by subsequent
@@ -62,21 +99,36 @@ func (q *CodeQueue) Push(code string) {
 // Pop a `code` from the Queue. If empty, return a random code
 func (q *CodeQueue) Pop() (string, error) {
 	q.Lock()
-	defer q.Unlock()
-
 	if len(q.Queue) == 0 {
-		code, err := randomNonce(24)
-		if err != nil {
-			return "", err
+		generate := q.Generate
+		q.Unlock()
+		// generated unlocked, so concurrent logins don't wait on each other
+		if generate != nil {
+			return generate()
 		}
-		return code, nil
+		return randomNonce(24)
 	}
+	defer q.Unlock()
 
 	var code string
 	code, q.Queue = q.Queue[0], q.Queue[1:]
 	return code, nil
 }
 
+// Len returns the number of queued codes
+func (q *CodeQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.Queue)
+}
+
+// Clear removes every queued code
+func (q *CodeQueue) Clear() {
+	q.Lock()
+	defer q.Unlock()
+	q.Queue = nil
+}
+
 // Push adds a ServerError to the Queue to be returned in subsequent
 // handler calls
 func (q *ErrorQueue) Push(se *ServerError) {
@@ -98,3 +150,29 @@ func (q *ErrorQueue) Pop() *ServerError {
 	se, q.Queue = q.Queue[0], q.Queue[1:]
 	return se
 }
+
+// Peek returns the next ServerError without removing it. If empty,
+// return nil
+func (q *ErrorQueue) Peek() *ServerError {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.Queue) == 0 {
+		return nil
+	}
+	return q.Queue[0]
+}
+
+// Len returns the number of queued ServerErrors
+func (q *ErrorQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.Queue)
+}
+
+// Clear removes every queued ServerError
+func (q *ErrorQueue) Clear() {
+	q.Lock()
+	defer q.Unlock()
+	q.Queue = nil
+}
@@ -0,0 +1,90 @@
+package mockoidc
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// QuotaExceeded is the default error of token requests over their Quota
+const QuotaExceeded = "quota_exceeded"
+
+// Quota caps the tokens the `token_endpoint` issues to a client, like IdPs
+// enforcing licensing or rate quotas. Requests beyond Limit in a Window
+// fail with Status & Error, by default `429 quota_exceeded`. A zero
+// Window never resets.
+type Quota struct {
+	Limit       int
+	Window      time.Duration
+	Status      int
+	Error       string
+	Description string
+}
+
+// ResetQuotas forgets the tokens counted against every Quota
+func (m *MockOIDC) ResetQuotas() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.issuances = nil
+}
+
+// allowIssuance counts an issuance against the client's Quota, or responds
+// with the Quota error if it's exceeded. ScopedMocks count their issuances
+// separately.
+func (m *MockOIDC) allowIssuance(rw http.ResponseWriter, req *http.Request, clientID string) bool {
+	quota, ok := m.Quotas[clientID]
+	if !ok {
+		return true
+	}
+	key := requestNamespace(req) + " " + clientID
+
+	now := m.Now()
+	m.mu.Lock()
+	issued := m.issuances[key]
+	if quota.Window > 0 {
+		live := issued[:0]
+		for _, t := range issued {
+			if now.Sub(t) < quota.Window {
+				live = append(live, t)
+			}
+		}
+		issued = live
+	}
+	allowed := len(issued) < quota.Limit
+	if allowed {
+		issued = append(issued, now)
+	}
+	if m.issuances == nil {
+		m.issuances = make(map[string][]time.Time)
+	}
+	m.issuances[key] = issued
+	// the oldest issuance leaves the Window first. Without any, e.g. with a
+	// zero Limit, retrying won't help.
+	var retry time.Duration
+	if !allowed && quota.Window > 0 && len(issued) > 0 {
+		retry = issued[0].Add(quota.Window).Sub(now)
+	}
+	m.mu.Unlock()
+
+	if allowed {
+		return true
+	}
+
+	if retry > 0 {
+		rw.Header().Set("Retry-After", strconv.FormatInt(ttlSeconds(retry), 10))
+	}
+	status := quota.Status
+	if status == 0 {
+		status = http.StatusTooManyRequests
+	}
+	oauthError := quota.Error
+	if oauthError == "" {
+		oauthError = QuotaExceeded
+	}
+	description := quota.Description
+	if description == "" {
+		description = "Token issuance quota exceeded"
+	}
+	NewOAuthError(oauthError, description, status).Write(rw)
+	return false
+}
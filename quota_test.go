@@ -0,0 +1,94 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Quotas(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Quotas = map[string]mockoidc.Quota{
+		m.ClientID: {Limit: 2, Window: time.Minute},
+	}
+
+	session, _ := m.SessionStore.NewSession(
+		"openid email", "sessionNonce", mockoidc.DefaultUser(), "", "")
+	refreshToken, _ := session.RefreshToken(m.Config(), m.Keypair, m.Now())
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("refresh_token", refreshToken)
+	data.Set("grant_type", "refresh_token")
+	token := func() (int, map[string]interface{}, http.Header) {
+		rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+		resp := make(map[string]interface{})
+		assert.NoError(t, getJSON(rr, &resp))
+		return rr.Code, resp, rr.Header()
+	}
+
+	for i := 0; i < 2; i++ {
+		status, _, _ := token()
+		assert.Equal(t, http.StatusOK, status)
+	}
+
+	m.FastForward(20 * time.Second)
+	status, resp, header := token()
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, mockoidc.QuotaExceeded, resp["error"])
+	assert.Equal(t, "40", header.Get("Retry-After"))
+
+	// the window slides past the earliest issuances
+	m.FastForward(40 * time.Second)
+	status, _, _ = token()
+	assert.Equal(t, http.StatusOK, status)
+
+	m.Quotas[m.ClientID] = mockoidc.Quota{
+		Limit:  1,
+		Status: http.StatusForbidden,
+		Error:  "license_exceeded",
+	}
+	m.ResetQuotas()
+	status, _, _ = token()
+	assert.Equal(t, http.StatusOK, status)
+	status, resp, header = token()
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, "license_exceeded", resp["error"])
+	assert.Empty(t, header.Get("Retry-After"))
+
+	// a zero Limit rejects every request, without a Retry-After
+	m.Quotas[m.ClientID] = mockoidc.Quota{Limit: 0, Window: time.Minute}
+	m.ResetQuotas()
+	status, resp, header = token()
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, mockoidc.QuotaExceeded, resp["error"])
+	assert.Empty(t, header.Get("Retry-After"))
+}
+
+func TestMockOIDC_Quotas_CodeGrant(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Quotas = map[string]mockoidc.Quota{
+		m.ClientID: {Limit: 1, Window: time.Minute},
+	}
+
+	first, _ := m.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	second, _ := m.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+
+	status, _ := redeemCode(t, m, first.SessionID)
+	assert.Equal(t, http.StatusOK, status)
+	status, resp := redeemCode(t, m, second.SessionID)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, mockoidc.QuotaExceeded, resp["error"])
+
+	// the rejected code can be redeemed once the client honored Retry-After
+	m.FastForward(time.Minute)
+	status, _ = redeemCode(t, m, second.SessionID)
+	assert.Equal(t, http.StatusOK, status)
+}
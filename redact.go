@@ -0,0 +1,132 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces sensitive values in logs and recorded requests
+const Redacted = "[REDACTED]"
+
+var (
+	// RedactedFields are form parameters & JSON keys holding tokens,
+	// secrets or PII claims that are masked by Redact functions.
+	RedactedFields = []string{
+		"access_token",
+		"refresh_token",
+		"id_token",
+		"code",
+		"code_verifier",
+		"client_secret",
+		"client_assertion",
+		"request",
+		"password",
+		"email",
+		"phone_number",
+		"address",
+		"login_hint",
+		"id_token_hint",
+	}
+	// RedactedHeaders are HTTP headers masked by RedactHeader
+	RedactedHeaders = []string{
+		"Authorization",
+		"Cookie",
+		"Set-Cookie",
+	}
+)
+
+// RedactValues returns a copy of the values with RedactedFields masked
+func RedactValues(values url.Values) url.Values {
+	redacted := make(url.Values, len(values))
+	for key, vals := range values {
+		if !redactedField(key) {
+			redacted[key] = append([]string(nil), vals...)
+			continue
+		}
+		for range vals {
+			redacted[key] = append(redacted[key], Redacted)
+		}
+	}
+	return redacted
+}
+
+// RedactHeader returns a copy of the header with RedactedHeaders masked
+func RedactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range RedactedHeaders {
+		if _, ok := redacted[http.CanonicalHeaderKey(name)]; ok {
+			redacted.Set(name, Redacted)
+		}
+	}
+	return redacted
+}
+
+// RedactJSON masks RedactedFields at any depth of a JSON document. Data
+// that isn't JSON is returned as is.
+func RedactJSON(data []byte) []byte {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return data
+	}
+	redacted, err := json.Marshal(redactJSONValue(doc, RedactedFields))
+	if err != nil {
+		return data
+	}
+	return redacted
+}
+
+// redactJSONValue masks the fields at any depth of a decoded JSON value
+func redactJSONValue(value interface{}, fields []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if matchField(key, fields) {
+				v[key] = redactedValue(child)
+			} else {
+				v[key] = redactJSONValue(child, fields)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactJSONValue(child, fields)
+		}
+	}
+	return value
+}
+
+// redactedValue masks a value, keeping the shape of arrays & objects so
+// the redacted JSON still decodes into the same Go types. Empty values
+// are left as-is, as they have nothing to hide.
+func redactedValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = redactedValue(child)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactedValue(child)
+		}
+		return v
+	}
+	if value == nil || value == "" {
+		return value
+	}
+	return Redacted
+}
+
+func redactedField(key string) bool {
+	return matchField(key, RedactedFields)
+}
+
+func matchField(key string, fields []string) bool {
+	for _, field := range fields {
+		if strings.EqualFold(field, key) {
+			return true
+		}
+	}
+	return false
+}
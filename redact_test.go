@@ -0,0 +1,55 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactValues(t *testing.T) {
+	values := url.Values{}
+	values.Set("client_id", "client")
+	values.Set("client_secret", "secret")
+	values.Add("code", "one")
+	values.Add("code", "two")
+
+	redacted := mockoidc.RedactValues(values)
+	assert.Equal(t, "client", redacted.Get("client_id"))
+	assert.Equal(t, mockoidc.Redacted, redacted.Get("client_secret"))
+	assert.Equal(t, []string{mockoidc.Redacted, mockoidc.Redacted}, redacted["code"])
+
+	// the original is untouched
+	assert.Equal(t, "secret", values.Get("client_secret"))
+}
+
+func TestRedactHeader(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer token")
+	header.Set("Content-Type", "application/json")
+
+	redacted := mockoidc.RedactHeader(header)
+	assert.Equal(t, mockoidc.Redacted, redacted.Get("Authorization"))
+	assert.Equal(t, "application/json", redacted.Get("Content-Type"))
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+}
+
+func TestRedactJSON(t *testing.T) {
+	data := []byte(`{"access_token":"abc","token_type":"bearer","user":{"email":"jane@example.com","groups":["a"]}}`)
+
+	doc := make(map[string]interface{})
+	err := json.Unmarshal(mockoidc.RedactJSON(data), &doc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, mockoidc.Redacted, doc["access_token"])
+	assert.Equal(t, "bearer", doc["token_type"])
+	user := doc["user"].(map[string]interface{})
+	assert.Equal(t, mockoidc.Redacted, user["email"])
+	assert.Equal(t, []interface{}{"a"}, user["groups"])
+
+	notJSON := []byte("not json")
+	assert.Equal(t, notJSON, mockoidc.RedactJSON(notJSON))
+}
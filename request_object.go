@@ -0,0 +1,167 @@
+package mockoidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	// RequestURITimeout is how long fetching a `request_uri` may take
+	RequestURITimeout = 10 * time.Second
+
+	// maxRequestObjectSize caps the `request_uri` responses read
+	maxRequestObjectSize = 1 << 20
+)
+
+var requestURIClient = &http.Client{Timeout: RequestURITimeout}
+
+// parseRequestObject merges the parameters of a signed Request Object
+// (RFC 9101) passed by value in `request` or by reference in `request_uri`
+// into the request form. Request Object parameters take precedence. The
+// object's `iss` must be its `client_id` and its `aud` the issuer.
+func (m *MockOIDC) parseRequestObject(rw http.ResponseWriter, req *http.Request) bool {
+	requestJWT := req.Form.Get("request")
+	requestURI := req.Form.Get("request_uri")
+	if requestJWT == "" && requestURI == "" {
+		return true
+	}
+	if m.ClientPublicKey == nil {
+		ErrRequestNotSupported.Describe("Request objects are not supported without a ClientPublicKey").
+			Write(rw)
+		return false
+	}
+	if requestJWT != "" && requestURI != "" {
+		ErrInvalidRequest.Describe("Only one of request and request_uri can be used").Write(rw)
+		return false
+	}
+
+	if requestURI != "" {
+		if !m.allowRequestURI(requestURI) {
+			ErrInvalidRequestURI.Describe("The request_uri is not allowed").Write(rw)
+			return false
+		}
+		var err error
+		requestJWT, err = fetchRequestObject(req.Context(), requestURI)
+		if err != nil {
+			ErrInvalidRequestURI.Describe("Unable to fetch request_uri: %v", err).Write(rw)
+			return false
+		}
+	}
+
+	parser := &jwt.Parser{UseJSONNumber: true, SkipClaimsValidation: true}
+	token, err := parser.Parse(requestJWT, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return m.ClientPublicKey, nil
+	})
+	if err == nil {
+		err = validateTimeClaims(token, m.Now())
+	}
+	if err != nil {
+		m.countSigningFailure(req, SignedRequestJAR, signingFailureReason(err))
+		ErrInvalidRequestObject.Describe("Invalid request object: %v", err).Write(rw)
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		internalServerError(rw, "Unable to extract request object claims")
+		return false
+	}
+
+	clientID, _ := claims["client_id"].(string)
+	if formID := req.Form.Get("client_id"); formID != "" && clientID != formID {
+		m.countSigningFailure(req, SignedRequestJAR, SigningFailureClientMismatch)
+		ErrInvalidRequestObject.Describe("Request object client_id does not match the request").
+			Write(rw)
+		return false
+	}
+	if iss, _ := claims["iss"].(string); iss == "" || iss != clientID {
+		m.countSigningFailure(req, SignedRequestJAR, SigningFailureClientMismatch)
+		ErrInvalidRequestObject.Describe("Request object iss must be the client_id").Write(rw)
+		return false
+	}
+	if !claims.VerifyAudience(m.requestIssuer(req), true) {
+		ErrInvalidRequestObject.Describe("Request object aud must be the issuer").Write(rw)
+		return false
+	}
+	if jti, ok := claims["jti"].(string); ok && !m.useJTI(SignedRequestJAR, jti, claims) {
+		m.countSigningFailure(req, SignedRequestJAR, SigningFailureReplay)
+		ErrInvalidRequestObject.Describe("Request object jti was already used").Write(rw)
+		return false
+	}
+
+	params := make(map[string]string, len(claims))
+	for key, value := range claims {
+		switch key {
+		case "iss", "aud", "exp", "iat", "nbf", "jti":
+			continue
+		}
+		param, err := requestObjectParam(value)
+		if err != nil {
+			ErrInvalidRequestObject.Describe("Invalid request object claim %s: %v", key, err).
+				Write(rw)
+			return false
+		}
+		params[key] = param
+	}
+	for key, param := range params {
+		req.Form.Set(key, param)
+	}
+	req.Form.Del("request")
+	req.Form.Del("request_uri")
+	return true
+}
+
+// requestObjectParam is the form value of a Request Object claim: strings
+// as is, other values like the `claims` object JSON encoded.
+func requestObjectParam(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// allowRequestURI reports whether the RequestURIAllowlist allows fetching
+// the `request_uri`
+func (m *MockOIDC) allowRequestURI(requestURI string) bool {
+	for _, prefix := range m.RequestURIAllowlist {
+		if strings.HasPrefix(requestURI, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func fetchRequestObject(ctx context.Context, requestURI string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURI, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := requestURIClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRequestObjectSize))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
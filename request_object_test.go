@@ -0,0 +1,210 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Authorize_RequestObject(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.IssuerURL = "https://issuer.example.com/oidc"
+
+	client, err := mockoidc.RandomKeypair(1024)
+	assert.NoError(t, err)
+	attacker, err := mockoidc.RandomKeypair(1024)
+	assert.NoError(t, err)
+
+	requestClaims := jwt.MapClaims{
+		"iss":           m.ClientID,
+		"aud":           m.Issuer(),
+		"client_id":     m.ClientID,
+		"scope":         "openid email",
+		"response_type": "code",
+		"redirect_uri":  "https://example.com/callback",
+		"state":         "objectState",
+		"nonce":         "objectNonce",
+		"max_age":       300,
+	}
+	requestObject, err := client.SignJWT(requestClaims)
+	assert.NoError(t, err)
+
+	authorize := func(data url.Values) *httptest.ResponseRecorder {
+		return testResponse(t, mockoidc.AuthorizationEndpoint+"?"+data.Encode(),
+			m.Authorize, http.MethodGet, nil)
+	}
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("request", requestObject)
+
+	// not supported without a client key
+	rr := authorize(data)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), mockoidc.RequestNotSupported)
+
+	m.ClientPublicKey = client.PublicKey
+
+	// request by value
+	m.QueueCode("by-value")
+	rr = authorize(data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", location.Host)
+	assert.Equal(t, "objectState", location.Query().Get("state"))
+
+	session, err := m.SessionStore.GetSessionByID("by-value")
+	assert.NoError(t, err)
+	assert.Equal(t, "objectNonce", session.OIDCNonce)
+	assert.Equal(t, []string{"openid", "email"}, session.Scopes)
+
+	// request by reference
+	objectServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(rw, requestObject)
+	}))
+	defer objectServer.Close()
+
+	byReference := url.Values{}
+	byReference.Set("client_id", m.ClientID)
+	byReference.Set("request_uri", objectServer.URL+"/object")
+
+	// request_uris outside the allowlist aren't fetched, none are by default
+	for _, allowlist := range [][]string{nil, {"https://objects.example.com/"}} {
+		m.RequestURIAllowlist = allowlist
+		rr = authorize(byReference)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "The request_uri is not allowed")
+	}
+	m.RequestURIAllowlist = []string{objectServer.URL + "/"}
+	m.QueueCode("by-reference")
+	rr = authorize(byReference)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	_, err = m.SessionStore.GetSessionByID("by-reference")
+	assert.NoError(t, err)
+
+	// non-string claims are JSON encoded
+	structured := jwt.MapClaims{
+		"iss":           m.ClientID,
+		"aud":           m.Issuer(),
+		"client_id":     m.ClientID,
+		"scope":         "openid",
+		"response_type": "code",
+		"redirect_uri":  "https://example.com/callback",
+		"state":         "structured",
+		"claims":        map[string]interface{}{"userinfo": map[string]interface{}{"email": nil}},
+		"max_age":       json.Number("1000000000000000000000"),
+	}
+	object, err := client.SignJWT(structured)
+	assert.NoError(t, err)
+	values := url.Values{}
+	values.Set("request", object)
+	req := httptest.NewRequest(http.MethodGet, mockoidc.AuthorizationEndpoint+"?"+values.Encode(), nil)
+	m.Authorize(httptest.NewRecorder(), req)
+	assert.Equal(t, `{"userinfo":{"email":null}}`, req.Form.Get("claims"))
+	assert.Equal(t, "1000000000000000000000", req.Form.Get("max_age"))
+
+	// signed by the wrong key
+	forged, err := attacker.SignJWT(requestClaims)
+	assert.NoError(t, err)
+	data.Set("request", forged)
+	rr = authorize(data)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), mockoidc.InvalidRequestObject)
+
+	// mismatched client_id
+	data.Set("request", requestObject)
+	data.Set("client_id", "someone-else")
+	rr = authorize(data)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), mockoidc.InvalidRequestObject)
+
+	// iss must be the client_id & aud the issuer
+	for name, claims := range map[string]jwt.MapClaims{
+		"missing iss": {"aud": m.Issuer(), "client_id": m.ClientID},
+		"foreign iss": {"iss": "someone-else", "aud": m.Issuer(), "client_id": m.ClientID},
+		"missing aud": {"iss": m.ClientID, "client_id": m.ClientID},
+		"foreign aud": {"iss": m.ClientID, "aud": "https://other.example.com", "client_id": m.ClientID},
+	} {
+		object, err := client.SignJWT(claims)
+		assert.NoError(t, err)
+		data.Set("request", object)
+		data.Set("client_id", m.ClientID)
+		rr = authorize(data)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, name)
+		assert.Contains(t, rr.Body.String(), mockoidc.InvalidRequestObject, name)
+	}
+
+	// expired
+	expiredClaims := jwt.MapClaims{"client_id": m.ClientID, "exp": 1}
+	expired, err := client.SignJWT(expiredClaims)
+	assert.NoError(t, err)
+	data.Set("request", expired)
+	data.Set("client_id", m.ClientID)
+	rr = authorize(data)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// jti replay
+	requestClaims["jti"] = "once"
+	once, err := client.SignJWT(requestClaims)
+	assert.NoError(t, err)
+	data.Set("request", once)
+	rr = authorize(data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	rr = authorize(data)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "jti")
+
+	// jtis are forgotten once their request expired
+	requestClaims["jti"] = "until-exp"
+	requestClaims["exp"] = m.Now().Add(time.Minute).Unix()
+	untilExp, err := client.SignJWT(requestClaims)
+	assert.NoError(t, err)
+	data.Set("request", untilExp)
+	rr = authorize(data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	m.FastForward(2 * time.Minute)
+	requestClaims["exp"] = m.Now().Add(time.Minute).Unix()
+	reissued, err := client.SignJWT(requestClaims)
+	assert.NoError(t, err)
+	data.Set("request", reissued)
+	rr = authorize(data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	assert.Equal(t, map[mockoidc.SigningFailure]int{
+		{Mechanism: mockoidc.SignedRequestJAR, Reason: mockoidc.SigningFailureBadSignature}:   1,
+		{Mechanism: mockoidc.SignedRequestJAR, Reason: mockoidc.SigningFailureClientMismatch}: 3,
+		{Mechanism: mockoidc.SignedRequestJAR, Reason: mockoidc.SigningFailureExpired}:        1,
+		{Mechanism: mockoidc.SignedRequestJAR, Reason: mockoidc.SigningFailureReplay}:         1,
+	}, m.SigningFailures())
+
+	// invalid request objects are redirected to a verified redirect_uri
+	m.RedirectAuthorizeErrors = true
+	data.Set("request", forged)
+	data.Set("redirect_uri", "https://example.com/callback")
+	data.Set("state", "outerState")
+	rr = authorize(data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", location.Host)
+	assert.Equal(t, mockoidc.InvalidRequestObject, location.Query().Get("error"))
+	assert.Equal(t, "outerState", location.Query().Get("state"))
+	m.RedirectAuthorizeErrors = false
+
+	rr = httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, mockoidc.MetricsEndpoint, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "# TYPE mockoidc_signing_failures_total counter\n")
+	assert.Contains(t, rr.Body.String(),
+		`mockoidc_signing_failures_total{mechanism="jar",reason="jti_replay",scope=""} 1`+"\n")
+}
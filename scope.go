@@ -0,0 +1,232 @@
+package mockoidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ScopesBase prefixes the endpoints of each ScopedMock, e.g.
+// `/scopes/{name}/oidc/authorize`.
+const ScopesBase = "/scopes/"
+
+type scopeContextKey struct{}
+
+// ScopedMock is a view of a MockOIDC for one test (or test package) that
+// shares its listener and keys. Logins through the ScopedMock endpoints
+// only use its queues, their codes are only accepted by its
+// `token_endpoint`, and the tokens, lint findings, signing failures &
+// quota usage they lead to are only reported by the ScopedMock.
+type ScopedMock struct {
+	Name       string
+	UserQueue  *UserQueue
+	CodeQueue  *CodeQueue
+	ErrorQueue *ErrorQueue
+
+	m *MockOIDC
+}
+
+// Scope returns the ScopedMock with the name, creating it if needed
+func (m *MockOIDC) Scope(name string) *ScopedMock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.scopes == nil {
+		m.scopes = make(map[string]*ScopedMock)
+	}
+	if _, ok := m.scopes[name]; !ok {
+		m.scopes[name] = &ScopedMock{
+			Name:       name,
+			UserQueue:  &UserQueue{},
+			CodeQueue:  &CodeQueue{},
+			ErrorQueue: &ErrorQueue{},
+			m:          m,
+		}
+		if m.deterministicRand != nil {
+			m.scopes[name].CodeQueue.Generate = m.seededCode
+		}
+	}
+	return m.scopes[name]
+}
+
+// QueueUser adds a mock User to the ScopedMock's queue
+func (s *ScopedMock) QueueUser(user User) {
+	s.UserQueue.Push(user)
+}
+
+// QueueCode adds a code to the ScopedMock's queue. Codes queued with
+// MockOIDC.QueueCode aren't used by ScopedMock logins.
+func (s *ScopedMock) QueueCode(code string) {
+	s.CodeQueue.Push(code)
+}
+
+// QueueError queues an error for the next ScopedMock handler call
+func (s *ScopedMock) QueueError(se *ServerError) {
+	s.ErrorQueue.Push(se)
+}
+
+// SecurityLint returns the insecure client behaviors spotted in requests
+// to the ScopedMock
+func (s *ScopedMock) SecurityLint() []LintFinding {
+	return s.m.lintFindingsOf(s.Name)
+}
+
+// SigningFailures returns how often signed requests to the ScopedMock
+// failed verification
+func (s *ScopedMock) SigningFailures() map[SigningFailure]int {
+	return s.m.signingFailuresOf(s.Name)
+}
+
+// Stats returns the MockOIDC Stats with the sessions & queues of the
+// ScopedMock only
+func (s *ScopedMock) Stats() Stats {
+	stats := s.m.Stats()
+	stats.Sessions = 0
+	if store, ok := s.m.SessionStore.(interface{ ListSessions() []*Session }); ok {
+		for _, session := range store.ListSessions() {
+			if session.Namespace == s.Name {
+				stats.Sessions++
+			}
+		}
+	}
+	stats.QueuedUsers = s.UserQueue.Len()
+	stats.QueuedCodes = s.CodeQueue.Len()
+	stats.QueuedErrors = s.ErrorQueue.Len()
+	return stats
+}
+
+// IssuedTokens returns every token issued to sessions of the ScopedMock
+func (s *ScopedMock) IssuedTokens() []IssuedToken {
+	return s.m.FindIssuedTokens(func(token IssuedToken) bool {
+		return token.Namespace == s.Name
+	})
+}
+
+// Config is the MockOIDC Config with the ScopedMock's Issuer
+func (s *ScopedMock) Config() *Config {
+	cfg := s.m.Config()
+	cfg.Issuer = s.Issuer()
+	return cfg
+}
+
+// Addr returns the base URL of the ScopedMock endpoints (if started)
+func (s *ScopedMock) Addr() string {
+	return s.addr(nil)
+}
+
+// addr is the base URL of the ScopedMock endpoints advertised to a request
+func (s *ScopedMock) addr(req *http.Request) string {
+	addr := s.m.advertisedAddr(req)
+	if addr == "" {
+		return ""
+	}
+	return addr + ScopesBase + url.PathEscape(s.Name)
+}
+
+// Issuer returns the OIDC Issuer of the ScopedMock
+func (s *ScopedMock) Issuer() string {
+	return s.endpoint(IssuerBase)
+}
+
+// DiscoveryEndpoint returns the ScopedMock `/.well-known/openid-configuration` URL
+func (s *ScopedMock) DiscoveryEndpoint() string {
+	return s.endpoint(DiscoveryEndpoint)
+}
+
+// AuthorizationEndpoint returns the ScopedMock `authorization_endpoint`
+func (s *ScopedMock) AuthorizationEndpoint() string {
+	return s.endpoint(AuthorizationEndpoint)
+}
+
+// TokenEndpoint returns the ScopedMock `token_endpoint`
+func (s *ScopedMock) TokenEndpoint() string {
+	return s.endpoint(TokenEndpoint)
+}
+
+// UserinfoEndpoint returns the ScopedMock `userinfo_endpoint`
+func (s *ScopedMock) UserinfoEndpoint() string {
+	return s.endpoint(UserinfoEndpoint)
+}
+
+// JWKSEndpoint returns the ScopedMock `jwks_uri`
+func (s *ScopedMock) JWKSEndpoint() string {
+	return s.endpoint(JWKSEndpoint)
+}
+
+func (s *ScopedMock) endpoint(path string) string {
+	return s.endpointFor(nil, path)
+}
+
+func (s *ScopedMock) endpointFor(req *http.Request, path string) string {
+	addr := s.addr(req)
+	if addr == "" {
+		return ""
+	}
+	return addr + s.m.route(path)
+}
+
+// scopeHandler serves `/scopes/{name}/...` requests with the handler for
+// the path after the scope, with the ScopedMock in the request context.
+func (m *MockOIDC) scopeHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rest := strings.TrimPrefix(req.URL.Path, ScopesBase)
+		parts := strings.SplitN(rest, "/", 2)
+		name, err := url.PathUnescape(parts[0])
+		if err != nil || len(parts) < 2 {
+			http.NotFound(rw, req)
+			return
+		}
+
+		m.mu.Lock()
+		scope, ok := m.scopes[name]
+		m.mu.Unlock()
+		if !ok {
+			http.NotFound(rw, req)
+			return
+		}
+
+		scoped := req.Clone(context.WithValue(req.Context(), scopeContextKey{}, scope))
+		scoped.URL.Path = "/" + parts[1]
+		scoped.URL.RawPath = ""
+		next.ServeHTTP(rw, scoped)
+	})
+}
+
+// requestScope is the ScopedMock a request was made through, if any
+func requestScope(req *http.Request) *ScopedMock {
+	scope, _ := req.Context().Value(scopeContextKey{}).(*ScopedMock)
+	return scope
+}
+
+// requestNamespace is the name of the ScopedMock a request was made
+// through, empty for requests to the MockOIDC itself
+func requestNamespace(req *http.Request) string {
+	if scope := requestScope(req); scope != nil {
+		return scope.Name
+	}
+	return ""
+}
+
+// requestIssuer is the issuer advertised to the request, the ScopedMock's
+// if it was made through one
+func (m *MockOIDC) requestIssuer(req *http.Request) string {
+	if scope := requestScope(req); scope != nil {
+		return scope.endpointFor(req, IssuerBase)
+	}
+	return m.endpointFor(req, IssuerBase)
+}
+
+// sessionConfig is the Config tokens of the Session are issued with in
+// response to the request
+func (m *MockOIDC) sessionConfig(s *Session, req *http.Request) *Config {
+	if s.Namespace == "" {
+		cfg := m.Config()
+		cfg.Issuer = m.endpointFor(req, IssuerBase)
+		return cfg
+	}
+	scope := m.Scope(s.Namespace)
+	cfg := scope.Config()
+	cfg.Issuer = scope.endpointFor(req, IssuerBase)
+	return cfg
+}
@@ -0,0 +1,105 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Scope(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	alice := &mockoidc.MockUser{Subject: "alice"}
+	bob := &mockoidc.MockUser{Subject: "bob"}
+	m.QueueUser(alice)
+
+	scope := m.Scope("package-b")
+	assert.Equal(t, scope, m.Scope("package-b"))
+	scope.QueueUser(bob)
+
+	// scoped discovery
+	resp, err := httpClient.Get(scope.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	discovery := make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	assert.Equal(t, scope.Issuer(), discovery["issuer"])
+	assert.Equal(t, scope.TokenEndpoint(), discovery["token_endpoint"])
+
+	// scoped logins only use the scope's queues
+	m.QueueCode("root-code")
+	scope.QueueCode("scoped-code")
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+	resp, err = httpClient.Get(scope.AuthorizationEndpoint() + "?" + data.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, alice, m.PeekUser())
+	assert.Equal(t, 1, m.Stats().QueuedCodes)
+	assert.Equal(t, 0, scope.Stats().QueuedCodes)
+	assert.Equal(t, 1, scope.Stats().Sessions)
+
+	// the lint finding of the missing nonce is the scope's
+	assert.Len(t, scope.SecurityLint(), 2)
+	assert.Empty(t, m.SecurityLint())
+
+	tokenData := url.Values{}
+	tokenData.Set("client_id", m.ClientID)
+	tokenData.Set("client_secret", m.ClientSecret)
+	tokenData.Set("code", "scoped-code")
+	tokenData.Set("grant_type", "authorization_code")
+
+	// scoped codes aren't accepted by the root token_endpoint
+	resp, err = httpClient.PostForm(m.TokenEndpoint(), tokenData)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = httpClient.PostForm(scope.TokenEndpoint(), tokenData)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	tokens := make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+
+	idToken, err := m.Keypair.VerifyJWT(tokens["id_token"].(string))
+	assert.NoError(t, err)
+	claims := idToken.Claims.(jwt.MapClaims)
+	assert.Equal(t, "bob", claims["sub"])
+	assert.Equal(t, scope.Issuer(), claims["iss"])
+
+	assert.NotEmpty(t, scope.IssuedTokens())
+	assert.Empty(t, m.Scope("package-c").IssuedTokens())
+
+	// scoped errors don't leak
+	scope.QueueError(&mockoidc.ServerError{
+		Code:  http.StatusInternalServerError,
+		Error: mockoidc.InternalServerError,
+	})
+	resp, err = httpClient.Get(m.JWKSEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = httpClient.Get(scope.JWKSEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	// unknown scopes
+	resp, err = httpClient.Get(m.Addr() + mockoidc.ScopesBase + "unknown" + mockoidc.JWKSEndpoint)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
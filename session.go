@@ -1,11 +1,14 @@
 package mockoidc
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"gopkg.in/square/go-jose.v2"
 )
 
 // Session stores a User and their OIDC options across requests
@@ -17,37 +20,101 @@ type Session struct {
 	Granted             bool
 	CodeChallenge       string
 	CodeChallengeMethod string
+	ACR                 string
+	AMR                 []string
+	AuthTime            time.Time
+	Prompts             []string
+	ClientID            string
+	Revoked             bool
+	Namespace           string
+
+	// CodeIssuedAt is when the `authorization_endpoint` issued the code
+	// of the Session. It's zero for Sessions created otherwise.
+	CodeIssuedAt time.Time
+
+	// IssuedAt & RefreshedAt are when the `token_endpoint` first & last
+	// issued tokens for the Session.
+	IssuedAt    time.Time
+	RefreshedAt time.Time
+
+	// ExpiresAt is when the last token of the Session expires, after
+	// which it is garbage collected. Zero never expires.
+	ExpiresAt time.Time
+}
+
+// SessionStore manages our Session objects. ShardedSessionStore is the
+// default, custom backends or instrumented stores can be passed with
+// Config.SessionStore.
+//
+// Stores with a `ListSessions() []*Session` method support Snapshot,
+// Stats & session garbage collection, stores that also have a
+// `PutSession(*Session)` method support Restore, and stores whose session
+// IDs come from a `Codes() *CodeQueue` support QueueCode. Stores with a
+// `SaveSession(*Session) error` method have it called instead of
+// PutSession, so failed saves fail the request.
+type SessionStore interface {
+	NewSession(scope string, nonce string, user User, codeChallenge string, codeChallengeMethod string) (*Session, error)
+	GetSessionByID(id string) (*Session, error)
+	GetSessionByToken(token *jwt.Token) (*Session, error)
+	Delete(id string)
 }
 
-// SessionStore manages our Session objects
-type SessionStore struct {
+// MemorySessionStore is a single map SessionStore tests can inspect
+type MemorySessionStore struct {
+	sync.Mutex
 	Store     map[string]*Session
 	CodeQueue *CodeQueue
 }
 
+// ClaimsHook can modify token claims before they are signed, e.g. to
+// inject per-request claims like tenant IDs or entitlements.
+type ClaimsHook func(session *Session, claims jwt.MapClaims)
+
 // IDTokenClaims are the mandatory claims any User.Claims implementation
 // should use in their jwt.Claims building.
 type IDTokenClaims struct {
-	Nonce string `json:"nonce,omitempty"`
+	Nonce    string   `json:"nonce,omitempty"`
+	ACR      string   `json:"acr,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
+	AuthTime int64    `json:"auth_time,omitempty"`
+	SID      string   `json:"sid,omitempty"`
+
+	SubJWK *jose.JSONWebKey `json:"sub_jwk,omitempty"`
+	*jwt.StandardClaims
+}
+
+// AccessTokenClaims are the claims of access tokens. `scope` records the
+// scopes the token was issued for, which can be narrower than its
+// Session's after a `refresh_token` grant.
+type AccessTokenClaims struct {
+	Scope string `json:"scope"`
+
 	*jwt.StandardClaims
 }
 
-// NewSessionStore initializes the SessionStore for this server
-func NewSessionStore() *SessionStore {
-	return &SessionStore{
+// NewSessionStore initializes a MemorySessionStore
+func NewSessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
 		Store:     make(map[string]*Session),
 		CodeQueue: &CodeQueue{},
 	}
 }
 
 // NewSession creates a new Session for a User
-func (ss *SessionStore) NewSession(scope string, nonce string, user User, codeChallenge string, codeChallengeMethod string) (*Session, error) {
+func (ss *MemorySessionStore) NewSession(scope string, nonce string, user User, codeChallenge string, codeChallengeMethod string) (*Session, error) {
 	sessionID, err := ss.CodeQueue.Pop()
 	if err != nil {
 		return nil, err
 	}
 
-	session := &Session{
+	session := newSession(sessionID, scope, nonce, user, codeChallenge, codeChallengeMethod)
+	ss.PutSession(session)
+
+	return session, nil
+}
+
+func newSession(sessionID string, scope string, nonce string, user User, codeChallenge string, codeChallengeMethod string) *Session {
+	return &Session{
 		SessionID:           sessionID,
 		Scopes:              strings.Split(scope, " "),
 		OIDCNonce:           nonce,
@@ -55,37 +122,107 @@ func (ss *SessionStore) NewSession(scope string, nonce string, user User, codeCh
 		CodeChallenge:       codeChallenge,
 		CodeChallengeMethod: codeChallengeMethod,
 	}
-	ss.Store[sessionID] = session
+}
 
-	return session, nil
+// PutSession stores a Session, replacing any with the same ID
+func (ss *MemorySessionStore) PutSession(session *Session) {
+	ss.Lock()
+	defer ss.Unlock()
+	ss.Store[session.SessionID] = session
+}
+
+// ListSessions returns every Session
+func (ss *MemorySessionStore) ListSessions() []*Session {
+	ss.Lock()
+	defer ss.Unlock()
+
+	sessions := make([]*Session, 0, len(ss.Store))
+	for _, session := range ss.Store {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// Codes returns the CodeQueue session IDs are popped from
+func (ss *MemorySessionStore) Codes() *CodeQueue {
+	return ss.CodeQueue
+}
+
+// Delete deletes the Session with the ID, if any
+func (ss *MemorySessionStore) Delete(id string) {
+	ss.Lock()
+	defer ss.Unlock()
+	delete(ss.Store, id)
+}
+
+// Purge deletes every Session
+func (ss *MemorySessionStore) Purge() {
+	ss.Lock()
+	defer ss.Unlock()
+	ss.Store = make(map[string]*Session)
+}
+
+// DeleteExpired deletes the Sessions that expired by now and returns how
+// many were deleted.
+func (ss *MemorySessionStore) DeleteExpired(now time.Time) int {
+	ss.Lock()
+	defer ss.Unlock()
+
+	deleted := 0
+	for id, session := range ss.Store {
+		if !session.ExpiresAt.IsZero() && !now.Before(session.ExpiresAt) {
+			delete(ss.Store, id)
+			deleted++
+		}
+	}
+	return deleted
 }
 
 // GetSessionByID looks up the Session
-func (ss *SessionStore) GetSessionByID(id string) (*Session, error) {
+func (ss *MemorySessionStore) GetSessionByID(id string) (*Session, error) {
+	ss.Lock()
+	defer ss.Unlock()
+
 	session, ok := ss.Store[id]
 	if !ok {
-		return nil, errors.New("session not found")
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
 	}
 	return session, nil
 }
 
 // GetSessionByToken decodes a token and looks up a Session based on the
 // session ID claim.
-func (ss *SessionStore) GetSessionByToken(token *jwt.Token) (*Session, error) {
+func (ss *MemorySessionStore) GetSessionByToken(token *jwt.Token) (*Session, error) {
+	sessionID, err := tokenSessionID(token)
+	if err != nil {
+		return nil, err
+	}
+	return ss.GetSessionByID(sessionID)
+}
+
+// tokenSessionID returns the session ID claim of a valid token
+func tokenSessionID(token *jwt.Token) (string, error) {
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
-		return nil, errors.New("invalid token")
+		return "", ErrInvalidToken
 	}
 
-	sessionID := claims["jti"].(string)
-	return ss.GetSessionByID(sessionID)
+	sessionID, ok := claims["jti"].(string)
+	if !ok {
+		return "", fmt.Errorf("%w: missing jti claim", ErrInvalidToken)
+	}
+	return sessionID, nil
 }
 
 // AccessToken returns the JWT token with the appropriate claims for
 // an access token
 func (s *Session) AccessToken(config *Config, kp *Keypair, now time.Time) (string, error) {
-	claims := s.standardClaims(config, config.AccessTTL, now)
-	return kp.SignJWT(claims)
+	claims := &AccessTokenClaims{
+		Scope:          strings.Join(s.Scopes, " "),
+		StandardClaims: s.standardClaims(config, config.AccessTTL, now),
+	}
+	return s.signWithHook(kp, claims,
+		accessTokenAudience(config.AccessTokenAudience, config.AccessTokenClaims))
 }
 
 // RefreshToken returns the JWT token with the appropriate claims for
@@ -99,21 +236,98 @@ func (s *Session) RefreshToken(config *Config, kp *Keypair, now time.Time) (stri
 // based on the scopes set.
 func (s *Session) IDToken(config *Config, kp *Keypair, now time.Time) (string, error) {
 	base := &IDTokenClaims{
-		StandardClaims: s.standardClaims(config, config.AccessTTL, now),
+		StandardClaims: s.standardClaims(config, config.idTokenTTL(), now),
 		Nonce:          s.OIDCNonce,
+		ACR:            s.ACR,
+		AMR:            s.AMR,
+		SID:            s.SessionID,
 	}
-	claims, err := s.User.Claims(s.Scopes, base)
+	if !s.AuthTime.IsZero() {
+		base.AuthTime = s.AuthTime.Unix()
+	}
+	if config.SelfIssued {
+		if err := selfIssue(base, kp); err != nil {
+			return "", err
+		}
+	}
+	claims, err := s.User.Claims(s.ClaimScopes(config), base)
 	if err != nil {
 		return "", err
 	}
 
-	return kp.SignJWT(claims)
+	return s.signWithHook(kp, claims,
+		idTokenAudience(config.IDTokenAudience, config.IDTokenClaims))
+}
+
+// idTokenTTL is the IDTokenTTL, or the AccessTTL if it isn't set
+func (c *Config) idTokenTTL() time.Duration {
+	if c.IDTokenTTL != 0 {
+		return c.IDTokenTTL
+	}
+	return c.AccessTTL
+}
+
+// ClaimScopes are the scopes User claims are filtered by. They are the
+// Session scopes, or every supported scope with Config.LenientClaims.
+func (s *Session) ClaimScopes(config *Config) []string {
+	if config.LenientClaims {
+		return ScopesSupported
+	}
+	return s.Scopes
+}
+
+// signWithHook lets a ClaimsHook modify the claims before they are signed
+func (s *Session) signWithHook(kp *Keypair, claims jwt.Claims, hook ClaimsHook) (string, error) {
+	if hook == nil {
+		return kp.SignJWT(claims)
+	}
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	mapClaims := jwt.MapClaims{}
+	if err := json.Unmarshal(data, &mapClaims); err != nil {
+		return "", err
+	}
+	hook(s, mapClaims)
+
+	return kp.SignJWT(mapClaims)
+}
+
+// expiresAt is the `exp` claim of a token issued now. Sub-second expiries
+// are rounded up to the next whole second, so short TTLs never produce
+// tokens that are expired before they are issued. TTLs that aren't
+// positive do: tokens are only expired once `exp` is in the past, so it's
+// at least a second before now.
+func expiresAt(now time.Time, ttl time.Duration) int64 {
+	if ttl <= 0 {
+		exp := now.Add(ttl).Unix()
+		if exp >= now.Unix() {
+			return now.Unix() - 1
+		}
+		return exp
+	}
+	exp := now.Add(ttl)
+	if exp.Nanosecond() > 0 {
+		return exp.Unix() + 1
+	}
+	return exp.Unix()
+}
+
+// ttlSeconds is a TTL in whole seconds, rounded up like expiresAt
+func ttlSeconds(ttl time.Duration) int64 {
+	seconds := int64(ttl / time.Second)
+	if ttl%time.Second > 0 {
+		seconds++
+	}
+	return seconds
 }
 
 func (s *Session) standardClaims(config *Config, ttl time.Duration, now time.Time) *jwt.StandardClaims {
 	return &jwt.StandardClaims{
 		Audience:  config.ClientID,
-		ExpiresAt: now.Add(ttl).Unix(),
+		ExpiresAt: expiresAt(now, ttl),
 		Id:        s.SessionID,
 		IssuedAt:  now.Unix(),
 		Issuer:    config.Issuer,
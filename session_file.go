@@ -0,0 +1,185 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultFileSaveDelay is the SaveDelay of FileSessionStores
+const DefaultFileSaveDelay = 100 * time.Millisecond
+
+// FileSessionStore is a MemorySessionStore that saves its Sessions to a
+// JSON file, so a restarted server still accepts the refresh tokens it
+// issued. Sessions of Users that aren't MockUsers are looked up in Users
+// when the file is loaded.
+//
+// Changes made within the SaveDelay are batched into a single write, and
+// the file is replaced atomically. Flush writes pending changes right
+// away; MockOIDC.Shutdown flushes its SessionStore. With a SaveDelay of 0
+// every change is written immediately.
+type FileSessionStore struct {
+	*MemorySessionStore
+	Path      string
+	Users     UserStore
+	SaveDelay time.Duration
+
+	mu      sync.Mutex
+	pending *time.Timer
+	dirty   bool
+}
+
+// NewFileSessionStore creates a FileSessionStore loading the Sessions
+// saved at the path, if any.
+func NewFileSessionStore(path string, users UserStore) (*FileSessionStore, error) {
+	store := &FileSessionStore{
+		MemorySessionStore: NewSessionStore(),
+		Path:               path,
+		Users:              users,
+		SaveDelay:          DefaultFileSaveDelay,
+	}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewSession creates a new Session for a User and saves it
+func (s *FileSessionStore) NewSession(scope string, nonce string, user User, codeChallenge string, codeChallengeMethod string) (*Session, error) {
+	session, err := s.MemorySessionStore.NewSession(scope, nonce, user, codeChallenge, codeChallengeMethod)
+	if err != nil {
+		return nil, err
+	}
+	return session, s.changed()
+}
+
+// PutSession stores a Session and saves it. Use SaveSession to learn
+// whether saving failed.
+func (s *FileSessionStore) PutSession(session *Session) {
+	s.MemorySessionStore.PutSession(session)
+	_ = s.changed()
+}
+
+// SaveSession stores a Session and saves it
+func (s *FileSessionStore) SaveSession(session *Session) error {
+	s.MemorySessionStore.PutSession(session)
+	return s.changed()
+}
+
+// Delete deletes the Session with the ID, if any, from the file
+func (s *FileSessionStore) Delete(id string) {
+	s.MemorySessionStore.Delete(id)
+	_ = s.changed()
+}
+
+// Purge deletes every Session from the file
+func (s *FileSessionStore) Purge() {
+	s.MemorySessionStore.Purge()
+	_ = s.changed()
+}
+
+// DeleteExpired deletes the Sessions that expired by now from the file
+// and returns how many were deleted.
+func (s *FileSessionStore) DeleteExpired(now time.Time) int {
+	deleted := s.MemorySessionStore.DeleteExpired(now)
+	if deleted > 0 {
+		_ = s.changed()
+	}
+	return deleted
+}
+
+// Flush writes the pending changes to the file
+func (s *FileSessionStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != nil {
+		s.pending.Stop()
+		s.pending = nil
+	}
+	if !s.dirty {
+		return nil
+	}
+	if err := s.save(); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// changed saves a change, immediately without a SaveDelay or else with the
+// other changes made within it. A failed save is retried with the next
+// change.
+func (s *FileSessionStore) changed() error {
+	s.mu.Lock()
+	s.dirty = true
+	if s.SaveDelay > 0 {
+		if s.pending == nil {
+			s.pending = time.AfterFunc(s.SaveDelay, func() { _ = s.Flush() })
+		}
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+	return s.Flush()
+}
+
+// save atomically replaces the file with the current Sessions by renaming
+// a temporary file over it
+func (s *FileSessionStore) save() error {
+	stored := s.ListSessions()
+	sessions := make([]PersistedSession, 0, len(stored))
+	for _, session := range stored {
+		sessions = append(sessions, persistSession(session))
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].SessionID < sessions[j].SessionID
+	})
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.Path), filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// load reads the Sessions saved in the file, if it exists
+func (s *FileSessionStore) load() error {
+	data, err := ioutil.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var sessions []PersistedSession
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return err
+	}
+	for _, persisted := range sessions {
+		session, err := persisted.session(s.Users)
+		if err != nil {
+			return err
+		}
+		s.MemorySessionStore.PutSession(session)
+	}
+	return nil
+}
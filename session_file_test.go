@@ -0,0 +1,135 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixtureUser is a User that isn't a MockUser
+type fixtureUser struct {
+	*mockoidc.MockUser
+}
+
+func TestFileSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	user := &mockoidc.MockUser{Subject: "file-user"}
+
+	store, err := mockoidc.NewFileSessionStore(path, nil)
+	assert.NoError(t, err)
+	session, err := store.NewSession("openid email", "nonce", user, "", "")
+	assert.NoError(t, err)
+	session.Granted = true
+	store.PutSession(session)
+	deleted, err := store.NewSession("openid", "nonce", user, "", "")
+	assert.NoError(t, err)
+	store.Delete(deleted.SessionID)
+
+	// changes are batched until the SaveDelay passed or they're flushed
+	assert.NoFileExists(t, path)
+	assert.NoError(t, store.Flush())
+	assert.FileExists(t, path)
+
+	reloaded, err := mockoidc.NewFileSessionStore(path, nil)
+	assert.NoError(t, err)
+	assert.Len(t, reloaded.ListSessions(), 1)
+	restored, err := reloaded.GetSessionByID(session.SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, session.Scopes, restored.Scopes)
+	assert.True(t, restored.Granted)
+	assert.Equal(t, user, restored.User)
+
+	// without a SaveDelay every change is written right away
+	reloaded.SaveDelay = 0
+	reloaded.Delete(session.SessionID)
+	empty, err := mockoidc.NewFileSessionStore(path, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, empty.ListSessions())
+}
+
+func TestFileSessionStore_SaveDelay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	store, err := mockoidc.NewFileSessionStore(path, nil)
+	assert.NoError(t, err)
+	store.SaveDelay = 10 * time.Millisecond
+
+	_, err = store.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		reloaded, err := mockoidc.NewFileSessionStore(path, nil)
+		return err == nil && len(reloaded.ListSessions()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestFileSessionStore_UserLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+	user := &fixtureUser{MockUser: &mockoidc.MockUser{Subject: "fixture"}}
+
+	store, err := mockoidc.NewFileSessionStore(path, nil)
+	assert.NoError(t, err)
+	_, err = store.NewSession("openid", "nonce", user, "", "")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Flush())
+
+	_, err = mockoidc.NewFileSessionStore(path, nil)
+	assert.ErrorIs(t, err, mockoidc.ErrUserNotFound)
+
+	reloaded, err := mockoidc.NewFileSessionStore(path, mockoidc.NewMemoryUserStore(user))
+	assert.NoError(t, err)
+	assert.Equal(t, user, reloaded.ListSessions()[0].User)
+}
+
+func TestMockOIDC_FileSessionStoreRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	start := func() *mockoidc.MockOIDC {
+		m, err := mockoidc.NewServer(nil)
+		assert.NoError(t, err)
+		store, err := mockoidc.NewFileSessionStore(path, m.UserStore)
+		assert.NoError(t, err)
+		m.ApplyConfig(&mockoidc.Config{
+			ClientID:     "restart-client",
+			ClientSecret: "restart-secret",
+			SessionStore: store,
+		})
+		return m
+	}
+	token := func(m *mockoidc.MockOIDC, data url.Values) (int, map[string]interface{}) {
+		data.Set("client_id", m.ClientID)
+		data.Set("client_secret", m.ClientSecret)
+		rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+		tokenResp := make(map[string]interface{})
+		assert.NoError(t, getJSON(rr, &tokenResp))
+		return rr.Code, tokenResp
+	}
+
+	m := start()
+	m.QueueCode("restart-code")
+	assert.HTTPStatusCode(t, m.Authorize, http.MethodGet,
+		mockoidc.AuthorizationEndpoint, authorizeData(m), http.StatusFound)
+	code, tokenResp := token(m, url.Values{
+		"code":       {"restart-code"},
+		"grant_type": {"authorization_code"},
+	})
+	assert.Equal(t, http.StatusOK, code)
+
+	// the mock restarts, e.g. to simulate IdP downtime
+	assert.NoError(t, m.Shutdown())
+	restarted := start()
+	code, _ = token(restarted, url.Values{
+		"code":       {"restart-code"},
+		"grant_type": {"authorization_code"},
+	})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = token(restarted, url.Values{
+		"refresh_token": {tokenResp["refresh_token"].(string)},
+		"grant_type":    {"refresh_token"},
+	})
+	assert.Equal(t, http.StatusOK, code)
+}
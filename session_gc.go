@@ -0,0 +1,100 @@
+package mockoidc
+
+import "time"
+
+// sessionGCInterval is how often `authorization_endpoint` requests
+// garbage collect expired sessions
+const sessionGCInterval = time.Minute
+
+// CollectSessions deletes the sessions whose tokens have all expired and
+// returns how many were deleted. It runs automatically on
+// `authorization_endpoint` requests at most once a minute, so long-running
+// load tests don't accumulate sessions. The bookkeeping of sessions the
+// store no longer has, e.g. as the LRUSessionStore evicted them, is
+// dropped too.
+func (m *MockOIDC) CollectSessions() int {
+	m.mu.Lock()
+	m.lastSessionGC = m.Now()
+	m.mu.Unlock()
+
+	now := m.Now()
+	deleted := 0
+	switch store := m.SessionStore.(type) {
+	case interface{ DeleteExpired(time.Time) int }:
+		deleted = store.DeleteExpired(now)
+	case interface{ ListSessions() []*Session }:
+		for _, session := range store.ListSessions() {
+			if !session.ExpiresAt.IsZero() && !now.Before(session.ExpiresAt) {
+				m.SessionStore.Delete(session.SessionID)
+				deleted++
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, capped := range []map[string][]string{m.userSessions, m.clientSessions} {
+		for key, ids := range capped {
+			if kept := m.liveSessionIDs(ids, now); len(kept) == 0 {
+				delete(capped, key)
+			} else {
+				capped[key] = kept
+			}
+		}
+	}
+	return deleted
+}
+
+// peekSession reads a session for bookkeeping, without making it recently
+// used in stores that evict the least recently used sessions
+func (m *MockOIDC) peekSession(id string) (*Session, error) {
+	if store, ok := m.SessionStore.(interface {
+		peekSession(string) (*Session, error)
+	}); ok {
+		return store.peekSession(id)
+	}
+	return m.SessionStore.GetSessionByID(id)
+}
+
+// liveSessionIDs filters the IDs of the sessions that are stored, weren't
+// revoked and didn't expire by now, in place. The sessions are read from
+// the SessionStore, where other requests revoke them. It must be called
+// with the lock held.
+func (m *MockOIDC) liveSessionIDs(ids []string, now time.Time) []string {
+	kept := ids[:0]
+	for _, id := range ids {
+		session, err := m.peekSession(id)
+		switch {
+		case err != nil:
+		case session.Revoked:
+		case !session.ExpiresAt.IsZero() && !now.Before(session.ExpiresAt):
+		default:
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// collectSessions runs CollectSessions if it didn't run for the
+// sessionGCInterval.
+func (m *MockOIDC) collectSessions() {
+	m.mu.Lock()
+	due := !m.Now().Before(m.lastSessionGC.Add(sessionGCInterval))
+	m.mu.Unlock()
+
+	if due {
+		m.CollectSessions()
+	}
+}
+
+// sessionTTL is how long a session lives after its last tokens were
+// issued: until the longest lived of them expires.
+func (m *MockOIDC) sessionTTL() time.Duration {
+	ttl := m.RefreshTTL
+	for _, tokenTTL := range []time.Duration{m.AccessTTL, m.IDTokenTTL} {
+		if tokenTTL > ttl {
+			ttl = tokenTTL
+		}
+	}
+	return ttl
+}
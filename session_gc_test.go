@@ -0,0 +1,64 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionStore_Purge(t *testing.T) {
+	ss := mockoidc.NewSessionStore()
+	now := time.Unix(TestNow, 0)
+
+	expired, err := ss.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	expired.ExpiresAt = now
+	live, err := ss.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	live.ExpiresAt = now.Add(time.Second)
+	_, err = ss.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, ss.DeleteExpired(now))
+	assert.Len(t, ss.Store, 2)
+	_, err = ss.GetSessionByID(expired.SessionID)
+	assert.ErrorIs(t, err, mockoidc.ErrSessionNotFound)
+
+	ss.Purge()
+	assert.Len(t, ss.Store, 0)
+}
+
+func TestMockOIDC_CollectSessions(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.RefreshTTL = time.Hour
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+	authorize := func() {
+		assert.HTTPStatusCode(t, m.Authorize, http.MethodGet,
+			mockoidc.AuthorizationEndpoint, data, http.StatusFound)
+	}
+
+	authorize()
+	authorize()
+	assert.Equal(t, 2, m.Stats().Sessions)
+	assert.Equal(t, 0, m.CollectSessions())
+
+	// sessions are collected once their refresh tokens expired
+	m.FastForward(time.Hour)
+	authorize()
+	assert.Equal(t, 1, m.Stats().Sessions)
+
+	m.FastForward(time.Hour)
+	assert.Equal(t, 1, m.CollectSessions())
+	assert.Equal(t, 0, m.Stats().Sessions)
+}
@@ -0,0 +1,162 @@
+package mockoidc
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// LRUSessionStore is an in-memory SessionStore holding at most
+// MaxSessions Sessions, so sustained load tests have predictable memory
+// usage. Once full, the least recently used Session is evicted and its
+// codes & tokens become invalid.
+type LRUSessionStore struct {
+	MaxSessions int
+	CodeQueue   *CodeQueue
+
+	mu        sync.Mutex
+	sessions  map[string]*list.Element
+	order     *list.List
+	evictions int
+}
+
+// NewLRUSessionStore creates an LRUSessionStore holding at most
+// maxSessions Sessions
+func NewLRUSessionStore(maxSessions int) *LRUSessionStore {
+	return &LRUSessionStore{
+		MaxSessions: maxSessions,
+		CodeQueue:   &CodeQueue{},
+		sessions:    make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// NewSession creates a new Session for a User, evicting the least
+// recently used Session if the store is full.
+func (s *LRUSessionStore) NewSession(scope string, nonce string, user User, codeChallenge string, codeChallengeMethod string) (*Session, error) {
+	sessionID, err := s.CodeQueue.Pop()
+	if err != nil {
+		return nil, err
+	}
+
+	session := newSession(sessionID, scope, nonce, user, codeChallenge, codeChallengeMethod)
+	s.PutSession(session)
+
+	return session, nil
+}
+
+// PutSession stores a Session as the most recently used, replacing any
+// with the same ID.
+func (s *LRUSessionStore) PutSession(session *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.sessions[session.SessionID]; ok {
+		elem.Value = session
+		s.order.MoveToFront(elem)
+		return
+	}
+	s.sessions[session.SessionID] = s.order.PushFront(session)
+
+	for s.MaxSessions > 0 && s.order.Len() > s.MaxSessions {
+		s.remove(s.order.Back())
+		s.evictions++
+	}
+}
+
+// GetSessionByID looks up the Session and marks it most recently used
+func (s *LRUSessionStore) GetSessionByID(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	s.order.MoveToFront(elem)
+	return elem.Value.(*Session), nil
+}
+
+// peekSession looks up the Session without making it recently used
+func (s *LRUSessionStore) peekSession(id string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return elem.Value.(*Session), nil
+}
+
+// GetSessionByToken decodes a token and looks up a Session based on the
+// session ID claim.
+func (s *LRUSessionStore) GetSessionByToken(token *jwt.Token) (*Session, error) {
+	sessionID, err := tokenSessionID(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSessionByID(sessionID)
+}
+
+// Delete deletes the Session with the ID, if any
+func (s *LRUSessionStore) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.sessions[id]; ok {
+		s.remove(elem)
+	}
+}
+
+// ListSessions returns every Session, most recently used first
+func (s *LRUSessionStore) ListSessions() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]*Session, 0, s.order.Len())
+	for elem := s.order.Front(); elem != nil; elem = elem.Next() {
+		sessions = append(sessions, elem.Value.(*Session))
+	}
+	return sessions
+}
+
+// DeleteExpired deletes the Sessions that expired by now and returns how
+// many were deleted. They don't count as evictions.
+func (s *LRUSessionStore) DeleteExpired(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for elem := s.order.Front(); elem != nil; {
+		next := elem.Next()
+		session := elem.Value.(*Session)
+		if !session.ExpiresAt.IsZero() && !now.Before(session.ExpiresAt) {
+			s.remove(elem)
+			deleted++
+		}
+		elem = next
+	}
+	return deleted
+}
+
+// Codes returns the CodeQueue session IDs are popped from
+func (s *LRUSessionStore) Codes() *CodeQueue {
+	return s.CodeQueue
+}
+
+// Evictions returns how many Sessions were evicted to stay within
+// MaxSessions
+func (s *LRUSessionStore) Evictions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.evictions
+}
+
+func (s *LRUSessionStore) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.sessions, elem.Value.(*Session).SessionID)
+}
@@ -0,0 +1,92 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUSessionStore(t *testing.T) {
+	store := mockoidc.NewLRUSessionStore(2)
+	user := mockoidc.DefaultUser()
+
+	first, err := store.NewSession("openid", "nonce", user, "", "")
+	assert.NoError(t, err)
+	second, err := store.NewSession("openid", "nonce", user, "", "")
+	assert.NoError(t, err)
+
+	// using the first session makes the second the least recently used
+	_, err = store.GetSessionByID(first.SessionID)
+	assert.NoError(t, err)
+	third, err := store.NewSession("openid", "nonce", user, "", "")
+	assert.NoError(t, err)
+
+	_, err = store.GetSessionByID(second.SessionID)
+	assert.ErrorIs(t, err, mockoidc.ErrSessionNotFound)
+	assert.Equal(t, []*mockoidc.Session{third, first}, store.ListSessions())
+	assert.Equal(t, 1, store.Evictions())
+
+	// replacing a session doesn't evict
+	store.PutSession(first)
+	assert.Len(t, store.ListSessions(), 2)
+	assert.Equal(t, 1, store.Evictions())
+
+	store.Delete(first.SessionID)
+	assert.Equal(t, []*mockoidc.Session{third}, store.ListSessions())
+}
+
+func TestLRUSessionStore_DeleteExpired(t *testing.T) {
+	store := mockoidc.NewLRUSessionStore(10)
+	now := time.Unix(TestNow, 0)
+
+	expired, err := store.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	expired.ExpiresAt = now
+	live, err := store.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	live.ExpiresAt = now.Add(time.Second)
+
+	assert.Equal(t, 1, store.DeleteExpired(now))
+	assert.Equal(t, []*mockoidc.Session{live}, store.ListSessions())
+	assert.Equal(t, 0, store.Evictions())
+}
+
+func TestMockOIDC_LRUSessionStore(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(&mockoidc.Config{SessionStore: mockoidc.NewLRUSessionStore(3)})
+
+	for i := 0; i < 10; i++ {
+		assert.HTTPStatusCode(t, m.Authorize, http.MethodGet,
+			mockoidc.AuthorizationEndpoint, authorizeData(m), http.StatusFound)
+	}
+
+	stats := m.Stats()
+	assert.Equal(t, 3, stats.Sessions)
+	assert.Equal(t, 7, stats.SessionEvictions)
+}
+
+func TestMockOIDC_HistoryLimit(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(&mockoidc.Config{
+		SessionStore: mockoidc.NewLRUSessionStore(3),
+		HistoryLimit: 4,
+	})
+
+	var last map[string]interface{}
+	for i := 0; i < 20; i++ {
+		last = issueTokens(t, m)
+	}
+
+	issued := m.IssuedTokens()
+	assert.LessOrEqual(t, len(issued), 5)
+	tokens := make([]string, 0, len(issued))
+	for _, token := range issued {
+		tokens = append(tokens, token.Token)
+	}
+	assert.Contains(t, tokens, last["access_token"])
+}
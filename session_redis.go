@@ -0,0 +1,483 @@
+package mockoidc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// DefaultRedisPrefix is the key prefix of Sessions in Redis
+const DefaultRedisPrefix = "mockoidc:session:"
+
+// DefaultRedisTimeout bounds connecting to Redis & every command
+const DefaultRedisTimeout = 5 * time.Second
+
+// redisRedeemedTTL is how long redeemed codes of Sessions that don't
+// expire yet are remembered. Replays after it are still rejected as the
+// Session is Granted.
+const redisRedeemedTTL = 24 * time.Hour
+
+// RedisClient is the subset of Redis commands RedisSessionStore uses, so
+// any Redis client library can be adapted to it. RedisConn is a minimal
+// built-in one.
+type RedisClient interface {
+	// Get returns false if the key doesn't exist
+	Get(ctx context.Context, key string) (string, bool, error)
+	// Set stores the value, expiring after the ttl unless it's zero
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	// SetNX stores the value unless the key exists, like Set. It's false
+	// if the key existed.
+	SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error)
+	Del(ctx context.Context, key string) error
+}
+
+// RedisSessionStore keeps Sessions in Redis, so MockOIDC replicas behind
+// a load balancer share them. Sessions are saved as JSON with their
+// MockUsers in full, Users that aren't MockUsers are looked up in Users.
+// Redis expires Sessions once their tokens did.
+//
+// Session IDs are popped off the CodeQueue of the replica handling the
+// `authorization_endpoint` request. Codes are redeemed with an atomic
+// SET NX, so they're only redeemed once across all replicas, and
+// revocations are kept in a key of their own, so saving a stale copy of a
+// Session can't undo them.
+type RedisSessionStore struct {
+	Client    RedisClient
+	Prefix    string
+	Users     UserStore
+	CodeQueue *CodeQueue
+
+	// Timeout bounds every command, unless it's zero
+	Timeout time.Duration
+
+	// Now is the time Session expiry is relative to. It defaults to the
+	// clock of the MockOIDC using the store, or time.Now outside of one.
+	Now func() time.Time
+
+	clockMu sync.Mutex
+	clock   func() time.Time
+}
+
+// NewRedisSessionStore creates a RedisSessionStore with the
+// DefaultRedisPrefix & DefaultRedisTimeout
+func NewRedisSessionStore(client RedisClient, users UserStore) *RedisSessionStore {
+	return &RedisSessionStore{
+		Client:    client,
+		Prefix:    DefaultRedisPrefix,
+		Users:     users,
+		CodeQueue: &CodeQueue{},
+		Timeout:   DefaultRedisTimeout,
+	}
+}
+
+// NewSession creates a new Session for a User and saves it
+func (s *RedisSessionStore) NewSession(scope string, nonce string, user User, codeChallenge string, codeChallengeMethod string) (*Session, error) {
+	sessionID, err := s.CodeQueue.Pop()
+	if err != nil {
+		return nil, err
+	}
+
+	session := newSession(sessionID, scope, nonce, user, codeChallenge, codeChallengeMethod)
+	if err := s.put(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetSessionByID loads the Session
+func (s *RedisSessionStore) GetSessionByID(id string) (*Session, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	data, ok, err := s.Client.Get(ctx, s.Prefix+id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+
+	var persisted PersistedSession
+	if err := json.Unmarshal([]byte(data), &persisted); err != nil {
+		return nil, err
+	}
+	if !persisted.Revoked {
+		_, persisted.Revoked, err = s.Client.Get(ctx, s.revokedKey(id))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return persisted.session(s.Users)
+}
+
+// GetSessionByToken decodes a token and loads the Session of its session
+// ID claim.
+func (s *RedisSessionStore) GetSessionByToken(token *jwt.Token) (*Session, error) {
+	sessionID, err := tokenSessionID(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSessionByID(sessionID)
+}
+
+// PutSession saves a Session, replacing any with the same ID. Use
+// SaveSession to learn whether it failed.
+func (s *RedisSessionStore) PutSession(session *Session) {
+	_ = s.put(session)
+}
+
+// SaveSession saves a Session, replacing any with the same ID
+func (s *RedisSessionStore) SaveSession(session *Session) error {
+	return s.put(session)
+}
+
+// RedeemCode marks the code of a Session as redeemed with SET NX. It's
+// false if any replica already redeemed it.
+func (s *RedisSessionStore) RedeemCode(session *Session) (bool, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	ttl := s.ttl(session)
+	if ttl <= 0 {
+		ttl = redisRedeemedTTL
+	}
+	return s.Client.SetNX(ctx, s.redeemedKey(session.SessionID), "1", ttl)
+}
+
+// Delete deletes the Session with the ID, if any
+func (s *RedisSessionStore) Delete(id string) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	for _, key := range []string{s.Prefix + id, s.redeemedKey(id), s.revokedKey(id)} {
+		_ = s.Client.Del(ctx, key)
+	}
+}
+
+// Codes returns the CodeQueue session IDs are popped from
+func (s *RedisSessionStore) Codes() *CodeQueue {
+	return s.CodeQueue
+}
+
+func (s *RedisSessionStore) put(session *Session) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	ttl := s.ttl(session)
+	if ttl < 0 {
+		return s.Client.Del(ctx, s.Prefix+session.SessionID)
+	}
+
+	data, err := json.Marshal(persistSession(session))
+	if err != nil {
+		return err
+	}
+	if session.Revoked {
+		if err := s.Client.Set(ctx, s.revokedKey(session.SessionID), "1", ttl); err != nil {
+			return err
+		}
+	}
+	return s.Client.Set(ctx, s.Prefix+session.SessionID, string(data), ttl)
+}
+
+// ttl is how long until the Session expires: zero if it doesn't and
+// negative if it did.
+func (s *RedisSessionStore) ttl(session *Session) time.Duration {
+	if session.ExpiresAt.IsZero() {
+		return 0
+	}
+	ttl := session.ExpiresAt.Sub(s.now())
+	if ttl <= 0 {
+		return -1
+	}
+	return ttl
+}
+
+// now is the Now, the clock of the MockOIDC using the store or time.Now
+func (s *RedisSessionStore) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	s.clockMu.Lock()
+	clock := s.clock
+	s.clockMu.Unlock()
+	if clock != nil {
+		return clock()
+	}
+	return time.Now()
+}
+
+// installSessionClock makes a RedisSessionStore without a Now expire
+// Sessions by the MockOIDC's clock
+func (m *MockOIDC) installSessionClock() {
+	store, ok := m.SessionStore.(*RedisSessionStore)
+	if !ok {
+		return
+	}
+	store.clockMu.Lock()
+	defer store.clockMu.Unlock()
+	if store.clock == nil {
+		store.clock = m.Now
+	}
+}
+
+// context bounds a command by the Timeout
+func (s *RedisSessionStore) context() (context.Context, context.CancelFunc) {
+	if s.Timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), s.Timeout)
+}
+
+func (s *RedisSessionStore) redeemedKey(id string) string {
+	return s.Prefix + id + ":redeemed"
+}
+
+func (s *RedisSessionStore) revokedKey(id string) string {
+	return s.Prefix + id + ":revoked"
+}
+
+// RedisConn is a minimal RedisClient speaking RESP to a single Redis
+// server over one connection, redialed after network errors. Create it
+// with its options set instead of DialRedis to authenticate or use TLS,
+// it connects on the first command. Use an adapter of your Redis library
+// for connection pools or clusters.
+type RedisConn struct {
+	Addr string
+	// Username & Password are sent with AUTH, unless Password is empty
+	Username string
+	Password string
+	// DB is SELECTed unless it's zero
+	DB int
+	// TLSConfig enables TLS unless it's nil
+	TLSConfig *tls.Config
+	// Timeout bounds connecting and commands whose context has no
+	// deadline. It defaults to DefaultRedisTimeout.
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// redisError is an error reply of the Redis server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// DialRedis connects a RedisConn to the `host:port` address
+func DialRedis(addr string) (*RedisConn, error) {
+	c := &RedisConn{Addr: addr}
+	if err := c.dial(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Ping checks the connection to the Redis server
+func (c *RedisConn) Ping(ctx context.Context) error {
+	_, err := c.do(ctx, "PING")
+	return err
+}
+
+// Get returns the value of a key, or false if it doesn't exist
+func (c *RedisConn) Get(ctx context.Context, key string) (string, bool, error) {
+	reply, err := c.do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return "", false, err
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return "", false, fmt.Errorf("redis: unexpected GET reply %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set stores the value of a key, expiring after the ttl unless it's zero
+func (c *RedisConn) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	_, err := c.do(ctx, setArgs(key, value, ttl)...)
+	return err
+}
+
+// SetNX stores the value of a key unless it exists, expiring after the
+// ttl unless it's zero. It's false if the key existed.
+func (c *RedisConn) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	reply, err := c.do(ctx, append(setArgs(key, value, ttl), "NX")...)
+	return err == nil && reply != nil, err
+}
+
+func setArgs(key, value string, ttl time.Duration) []string {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		ms := ttl.Milliseconds()
+		if ms == 0 {
+			ms = 1
+		}
+		args = append(args, "PX", strconv.FormatInt(ms, 10))
+	}
+	return args
+}
+
+// Del deletes a key
+func (c *RedisConn) Del(ctx context.Context, key string) error {
+	_, err := c.do(ctx, "DEL", key)
+	return err
+}
+
+// Close closes the connection
+func (c *RedisConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+func (c *RedisConn) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultRedisTimeout
+	}
+	return c.Timeout
+}
+
+// dial connects, authenticates & selects the DB
+func (c *RedisConn) dial(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: c.timeout()}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if c.TLSConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: c.TLSConfig}).DialContext(ctx, "tcp", c.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+
+	var setup [][]string
+	if c.Password != "" {
+		auth := []string{"AUTH", c.Password}
+		if c.Username != "" {
+			auth = []string{"AUTH", c.Username, c.Password}
+		}
+		setup = append(setup, auth)
+	}
+	if c.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.DB)})
+	}
+	for _, args := range setup {
+		if _, err := c.roundTrip(ctx, args...); err != nil {
+			conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends a command and reads its reply: a string, an int64, a
+// []interface{} or nil.
+func (c *RedisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.dial(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTrip(ctx, args...)
+
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+// roundTrip sends a command on the connection, bounded by the deadline of
+// the context or the Timeout.
+func (c *RedisConn) roundTrip(ctx context.Context, args ...string) (interface{}, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(c.timeout())
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var cmd strings.Builder
+	fmt.Fprintf(&cmd, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&cmd, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, cmd.String()); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.r)
+}
+
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		replies := make([]interface{}, n)
+		for i := range replies {
+			if replies[i], err = readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,424 @@
+package mockoidc_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis serves GET, SET, DEL, AUTH & SELECT over RESP from a map
+type fakeRedis struct {
+	sync.Mutex
+	values   map[string]string
+	ttls     map[string]string
+	password string
+	db       string
+}
+
+func startFakeRedis(t *testing.T) (*fakeRedis, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	fake := &fakeRedis{values: map[string]string{}, ttls: map[string]string{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(conn)
+		}
+	}()
+	return fake, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := false
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.Lock()
+		password := f.password
+		f.Unlock()
+		switch {
+		case strings.EqualFold(args[0], "AUTH"):
+			authenticated = args[len(args)-1] == password
+			if !authenticated {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			fmt.Fprint(conn, "+OK\r\n")
+		case password != "" && !authenticated:
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+		default:
+			fmt.Fprint(conn, f.reply(args))
+		}
+	}
+}
+
+func (f *fakeRedis) has(key string) bool {
+	f.Lock()
+	defer f.Unlock()
+	_, ok := f.values[key]
+	return ok
+}
+
+func (f *fakeRedis) ttl(key string) string {
+	f.Lock()
+	defer f.Unlock()
+	return f.ttls[key]
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.Lock()
+	defer f.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		if args[len(args)-1] == "NX" {
+			if _, ok := f.values[args[1]]; ok {
+				return "$-1\r\n"
+			}
+		}
+		f.values[args[1]] = args[2]
+		delete(f.ttls, args[1])
+		if len(args) >= 5 && args[3] == "PX" {
+			f.ttls[args[1]] = args[4]
+		}
+		return "+OK\r\n"
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		f.db = args[1]
+		return "+OK\r\n"
+	case "DEL":
+		_, ok := f.values[args[1]]
+		delete(f.values, args[1])
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
+
+func TestRedisConn(t *testing.T) {
+	fake, addr := startFakeRedis(t)
+	conn, err := mockoidc.DialRedis(addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	ctx := context.Background()
+
+	_, ok, err := conn.Get(ctx, "missing")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, conn.Set(ctx, "key", "multi\r\nline", time.Minute))
+	value, ok, err := conn.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "multi\r\nline", value)
+	assert.Equal(t, "60000", fake.ttl("key"))
+
+	assert.NoError(t, conn.Del(ctx, "key"))
+	_, ok, err = conn.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// the connection is redialed after network errors
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, conn.Set(ctx, "key", "value", 0))
+	assert.Empty(t, fake.ttl("key"))
+
+	set, err := conn.SetNX(ctx, "key", "other", time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, set)
+	set, err = conn.SetNX(ctx, "new-key", "value", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, set)
+	assert.Equal(t, "60000", fake.ttl("new-key"))
+}
+
+func TestRedisConn_Auth(t *testing.T) {
+	fake, addr := startFakeRedis(t)
+	fake.password = "redis-secret"
+	ctx := context.Background()
+
+	conn := &mockoidc.RedisConn{Addr: addr, Password: "wrong"}
+	defer conn.Close()
+	assert.EqualError(t, conn.Set(ctx, "key", "value", 0), "redis: WRONGPASS invalid password")
+
+	conn = &mockoidc.RedisConn{Addr: addr, Username: "mockoidc", Password: "redis-secret", DB: 2}
+	defer conn.Close()
+	assert.NoError(t, conn.Ping(ctx))
+	assert.NoError(t, conn.Set(ctx, "key", "value", 0))
+	assert.True(t, fake.has("key"))
+	fake.Lock()
+	assert.Equal(t, "2", fake.db)
+	fake.Unlock()
+}
+
+func TestRedisConn_Timeout(t *testing.T) {
+	// a Redis server that never replies
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	conn := &mockoidc.RedisConn{Addr: ln.Addr().String(), Timeout: 50 * time.Millisecond}
+	defer conn.Close()
+	_, _, err = conn.Get(context.Background(), "key")
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	conn.Timeout = time.Hour
+	_, _, err = conn.Get(ctx, "key")
+	assert.Error(t, err)
+}
+
+func TestRedisSessionStore(t *testing.T) {
+	fake, addr := startFakeRedis(t)
+	conn, err := mockoidc.DialRedis(addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	now := time.Unix(TestNow, 0)
+	store := mockoidc.NewRedisSessionStore(conn, nil)
+	store.Now = func() time.Time { return now }
+	user := &mockoidc.MockUser{Subject: "redis-user"}
+
+	session, err := store.NewSession("openid email", "nonce", user, "", "")
+	assert.NoError(t, err)
+	assert.True(t, fake.has(mockoidc.DefaultRedisPrefix+session.SessionID))
+
+	session.Granted = true
+	session.ExpiresAt = now.Add(time.Hour)
+	store.PutSession(session)
+	assert.Equal(t, "3600000", fake.ttl(mockoidc.DefaultRedisPrefix+session.SessionID))
+
+	loaded, err := store.GetSessionByID(session.SessionID)
+	assert.NoError(t, err)
+	assert.True(t, loaded.Granted)
+	assert.Equal(t, session.Scopes, loaded.Scopes)
+	assert.Equal(t, user, loaded.User)
+
+	// saving a stale copy doesn't undo a revocation
+	loaded.Revoked = true
+	store.PutSession(loaded)
+	store.PutSession(session)
+	loaded, err = store.GetSessionByID(session.SessionID)
+	assert.NoError(t, err)
+	assert.True(t, loaded.Revoked)
+
+	// expired sessions are deleted instead of saved
+	session.ExpiresAt = now
+	store.PutSession(session)
+	_, err = store.GetSessionByID(session.SessionID)
+	assert.ErrorIs(t, err, mockoidc.ErrSessionNotFound)
+
+	store.Delete(session.SessionID)
+	assert.False(t, fake.has(mockoidc.DefaultRedisPrefix+session.SessionID+":revoked"))
+}
+
+func TestRedisSessionStore_RedeemCode(t *testing.T) {
+	_, addr := startFakeRedis(t)
+	replica := func() *mockoidc.RedisSessionStore {
+		conn, err := mockoidc.DialRedis(addr)
+		assert.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return mockoidc.NewRedisSessionStore(conn, nil)
+	}
+	a, b := replica(), replica()
+
+	session, err := a.NewSession("openid", "", &mockoidc.MockUser{Subject: "redis-user"}, "", "")
+	assert.NoError(t, err)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		redeemed int
+	)
+	for _, store := range []*mockoidc.RedisSessionStore{a, b, a, b} {
+		wg.Add(1)
+		go func(store *mockoidc.RedisSessionStore) {
+			defer wg.Done()
+			loaded, err := store.GetSessionByID(session.SessionID)
+			assert.NoError(t, err)
+			ok, err := store.RedeemCode(loaded)
+			assert.NoError(t, err)
+			if ok {
+				mu.Lock()
+				redeemed++
+				mu.Unlock()
+			}
+		}(store)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, redeemed)
+}
+
+func TestMockOIDC_RedisSessionStoreReplicas(t *testing.T) {
+	fake, addr := startFakeRedis(t)
+
+	replica := func() *mockoidc.MockOIDC {
+		m, err := mockoidc.NewServer(nil)
+		assert.NoError(t, err)
+		conn, err := mockoidc.DialRedis(addr)
+		assert.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		m.ApplyConfig(&mockoidc.Config{
+			ClientID:     "replica-client",
+			ClientSecret: "replica-secret",
+			SessionStore: mockoidc.NewRedisSessionStore(conn, m.UserStore),
+		})
+		return m
+	}
+	token := func(m *mockoidc.MockOIDC, data url.Values) (int, map[string]interface{}) {
+		data.Set("client_id", m.ClientID)
+		data.Set("client_secret", m.ClientSecret)
+		rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+		tokenResp := make(map[string]interface{})
+		assert.NoError(t, getJSON(rr, &tokenResp))
+		return rr.Code, tokenResp
+	}
+
+	a, b := replica(), replica()
+	a.QueueCode("replica-code")
+	assert.HTTPStatusCode(t, a.Authorize, http.MethodGet,
+		mockoidc.AuthorizationEndpoint, authorizeData(a), http.StatusFound)
+
+	// the code is redeemed at another replica
+	code, tokenResp := token(b, url.Values{
+		"code":       {"replica-code"},
+		"grant_type": {"authorization_code"},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = token(a, url.Values{
+		"code":       {"replica-code"},
+		"grant_type": {"authorization_code"},
+	})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = token(a, url.Values{
+		"refresh_token": {tokenResp["refresh_token"].(string)},
+		"grant_type":    {"refresh_token"},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	// sessions expire by the mock's clock by default
+	a.FreezeTime()
+	a.FastForward(48 * time.Hour)
+	a.QueueCode("fast-forwarded")
+	assert.HTTPStatusCode(t, a.Authorize, http.MethodGet,
+		mockoidc.AuthorizationEndpoint, authorizeData(a), http.StatusFound)
+	assert.Equal(t, strconv.FormatInt(a.RefreshTTL.Milliseconds(), 10),
+		fake.ttl(mockoidc.DefaultRedisPrefix+"fast-forwarded"))
+}
+
+// failingRedis fails every SET once fail is set
+type failingRedis struct {
+	mockoidc.RedisClient
+	fail bool
+}
+
+func (f *failingRedis) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if f.fail {
+		return errors.New("redis unavailable")
+	}
+	return f.RedisClient.Set(ctx, key, value, ttl)
+}
+
+func TestMockOIDC_RedisSessionStoreErrors(t *testing.T) {
+	_, addr := startFakeRedis(t)
+	conn, err := mockoidc.DialRedis(addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	client := &failingRedis{RedisClient: conn}
+	store := mockoidc.NewRedisSessionStore(client, m.UserStore)
+	m.SessionStore = store
+
+	m.QueueCode("unsaved")
+	client.fail = true
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint+"?"+authorizeData(m).Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	client.fail = false
+	m.QueueCode("saved")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint+"?"+authorizeData(m).Encode(),
+		m.Authorize, http.MethodGet, nil)
+	assert.Equal(t, http.StatusFound, rr.Code)
+
+	// a failed save of the issued tokens fails the token request
+	client.fail = true
+	code, _ := redeemCode(t, m, "saved")
+	assert.Equal(t, http.StatusInternalServerError, code)
+
+	session, err := store.GetSessionByID("saved")
+	assert.NoError(t, err)
+	assert.Error(t, store.SaveSession(session))
+}
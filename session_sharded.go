@@ -0,0 +1,149 @@
+package mockoidc
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// DefaultSessionShards is the number of shards of NewServer's
+// ShardedSessionStore
+const DefaultSessionShards = 32
+
+// ShardedSessionStore is the default in-memory SessionStore. Sessions are
+// spread over independently locked shards, so concurrent token requests
+// for different sessions don't wait on each other.
+type ShardedSessionStore struct {
+	CodeQueue *CodeQueue
+
+	shards []sessionShard
+}
+
+type sessionShard struct {
+	sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewShardedSessionStore creates a ShardedSessionStore with the number of
+// shards, DefaultSessionShards if it's not positive.
+func NewShardedSessionStore(shards int) *ShardedSessionStore {
+	if shards <= 0 {
+		shards = DefaultSessionShards
+	}
+	store := &ShardedSessionStore{
+		CodeQueue: &CodeQueue{},
+		shards:    make([]sessionShard, shards),
+	}
+	for i := range store.shards {
+		store.shards[i].sessions = make(map[string]*Session)
+	}
+	return store
+}
+
+// NewSession creates a new Session for a User
+func (s *ShardedSessionStore) NewSession(scope string, nonce string, user User, codeChallenge string, codeChallengeMethod string) (*Session, error) {
+	sessionID, err := s.CodeQueue.Pop()
+	if err != nil {
+		return nil, err
+	}
+
+	session := newSession(sessionID, scope, nonce, user, codeChallenge, codeChallengeMethod)
+	s.PutSession(session)
+
+	return session, nil
+}
+
+// PutSession stores a Session, replacing any with the same ID
+func (s *ShardedSessionStore) PutSession(session *Session) {
+	shard := s.shard(session.SessionID)
+	shard.Lock()
+	defer shard.Unlock()
+	shard.sessions[session.SessionID] = session
+}
+
+// GetSessionByID looks up the Session
+func (s *ShardedSessionStore) GetSessionByID(id string) (*Session, error) {
+	shard := s.shard(id)
+	shard.RLock()
+	defer shard.RUnlock()
+
+	session, ok := shard.sessions[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, id)
+	}
+	return session, nil
+}
+
+// GetSessionByToken decodes a token and looks up a Session based on the
+// session ID claim.
+func (s *ShardedSessionStore) GetSessionByToken(token *jwt.Token) (*Session, error) {
+	sessionID, err := tokenSessionID(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetSessionByID(sessionID)
+}
+
+// Delete deletes the Session with the ID, if any
+func (s *ShardedSessionStore) Delete(id string) {
+	shard := s.shard(id)
+	shard.Lock()
+	defer shard.Unlock()
+	delete(shard.sessions, id)
+}
+
+// ListSessions returns every Session
+func (s *ShardedSessionStore) ListSessions() []*Session {
+	var sessions []*Session
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.RLock()
+		for _, session := range shard.sessions {
+			sessions = append(sessions, session)
+		}
+		shard.RUnlock()
+	}
+	return sessions
+}
+
+// Purge deletes every Session
+func (s *ShardedSessionStore) Purge() {
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.Lock()
+		shard.sessions = make(map[string]*Session)
+		shard.Unlock()
+	}
+}
+
+// DeleteExpired deletes the Sessions that expired by now and returns how
+// many were deleted.
+func (s *ShardedSessionStore) DeleteExpired(now time.Time) int {
+	deleted := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.Lock()
+		for id, session := range shard.sessions {
+			if !session.ExpiresAt.IsZero() && !now.Before(session.ExpiresAt) {
+				delete(shard.sessions, id)
+				deleted++
+			}
+		}
+		shard.Unlock()
+	}
+	return deleted
+}
+
+// Codes returns the CodeQueue session IDs are popped from
+func (s *ShardedSessionStore) Codes() *CodeQueue {
+	return s.CodeQueue
+}
+
+func (s *ShardedSessionStore) shard(id string) *sessionShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return &s.shards[h.Sum32()%uint32(len(s.shards))]
+}
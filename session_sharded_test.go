@@ -0,0 +1,124 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedSessionStore(t *testing.T) {
+	store := mockoidc.NewShardedSessionStore(4)
+	now := time.Unix(TestNow, 0)
+
+	var wg sync.WaitGroup
+	sessions := make([]*mockoidc.Session, 100)
+	for i := range sessions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			session, err := store.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+			assert.NoError(t, err)
+			sessions[i] = session
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, store.ListSessions(), 100)
+
+	for _, session := range sessions {
+		found, err := store.GetSessionByID(session.SessionID)
+		assert.NoError(t, err)
+		assert.Equal(t, session, found)
+	}
+
+	sessions[0].ExpiresAt = now
+	store.Delete(sessions[1].SessionID)
+	assert.Equal(t, 1, store.DeleteExpired(now))
+	_, err := store.GetSessionByID(sessions[0].SessionID)
+	assert.ErrorIs(t, err, mockoidc.ErrSessionNotFound)
+	assert.Len(t, store.ListSessions(), 98)
+
+	store.Purge()
+	assert.Empty(t, store.ListSessions())
+}
+
+func TestNewServer_ShardedSessionStore(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &mockoidc.ShardedSessionStore{}, m.SessionStore)
+}
+
+func BenchmarkSessionStore(b *testing.B) {
+	stores := map[string]func() mockoidc.SessionStore{
+		"memory":  func() mockoidc.SessionStore { return mockoidc.NewSessionStore() },
+		"sharded": func() mockoidc.SessionStore { return mockoidc.NewShardedSessionStore(0) },
+		"lru":     func() mockoidc.SessionStore { return mockoidc.NewLRUSessionStore(1 << 20) },
+	}
+	for name, newStore := range stores {
+		b.Run(name, func(b *testing.B) {
+			store := newStore()
+			user := mockoidc.DefaultUser()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					session, err := store.NewSession("openid", "nonce", user, "", "")
+					if err != nil {
+						b.Fatal(err)
+					}
+					// a code exchange & a refresh look the session up
+					for i := 0; i < 2; i++ {
+						if _, err := store.GetSessionByID(session.SessionID); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkMockOIDC_Token(b *testing.B) {
+	b.Run("default", func(b *testing.B) {
+		benchmarkToken(b, &mockoidc.Config{})
+	})
+	b.Run("fast", func(b *testing.B) {
+		benchmarkToken(b, &mockoidc.Config{FastTokens: true})
+	})
+}
+
+func benchmarkToken(b *testing.B, cfg *mockoidc.Config) {
+	m, err := mockoidc.NewServer(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	m.ApplyConfig(cfg)
+	user := mockoidc.DefaultUser()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			session, err := m.SessionStore.NewSession("openid", "nonce", user, "", "")
+			if err != nil {
+				b.Fatal(err)
+			}
+			data := url.Values{}
+			data.Set("client_id", m.ClientID)
+			data.Set("client_secret", m.ClientSecret)
+			data.Set("code", session.SessionID)
+			data.Set("grant_type", "authorization_code")
+
+			req := httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint, strings.NewReader(data.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rr := httptest.NewRecorder()
+			m.Token(rr, req)
+			if rr.Code != http.StatusOK {
+				b.Fatalf("token request failed: %d %s", rr.Code, rr.Body)
+			}
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package mockoidc_test
 
 import (
+	"errors"
+	"net/http"
+	"net/url"
 	"testing"
 	"time"
 
@@ -67,6 +70,75 @@ func TestSession_AccessToken(t *testing.T) {
 	assert.Equal(t, dummySession.User.ID(), claims["sub"])
 }
 
+func TestSession_AccessToken_Expiry(t *testing.T) {
+	keypair, _ := mockoidc.DefaultKeypair()
+	now := time.Unix(TestNow, 900*int64(time.Millisecond))
+
+	testCases := map[string]struct {
+		TTL         time.Duration
+		ExpectedExp int64
+	}{
+		"sub-second": {
+			TTL:         200 * time.Millisecond,
+			ExpectedExp: TestNow + 2,
+		},
+		"multi-year": {
+			TTL:         100 * 365 * 24 * time.Hour,
+			ExpectedExp: TestNow + 100*365*24*60*60 + 1,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config := &mockoidc.Config{AccessTTL: tc.TTL}
+			tokenString, err := dummySession.AccessToken(config, keypair, now)
+			assert.NoError(t, err)
+
+			claims := jwt.MapClaims{}
+			_, _, err = new(jwt.Parser).ParseUnverified(tokenString, claims)
+			assert.NoError(t, err)
+			assert.Equal(t, float64(TestNow), claims["iat"])
+			assert.Equal(t, float64(tc.ExpectedExp), claims["exp"])
+		})
+	}
+}
+
+func TestSession_TTLPerTokenType(t *testing.T) {
+	keypair, _ := mockoidc.DefaultKeypair()
+	now := time.Unix(TestNow, 0)
+	config := &mockoidc.Config{
+		AccessTTL:  5 * time.Minute,
+		IDTokenTTL: time.Hour,
+		RefreshTTL: 30 * 24 * time.Hour,
+	}
+
+	for name, tc := range map[string]struct {
+		issue func(*mockoidc.Config, *mockoidc.Keypair, time.Time) (string, error)
+		ttl   time.Duration
+	}{
+		"access":  {dummySession.AccessToken, config.AccessTTL},
+		"id":      {dummySession.IDToken, config.IDTokenTTL},
+		"refresh": {dummySession.RefreshToken, config.RefreshTTL},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tokenString, err := tc.issue(config, keypair, now)
+			assert.NoError(t, err)
+
+			claims := jwt.MapClaims{}
+			_, _, err = new(jwt.Parser).ParseUnverified(tokenString, claims)
+			assert.NoError(t, err)
+			assert.Equal(t, float64(now.Add(tc.ttl).Unix()), claims["exp"])
+		})
+	}
+
+	// ID Tokens default to the AccessTTL
+	tokenString, err := dummySession.IDToken(&mockoidc.Config{AccessTTL: time.Minute}, keypair, now)
+	assert.NoError(t, err)
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(tokenString, claims)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(now.Add(time.Minute).Unix()), claims["exp"])
+}
+
 func TestSession_RefreshToken(t *testing.T) {
 	keypair, _ := mockoidc.DefaultKeypair()
 	tokenString, err := dummySession.RefreshToken(dummyConfig, keypair, mockoidc.NowFunc())
@@ -106,14 +178,73 @@ func TestSession_IDToken(t *testing.T) {
 
 	u := dummySession.User.(*mockoidc.MockUser)
 	assert.Equal(t, u.PreferredUsername, claims["preferred_username"])
-	assert.Equal(t, u.Address, claims["address"])
-	assert.Equal(t, u.Phone, claims["phone_number"])
+	// phone & address need their own scopes
+	assert.Nil(t, claims["address"])
+	assert.Nil(t, claims["phone_number"])
 
 	groups, ok := claims["groups"].([]interface{})
 	assert.True(t, ok)
 	assert.Equal(t, len(groups), 2)
 }
 
+func TestSession_IDToken_LenientClaims(t *testing.T) {
+	keypair, _ := mockoidc.DefaultKeypair()
+	session := &mockoidc.Session{
+		SessionID: "LenientSessionId",
+		Scopes:    []string{"openid"},
+		User:      mockoidc.DefaultUser(),
+	}
+	lenientConfig := *dummyConfig
+	lenientConfig.LenientClaims = true
+
+	for _, tc := range []struct {
+		Config        *mockoidc.Config
+		ExpectedEmail interface{}
+	}{
+		{Config: dummyConfig, ExpectedEmail: nil},
+		{Config: &lenientConfig, ExpectedEmail: mockoidc.DefaultUser().Email},
+	} {
+		tokenString, err := session.IDToken(tc.Config, keypair, mockoidc.NowFunc())
+		assert.NoError(t, err)
+
+		token, err := keypair.VerifyJWT(tokenString)
+		assert.NoError(t, err)
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		assert.True(t, ok)
+		assert.Equal(t, tc.ExpectedEmail, claims["email"])
+	}
+}
+
+func TestSession_ClaimsHooks(t *testing.T) {
+	keypair, _ := mockoidc.DefaultKeypair()
+	config := *dummyConfig
+	config.AccessTokenClaims = func(session *mockoidc.Session, claims jwt.MapClaims) {
+		claims["tenant"] = "tenant-" + session.SessionID
+	}
+	config.IDTokenClaims = func(_ *mockoidc.Session, claims jwt.MapClaims) {
+		claims["entitlements"] = []string{"read", "write"}
+		delete(claims, "email")
+	}
+
+	accessToken, err := dummySession.AccessToken(&config, keypair, mockoidc.NowFunc())
+	assert.NoError(t, err)
+	token, err := keypair.VerifyJWT(accessToken)
+	assert.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, "tenant-"+dummySession.SessionID, claims["tenant"])
+	assert.Equal(t, dummySession.User.ID(), claims["sub"])
+
+	idToken, err := dummySession.IDToken(&config, keypair, mockoidc.NowFunc())
+	assert.NoError(t, err)
+	token, err = keypair.VerifyJWT(idToken)
+	assert.NoError(t, err)
+	claims = token.Claims.(jwt.MapClaims)
+	assert.Equal(t, []interface{}{"read", "write"}, claims["entitlements"])
+	assert.Nil(t, claims["email"])
+	assert.Nil(t, claims["tenant"])
+}
+
 func TestSessionStore_GetSessionByID(t *testing.T) {
 	ss := mockoidc.NewSessionStore()
 
@@ -142,7 +273,7 @@ func TestSessionStore_GetSessionByID(t *testing.T) {
 	assert.Equal(t, session, s2)
 
 	session, err = ss.GetSessionByID("Fake Session ID")
-	assert.Error(t, err)
+	assert.True(t, errors.Is(err, mockoidc.ErrSessionNotFound))
 	assert.Nil(t, session)
 }
 
@@ -185,6 +316,83 @@ func TestSessionStore_GetSessionFromToken(t *testing.T) {
 
 	delete(ss.Store, s2.SessionID)
 	session, err = ss.GetSessionByToken(token)
-	assert.Error(t, err)
+	assert.True(t, errors.Is(err, mockoidc.ErrSessionNotFound))
 	assert.Nil(t, session)
 }
+
+// countingSessionStore is an instrumented SessionStore
+type countingSessionStore struct {
+	*mockoidc.MemorySessionStore
+	created  int
+	lookedUp int
+}
+
+func (s *countingSessionStore) NewSession(scope string, nonce string, user mockoidc.User, codeChallenge string, codeChallengeMethod string) (*mockoidc.Session, error) {
+	s.created++
+	return s.MemorySessionStore.NewSession(scope, nonce, user, codeChallenge, codeChallengeMethod)
+}
+
+func (s *countingSessionStore) GetSessionByID(id string) (*mockoidc.Session, error) {
+	s.lookedUp++
+	return s.MemorySessionStore.GetSessionByID(id)
+}
+
+// minimalSessionStore only has the SessionStore interface methods
+type minimalSessionStore struct {
+	mockoidc.SessionStore
+}
+
+func authorizeData(m *mockoidc.MockOIDC) url.Values {
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+	return data
+}
+
+func TestMockOIDC_CustomSessionStore(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	store := &countingSessionStore{MemorySessionStore: mockoidc.NewSessionStore()}
+	m.ApplyConfig(&mockoidc.Config{SessionStore: store})
+	assert.Equal(t, store, m.Config().SessionStore)
+
+	m.QueueCode("custom-code")
+	assert.Equal(t, 1, m.Stats().QueuedCodes)
+	assert.HTTPStatusCode(t, m.Authorize, http.MethodGet,
+		mockoidc.AuthorizationEndpoint, authorizeData(m), http.StatusFound)
+	assert.Equal(t, 1, store.created)
+	assert.Equal(t, 1, m.Stats().Sessions)
+
+	session, err := m.SessionStore.GetSessionByID("custom-code")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"openid"}, session.Scopes)
+	assert.Equal(t, 1, store.lookedUp)
+
+	m.SessionStore.Delete("custom-code")
+	_, err = m.SessionStore.GetSessionByID("custom-code")
+	assert.ErrorIs(t, err, mockoidc.ErrSessionNotFound)
+}
+
+func TestMockOIDC_MinimalSessionStore(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(&mockoidc.Config{
+		SessionStore: minimalSessionStore{mockoidc.NewSessionStore()},
+	})
+
+	// without a CodeQueue, QueueCode is a no-op
+	m.QueueCode("ignored")
+	assert.HTTPStatusCode(t, m.Authorize, http.MethodGet,
+		mockoidc.AuthorizationEndpoint, authorizeData(m), http.StatusFound)
+	_, err = m.SessionStore.GetSessionByID("ignored")
+	assert.ErrorIs(t, err, mockoidc.ErrSessionNotFound)
+
+	stats := m.Stats()
+	assert.Equal(t, 0, stats.Sessions)
+	assert.Equal(t, 0, stats.QueuedCodes)
+	assert.Empty(t, m.Snapshot().Sessions)
+	assert.ErrorIs(t, m.Restore(&mockoidc.State{}), mockoidc.ErrSessionStoreReadOnly)
+}
@@ -0,0 +1,120 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Signed request mechanisms whose verification failures are counted
+const (
+	SignedRequestJAR = "jar"
+)
+
+// Reasons signed requests fail verification
+const (
+	SigningFailureMalformed      = "malformed"
+	SigningFailureBadSignature   = "bad_signature"
+	SigningFailureExpired        = "expired"
+	SigningFailureReplay         = "jti_replay"
+	SigningFailureClientMismatch = "client_mismatch"
+)
+
+// SigningFailure identifies a counter of SigningFailures
+type SigningFailure struct {
+	Mechanism string
+	Reason    string
+}
+
+// SigningFailures returns how often signed requests failed verification
+// per mechanism and reason, so client teams can see why their signed
+// requests are rejected. Failures of ScopedMock requests are reported by
+// their ScopedMock.
+func (m *MockOIDC) SigningFailures() map[SigningFailure]int {
+	return m.signingFailuresOf("")
+}
+
+func (m *MockOIDC) signingFailuresOf(namespace string) map[SigningFailure]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	failures := make(map[SigningFailure]int, len(m.signingFailures[namespace]))
+	for failure, count := range m.signingFailures[namespace] {
+		failures[failure] = count
+	}
+	return failures
+}
+
+// countSigningFailure counts a failure against the namespace of the
+// request
+func (m *MockOIDC) countSigningFailure(req *http.Request, mechanism, reason string) {
+	namespace := requestNamespace(req)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.signingFailures == nil {
+		m.signingFailures = make(map[string]map[SigningFailure]int)
+	}
+	if m.signingFailures[namespace] == nil {
+		m.signingFailures[namespace] = make(map[SigningFailure]int)
+	}
+	m.signingFailures[namespace][SigningFailure{Mechanism: mechanism, Reason: reason}]++
+}
+
+// signingFailureReason classifies a jwt.Parse error
+func signingFailureReason(err error) string {
+	var ve *jwt.ValidationError
+	if !errors.As(err, &ve) {
+		return SigningFailureMalformed
+	}
+	switch {
+	case ve.Errors&(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet|jwt.ValidationErrorIssuedAt) != 0:
+		return SigningFailureExpired
+	case ve.Errors&(jwt.ValidationErrorSignatureInvalid|jwt.ValidationErrorUnverifiable) != 0:
+		return SigningFailureBadSignature
+	default:
+		return SigningFailureMalformed
+	}
+}
+
+// jtiLifetime is how long the `jti` of a signed request without an `exp`
+// is remembered
+const jtiLifetime = time.Hour
+
+// useJTI records a signed request's `jti` until its `exp`, returning false
+// if it was already used. Once expired, the request is rejected anyway,
+// so the `jti`s of expired requests are forgotten.
+func (m *MockOIDC) useJTI(mechanism, jti string, claims jwt.MapClaims) bool {
+	now := m.Now()
+	expiry := now.Add(jtiLifetime)
+	switch exp := claims["exp"].(type) {
+	case json.Number:
+		if ts, err := exp.Int64(); err == nil {
+			expiry = time.Unix(ts, 0)
+		}
+	case float64:
+		expiry = time.Unix(int64(exp), 0)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.usedJTIs == nil {
+		m.usedJTIs = make(map[string]time.Time)
+	}
+	for key, until := range m.usedJTIs {
+		if now.After(until) {
+			delete(m.usedJTIs, key)
+		}
+	}
+	key := mechanism + ":" + jti
+	if _, ok := m.usedJTIs[key]; ok {
+		return false
+	}
+	m.usedJTIs[key] = expiry
+	return true
+}
@@ -0,0 +1,60 @@
+package mockoidc
+
+import (
+	"crypto"
+	"encoding/base64"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// Experimental Self-Issued OpenID Provider v2 (SIOPv2) settings
+const (
+	SelfIssuedIssuer           = "https://self-issued.me/v2"
+	SubjectSyntaxJWKThumbprint = "urn:ietf:params:oauth:jwk-thumbprint"
+)
+
+// JWK is the public JSON Web Key of the Keypair
+func (k *Keypair) JWK() (*jose.JSONWebKey, error) {
+	kid, err := k.KeyID()
+	if err != nil {
+		return nil, err
+	}
+	return &jose.JSONWebKey{
+		Use:       "sig",
+		Algorithm: string(jose.RS256),
+		Key:       k.PublicKey,
+		KeyID:     kid,
+	}, nil
+}
+
+// Thumbprint is the RFC 7638 SHA-256 JWK thumbprint of the public key,
+// base64url encoded. Self-issued ID Tokens use it as their subject.
+func (k *Keypair) Thumbprint() (string, error) {
+	jwk, err := k.JWK()
+	if err != nil {
+		return "", err
+	}
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// selfIssue turns ID Token claims into SIOPv2 self-issued claims: the
+// subject is the JWK thumbprint of the signing key, included as `sub_jwk`.
+func selfIssue(claims *IDTokenClaims, kp *Keypair) error {
+	jwk, err := kp.JWK()
+	if err != nil {
+		return err
+	}
+	thumbprint, err := kp.Thumbprint()
+	if err != nil {
+		return err
+	}
+
+	claims.Issuer = SelfIssuedIssuer
+	claims.Subject = thumbprint
+	claims.SubJWK = jwk
+	return nil
+}
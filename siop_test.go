@@ -0,0 +1,33 @@
+package mockoidc_test
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSession_IDToken_SelfIssued(t *testing.T) {
+	keypair, err := mockoidc.DefaultKeypair()
+	assert.NoError(t, err)
+	thumbprint, err := keypair.Thumbprint()
+	assert.NoError(t, err)
+
+	config := dummyConfig.Merge(&mockoidc.Config{SelfIssued: true})
+	tokenString, err := dummySession.IDToken(config, keypair, mockoidc.NowFunc())
+	assert.NoError(t, err)
+
+	token, err := keypair.VerifyJWT(tokenString)
+	assert.NoError(t, err)
+	claims := token.Claims.(jwt.MapClaims)
+
+	assert.Equal(t, mockoidc.SelfIssuedIssuer, claims["iss"])
+	assert.Equal(t, thumbprint, claims["sub"])
+	assert.Equal(t, dummyConfig.ClientID, claims["aud"])
+
+	subJWK, ok := claims["sub_jwk"].(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, "RSA", subJWK["kty"])
+	assert.NotContains(t, subJWK, "d")
+}
@@ -0,0 +1,85 @@
+package mockoidc
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of the resources used by the MockOIDC server and
+// the process it runs in. Long soak tests can use it to detect leaks.
+type Stats struct {
+	Time             time.Time
+	Goroutines       int
+	HeapAlloc        uint64
+	HeapObjects      uint64
+	NumGC            uint32
+	PauseTotal       time.Duration
+	Sessions         int
+	SessionEvictions int
+	QueuedUsers      int
+	QueuedCodes      int
+	QueuedErrors     int
+	ActiveLogins     int
+}
+
+// Stats returns the current resource usage
+func (m *MockOIDC) Stats() Stats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	stats := Stats{
+		Time:        m.Now(),
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   mem.HeapAlloc,
+		HeapObjects: mem.HeapObjects,
+		NumGC:       mem.NumGC,
+		PauseTotal:  time.Duration(mem.PauseTotalNs),
+	}
+
+	if m.SessionStore != nil {
+		if store, ok := m.SessionStore.(interface{ ListSessions() []*Session }); ok {
+			stats.Sessions = len(store.ListSessions())
+		}
+		if store, ok := m.SessionStore.(interface{ Evictions() int }); ok {
+			stats.SessionEvictions = store.Evictions()
+		}
+		if codes := m.codeQueue(); codes != nil {
+			stats.QueuedCodes = codes.Len()
+		}
+	}
+	if m.UserQueue != nil {
+		stats.QueuedUsers = m.QueuedUsers()
+	}
+	if m.ErrorQueue != nil {
+		stats.QueuedErrors = m.QueuedErrors()
+	}
+
+	m.mu.Lock()
+	stats.ActiveLogins = len(m.authTimes)
+	m.mu.Unlock()
+
+	return stats
+}
+
+// ReportStats calls report with the server Stats every interval in the
+// background until the returned stop function is called.
+func (m *MockOIDC) ReportStats(interval time.Duration, report func(Stats)) (stop func()) {
+	var once sync.Once
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				report(m.Stats())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() { once.Do(func() { close(done) }) }
+}
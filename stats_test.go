@@ -0,0 +1,49 @@
+package mockoidc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Stats(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	_, err = m.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	m.QueueUser(mockoidc.DefaultUser())
+	m.QueueCode("code")
+	m.QueueError(&mockoidc.ServerError{})
+
+	stats := m.Stats()
+	assert.Equal(t, 1, stats.Sessions)
+	assert.Equal(t, 1, stats.QueuedUsers)
+	assert.Equal(t, 1, stats.QueuedCodes)
+	assert.Equal(t, 1, stats.QueuedErrors)
+	assert.Greater(t, stats.Goroutines, 0)
+	assert.Greater(t, stats.HeapAlloc, uint64(0))
+}
+
+func TestMockOIDC_ReportStats(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	reports := make(chan mockoidc.Stats, 1)
+	stop := m.ReportStats(time.Millisecond, func(stats mockoidc.Stats) {
+		select {
+		case reports <- stats:
+		default:
+		}
+	})
+	defer stop()
+
+	select {
+	case stats := <-reports:
+		assert.Greater(t, stats.Goroutines, 0)
+	case <-time.After(time.Second):
+		t.Fatal("no stats reported")
+	}
+}
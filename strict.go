@@ -0,0 +1,81 @@
+package mockoidc
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const formURLEncoded = "application/x-www-form-urlencoded"
+
+// strictAuthorize rejects `authorization_endpoint` requests violating the
+// spec in ways the default validation lets through: POSTs that aren't form
+// encoded, duplicate parameters, unknown response types and OpenID
+// requests without the `openid` scope.
+func (m *MockOIDC) strictAuthorize(rw http.ResponseWriter, req *http.Request) bool {
+	if !m.StrictValidation {
+		return true
+	}
+	if req.Method == http.MethodPost && !requireFormBody(rw, req) {
+		return false
+	}
+	if !rejectDuplicates(rw, req) {
+		return false
+	}
+	if responseType := req.Form.Get("response_type"); responseType != "" &&
+		!contains(responseType, ResponseTypesSupported) {
+		ErrUnsupportedResponseType.Describe("Unsupported response_type: %s", responseType).Write(rw)
+		return false
+	}
+	if !m.PlainOAuth2 && !contains(openidScope, strings.Fields(req.Form.Get("scope"))) {
+		ErrInvalidScope.Describe("The openid scope is required").Write(rw)
+		return false
+	}
+	return true
+}
+
+// strictToken rejects `token_endpoint` requests violating the spec in
+// ways the default validation lets through: duplicate parameters,
+// parameters outside a form encoded POST body.
+func (m *MockOIDC) strictToken(rw http.ResponseWriter, req *http.Request) bool {
+	if !m.StrictValidation {
+		return true
+	}
+	if req.Method != http.MethodPost {
+		ErrInvalidRequest.Describe("Unsupported method: %s", req.Method).
+			WithStatus(http.StatusMethodNotAllowed).Write(rw)
+		return false
+	}
+	if !requireFormBody(rw, req) {
+		return false
+	}
+	if req.URL != nil && req.URL.RawQuery != "" {
+		ErrInvalidRequest.Describe("Parameters must be sent in the request body, not the query string").
+			Write(rw)
+		return false
+	}
+	return rejectDuplicates(rw, req)
+}
+
+// requireFormBody fails requests whose body isn't form encoded
+func requireFormBody(rw http.ResponseWriter, req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != formURLEncoded {
+		ErrInvalidRequest.Describe("Unsupported Content-Type: %s, expected %s", req.Header.Get("Content-Type"), formURLEncoded).
+			Write(rw)
+		return false
+	}
+	return true
+}
+
+// rejectDuplicates fails requests with a parameter included more than
+// once (RFC 6749 section 3.1).
+func rejectDuplicates(rw http.ResponseWriter, req *http.Request) bool {
+	for param, values := range req.Form {
+		if len(values) > 1 {
+			ErrInvalidRequest.Describe("Duplicate parameter: %s", param).Write(rw)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_StrictValidation_Authorize(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.StrictValidation = true
+
+	authorize := func(query string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, mockoidc.AuthorizationEndpoint+"?"+query, nil)
+		rr := httptest.NewRecorder()
+		m.Authorize(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		errResp := map[string]interface{}{}
+		assert.NoError(t, getJSON(rr, &errResp))
+		return errResp
+	}
+
+	data := authorizeData(m)
+	errResp := authorize(data.Encode() + "&state=again")
+	assert.Equal(t, mockoidc.InvalidRequest, errResp["error"])
+	assert.Equal(t, "Duplicate parameter: state", errResp["error_description"])
+
+	data.Set("response_type", "token")
+	errResp = authorize(data.Encode())
+	assert.Equal(t, mockoidc.UnsupportedResponseType, errResp["error"])
+
+	data = authorizeData(m)
+	data.Set("scope", "email")
+	errResp = authorize(data.Encode())
+	assert.Equal(t, mockoidc.InvalidScope, errResp["error"])
+	assert.Equal(t, "The openid scope is required", errResp["error_description"])
+
+	assert.HTTPStatusCode(t, m.Authorize, http.MethodGet,
+		mockoidc.AuthorizationEndpoint, authorizeData(m), http.StatusFound)
+}
+
+func TestMockOIDC_StrictValidation_Token(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.StrictValidation = true
+
+	session, err := m.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+
+	token := func(target, contentType, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		m.Token(rr, req)
+		errResp := map[string]interface{}{}
+		_ = getJSON(rr, &errResp)
+		description, _ := errResp["error_description"].(string)
+		return rr.Code, description
+	}
+
+	code, description := token(mockoidc.TokenEndpoint, "application/json", data.Encode())
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, description, "Unsupported Content-Type: application/json")
+
+	code, description = token(mockoidc.TokenEndpoint+"?scope=openid",
+		"application/x-www-form-urlencoded", data.Encode())
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, description, "query string")
+
+	code, description = token(mockoidc.TokenEndpoint,
+		"application/x-www-form-urlencoded", data.Encode()+"&code=again")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "Duplicate parameter: code", description)
+
+	code, _ = token(mockoidc.TokenEndpoint,
+		"application/x-www-form-urlencoded; charset=utf-8", data.Encode())
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,98 @@
+package mockoidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// TenantsBase prefixes the endpoints of each tenant, e.g.
+// `/tenants/{name}/oidc/authorize`.
+const TenantsBase = "/tenants/"
+
+// tenant is a MockOIDC hosted on another's listener
+type tenant struct {
+	m       *MockOIDC
+	once    sync.Once
+	handler http.Handler
+}
+
+// Tenant returns the tenant MockOIDC with the name, creating it if needed.
+// Tenants are independent issuers served under TenantsBase on the same
+// listener, each with its own random Keypair, client, sessions & queues,
+// to test multi-tenant RPs that must keep issuers isolated. Configure a
+// tenant before its first request.
+func (m *MockOIDC) Tenant(name string) (*MockOIDC, error) {
+	m.mu.Lock()
+	t, ok := m.tenants[name]
+	m.mu.Unlock()
+	if ok {
+		return t.m, nil
+	}
+
+	// the key is generated unlocked, so requests don't wait on it
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	tm, err := NewServer(key)
+	if err != nil {
+		return nil, err
+	}
+	tm.parent = m
+	tm.tenantName = name
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// a concurrent call may have created the tenant meanwhile
+	if t, ok := m.tenants[name]; ok {
+		return t.m, nil
+	}
+	if m.tenants == nil {
+		m.tenants = make(map[string]*tenant)
+	}
+	m.tenants[name] = &tenant{m: tm}
+	return tm, nil
+}
+
+// tenantAddr is the base URL of a tenant's endpoints, under its parent
+func (m *MockOIDC) tenantAddr() string {
+	addr := m.parent.Addr()
+	if addr == "" {
+		return ""
+	}
+	return addr + TenantsBase + url.PathEscape(m.tenantName)
+}
+
+// tenantHandler serves `/tenants/{name}/...` requests with the tenant's
+// handler for the path after the tenant.
+func (m *MockOIDC) tenantHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rest := strings.TrimPrefix(req.URL.Path, TenantsBase)
+		parts := strings.SplitN(rest, "/", 2)
+		name, err := url.PathUnescape(parts[0])
+		if err != nil || len(parts) < 2 {
+			http.NotFound(rw, req)
+			return
+		}
+
+		m.mu.Lock()
+		t, ok := m.tenants[name]
+		m.mu.Unlock()
+		if !ok {
+			http.NotFound(rw, req)
+			return
+		}
+		t.once.Do(func() {
+			t.handler = t.m.newHandler()
+		})
+
+		rewritten := req.Clone(req.Context())
+		rewritten.URL.Path = "/" + parts[1]
+		rewritten.URL.RawPath = ""
+		t.handler.ServeHTTP(rw, rewritten)
+	})
+}
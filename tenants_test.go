@@ -0,0 +1,87 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Tenant(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	a, err := m.Tenant("a")
+	assert.NoError(t, err)
+	b, err := m.Tenant("b")
+	assert.NoError(t, err)
+	again, err := m.Tenant("a")
+	assert.NoError(t, err)
+	assert.Equal(t, a, again)
+
+	assert.Equal(t, m.Addr()+"/tenants/a/oidc", a.Issuer())
+	assert.Equal(t, m.Addr()+"/tenants/b/oidc/token", b.TokenEndpoint())
+	assert.NotEqual(t, a.ClientID, b.ClientID)
+
+	kidA, err := a.Keypair.KeyID()
+	assert.NoError(t, err)
+	kidB, err := b.Keypair.KeyID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, kidA, kidB)
+
+	resp, err := http.Get(a.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	discovery := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	resp.Body.Close()
+	assert.Equal(t, a.Issuer(), discovery["issuer"])
+	assert.Equal(t, a.JWKSEndpoint(), discovery["jwks_uri"])
+
+	// a session of tenant a can't be redeemed at tenant b
+	session, err := a.SessionStore.NewSession("openid", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+	redeem := func(tenant *mockoidc.MockOIDC) int {
+		resp, err := http.PostForm(tenant.TokenEndpoint(), url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {tenant.ClientID},
+			"client_secret": {tenant.ClientSecret},
+			"code":          {session.SessionID},
+		})
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, redeem(b))
+	assert.Equal(t, http.StatusOK, redeem(a))
+
+	assert.Len(t, a.RequestsTo(mockoidc.TokenEndpoint), 1)
+	assert.Len(t, b.RequestsTo(mockoidc.TokenEndpoint), 1)
+	assert.Empty(t, m.RequestsTo(mockoidc.TokenEndpoint))
+
+	resp, err = http.Get(m.Addr() + "/tenants/c/oidc/.well-known/openid-configuration")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestMockOIDC_Tenant_Concurrent(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	tenants := make(chan *mockoidc.MockOIDC, 4)
+	for i := 0; i < cap(tenants); i++ {
+		go func() {
+			tm, err := m.Tenant("acme")
+			assert.NoError(t, err)
+			tenants <- tm
+		}()
+	}
+	first := <-tenants
+	for i := 1; i < cap(tenants); i++ {
+		assert.Same(t, first, <-tenants)
+	}
+}
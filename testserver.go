@@ -0,0 +1,50 @@
+package mockoidc
+
+import "net/http/httptest"
+
+// TestingTB is the subset of testing.TB the test server constructors use
+type TestingTB interface {
+	TestingT
+	Fatalf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// RunTestServer creates a default MockOIDC and starts it on an
+// `httptest.Server` that is closed when the test finishes.
+func RunTestServer(t TestingTB) *MockOIDC {
+	t.Helper()
+	return runTestServer(t, false)
+}
+
+// RunTLSTestServer is RunTestServer with TLS. Client returns an
+// http.Client that trusts the server's certificate.
+func RunTLSTestServer(t TestingTB) *MockOIDC {
+	t.Helper()
+	return runTestServer(t, true)
+}
+
+func runTestServer(t TestingTB, useTLS bool) *MockOIDC {
+	t.Helper()
+
+	m, err := NewServer(nil)
+	if err != nil {
+		t.Fatalf("mockoidc: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(m.newHandler())
+	if useTLS {
+		srv.StartTLS()
+		m.tlsConfig = srv.TLS
+	} else {
+		srv.Start()
+	}
+	srv.Config.Addr = srv.Listener.Addr().String()
+	m.Server = srv.Config
+	m.testServer = srv
+	t.Cleanup(srv.Close)
+
+	if err := m.writeCapabilities(); err != nil {
+		t.Fatalf("mockoidc: %v", err)
+	}
+	return m
+}
@@ -0,0 +1,48 @@
+package mockoidc_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunTestServer(t *testing.T) {
+	var m *mockoidc.MockOIDC
+	t.Run("server", func(t *testing.T) {
+		m = mockoidc.RunTestServer(t)
+		assert.Contains(t, m.Issuer(), "http://127.0.0.1:")
+
+		resp, err := m.Client().Get(m.DiscoveryEndpoint())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		err = m.AddMiddleware(func(next http.Handler) http.Handler {
+			return next
+		})
+		assert.True(t, errors.Is(err, mockoidc.ErrServerStarted))
+	})
+
+	// the server is closed when the test finishes
+	_, err := http.Get(m.DiscoveryEndpoint())
+	assert.Error(t, err)
+}
+
+func TestRunTLSTestServer(t *testing.T) {
+	m := mockoidc.RunTLSTestServer(t)
+	assert.Contains(t, m.Issuer(), "https://127.0.0.1:")
+
+	resp, err := m.Client().Get(m.JWKSEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = http.Get(m.JWKSEndpoint())
+	assert.Error(t, err)
+	assert.NotNil(t, m.CertPool())
+
+	assert.NoError(t, m.Shutdown())
+}
@@ -0,0 +1,122 @@
+package mockoidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+)
+
+// StartTLS starts the MockOIDC server with TLS on `127.0.0.1:0`. It serves
+// the PEM encoded certificate & key passed, or an auto-generated self-signed
+// certificate if both are nil. CertPool & Client trust the certificate.
+func (m *MockOIDC) StartTLS(certPEM, keyPEM []byte) error {
+	var (
+		cert tls.Certificate
+		err  error
+	)
+	if certPEM == nil && keyPEM == nil {
+		cert, err = selfSignedCertificate()
+	} else {
+		cert, err = tls.X509KeyPair(certPEM, keyPEM)
+	}
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	for _, der := range cert.Certificate {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return err
+		}
+		pool.AddCert(c)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	previous := m.certPool
+	m.certPool = pool
+	if err := m.Start(ln, &tls.Config{Certificates: []tls.Certificate{cert}}); err != nil {
+		_ = ln.Close()
+		m.certPool = previous
+		return err
+	}
+	return nil
+}
+
+// CertPool returns a pool trusting the certificate of servers started with
+// StartTLS or RunTLSTestServer, to configure test HTTP clients with.
+func (m *MockOIDC) CertPool() *x509.CertPool {
+	if m.testServer != nil && m.testServer.Certificate() != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(m.testServer.Certificate())
+		return pool
+	}
+	return m.certPool
+}
+
+// Client returns an http.Client for the server. Servers started with
+// StartTLS or RunTLSTestServer get one trusting their certificate.
+func (m *MockOIDC) Client() *http.Client {
+	if m.testServer != nil {
+		return m.testServer.Client()
+	}
+	if m.certPool != nil {
+		return &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: m.certPool},
+			},
+		}
+	}
+	return http.DefaultClient
+}
+
+// selfSignedCertificate generates a certificate for the loopback addresses
+// that is its own CA.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"mockoidc"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	)
+}
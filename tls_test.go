@@ -0,0 +1,76 @@
+package mockoidc_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_StartTLS(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.StartTLS(nil, nil))
+	defer m.Shutdown()
+	assert.Contains(t, m.Issuer(), "https://127.0.0.1:")
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: m.CertPool()},
+		},
+	}
+	resp, err := client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = m.Client().Get(m.JWKSEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = http.Get(m.DiscoveryEndpoint())
+	assert.Error(t, err)
+
+	// a failed start keeps the certificate of the running server
+	pool := m.CertPool()
+	assert.ErrorIs(t, m.StartTLS(nil, nil), mockoidc.ErrServerStarted)
+	assert.Same(t, pool, m.CertPool())
+	resp, err = m.Client().Get(m.JWKSEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestMockOIDC_StartTLS_Certificate(t *testing.T) {
+	cfg := selfSignedTLSConfig(t)
+	cert := cfg.Certificates[0]
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: mustMarshalPKCS8(t, cert.PrivateKey),
+	})
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.StartTLS(certPEM, keyPEM))
+	defer m.Shutdown()
+
+	resp, err := m.Client().Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	other, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	assert.Error(t, other.StartTLS(certPEM, []byte("not a key")))
+}
+
+func mustMarshalPKCS8(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	return der
+}
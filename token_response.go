@@ -0,0 +1,81 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// TokenResponse is a caller-crafted `token_endpoint` response. Empty
+// fields are left out of the JSON, Extra fields are added as is and
+// override the others, e.g. `"expires_in": "3600"` or `"id_token": nil`.
+type TokenResponse struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	IDToken      string
+	ExpiresIn    int64
+	Scope        string
+	Extra        map[string]interface{}
+
+	// Status is the HTTP status code, http.StatusOK if it's zero
+	Status int
+}
+
+// QueueTokenResponse makes the next token request return the
+// TokenResponse exactly, without validating the request or minting tokens.
+// Queued responses are returned in order.
+func (m *MockOIDC) QueueTokenResponse(tr TokenResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokenResponses = append(m.tokenResponses, tr)
+}
+
+func (m *MockOIDC) popTokenResponse() (TokenResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.tokenResponses) == 0 {
+		return TokenResponse{}, false
+	}
+	tr := m.tokenResponses[0]
+	m.tokenResponses = m.tokenResponses[1:]
+	return tr, true
+}
+
+func (tr TokenResponse) fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	set := func(key, value string) {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	set("access_token", tr.AccessToken)
+	set("token_type", tr.TokenType)
+	set("refresh_token", tr.RefreshToken)
+	set("id_token", tr.IDToken)
+	set("scope", tr.Scope)
+	if tr.ExpiresIn != 0 {
+		fields["expires_in"] = tr.ExpiresIn
+	}
+	for key, value := range tr.Extra {
+		fields[key] = value
+	}
+	return fields
+}
+
+func (tr TokenResponse) write(rw http.ResponseWriter) {
+	resp, err := json.Marshal(tr.fields())
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	status := tr.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	noCache(rw)
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(status)
+	_, _ = rw.Write(resp)
+}
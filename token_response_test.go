@@ -0,0 +1,54 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_QueueTokenResponse(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	m.QueueTokenResponse(mockoidc.TokenResponse{
+		AccessToken: "not-a-jwt",
+		TokenType:   "mac",
+		Extra: map[string]interface{}{
+			"expires_in": "3600",
+			"custom":     true,
+		},
+	})
+	m.QueueTokenResponse(mockoidc.TokenResponse{
+		Extra:  map[string]interface{}{"error": "slow_down"},
+		Status: http.StatusTeapot,
+	})
+
+	// queued responses don't need a valid request
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, url.Values{})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	tokenResp := make(map[string]interface{})
+	assert.NoError(t, getJSON(rr, &tokenResp))
+	assert.Equal(t, map[string]interface{}{
+		"access_token": "not-a-jwt",
+		"token_type":   "mac",
+		"expires_in":   "3600",
+		"custom":       true,
+	}, tokenResp)
+
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, url.Values{})
+	assert.Equal(t, http.StatusTeapot, rr.Code)
+	assert.JSONEq(t, `{"error":"slow_down"}`, rr.Body.String())
+
+	// then tokens are minted as usual
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, url.Values{})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	m.QueueTokenResponse(mockoidc.TokenResponse{AccessToken: "cleared"})
+	m.ClearQueue()
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, url.Values{})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
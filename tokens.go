@@ -0,0 +1,145 @@
+package mockoidc
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Token types recorded in the IssuedToken registry
+const (
+	AccessTokenType  = "access_token"
+	RefreshTokenType = "refresh_token"
+	IDTokenType      = "id_token"
+)
+
+// IssuedToken is a snapshot of a token issued by the `token_endpoint`
+type IssuedToken struct {
+	Type      string
+	Token     string
+	KeyID     string
+	Claims    jwt.MapClaims
+	SessionID string
+	GrantType string
+	Namespace string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+
+	// Expired is set by ExpireAccessTokens & ExpireRefreshTokens
+	Expired bool
+}
+
+// IssuedTokens returns every token issued so far, so tests can assert
+// invariants across a whole run.
+func (m *MockOIDC) IssuedTokens() []IssuedToken {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]IssuedToken(nil), m.issuedTokens...)
+}
+
+// FindIssuedTokens returns the issued tokens the filter matches
+func (m *MockOIDC) FindIssuedTokens(filter func(IssuedToken) bool) []IssuedToken {
+	var found []IssuedToken
+	for _, token := range m.IssuedTokens() {
+		if filter(token) {
+			found = append(found, token)
+		}
+	}
+	return found
+}
+
+// ExpireAccessTokens makes every access token issued so far expired
+// without changing the clock. Tokens issued afterwards aren't affected.
+func (m *MockOIDC) ExpireAccessTokens() {
+	m.expireTokens(AccessTokenType)
+}
+
+// ExpireRefreshTokens makes every refresh token issued so far expired
+// without changing the clock. Tokens issued afterwards aren't affected.
+func (m *MockOIDC) ExpireRefreshTokens() {
+	m.expireTokens(RefreshTokenType)
+}
+
+func (m *MockOIDC) expireTokens(tokenType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.issuedTokens {
+		if m.issuedTokens[i].Type == tokenType {
+			m.issuedTokens[i].Expired = true
+		}
+	}
+}
+
+// issuedToken looks up the latest issue of a token in the registry.
+// Tokens are deterministic, so the same token can be issued again in the
+// same second.
+func (m *MockOIDC) issuedToken(token string) (IssuedToken, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.issuedIndex == nil {
+		m.indexIssuedTokens()
+	}
+	i, ok := m.issuedIndex[token]
+	if !ok {
+		return IssuedToken{}, false
+	}
+	return m.issuedTokens[i], true
+}
+
+// tokenSession returns the Session of a token issued with narrowed down
+// scopes by a `refresh_token` grant as a copy with the token's scopes.
+func (m *MockOIDC) tokenSession(token string, session *Session) *Session {
+	issued, ok := m.issuedToken(token)
+	if !ok || issued.Scopes == nil || len(issued.Scopes) == len(session.Scopes) {
+		return session
+	}
+	narrowed := *session
+	narrowed.Scopes = issued.Scopes
+	return &narrowed
+}
+
+// indexIssuedTokens indexes the latest issue of every token, so lookups
+// don't scan the registry of long load tests. m.mu must be held.
+func (m *MockOIDC) indexIssuedTokens() {
+	m.issuedIndex = make(map[string]int, len(m.issuedTokens))
+	for i, issued := range m.issuedTokens {
+		m.issuedIndex[issued.Token] = i
+	}
+}
+
+func (m *MockOIDC) recordToken(tokenType, token string, session *Session, grantType string, now time.Time, ttl time.Duration) {
+	issued := IssuedToken{
+		Type:      tokenType,
+		Token:     token,
+		Claims:    jwt.MapClaims{},
+		SessionID: session.SessionID,
+		GrantType: grantType,
+		Namespace: session.Namespace,
+		Scopes:    session.Scopes,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, issued.Claims)
+	if err == nil {
+		issued.KeyID, _ = parsed.Header["kid"].(string)
+	}
+
+	m.debug("token issued",
+		"type", tokenType,
+		"session", session.SessionID,
+		"grant_type", grantType,
+		"kid", issued.KeyID,
+		"expires_at", issued.ExpiresAt)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.issuedTokens = append(m.issuedTokens, issued)
+	if drop := m.historyOverflow(len(m.issuedTokens)); drop > 0 {
+		m.issuedTokens = append([]IssuedToken(nil), m.issuedTokens[drop:]...)
+		m.issuedIndex = nil
+	}
+	if m.issuedIndex != nil {
+		m.issuedIndex[token] = len(m.issuedTokens) - 1
+	}
+}
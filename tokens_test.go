@@ -0,0 +1,105 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_IssuedTokens(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	session, err := m.SessionStore.NewSession(
+		"openid email", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	issued := m.IssuedTokens()
+	assert.Len(t, issued, 3)
+
+	kid, err := m.Keypair.KeyID()
+	assert.NoError(t, err)
+
+	var types []string
+	for _, token := range issued {
+		types = append(types, token.Type)
+		assert.Equal(t, kid, token.KeyID)
+		assert.Equal(t, session.SessionID, token.SessionID)
+		assert.Equal(t, "authorization_code", token.GrantType)
+		assert.Equal(t, session.User.ID(), token.Claims["sub"])
+	}
+	assert.ElementsMatch(t, []string{
+		mockoidc.AccessTokenType,
+		mockoidc.IDTokenType,
+		mockoidc.RefreshTokenType,
+	}, types)
+
+	idTokens := m.FindIssuedTokens(func(token mockoidc.IssuedToken) bool {
+		return token.Type == mockoidc.IDTokenType
+	})
+	assert.Len(t, idTokens, 1)
+	assert.Equal(t, "nonce", idTokens[0].Claims["nonce"])
+}
+
+func TestMockOIDC_ExpireTokens(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	session, err := m.SessionStore.NewSession(
+		"openid email", "nonce", mockoidc.DefaultUser(), "", "")
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	tokenOf := func(tokenType string) string {
+		tokens := m.FindIssuedTokens(func(token mockoidc.IssuedToken) bool {
+			return token.Type == tokenType
+		})
+		return tokens[len(tokens)-1].Token
+	}
+	userinfo := func() int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+		req.Header.Set("Authorization", "Bearer "+tokenOf(mockoidc.AccessTokenType))
+		m.Userinfo(rr, req)
+		return rr.Code
+	}
+	refresh := func() int {
+		data := url.Values{}
+		data.Set("client_id", m.ClientID)
+		data.Set("client_secret", m.ClientSecret)
+		data.Set("refresh_token", tokenOf(mockoidc.RefreshTokenType))
+		data.Set("grant_type", "refresh_token")
+		return testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data).Code
+	}
+
+	assert.Equal(t, http.StatusOK, userinfo())
+
+	m.ExpireAccessTokens()
+	assert.Equal(t, http.StatusUnauthorized, userinfo())
+
+	// refreshing issues a new, valid access token
+	assert.Equal(t, http.StatusOK, refresh())
+	assert.Equal(t, http.StatusOK, userinfo())
+
+	m.ExpireRefreshTokens()
+	assert.Equal(t, http.StatusUnauthorized, refresh())
+}
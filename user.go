@@ -1,7 +1,11 @@
 package mockoidc
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 )
@@ -22,37 +26,142 @@ type User interface {
 	Claims([]string, *IDTokenClaims) (jwt.Claims, error)
 }
 
+// UserStore looks up the Users `authorization_endpoint` requests can
+// select, e.g. with a `login_hint`.
+type UserStore interface {
+	GetUserByID(id string) (User, error)
+	GetUserByEmail(email string) (User, error)
+	ListUsers() []User
+}
+
+// MemoryUserStore is the default in-memory UserStore
+type MemoryUserStore struct {
+	sync.Mutex
+	Users []User
+}
+
+// NewMemoryUserStore creates a MemoryUserStore holding the passed Users
+func NewMemoryUserStore(users ...User) *MemoryUserStore {
+	return &MemoryUserStore{Users: users}
+}
+
+// AddUser puts a User in the store
+func (s *MemoryUserStore) AddUser(user User) {
+	s.Lock()
+	defer s.Unlock()
+	s.Users = append(s.Users, user)
+}
+
+// GetUserByID finds the User with the ID
+func (s *MemoryUserStore) GetUserByID(id string) (User, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, user := range s.Users {
+		if user.ID() == id {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id)
+}
+
+// GetUserByEmail finds the MockUser with the Email
+func (s *MemoryUserStore) GetUserByEmail(email string) (User, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, user := range s.Users {
+		if mu, ok := user.(*MockUser); ok && mu.Email != "" && mu.Email == email {
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUserNotFound, email)
+}
+
+// ListUsers returns every User in the store
+func (s *MemoryUserStore) ListUsers() []User {
+	s.Lock()
+	defer s.Unlock()
+	return append([]User(nil), s.Users...)
+}
+
 // MockUser is a default implementation of the User interface
 type MockUser struct {
-	Subject           string
-	Email             string
-	EmailVerified     bool
-	PreferredUsername string
-	Phone             string
-	Address           string
-	Groups            []string
+	Subject             string
+	Email               string
+	EmailVerified       bool
+	PreferredUsername   string
+	Name                string
+	GivenName           string
+	FamilyName          string
+	Picture             string
+	Locale              string
+	UpdatedAt           time.Time
+	Phone               string
+	PhoneNumberVerified bool
+	Address             string
+	Groups              []string
+	Roles               []string
+
+	// Password is checked by the LoginPage. Users without one log in
+	// with any password. It's never serialized, so it doesn't leak into
+	// the admin API, diagnostics or persisted Sessions.
+	Password string `json:"-"`
+}
+
+// HasPassword reports whether the MockUser has a Password to check
+func (u *MockUser) HasPassword() bool {
+	return u.Password != ""
+}
+
+// CheckPassword reports whether the password is the MockUser's Password
+func (u *MockUser) CheckPassword(password string) bool {
+	return u.Password == "" ||
+		subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1
 }
 
 // DefaultUser returns a default MockUser that is set in
 // `authorization_endpoint` if the UserQueue is empty.
 func DefaultUser() *MockUser {
 	return &MockUser{
-		Subject:           "1234567890",
-		Email:             "jane.doe@example.com",
-		PreferredUsername: "jane.doe",
-		Phone:             "555-987-6543",
-		Address:           "123 Main Street",
-		Groups:            []string{"engineering", "design"},
-		EmailVerified:     true,
+		Subject:             "1234567890",
+		Email:               "jane.doe@example.com",
+		PreferredUsername:   "jane.doe",
+		Name:                "Jane Doe",
+		GivenName:           "Jane",
+		FamilyName:          "Doe",
+		Locale:              "en-US",
+		UpdatedAt:           time.Unix(1609459200, 0),
+		Phone:               "555-987-6543",
+		PhoneNumberVerified: true,
+		Address:             "123 Main Street",
+		Groups:              []string{"engineering", "design"},
+		Roles:               []string{"admin", "user"},
+		EmailVerified:       true,
 	}
 }
 
+// mockProfile are the MockUser claims shared by Userinfo & ID Tokens
+type mockProfile struct {
+	Email               string   `json:"email,omitempty"`
+	EmailVerified       bool     `json:"email_verified,omitempty"`
+	PreferredUsername   string   `json:"preferred_username,omitempty"`
+	Name                string   `json:"name,omitempty"`
+	GivenName           string   `json:"given_name,omitempty"`
+	FamilyName          string   `json:"family_name,omitempty"`
+	Picture             string   `json:"picture,omitempty"`
+	Locale              string   `json:"locale,omitempty"`
+	UpdatedAt           int64    `json:"updated_at,omitempty"`
+	Phone               string   `json:"phone_number,omitempty"`
+	PhoneNumberVerified bool     `json:"phone_number_verified,omitempty"`
+	Address             string   `json:"address,omitempty"`
+	Groups              []string `json:"groups,omitempty"`
+	Roles               []string `json:"roles,omitempty"`
+}
+
 type mockUserinfo struct {
-	Email             string   `json:"email,omitempty"`
-	PreferredUsername string   `json:"preferred_username,omitempty"`
-	Phone             string   `json:"phone_number,omitempty"`
-	Address           string   `json:"address,omitempty"`
-	Groups            []string `json:"groups,omitempty"`
+	Subject string `json:"sub"`
+	*mockProfile
 }
 
 func (u *MockUser) ID() string {
@@ -63,11 +172,8 @@ func (u *MockUser) Userinfo(scope []string) ([]byte, error) {
 	user := u.scopedClone(scope)
 
 	info := &mockUserinfo{
-		Email:             user.Email,
-		PreferredUsername: user.PreferredUsername,
-		Phone:             user.Phone,
-		Address:           user.Address,
-		Groups:            user.Groups,
+		Subject:     user.Subject,
+		mockProfile: user.profile(),
 	}
 
 	return json.Marshal(info)
@@ -75,28 +181,40 @@ func (u *MockUser) Userinfo(scope []string) ([]byte, error) {
 
 type mockClaims struct {
 	*IDTokenClaims
-	Email             string   `json:"email,omitempty"`
-	EmailVerified     bool     `json:"email_verified,omitempty"`
-	PreferredUsername string   `json:"preferred_username,omitempty"`
-	Phone             string   `json:"phone_number,omitempty"`
-	Address           string   `json:"address,omitempty"`
-	Groups            []string `json:"groups,omitempty"`
+	*mockProfile
 }
 
 func (u *MockUser) Claims(scope []string, claims *IDTokenClaims) (jwt.Claims, error) {
 	user := u.scopedClone(scope)
 
 	return &mockClaims{
-		IDTokenClaims:     claims,
-		Email:             user.Email,
-		EmailVerified:     user.EmailVerified,
-		PreferredUsername: user.PreferredUsername,
-		Phone:             user.Phone,
-		Address:           user.Address,
-		Groups:            user.Groups,
+		IDTokenClaims: claims,
+		mockProfile:   user.profile(),
 	}, nil
 }
 
+func (u *MockUser) profile() *mockProfile {
+	profile := &mockProfile{
+		Email:               u.Email,
+		EmailVerified:       u.EmailVerified,
+		PreferredUsername:   u.PreferredUsername,
+		Name:                u.Name,
+		GivenName:           u.GivenName,
+		FamilyName:          u.FamilyName,
+		Picture:             u.Picture,
+		Locale:              u.Locale,
+		Phone:               u.Phone,
+		PhoneNumberVerified: u.PhoneNumberVerified,
+		Address:             u.Address,
+		Groups:              u.Groups,
+		Roles:               u.Roles,
+	}
+	if !u.UpdatedAt.IsZero() {
+		profile.UpdatedAt = u.UpdatedAt.Unix()
+	}
+	return profile
+}
+
 func (u *MockUser) scopedClone(scopes []string) *MockUser {
 	clone := &MockUser{
 		Subject: u.Subject,
@@ -105,13 +223,24 @@ func (u *MockUser) scopedClone(scopes []string) *MockUser {
 		switch scope {
 		case "profile":
 			clone.PreferredUsername = u.PreferredUsername
-			clone.Address = u.Address
+			clone.Name = u.Name
+			clone.GivenName = u.GivenName
+			clone.FamilyName = u.FamilyName
+			clone.Picture = u.Picture
+			clone.Locale = u.Locale
+			clone.UpdatedAt = u.UpdatedAt
+		case "phone":
 			clone.Phone = u.Phone
+			clone.PhoneNumberVerified = u.PhoneNumberVerified
+		case "address":
+			clone.Address = u.Address
 		case "email":
 			clone.Email = u.Email
 			clone.EmailVerified = u.EmailVerified
 		case "groups":
 			clone.Groups = append(make([]string, 0, len(u.Groups)), u.Groups...)
+		case "roles":
+			clone.Roles = append(make([]string, 0, len(u.Roles)), u.Roles...)
 		}
 	}
 	return clone
@@ -2,6 +2,7 @@ package mockoidc_test
 
 import (
 	"encoding/json"
+	"errors"
 	"testing"
 
 	"github.com/golang-jwt/jwt"
@@ -18,7 +19,7 @@ func TestMockUser_Userinfo(t *testing.T) {
 		ExpectedGroups []string
 	}{
 		"all scopes": {
-			Scope:          []string{"openid", "email", "profile", "groups"},
+			Scope:          []string{"openid", "email", "profile", "groups", "phone"},
 			ExpectedEmail:  testUser.Email,
 			ExpectedPhone:  testUser.Phone,
 			ExpectedGroups: testUser.Groups,
@@ -26,7 +27,7 @@ func TestMockUser_Userinfo(t *testing.T) {
 		"missing groups scope": {
 			Scope:          []string{"openid", "email", "profile"},
 			ExpectedEmail:  testUser.Email,
-			ExpectedPhone:  testUser.Phone,
+			ExpectedPhone:  "",
 			ExpectedGroups: nil,
 		},
 		"missing profile scope": {
@@ -38,9 +39,15 @@ func TestMockUser_Userinfo(t *testing.T) {
 		"missing email scope": {
 			Scope:          []string{"openid", "profile", "groups"},
 			ExpectedEmail:  "",
-			ExpectedPhone:  testUser.Phone,
+			ExpectedPhone:  "",
 			ExpectedGroups: testUser.Groups,
 		},
+		"phone scope": {
+			Scope:          []string{"openid", "phone"},
+			ExpectedEmail:  "",
+			ExpectedPhone:  testUser.Phone,
+			ExpectedGroups: nil,
+		},
 	}
 	for name, tc := range testCases {
 		t.Run(name, func(t *testing.T) {
@@ -87,7 +94,7 @@ func TestMockUser_Claims(t *testing.T) {
 		ExpectedGroups []string
 	}{
 		"all scopes": {
-			Scope:          []string{"openid", "email", "profile", "groups"},
+			Scope:          []string{"openid", "email", "profile", "groups", "phone"},
 			Nonce:          "1234987",
 			ExpectedEmail:  testUser.Email,
 			ExpectedPhone:  testUser.Phone,
@@ -97,7 +104,7 @@ func TestMockUser_Claims(t *testing.T) {
 			Scope:          []string{"openid", "email", "profile"},
 			Nonce:          "3948y2tiugiu",
 			ExpectedEmail:  testUser.Email,
-			ExpectedPhone:  testUser.Phone,
+			ExpectedPhone:  "",
 			ExpectedGroups: nil,
 		},
 		"missing profile scope": {
@@ -111,7 +118,7 @@ func TestMockUser_Claims(t *testing.T) {
 			Scope:          []string{"openid", "profile", "groups"},
 			Nonce:          "",
 			ExpectedEmail:  "",
-			ExpectedPhone:  testUser.Phone,
+			ExpectedPhone:  "",
 			ExpectedGroups: testUser.Groups,
 		},
 	}
@@ -163,3 +170,58 @@ func TestMockUser_Claims(t *testing.T) {
 		})
 	}
 }
+
+func TestMockUser_StandardClaims(t *testing.T) {
+	testUser := mockoidc.DefaultUser()
+
+	payload, err := testUser.Userinfo([]string{"openid", "profile", "roles"})
+	assert.NoError(t, err)
+
+	data := make(map[string]interface{})
+	err = json.Unmarshal(payload, &data)
+	assert.NoError(t, err)
+
+	assert.Equal(t, testUser.Subject, data["sub"])
+	assert.Equal(t, testUser.Name, data["name"])
+	assert.Equal(t, testUser.GivenName, data["given_name"])
+	assert.Equal(t, testUser.FamilyName, data["family_name"])
+	assert.Equal(t, testUser.Locale, data["locale"])
+	assert.Equal(t, float64(testUser.UpdatedAt.Unix()), data["updated_at"])
+	assert.Equal(t, []interface{}{"admin", "user"}, data["roles"])
+	assert.Nil(t, data["groups"])
+	assert.Nil(t, data["phone_number_verified"])
+
+	payload, err = testUser.Userinfo([]string{"openid", "phone"})
+	assert.NoError(t, err)
+
+	data = make(map[string]interface{})
+	err = json.Unmarshal(payload, &data)
+	assert.NoError(t, err)
+
+	assert.Equal(t, testUser.Phone, data["phone_number"])
+	assert.Equal(t, true, data["phone_number_verified"])
+	assert.Nil(t, data["name"])
+	assert.Nil(t, data["roles"])
+}
+
+func TestMemoryUserStore(t *testing.T) {
+	alice := &mockoidc.MockUser{Subject: "alice", Email: "alice@example.com"}
+	store := mockoidc.NewMemoryUserStore(alice)
+	store.AddUser(&mockoidc.MockUser{Subject: "bob"})
+
+	user, err := store.GetUserByID("alice")
+	assert.NoError(t, err)
+	assert.Equal(t, alice, user)
+
+	user, err = store.GetUserByEmail("alice@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, alice, user)
+
+	_, err = store.GetUserByID("carol")
+	assert.True(t, errors.Is(err, mockoidc.ErrUserNotFound))
+
+	_, err = store.GetUserByEmail("")
+	assert.True(t, errors.Is(err, mockoidc.ErrUserNotFound))
+
+	assert.Len(t, store.ListUsers(), 2)
+}
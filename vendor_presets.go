@@ -0,0 +1,257 @@
+package mockoidc
+
+import (
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// DefaultAzureTenantID is the tenant of the `azure-ad` preset
+const DefaultAzureTenantID = "8a7d1b2c-3e4f-4a5b-9c6d-7e8f9a0b1c2d"
+
+// DefaultAuth0Namespace is the custom claim namespace of the `auth0` preset
+const DefaultAuth0Namespace = "https://example.com/"
+
+// Keycloak is a Config preset that mimics a Keycloak realm: the Issuer
+// is `/realms/{realm}`, the endpoints are served at Keycloak's
+// `/protocol/openid-connect` paths and tokens carry Keycloak's `typ`,
+// `azp`, `preferred_username`, `realm_access` & `resource_access`
+// claims. MockUser Roles of the form `client:role` are client roles in
+// `resource_access`, the others are realm roles.
+func Keycloak(realm string) *Config {
+	base := "/realms/" + realm
+	protocol := base + "/protocol/openid-connect"
+	return &Config{
+		Profile:    "keycloak",
+		IssuerPath: base,
+		EndpointPaths: map[string]string{
+			AuthorizationEndpoint: protocol + "/auth",
+			TokenEndpoint:         protocol + "/token",
+			UserinfoEndpoint:      protocol + "/userinfo",
+			JWKSEndpoint:          protocol + "/certs",
+		},
+		AccessTokenClaims: keycloakClaims("Bearer"),
+		IDTokenClaims:     keycloakClaims("ID"),
+	}
+}
+
+// keycloakClaims adds the Keycloak claims of a token type
+func keycloakClaims(typ string) ClaimsHook {
+	return func(session *Session, claims jwt.MapClaims) {
+		claims["typ"] = typ
+		claims["azp"] = claims["aud"]
+		if session.ClientID != "" {
+			claims["azp"] = session.ClientID
+		}
+		user, ok := session.User.(*MockUser)
+		if ok && user.PreferredUsername != "" {
+			claims["preferred_username"] = user.PreferredUsername
+		}
+		if typ != "Bearer" {
+			return
+		}
+
+		realmRoles := []string{}
+		resourceAccess := map[string]interface{}{}
+		if ok {
+			clientRoles := map[string][]string{}
+			for _, role := range user.Roles {
+				if parts := strings.SplitN(role, ":", 2); len(parts) == 2 {
+					clientRoles[parts[0]] = append(clientRoles[parts[0]], parts[1])
+				} else {
+					realmRoles = append(realmRoles, role)
+				}
+			}
+			for client, roles := range clientRoles {
+				resourceAccess[client] = map[string]interface{}{"roles": roles}
+			}
+		}
+		claims["realm_access"] = map[string]interface{}{"roles": realmRoles}
+		claims["resource_access"] = resourceAccess
+	}
+}
+
+// AzureAD is a Config preset that mimics the Microsoft identity platform
+// (Azure AD v2.0) endpoints of a tenant: the Issuer is `/{tenant}/v2.0`,
+// the endpoints are served at its `/{tenant}/oauth2/v2.0` paths with the
+// JWKS at `/{tenant}/discovery/v2.0/keys`, and tokens carry the `tid`,
+// `oid`, `upn` & `ver` claims. The IdentityAPIs are served, and the `oid`
+// is the User ID, like the `id` GraphMe returns.
+func AzureAD(tenantID string) *Config {
+	base := "/" + tenantID
+	return &Config{
+		Profile:      "azure-ad",
+		IssuerPath:   base + "/v2.0",
+		IdentityAPIs: true,
+		EndpointPaths: map[string]string{
+			AuthorizationEndpoint: base + "/oauth2/v2.0/authorize",
+			TokenEndpoint:         base + "/oauth2/v2.0/token",
+			JWKSEndpoint:          base + "/discovery/v2.0/keys",
+		},
+		AccessTokenClaims: azureADClaims(tenantID),
+		IDTokenClaims:     azureADClaims(tenantID),
+	}
+}
+
+// azureADClaims adds the Azure AD v2.0 claims of the tenant
+func azureADClaims(tenantID string) ClaimsHook {
+	return func(session *Session, claims jwt.MapClaims) {
+		claims["ver"] = "2.0"
+		claims["tid"] = tenantID
+		claims["oid"] = session.User.ID()
+		if user, ok := session.User.(*MockUser); ok {
+			upn := user.PreferredUsername
+			if upn == "" {
+				upn = user.Email
+			}
+			if upn != "" {
+				claims["upn"] = upn
+			}
+		}
+	}
+}
+
+// Okta is a Config preset that mimics an Okta custom authorization server:
+// the Issuer is `/oauth2/{authorizationServerID}` with the endpoints at its
+// `/v1` paths. Access tokens carry Okta's `ver`, `cid`, `uid` & `scp`
+// claims with the User's login (email or preferred username) as `sub`.
+// Like Okta, the `groups` claim is only added for the `groups` scope.
+func Okta(authorizationServerID string) *Config {
+	base := "/oauth2/" + authorizationServerID
+	return &Config{
+		Profile:    "okta",
+		IssuerPath: base,
+		EndpointPaths: map[string]string{
+			AuthorizationEndpoint: base + "/v1/authorize",
+			TokenEndpoint:         base + "/v1/token",
+			UserinfoEndpoint:      base + "/v1/userinfo",
+			JWKSEndpoint:          base + "/v1/keys",
+		},
+		AccessTokenClaims: oktaAccessTokenClaims,
+		IDTokenClaims:     oktaIDTokenClaims,
+	}
+}
+
+func oktaAccessTokenClaims(session *Session, claims jwt.MapClaims) {
+	oktaIDTokenClaims(session, claims)
+	claims["cid"] = claims["aud"]
+	if session.ClientID != "" {
+		claims["cid"] = session.ClientID
+	}
+	claims["uid"] = session.User.ID()
+	claims["scp"] = session.Scopes
+
+	user, ok := session.User.(*MockUser)
+	if !ok {
+		return
+	}
+	if login := oktaLogin(user); login != "" {
+		claims["sub"] = login
+	}
+	if contains("groups", session.Scopes) {
+		claims["groups"] = append([]string{}, user.Groups...)
+	}
+}
+
+func oktaIDTokenClaims(_ *Session, claims jwt.MapClaims) {
+	claims["ver"] = 1
+}
+
+// oktaLogin is the Okta login of a MockUser, like OktaMe reports it
+func oktaLogin(user *MockUser) string {
+	if user.Email != "" {
+		return user.Email
+	}
+	return user.PreferredUsername
+}
+
+// Auth0 is a Config preset that mimics an Auth0 tenant: the endpoints are
+// served at Auth0's `/authorize`, `/oauth/token`, `/userinfo` &
+// `/.well-known/jwks.json` paths and MockUser Roles & Groups are added as
+// custom claims namespaced with the URL prefix, e.g.
+// `https://example.com/roles`, like an Auth0 Action adds them. Access
+// tokens carry the client ID as `azp` and the granted `scope`.
+func Auth0(namespace string) *Config {
+	return &Config{
+		Profile: "auth0",
+		EndpointPaths: map[string]string{
+			AuthorizationEndpoint: "/authorize",
+			TokenEndpoint:         "/oauth/token",
+			UserinfoEndpoint:      "/userinfo",
+			JWKSEndpoint:          "/.well-known/jwks.json",
+		},
+		AccessTokenClaims: auth0Claims(namespace, true),
+		IDTokenClaims:     auth0Claims(namespace, false),
+	}
+}
+
+// auth0Claims adds the namespaced custom claims, and `azp` to access
+// tokens.
+func auth0Claims(namespace string, accessToken bool) ClaimsHook {
+	return func(session *Session, claims jwt.MapClaims) {
+		if accessToken {
+			claims["azp"] = claims["aud"]
+			if session.ClientID != "" {
+				claims["azp"] = session.ClientID
+			}
+		}
+		if user, ok := session.User.(*MockUser); ok {
+			claims[namespace+"roles"] = append([]string{}, user.Roles...)
+			claims[namespace+"groups"] = append([]string{}, user.Groups...)
+		}
+	}
+}
+
+// Google is a Config preset that mimics Google sign-in: the endpoints are
+// served at Google's `/o/oauth2/v2/auth`, `/token`, `/v1/userinfo` &
+// `/oauth2/v3/certs` paths and ID tokens carry the client ID as `azp`,
+// `email_verified` whenever the email is included and the `hd` hosted
+// domain: the email domain of Users that aren't `gmail.com` accounts.
+// MockUser Pictures are included with the `profile` scope.
+func Google() *Config {
+	return &Config{
+		Profile: "google",
+		EndpointPaths: map[string]string{
+			AuthorizationEndpoint: "/o/oauth2/v2/auth",
+			TokenEndpoint:         "/token",
+			UserinfoEndpoint:      "/v1/userinfo",
+			JWKSEndpoint:          "/oauth2/v3/certs",
+		},
+		IDTokenClaims: googleIDTokenClaims,
+	}
+}
+
+func googleIDTokenClaims(session *Session, claims jwt.MapClaims) {
+	claims["azp"] = claims["aud"]
+	if session.ClientID != "" {
+		claims["azp"] = session.ClientID
+	}
+
+	user, ok := session.User.(*MockUser)
+	if !ok {
+		return
+	}
+	if _, ok := claims["email"]; ok {
+		claims["email_verified"] = user.EmailVerified
+	}
+	if at := strings.LastIndex(user.Email, "@"); at >= 0 {
+		if domain := strings.ToLower(user.Email[at+1:]); domain != "gmail.com" {
+			claims["hd"] = domain
+		}
+	}
+}
+
+// GitHub is a Config preset that mimics a GitHub OAuth App: a PlainOAuth2
+// provider with the authorization & token endpoints at GitHub's
+// `/login/oauth/authorize` & `/login/oauth/access_token` paths and the
+// GitHubUser profile at `/user`.
+func GitHub() *Config {
+	return &Config{
+		Profile:     "github",
+		PlainOAuth2: true,
+		EndpointPaths: map[string]string{
+			AuthorizationEndpoint: "/login/oauth/authorize",
+			TokenEndpoint:         "/login/oauth/access_token",
+		},
+	}
+}
@@ -0,0 +1,243 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeycloak(t *testing.T) {
+	m := startPreset(t, mockoidc.Keycloak("test"))
+	defer m.Shutdown()
+
+	assert.Equal(t, m.Addr()+"/realms/test", m.Issuer())
+	assert.Equal(t, "keycloak", m.Profile)
+
+	discovery := fetchDiscovery(t, m.DiscoveryEndpoint())
+	protocol := m.Issuer() + "/protocol/openid-connect"
+	assert.Equal(t, m.Issuer(), discovery["issuer"])
+	assert.Equal(t, protocol+"/auth", discovery["authorization_endpoint"])
+	assert.Equal(t, protocol+"/token", discovery["token_endpoint"])
+	assert.Equal(t, protocol+"/userinfo", discovery["userinfo_endpoint"])
+	assert.Equal(t, protocol+"/certs", discovery["jwks_uri"])
+
+	user := &mockoidc.MockUser{
+		Subject:           "alice",
+		PreferredUsername: "alice",
+		Roles:             []string{"admin", "app:editor", "app:viewer"},
+	}
+	access, id := presetTokens(t, m, discovery, user, "openid profile")
+
+	assert.Equal(t, "Bearer", access["typ"])
+	assert.Equal(t, m.ClientID, access["azp"])
+	assert.Equal(t, "alice", access["preferred_username"])
+	assert.Equal(t, "openid profile", access["scope"])
+	assert.Equal(t, map[string]interface{}{
+		"roles": []interface{}{"admin"},
+	}, access["realm_access"])
+	assert.Equal(t, map[string]interface{}{
+		"app": map[string]interface{}{"roles": []interface{}{"editor", "viewer"}},
+	}, access["resource_access"])
+
+	assert.Equal(t, "ID", id["typ"])
+	assert.Equal(t, m.ClientID, id["azp"])
+	assert.Equal(t, "alice", id["preferred_username"])
+	assert.Nil(t, id["realm_access"])
+
+	// requests are recorded at the endpoint constants
+	assert.Len(t, m.RequestsTo(mockoidc.TokenEndpoint), 1)
+	assert.Len(t, m.RequestsTo(m.TokenEndpoint()), 1)
+}
+
+func TestAzureAD(t *testing.T) {
+	tenantID := "11111111-2222-3333-4444-555555555555"
+	m := startPreset(t, mockoidc.AzureAD(tenantID))
+	defer m.Shutdown()
+
+	assert.Equal(t, m.Addr()+"/"+tenantID+"/v2.0", m.Issuer())
+
+	discovery := fetchDiscovery(t, m.DiscoveryEndpoint())
+	base := m.Addr() + "/" + tenantID
+	assert.Equal(t, m.Issuer(), discovery["issuer"])
+	assert.Equal(t, base+"/oauth2/v2.0/authorize", discovery["authorization_endpoint"])
+	assert.Equal(t, base+"/oauth2/v2.0/token", discovery["token_endpoint"])
+	assert.Equal(t, base+"/discovery/v2.0/keys", discovery["jwks_uri"])
+
+	resp, err := httpClient.Get(base + "/discovery/v2.0/keys")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	access, id := presetTokens(t, m, discovery, mockoidc.DefaultUser(), "openid email")
+	for _, claims := range []jwt.MapClaims{access, id} {
+		assert.Equal(t, "2.0", claims["ver"])
+		assert.Equal(t, tenantID, claims["tid"])
+		assert.Equal(t, "1234567890", claims["oid"])
+		assert.Equal(t, "jane.doe", claims["upn"])
+		assert.Equal(t, m.Issuer(), claims["iss"])
+	}
+
+	// the Graph API is served, so it asks for a token rather than 404ing
+	resp, err = httpClient.Get(m.GraphMeEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestOkta(t *testing.T) {
+	m := startPreset(t, mockoidc.Okta("default"))
+	defer m.Shutdown()
+
+	assert.Equal(t, m.Addr()+"/oauth2/default", m.Issuer())
+
+	discovery := fetchDiscovery(t, m.DiscoveryEndpoint())
+	assert.Equal(t, m.Issuer()+"/v1/authorize", discovery["authorization_endpoint"])
+	assert.Equal(t, m.Issuer()+"/v1/token", discovery["token_endpoint"])
+	assert.Equal(t, m.Issuer()+"/v1/userinfo", discovery["userinfo_endpoint"])
+	assert.Equal(t, m.Issuer()+"/v1/keys", discovery["jwks_uri"])
+
+	access, id := presetTokens(t, m, discovery, mockoidc.DefaultUser(), "openid email")
+	assert.Equal(t, float64(1), access["ver"])
+	assert.Equal(t, m.ClientID, access["cid"])
+	assert.Equal(t, "1234567890", access["uid"])
+	assert.Equal(t, "jane.doe@example.com", access["sub"])
+	assert.Equal(t, []interface{}{"openid", "email"}, access["scp"])
+	assert.Nil(t, access["groups"])
+	assert.Equal(t, "1234567890", id["sub"])
+	assert.Nil(t, id["groups"])
+
+	access, id = presetTokens(t, m, discovery, mockoidc.DefaultUser(), "openid groups")
+	assert.Equal(t, []interface{}{"engineering", "design"}, access["groups"])
+	assert.Equal(t, []interface{}{"engineering", "design"}, id["groups"])
+}
+
+func TestAuth0(t *testing.T) {
+	m := startPreset(t, mockoidc.Auth0("https://app.example.com/"))
+	defer m.Shutdown()
+
+	discovery := fetchDiscovery(t, m.DiscoveryEndpoint())
+	assert.Equal(t, m.Addr()+"/authorize", discovery["authorization_endpoint"])
+	assert.Equal(t, m.Addr()+"/oauth/token", discovery["token_endpoint"])
+	assert.Equal(t, m.Addr()+"/userinfo", discovery["userinfo_endpoint"])
+	assert.Equal(t, m.Addr()+"/.well-known/jwks.json", discovery["jwks_uri"])
+
+	access, id := presetTokens(t, m, discovery, mockoidc.DefaultUser(), "openid email")
+	assert.Equal(t, m.ClientID, access["azp"])
+	assert.Equal(t, "openid email", access["scope"])
+	assert.Nil(t, id["azp"])
+	assert.Equal(t, m.ClientID, id["aud"])
+	for _, claims := range []jwt.MapClaims{access, id} {
+		assert.Equal(t, []interface{}{"admin", "user"}, claims["https://app.example.com/roles"])
+		assert.Equal(t, []interface{}{"engineering", "design"}, claims["https://app.example.com/groups"])
+	}
+}
+
+func TestGoogle(t *testing.T) {
+	m := startPreset(t, mockoidc.Google())
+	defer m.Shutdown()
+
+	discovery := fetchDiscovery(t, m.DiscoveryEndpoint())
+	assert.Equal(t, m.Addr()+"/o/oauth2/v2/auth", discovery["authorization_endpoint"])
+	assert.Equal(t, m.Addr()+"/token", discovery["token_endpoint"])
+	assert.Equal(t, m.Addr()+"/v1/userinfo", discovery["userinfo_endpoint"])
+	assert.Equal(t, m.Addr()+"/oauth2/v3/certs", discovery["jwks_uri"])
+
+	user := &mockoidc.MockUser{
+		Subject: "110169484474386276334",
+		Email:   "alice@corp.example.com",
+		Name:    "Alice",
+		Picture: "https://lh3.googleusercontent.com/a/alice",
+	}
+	_, id := presetTokens(t, m, discovery, user, "openid email profile")
+	assert.Equal(t, m.ClientID, id["aud"])
+	assert.Equal(t, m.ClientID, id["azp"])
+	assert.Equal(t, false, id["email_verified"])
+	assert.Equal(t, "corp.example.com", id["hd"])
+	assert.Equal(t, "https://lh3.googleusercontent.com/a/alice", id["picture"])
+
+	user.Email = "alice@gmail.com"
+	user.EmailVerified = true
+	_, id = presetTokens(t, m, discovery, user, "openid email")
+	assert.Equal(t, true, id["email_verified"])
+	assert.Nil(t, id["hd"])
+	assert.Nil(t, id["picture"])
+}
+
+func TestPresets_Vendors(t *testing.T) {
+	assert.Equal(t, "/realms/master", mockoidc.Presets["keycloak"]().IssuerPath)
+	assert.Equal(t, "/"+mockoidc.DefaultAzureTenantID+"/v2.0", mockoidc.Presets["azure-ad"]().IssuerPath)
+	assert.Equal(t, "/oauth2/default", mockoidc.Presets["okta"]().IssuerPath)
+	assert.Equal(t, "/oauth/token", mockoidc.Presets["auth0"]().EndpointPaths[mockoidc.TokenEndpoint])
+	assert.Equal(t, "/oauth2/v3/certs", mockoidc.Presets["google"]().EndpointPaths[mockoidc.JWKSEndpoint])
+}
+
+func startPreset(t *testing.T, cfg *mockoidc.Config) *mockoidc.MockOIDC {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ApplyConfig(cfg)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	return m
+}
+
+func fetchDiscovery(t *testing.T, endpoint string) map[string]interface{} {
+	resp, err := httpClient.Get(endpoint)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	discovery := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	return discovery
+}
+
+// presetTokens logs the user in at the advertised endpoints and returns
+// the claims of the access & ID tokens.
+func presetTokens(t *testing.T, m *mockoidc.MockOIDC, discovery map[string]interface{},
+	user mockoidc.User, scope string) (jwt.MapClaims, jwt.MapClaims) {
+	m.QueueUser(user)
+	m.QueueCode("preset-code")
+
+	query := url.Values{}
+	query.Set("scope", scope)
+	query.Set("response_type", "code")
+	query.Set("redirect_uri", "http://127.0.0.1/callback")
+	query.Set("state", "state")
+	query.Set("client_id", m.ClientID)
+	resp, err := httpClient.Get(discovery["authorization_endpoint"].(string) + "?" + query.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	form := url.Values{}
+	form.Set("client_id", m.ClientID)
+	form.Set("client_secret", m.ClientSecret)
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", "preset-code")
+	resp, err = httpClient.PostForm(discovery["token_endpoint"].(string), form)
+	assert.NoError(t, err)
+	tokens := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	claims := make([]jwt.MapClaims, 0, 2)
+	for _, name := range []string{"access_token", "id_token"} {
+		raw, _ := tokens[name].(string)
+		token, err := m.Keypair.VerifyJWT(raw)
+		if !assert.NoError(t, err, name) {
+			claims = append(claims, jwt.MapClaims{})
+			continue
+		}
+		claims = append(claims, token.Claims.(jwt.MapClaims))
+	}
+	return claims[0], claims[1]
+}